@@ -0,0 +1,204 @@
+package main
+
+/* This file defines the ancestors (pedigree) traversal
+
+   The ancestors are found by following the father and mother relations upward. Every ancestor is
+   listed together with its Ahnentafel (Sosa-Stradonitz) number: the person itself has the number
+   1, the father of the person with the number n has the number 2n and the mother 2n+1. The
+   generation of the ancestor with the number n is floor(log2(n)).
+
+   The same ancestor may appear on several lines of the pedigree (the pedigree collapse, e.g. when
+   the parents are cousins). Such an ancestor is listed once for every line (with a different
+   number each time) and all its entries are marked. */
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// Default traversal depth (in generations) of the ancestors query
+const defaultAncestorsDepth = 5
+
+// Maximum number of the ancestor entries (the pedigree collapse multiplies the entries)
+const maxAncestorEntries = 10000
+
+/* The structure used to extract the ancestors query parameters from a request query */
+type ancestorsQuery struct {
+	Depth int `form:"depth" binding:"isdefault|min=1,max=30"`
+}
+
+/* Single entry of the ancestors list */
+type ancestorPayload struct {
+	Person     fullPersonPayload `json:"person"`
+	Generation int               `json:"generation"`
+	Ahnentafel int64             `json:"ahnentafel"`
+	// Set if the ancestor appears on several lines of the pedigree
+	PedigreeCollapse bool `json:"pedigree_collapse"`
+	// Ahnentafel number of the first (lowest numbered) entry of the same ancestor (set for the
+	// other entries only)
+	SameAs int64 `json:"same_as,omitempty"`
+}
+
+/* Response of the ancestors query */
+type ancestorsPayload struct {
+	Person fullPersonPayload `json:"person"`
+	Depth  int               `json:"depth"`
+	// Entries ordered by the Ahnentafel number
+	Ancestors []ancestorPayload `json:"ancestors"`
+	// Set if the entry limit was reached (the last generation is incomplete)
+	Truncated bool `json:"truncated"`
+}
+
+/* Find the ancestors of a person
+
+   The function must be called from the function passed to the store view (or update) method.
+
+   Params:
+   * tx - the store (as passed to the function run by the store view or update method)
+   * pid - the person identifier
+   * depth - the number of generations to be traversed
+
+   Return:
+   * the ancestors (valid only if the person was found and no error occurred)
+   * success flag (true if the person was found and false otherwise)
+   * error (if occurred and nil otherwise) */
+func queryAncestors(tx Store, pid string, depth int) (ancestorsPayload, bool, error) {
+	cache := newFamilyCache(tx)
+
+	root, found, err := cache.getPerson(pid)
+	if !found || err != nil {
+		return ancestorsPayload{}, found, err
+	}
+
+	result := ancestorsPayload{
+		Person: root.toPayload(), Depth: depth, Ancestors: []ancestorPayload{}}
+
+	type occurrence struct {
+		pid    string
+		number int64
+	}
+
+	// The entries of every generation are created in the order of their numbers:
+	level := []occurrence{{pid, 1}}
+
+	for generation := 1; generation <= depth && len(level) > 0 && !result.Truncated; generation++ {
+		next := []occurrence{}
+
+		for _, child := range level {
+			parents, err := cache.getParents(child.pid)
+			if err != nil {
+				return ancestorsPayload{}, true, err
+			}
+
+			for idx, parentPid := range parents {
+				if parentPid == "" {
+					continue
+				}
+
+				if len(result.Ancestors) >= maxAncestorEntries {
+					result.Truncated = true
+					break
+				}
+
+				parent, found, err := cache.getPerson(parentPid)
+				if err != nil {
+					return ancestorsPayload{}, true, err
+				} else if !found {
+					log.Warnf("The parent (%s) of person (%s) doesn't exist", parentPid, child.pid)
+					continue
+				}
+
+				number := child.number*2 + int64(idx)
+
+				result.Ancestors = append(result.Ancestors, ancestorPayload{
+					Person: parent.toPayload(), Generation: generation, Ahnentafel: number})
+				next = append(next, occurrence{parentPid, number})
+			}
+		}
+
+		level = next
+	}
+
+	// Mark the pedigree collapse (the root is included in case of a relation cycle):
+	first := map[string]int64{pid: 1}
+	count := map[string]int{pid: 1}
+
+	for _, entry := range result.Ancestors {
+		if _, found := first[entry.Person.Id]; !found {
+			first[entry.Person.Id] = entry.Ahnentafel
+		}
+
+		count[entry.Person.Id]++
+	}
+
+	for idx := range result.Ancestors {
+		entry := &result.Ancestors[idx]
+
+		if count[entry.Person.Id] > 1 {
+			entry.PedigreeCollapse = true
+
+			if first[entry.Person.Id] != entry.Ahnentafel {
+				entry.SameAs = first[entry.Person.Id]
+			}
+		}
+	}
+
+	return result, true, nil
+}
+
+/* Handle a retrieve person ancestors request
+
+   The function will extract the person id from the request URI (specifyPersonUri) and the
+   traversal depth from the request query (ancestorsQuery) */
+func retrievePersonAncestors(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	var params specifyPersonUri
+
+	if err := c.ShouldBindUri(&params); err != nil {
+		log.Infof("Uri parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": uriErrorMsg})
+		return
+	}
+
+	var query ancestorsQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Infof("Query parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": queryErrorMsg})
+		return
+	}
+
+	if query.Depth == 0 {
+		query.Depth = defaultAncestorsDepth
+	}
+
+	var result ancestorsPayload
+	var found bool
+
+	// The traversal must see a consistent state of the relations:
+	err := getStore(c).view(func(tx Store) error {
+		var err error
+
+		result, found, err = queryAncestors(tx, params.Pid, query.Depth)
+
+		return err
+	})
+
+	if !found && err == nil {
+		log.Infof("The person with given id (%s) doesn't exist", params.Pid)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown person id"})
+		return
+	} else if err != nil {
+		log.Errorf("An error occurred during the ancestors retrieval attempt (%s)", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	}
+
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.JSON(http.StatusOK, result)
+
+	log.Infof("Found %d ancestor entries of the requested person (%s)",
+		len(result.Ancestors), params.Pid)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testAncestorJson struct {
+	Person           testPersonJson `json:"person"`
+	Generation       int            `json:"generation"`
+	Ahnentafel       int64          `json:"ahnentafel"`
+	PedigreeCollapse bool           `json:"pedigree_collapse"`
+	SameAs           int64          `json:"same_as"`
+}
+
+type testAncestorsJson struct {
+	Person    testPersonJson     `json:"person"`
+	Depth     int                `json:"depth"`
+	Ancestors []testAncestorJson `json:"ancestors"`
+	Truncated bool               `json:"truncated"`
+}
+
+func testAncestorsRes(t *testing.T, res *httptest.ResponseRecorder) testAncestorsJson {
+	payload := testAncestorsJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+/* Create a store with a pedigree collapse (the parents of P1 are half-siblings) */
+func testPedigreeStore() *memoryStore {
+	return newMemoryStore(
+		map[string]personRecord{
+			"P1":  {"P1", "Jan", "Kowalski", gMale, 1},
+			"F1":  {"F1", "Adam", "Kowalski", gMale, 1},
+			"M1":  {"M1", "Ewa", "Kowalska", gFemale, 1},
+			"GF":  {"GF", "Piotr", "Kowalski", gMale, 1},
+			"GM":  {"GM", "Maria", "Nowak", gFemale, 1},
+			"GM2": {"GM2", "Zofia", "Wiśniewska", gFemale, 1},
+			"GGF": {"GGF", "Paweł", "Kowalski", gMale, 1},
+		},
+		map[int64]relationRecord{
+			1: {1, "F1", "P1", relFather, 1},
+			2: {2, "M1", "P1", relMother, 1},
+			3: {3, "GF", "F1", relFather, 1},
+			4: {4, "GM", "F1", relMother, 1},
+			5: {5, "GF", "M1", relFather, 1},
+			6: {6, "GM2", "M1", relMother, 1},
+			7: {7, "GGF", "GF", relFather, 1},
+			8: {8, "F1", "M1", relHusband, 1},
+		})
+}
+
+/* Test the ancestors traversal
+
+   1. Default depth (the pedigree collapse is marked)
+   2. Limited depth
+   3. Person without ancestors
+   4. Invalid depth
+   5. Unknown person */
+func TestRetrievePersonAncestors(t *testing.T) {
+	router := setupRouter(testPedigreeStore())
+
+	// Case 1: Default depth
+
+	res := testMakeRequest(router, "GET", "/people/P1/ancestors", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	payload := testAncestorsRes(t, res)
+
+	assert.Equal(t, testPersonJson{"P1", "Jan", "Kowalski", gMale}, payload.Person)
+	assert.Equal(t, defaultAncestorsDepth, payload.Depth)
+	assert.False(t, payload.Truncated)
+
+	type entry struct {
+		pid        string
+		generation int
+		number     int64
+		collapse   bool
+		sameAs     int64
+	}
+
+	entries := []entry{}
+
+	for _, a := range payload.Ancestors {
+		entries = append(entries,
+			entry{a.Person.Id, a.Generation, a.Ahnentafel, a.PedigreeCollapse, a.SameAs})
+	}
+
+	assert.Equal(t, []entry{
+		{"F1", 1, 2, false, 0},
+		{"M1", 1, 3, false, 0},
+		{"GF", 2, 4, true, 0},
+		{"GM", 2, 5, false, 0},
+		{"GF", 2, 6, true, 4},
+		{"GM2", 2, 7, false, 0},
+		{"GGF", 3, 8, true, 0},
+		{"GGF", 3, 12, true, 8},
+	}, entries)
+
+	// Case 2: Limited depth
+
+	res = testMakeRequest(router, "GET", "/people/P1/ancestors?depth=1", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	payload = testAncestorsRes(t, res)
+
+	assert.Equal(t, 1, payload.Depth)
+	assert.Equal(t, []testAncestorJson{
+		{testPersonJson{"F1", "Adam", "Kowalski", gMale}, 1, 2, false, 0},
+		{testPersonJson{"M1", "Ewa", "Kowalska", gFemale}, 1, 3, false, 0},
+	}, payload.Ancestors)
+
+	// Case 3: No ancestors
+
+	res = testMakeRequest(router, "GET", "/people/GGF/ancestors", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, testAncestorsRes(t, res).Ancestors)
+
+	// Case 4: Invalid depth
+
+	res = testMakeRequest(router, "GET", "/people/P1/ancestors?depth=31", nil)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, queryErrorMsg, testErrorRes(t, res).Message)
+
+	// Case 5: Unknown person
+
+	res = testMakeRequest(router, "GET", "/people/P9/ancestors", nil)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, "Unknown person id", testErrorRes(t, res).Message)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// Batch operation codes
+const (
+	bopCreatePerson    = "create_person"
+	bopReplacePerson   = "replace_person"
+	bopDeletePerson    = "delete_person"
+	bopCreateRelation  = "create_relation"
+	bopReplaceRelation = "replace_relation"
+	bopDeleteRelation  = "delete_relation"
+)
+
+// Batch operation statuses
+const (
+	bstApplied = "applied"
+	bstFailed  = "failed"
+	// The operation was applied, but the changes were reverted due to a failure of another one
+	bstRolledBack = "rolled_back"
+	// The operation wasn't attempted due to a failure of a preceding one
+	bstSkipped = "skipped"
+)
+
+/* Single operation of the batch payload
+
+   Depending on the operation code, some of the optional fields are required:
+   * create_person: person (and optionally pid; the server generates it if missing)
+   * replace_person: pid, person
+   * delete_person: pid
+   * create_relation: relation
+   * replace_relation: rid, relation
+   * delete_relation: rid */
+type batchOperationPayload struct {
+	Op       string              `json:"op" binding:"required,oneof=create_person replace_person delete_person create_relation replace_relation delete_relation"`
+	Pid      string              `json:"pid" binding:"omitempty,alphanum|uuid"`
+	Rid      int64               `json:"rid"`
+	Person   *noidPersonPayload  `json:"person"`
+	Relation *iitRelationPayload `json:"relation"`
+}
+
+/* Check if all the fields required by the operation code are present */
+func (p *batchOperationPayload) validate() error {
+	// The server generates the id of a person created without one:
+	needPid := p.Op == bopReplacePerson || p.Op == bopDeletePerson
+	needPerson := p.Op == bopCreatePerson || p.Op == bopReplacePerson
+	needRid := p.Op == bopReplaceRelation || p.Op == bopDeleteRelation
+	needRelation := p.Op == bopCreateRelation || p.Op == bopReplaceRelation
+
+	if (needPid && p.Pid == "") || (needPerson && p.Person == nil) ||
+		(needRid && p.Rid == 0) || (needRelation && p.Relation == nil) {
+		return AppError{
+			errInvalidArgument, fmt.Sprintf("Incomplete '%s' batch operation", p.Op)}
+	}
+
+	return nil
+}
+
+/* Batch payload accepted by the applyBatch handler */
+type batchPayload struct {
+	Operations []batchOperationPayload `json:"operations" binding:"required,min=1,max=1000,dive"`
+}
+
+/* Result of a single batch operation returned by the applyBatch handler */
+type batchResultPayload struct {
+	Op         string `json:"op"`
+	Status     string `json:"status"`
+	Message    string `json:"message,omitempty"`
+	Pid        string `json:"pid,omitempty"`
+	RelationId int64  `json:"relation_id,omitempty"`
+	Location   string `json:"location,omitempty"`
+	// Trash item containing the records deleted by the operation
+	TrashId int64 `json:"trash_id,omitempty"`
+}
+
+/* Failure of a batch operation caused by the client (e.g. invalid relation)
+
+   The failure makes the whole batch fail with the given HTTP status */
+type batchOperationError struct {
+	status int
+	msg    string
+}
+
+func (e batchOperationError) Error() string {
+	return e.msg
+}
+
+/* Apply a single batch operation
+
+   The function follows the rules of the corresponding single operation handlers.
+
+   Params:
+   * c - gin context
+   * tx - the store (as passed to the function run by the store update method)
+   * op - the operation to be applied
+
+   Return:
+   * operation result (valid only if no error occurred)
+   * error (batchOperationError for the failures caused by the client and nil on success) */
+func applyBatchOperation(c *gin.Context, tx Store, op batchOperationPayload) (batchResultPayload, error) {
+	result := batchResultPayload{Op: op.Op, Status: bstApplied}
+
+	switch op.Op {
+	case bopCreatePerson:
+		pid := op.Pid
+
+		if pid == "" {
+			var err error
+
+			if pid, err = getPersonIdGenerator(c).nextPersonId(tx); err != nil {
+				return result, err
+			}
+		}
+
+		if err := tx.insertPerson(op.Person.toRecord(pid)); isAppError(err, errDuplicateFound) {
+			return result, batchOperationError{
+				http.StatusBadRequest, fmt.Sprintf("Person (%s) already exists", pid)}
+		} else if err != nil {
+			return result, err
+		}
+
+		result.Pid = pid
+		result.Location = makeRetrievePersonUrl(c, pid)
+
+	case bopReplacePerson:
+		if err := tx.updatePerson(op.Person.toRecord(op.Pid)); isAppError(err, errRecordNotFound) {
+			return result, batchOperationError{http.StatusNotFound, "Unknown person id"}
+		} else if err != nil {
+			return result, err
+		}
+
+		result.Pid = op.Pid
+
+	case bopDeletePerson:
+		person, found, err := tx.getPerson(op.Pid)
+
+		if !found {
+			return result, batchOperationError{http.StatusNotFound, "Unknown person id"}
+		} else if err != nil {
+			return result, err
+		}
+
+		item, err := trashPerson(tx, person)
+		if err != nil {
+			return result, err
+		}
+
+		result.Pid = op.Pid
+		result.TrashId = item.Id
+
+	case bopCreateRelation:
+		relation := op.Relation.toRecord(0)
+
+		if _, found, err := queryRelationByData(
+			tx, relation.Pid1, relation.Type, relation.Pid2); found {
+			return result, batchOperationError{
+				http.StatusBadRequest,
+				fmt.Sprintf("Relation (%s, %s, %s) already exists",
+					relation.Pid1, relation.Type, relation.Pid2)}
+		} else if err != nil {
+			return result, err
+		}
+
+		if valid, err := validateRelation(tx, relation); err != nil {
+			return result, err
+		} else if !valid {
+			return result, batchOperationError{
+				http.StatusBadRequest,
+				fmt.Sprintf("Relation (%s, %s, %s) is invalid",
+					relation.Pid1, relation.Type, relation.Pid2)}
+		}
+
+		var err error
+
+		if relation.Id, err = getRelationIdGenerator(c).nextRelationId(tx); err != nil {
+			return result, err
+		}
+
+		if err := tx.insertRelation(relation); err != nil {
+			return result, err
+		}
+
+		result.RelationId = relation.Id
+		result.Location = makeRetrieveRelationUrl(c, relation.Id)
+
+	case bopReplaceRelation:
+		relation := op.Relation.toRecord(op.Rid)
+
+		if _, found, err := tx.queryRelationById(op.Rid); !found {
+			return result, batchOperationError{http.StatusNotFound, "Unknown relation id"}
+		} else if err != nil {
+			return result, err
+		}
+
+		// The replacement is checked against the state left by the preceding operations:
+		if err := checkRelationReplacement(tx, relation); isAppError(err, errConflict) {
+			return result, batchOperationError{http.StatusConflict, err.(AppError).msg}
+		} else if err != nil {
+			return result, err
+		}
+
+		if err := tx.updateRelation(relation); err != nil {
+			return result, err
+		}
+
+		result.RelationId = op.Rid
+
+	case bopDeleteRelation:
+		relation, found, err := tx.queryRelationById(op.Rid)
+
+		if !found {
+			return result, batchOperationError{http.StatusNotFound, "Unknown relation id"}
+		} else if err != nil {
+			return result, err
+		}
+
+		item, err := trashRelation(tx, relation)
+		if err != nil {
+			return result, err
+		}
+
+		result.RelationId = op.Rid
+		result.TrashId = item.Id
+	}
+
+	return result, nil
+}
+
+/* Handle a batch request
+
+   The function will retrieve the list of operations from the request payload (batchPayload). The
+   operations are applied in order, each one seeing the effects of the preceding ones. Either all
+   the operations are applied or none of them. */
+func applyBatch(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	var payload batchPayload
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Infof("Batch data unmarshalling error: %s", err)
+
+		c.JSON(http.StatusBadRequest, gin.H{"message": payloadErrorMsg})
+		return
+	}
+
+	for _, op := range payload.Operations {
+		if err := op.validate(); err != nil {
+			log.Infof("Batch data validation error: %s", err)
+
+			c.JSON(http.StatusBadRequest, gin.H{"message": payloadErrorMsg})
+			return
+		}
+	}
+
+	results := make([]batchResultPayload, 0, len(payload.Operations))
+
+	err := getStore(c).update(func(tx Store) error {
+		for _, op := range payload.Operations {
+			result, err := applyBatchOperation(c, tx, op)
+
+			if err != nil {
+				result.Status = bstFailed
+
+				if opErr, ok := err.(batchOperationError); ok {
+					result.Message = opErr.msg
+				}
+
+				results = append(results, result)
+
+				return err
+			}
+
+			results = append(results, result)
+		}
+
+		return nil
+	})
+
+	failedIdx := len(results) - 1
+
+	if err != nil {
+		// Mark the applied operations as reverted and the remaining ones as not attempted:
+		for i := range results[:failedIdx] {
+			results[i] = batchResultPayload{Op: results[i].Op, Status: bstRolledBack}
+		}
+
+		for _, op := range payload.Operations[len(results):] {
+			results = append(results, batchResultPayload{Op: op.Op, Status: bstSkipped})
+		}
+	}
+
+	if opErr, ok := err.(batchOperationError); ok {
+		log.Infof("Batch operation #%d failed (%s)", failedIdx, opErr.msg)
+
+		c.JSON(opErr.status, gin.H{
+			"message":      "Batch rejected",
+			"failed_index": failedIdx,
+			"results":      results,
+		})
+		return
+	} else if err != nil {
+		log.Errorf("An error occurred during the batch application attempt (%s)", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Batch applied", "results": results})
+
+	log.Infof("Applied a batch of %d operation(s)", len(results))
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+type testBatchOperationJson struct {
+	Op       string               `json:"op"`
+	Pid      string               `json:"pid,omitempty"`
+	Rid      int64                `json:"rid,omitempty"`
+	Person   *testPersonJson      `json:"person,omitempty"`
+	Relation *testIitRelationJson `json:"relation,omitempty"`
+}
+
+type testBatchJson struct {
+	Operations []testBatchOperationJson `json:"operations"`
+}
+
+type testBatchResultJson struct {
+	Op         string `json:"op"`
+	Status     string `json:"status"`
+	Message    string `json:"message"`
+	Pid        string `json:"pid"`
+	RelationId int64  `json:"relation_id"`
+	Location   string `json:"location"`
+}
+
+type testBatchResJson struct {
+	Message     string                `json:"message"`
+	FailedIndex int                   `json:"failed_index"`
+	Results     []testBatchResultJson `json:"results"`
+}
+
+func testBatchRes(t *testing.T, res *httptest.ResponseRecorder) testBatchResJson {
+	payload := testBatchResJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+/* Test a successful batch request
+
+   1. Create a family (people and relations referring to the people created in the same batch)
+   2. Replace, delete and create records in a single batch */
+func TestBatchRequestSuccess(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	// Case 1: Create a family
+
+	res := testMakeRequest(router, "POST", "/batch", testJsonBody(t, testBatchJson{
+		[]testBatchOperationJson{
+			{Op: bopCreatePerson, Pid: "P1", Person: &testPersonJson{
+				Given: "Jan", Surname: "Kowalski", Gender: gMale}},
+			{Op: bopCreatePerson, Pid: "P2", Person: &testPersonJson{
+				Given: "Anna", Surname: "Nowak", Gender: gFemale}},
+			{Op: bopCreatePerson, Pid: "P3", Person: &testPersonJson{
+				Given: "Adam", Surname: "Kowalski", Gender: gMale}},
+			{Op: bopCreateRelation, Relation: &testIitRelationJson{"P1", "P3", relFather}},
+			{Op: bopCreateRelation, Relation: &testIitRelationJson{"P2", "P3", relMother}},
+			{Op: bopCreateRelation, Relation: &testIitRelationJson{"P1", "P2", relHusband}}}}))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	payload := testBatchRes(t, res)
+
+	require.Len(t, payload.Results, 6)
+
+	for _, result := range payload.Results {
+		assert.Equal(t, bstApplied, result.Status)
+	}
+
+	assert.Equal(t, "P1", payload.Results[0].Pid)
+	assert.Equal(t, "http://example.com/people/P1", payload.Results[0].Location)
+	assert.Len(t, store.people, 3)
+	assert.Len(t, store.relations, 3)
+
+	husbandId := payload.Results[5].RelationId
+
+	assert.Equal(t, relationRecord{husbandId, "P1", "P2", relHusband, 1}, store.relations[husbandId])
+
+	// Case 2: Replace, delete and create
+
+	res = testMakeRequest(router, "POST", "/batch", testJsonBody(t, testBatchJson{
+		[]testBatchOperationJson{
+			{Op: bopReplacePerson, Pid: "P2", Person: &testPersonJson{
+				Given: "Anna", Surname: "Kowalska", Gender: gFemale}},
+			{Op: bopDeleteRelation, Rid: husbandId},
+			{Op: bopDeletePerson, Pid: "P1"},
+			{Op: bopCreatePerson, Pid: "P4", Person: &testPersonJson{
+				Given: "Piotr", Surname: "Kowalski", Gender: gMale}},
+			{Op: bopCreateRelation, Relation: &testIitRelationJson{"P4", "P3", relFather}}}}))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	assert.Equal(t, "Kowalska", store.people["P2"].Surname)
+	assert.NotContains(t, store.people, "P1")
+	assert.Len(t, store.relations, 2)
+
+	relations, err := store.queryRelationsByData("", relFather, "P3")
+
+	assert.Nil(t, err)
+	require.Len(t, relations, 1)
+	assert.Equal(t, "P4", relations[0].Pid1)
+}
+
+/* Test if a failed batch operation reverts the whole batch in every store variant
+
+   1. Fail a batch with an invalid relation (a second father of the same person)
+   2. Check if the data of the store (and of the reopened journal) wasn't modified */
+func TestBatchRequestRollback(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "gentree.journal")
+	journal := testOpenJournalStore(t, journalPath)
+
+	stores := map[string]Store{
+		"memory":  newLockingStore(newMemoryStore(nil, nil)),
+		"journal": newLockingStore(journal),
+		"sqlite":  testOpenSqliteStore(t, filepath.Join(t.TempDir(), "gentree.db")),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			router := setupRouter(store)
+
+			require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+			require.Nil(t, store.insertPerson(personRecord{"P3", "Adam", "Kowalski", gMale, 0}))
+			require.Nil(t, store.insertRelation(relationRecord{1, "P1", "P3", relFather, 0}))
+
+			// Case 1: Failed batch
+
+			res := testMakeRequest(router, "POST", "/batch", testJsonBody(t, testBatchJson{
+				[]testBatchOperationJson{
+					{Op: bopReplacePerson, Pid: "P1", Person: &testPersonJson{
+						Given: "Janusz", Surname: "Kowalski", Gender: gMale}},
+					{Op: bopCreatePerson, Pid: "P2", Person: &testPersonJson{
+						Given: "Piotr", Surname: "Nowak", Gender: gMale}},
+					{Op: bopDeleteRelation, Rid: 1},
+					{Op: bopCreateRelation, Relation: &testIitRelationJson{"P2", "P3", relFather}},
+					{Op: bopCreateRelation, Relation: &testIitRelationJson{"P1", "P3", relFather}},
+					{Op: bopDeletePerson, Pid: "P3"}}}))
+
+			require.Equal(t, http.StatusBadRequest, res.Code)
+
+			payload := testBatchRes(t, res)
+
+			assert.Equal(t, 4, payload.FailedIndex)
+			require.Len(t, payload.Results, 6)
+
+			for i, status := range []string{
+				bstRolledBack, bstRolledBack, bstRolledBack, bstRolledBack, bstFailed, bstSkipped} {
+				assert.Equal(t, status, payload.Results[i].Status)
+			}
+
+			assert.Equal(t, "Relation (P1, father, P3) is invalid", payload.Results[4].Message)
+
+			// Case 2: Unmodified data
+
+			person, _, err := store.getPerson("P1")
+
+			assert.Nil(t, err)
+			assert.Equal(t, "Jan", person.Given)
+
+			_, found, err := store.getPerson("P2")
+
+			assert.Nil(t, err)
+			assert.False(t, found)
+
+			relations, err := store.queryRelationsByData("", "", "")
+
+			assert.Nil(t, err)
+			assert.Equal(t, []relationRecord{{1, "P1", "P3", relFather, 1}}, relations)
+
+			if name == "journal" {
+				require.Nil(t, journal.close())
+
+				journal = testOpenJournalStore(t, journalPath)
+
+				assert.Equal(t, int64(3), journal.seq)
+				assert.Len(t, journal.people, 2)
+				assert.Equal(t, "Jan", journal.people["P1"].Given)
+				assert.Len(t, journal.relations, 1)
+			}
+		})
+	}
+}
+
+/* Test the relation replacement checks of a batch request
+
+   1. Replace a relation with a second father of the same person
+   2. Replace a relation with a relation referring to an unknown person
+   3. Replace a father relation with another father of the same person
+   4. Replace a relation with a duplicate of another relation */
+func TestBatchRequestReplaceRelation(t *testing.T) {
+	store := newMemoryStore(
+		map[string]personRecord{
+			"A": {"A", "Jan", "Kowalski", gMale, 1},
+			"B": {"B", "Piotr", "Nowak", gMale, 1},
+			"M": {"M", "Anna", "Kowalska", gFemale, 1},
+			"D": {"D", "Adam", "Kowalski", gMale, 1},
+		},
+		map[int64]relationRecord{
+			1: {1, "A", "D", relFather, 1},
+			2: {2, "M", "D", relMother, 1},
+		})
+	router := setupRouter(store)
+
+	testReplace := func(rid int64, relation testIitRelationJson) *httptest.ResponseRecorder {
+		return testMakeRequest(router, "POST", "/batch", testJsonBody(t, testBatchJson{
+			[]testBatchOperationJson{
+				{Op: bopReplacePerson, Pid: "D", Person: &testPersonJson{
+					Given: "Adam", Surname: "Nowak", Gender: gMale}},
+				{Op: bopReplaceRelation, Rid: rid, Relation: &relation}}}))
+	}
+
+	// Case 1 and 2: Second father and unknown person
+
+	for _, tc := range []struct {
+		rid      int64
+		relation testIitRelationJson
+		message  string
+	}{
+		{2, testIitRelationJson{"B", "D", relFather}, "Relation (B, father, D) is invalid"},
+		{1, testIitRelationJson{"ZZZ", "D", relFather}, "Relation (ZZZ, father, D) is invalid"},
+	} {
+		res := testReplace(tc.rid, tc.relation)
+
+		require.Equal(t, http.StatusConflict, res.Code, tc)
+
+		payload := testBatchRes(t, res)
+
+		assert.Equal(t, 1, payload.FailedIndex, tc)
+		require.Len(t, payload.Results, 2, tc)
+		assert.Equal(t, bstRolledBack, payload.Results[0].Status, tc)
+		assert.Equal(t, bstFailed, payload.Results[1].Status, tc)
+		assert.Equal(t, tc.message, payload.Results[1].Message, tc)
+
+		assert.Equal(t, "Kowalski", store.people["D"].Surname, tc)
+		assert.Equal(t, relationRecord{1, "A", "D", relFather, 1}, store.relations[1], tc)
+		assert.Equal(t, relationRecord{2, "M", "D", relMother, 1}, store.relations[2], tc)
+	}
+
+	// Case 3: Another father (the replaced relation doesn't count)
+
+	res := testReplace(1, testIitRelationJson{"B", "D", relFather})
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, relationRecord{1, "B", "D", relFather, 2}, store.relations[1])
+
+	// Case 4: Duplicate
+
+	res = testReplace(2, testIitRelationJson{"B", "D", relFather})
+
+	require.Equal(t, http.StatusConflict, res.Code)
+	assert.Equal(t, "Relation (B, father, D) already exists", testBatchRes(t, res).Results[1].Message)
+	assert.Equal(t, relationRecord{2, "M", "D", relMother, 1}, store.relations[2])
+}
+
+/* Test the batch request payload validation
+
+   1. Empty operation list
+   2. Unknown operation code
+   3. Operation without the required fields
+   4. Too many operations
+   5. Invalid person data */
+func TestBatchRequestPayloadError(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	tooMany := make([]testBatchOperationJson, 1001)
+
+	for i := range tooMany {
+		tooMany[i] = testBatchOperationJson{Op: bopDeletePerson, Pid: "P1"}
+	}
+
+	for _, batch := range []testBatchJson{
+		// Case 1: Empty operation list
+		{[]testBatchOperationJson{}},
+		// Case 2: Unknown operation code
+		{[]testBatchOperationJson{{Op: "create_dog", Pid: "D1"}}},
+		// Case 3: Operation without the required fields
+		{[]testBatchOperationJson{{Op: bopCreatePerson, Pid: "P1"}}},
+		{[]testBatchOperationJson{{Op: bopReplaceRelation, Rid: 1}}},
+		{[]testBatchOperationJson{{Op: bopDeleteRelation}}},
+		// Case 4: Too many operations
+		{tooMany},
+		// Case 5: Invalid person data
+		{[]testBatchOperationJson{{Op: bopCreatePerson, Pid: "P1", Person: &testPersonJson{
+			Given: "Jan", Surname: "Kowalski", Gender: "dog"}}}},
+	} {
+		res := testMakeRequest(router, "POST", "/batch", testJsonBody(t, batch))
+
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, payloadErrorMsg, testErrorRes(t, res).Message)
+	}
+
+	assert.Empty(t, store.people)
+}
@@ -4,10 +4,46 @@ import (
 	flags "github.com/jessevdk/go-flags"
 	log "github.com/sirupsen/logrus"
 	"os"
+	"strings"
+	"time"
+)
+
+// Subcommands (the server is run if no subcommand is given)
+const (
+	cmdServe  = ""
+	cmdExport = "export"
+	cmdImport = "import"
 )
 
 type AppArgs struct {
 	LogLevel log.Level
+	// SQLite database file path (the in-memory store is used if empty)
+	DbPath string
+	// Journal file path (the in-memory store is used without journaling if empty)
+	JournalPath string
+	// Interval of the journal compaction (zero disables the compaction)
+	JournalCompactInterval time.Duration
+	// Period after which the deleted records are purged from the trash (zero disables the purge)
+	TrashRetention time.Duration
+	// Scheme of the ids of the people created without an id (see newPersonIdGenerator)
+	PersonIdScheme string
+	// Prefix and minimal digit count of the ids generated by the sequence scheme
+	PersonIdPrefix string
+	PersonIdWidth  int
+	// Scheme of the ids of the new relations (see newRelationIdGenerator)
+	RelationIdScheme string
+
+	// Selected subcommand (one of the cmdXxx constants)
+	Command string
+	// Data file path of the export and import subcommands (the standard output or input is used
+	// if empty)
+	SnapshotPath string
+	// Data format of the export and import subcommands (one of the formatXxx constants)
+	DataFormat string
+	// Snapshot import mode (see importSnapshot)
+	ImportMode string
+	// Server base URL used by the export subcommand (ending with the '/' character, see exporter)
+	BaseUrl string
 }
 
 // Parse the command line arguments and return the results
@@ -15,9 +51,38 @@ type AppArgs struct {
 func parseArgs() (AppArgs, error) {
 	var def struct {
 		LogLevel string `long:"log-level" choice:"trace" choice:"debug" choice:"info" choice:"warn" choice:"error" choice:"fatal" choice:"panic" default:"info"`
+		DbPath   string `long:"db"`
+
+		JournalPath            string        `long:"journal"`
+		JournalCompactInterval time.Duration `long:"journal-compact-interval" default:"1h"`
+
+		TrashRetention time.Duration `long:"trash-retention" default:"720h"`
+
+		PersonIdScheme string `long:"person-id-scheme" choice:"uuid4" choice:"uuid7" choice:"ulid" choice:"sequence" default:"uuid4"`
+		PersonIdPrefix string `long:"person-id-prefix" default:"I"`
+		PersonIdWidth  int    `long:"person-id-width" default:"4"`
+
+		RelationIdScheme string `long:"relation-id-scheme" choice:"time" choice:"random" default:"time"`
+
+		Export struct {
+			Format string `long:"format" choice:"snapshot" choice:"gedcom" choice:"gedcom7" choice:"gedzip" choice:"gedcomx" choice:"gramps" choice:"people-csv" choice:"relations-csv" choice:"turtle" choice:"rdfxml" choice:"jsonld" default:"snapshot" description:"Data file format"`
+			Output  string `long:"output" short:"o" description:"Data file path (standard output if not given)"`
+			BaseUrl string `long:"base-url" default:"http://localhost:8080/" description:"Server URL the RDF person IRIs and ontology import refer to"`
+		} `command:"export" description:"Write all the people and relations to a data file"`
+
+		Import struct {
+			Format string `long:"format" choice:"snapshot" choice:"gedcom" choice:"gedzip" choice:"gedcomx" choice:"gramps" choice:"people-csv" choice:"relations-csv" default:"snapshot" description:"Data file format (the GEDCOM version is detected)"`
+			Merge  bool   `long:"merge" description:"Merge the data into the existing records (the store must be empty otherwise)"`
+			Args   struct {
+				Input string `positional-arg-name:"FILE" description:"Data file path (standard input if not given)"`
+			} `positional-args:"yes"`
+		} `command:"import" description:"Load the people and relations from a data file"`
 	}
 
-	_, err := flags.Parse(&def)
+	parser := flags.NewParser(&def, flags.Default)
+	parser.SubcommandsOptional = true
+
+	_, err := parser.Parse()
 	if err != nil {
 		if fErr, ok := err.(*flags.Error); ok {
 			if fErr.Type == flags.ErrHelp {
@@ -28,14 +93,77 @@ func parseArgs() (AppArgs, error) {
 		return AppArgs{}, err
 	}
 
+	if def.TrashRetention < 0 {
+		log.Error("The --trash-retention option value mustn't be negative")
+
+		return AppArgs{}, AppError{errInvalidArgument, "Negative trash retention period"}
+	}
+
+	// The generated ids must pass the person id validation:
+	if !isAlphanum(def.PersonIdPrefix) || def.PersonIdWidth < 0 || def.PersonIdWidth > 20 {
+		log.Error("The --person-id-prefix value must be alphanumeric and --person-id-width between 0 and 20")
+
+		return AppArgs{}, AppError{errInvalidArgument, "Invalid person id sequence format"}
+	}
+
+	if def.DbPath != "" && def.JournalPath != "" {
+		log.Error("The --db and --journal options are mutually exclusive")
+
+		return AppArgs{}, AppError{errInvalidArgument, "Conflicting storage options"}
+	}
+
 	// Convert the log level argument value (string) to the logrus log level:
 	level, err := log.ParseLevel(def.LogLevel)
 	if err != nil {
 		return AppArgs{}, err
 	}
 
+	command, snapshotPath, dataFormat, importMode := cmdServe, "", formatSnapshot, importEmpty
+
+	if parser.Active != nil {
+		command = parser.Active.Name
+	}
+
+	// The in-memory store would be lost when the subcommand exits:
+	if command != cmdServe && def.DbPath == "" && def.JournalPath == "" {
+		log.Errorf("The %s command requires the --db or --journal option", command)
+
+		return AppArgs{}, AppError{errInvalidArgument, "Missing storage option"}
+	}
+
+	switch command {
+	case cmdExport:
+		snapshotPath = def.Export.Output
+		dataFormat = def.Export.Format
+	case cmdImport:
+		snapshotPath = def.Import.Args.Input
+		dataFormat = def.Import.Format
+
+		if def.Import.Merge {
+			importMode = importMerge
+		}
+	}
+
 	// Return the final args structure:
 	return AppArgs{
 		LogLevel: level,
+		DbPath:   def.DbPath,
+
+		JournalPath:            def.JournalPath,
+		JournalCompactInterval: def.JournalCompactInterval,
+
+		TrashRetention: def.TrashRetention,
+
+		PersonIdScheme: def.PersonIdScheme,
+		PersonIdPrefix: def.PersonIdPrefix,
+		PersonIdWidth:  def.PersonIdWidth,
+
+		RelationIdScheme: def.RelationIdScheme,
+
+		Command:      command,
+		SnapshotPath: snapshotPath,
+		DataFormat:   dataFormat,
+		ImportMode:   importMode,
+		BaseUrl:      strings.TrimSuffix(def.Export.BaseUrl, "/") + "/",
 	}, nil
 }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+/* Create all the store variants used by the server (as created by the openStore function)
+
+   The tests in this file are meant to be run with the race detector enabled (go test -race) */
+func testConcurrentStores(t *testing.T) map[string]Store {
+	journal, err := openJournalStore(filepath.Join(t.TempDir(), "gentree.journal"), 0)
+	require.Nil(t, err)
+	t.Cleanup(func() { journal.close() })
+
+	sqlite := testOpenSqliteStore(t, filepath.Join(t.TempDir(), "gentree.db"))
+
+	return map[string]Store{
+		"memory":  newLockingStore(newMemoryStore(nil, nil)),
+		"journal": newLockingStore(journal),
+		"sqlite":  sqlite,
+	}
+}
+
+/* Run the function in the given number of goroutines and wait for all of them to finish
+
+   The function receives the goroutine index */
+func testRunParallel(cnt int, fn func(idx int)) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < cnt; i++ {
+		wg.Add(1)
+
+		go func(idx int) {
+			defer wg.Done()
+			fn(idx)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+/* Test the person endpoints hammered by parallel requests
+
+   1. Create people in parallel, with each person created by two competing requests
+   2. Replace, retrieve and list the people in parallel
+   3. Delete half of the people in parallel, with each person deleted by two competing requests */
+func TestConcurrentPersonRequests(t *testing.T) {
+	const cnt = 50
+
+	for name, store := range testConcurrentStores(t) {
+		t.Run(name, func(t *testing.T) {
+			router := setupRouter(store)
+
+			// Case 1: Create
+
+			codes := make([]int, 2*cnt)
+
+			testRunParallel(2*cnt, func(idx int) {
+				res := testMakeRequest(router, "POST", "/people", testJsonBody(t, testPersonJson{
+					Id: fmt.Sprintf("P%d", idx/2), Given: "Jan", Surname: "Nowak", Gender: gMale}))
+				codes[idx] = res.Code
+			})
+
+			for i := 0; i < cnt; i++ {
+				// Exactly one of the two competing requests must succeed:
+				assert.ElementsMatch(
+					t, []int{http.StatusCreated, http.StatusBadRequest}, codes[2*i:2*i+2])
+			}
+
+			// Case 2: Replace, retrieve and list
+
+			testRunParallel(3*cnt, func(idx int) {
+				pid := fmt.Sprintf("P%d", idx/3)
+
+				switch idx % 3 {
+				case 0:
+					res := testMakeRequest(router, "PUT", "/people/"+pid, testJsonBody(t, testPersonJson{
+						Given: "Anna", Surname: "Nowak", Gender: gFemale}))
+					assert.Equal(t, http.StatusOK, res.Code)
+				case 1:
+					res := testMakeRequest(router, "GET", "/people/"+pid, nil)
+					assert.Equal(t, http.StatusOK, res.Code)
+				case 2:
+					res := testMakeRequest(router, "GET", "/people?limit=100", nil)
+					assert.Equal(t, http.StatusOK, res.Code)
+					assert.Len(t, testPersonListRes(t, res).Records, cnt)
+				}
+			})
+
+			// Case 3: Delete
+
+			codes = make([]int, cnt)
+
+			testRunParallel(cnt, func(idx int) {
+				res := testMakeRequest(router, "DELETE", fmt.Sprintf("/people/P%d", idx/2), nil)
+				codes[idx] = res.Code
+			})
+
+			for i := 0; i < cnt/2; i++ {
+				assert.ElementsMatch(
+					t, []int{http.StatusOK, http.StatusNotFound}, codes[2*i:2*i+2])
+			}
+
+			people, _, err := store.queryPeople(
+				paginationData{0, maxPageSize, 0, minPageSize, maxPageSize}, personFilter{})
+
+			assert.Nil(t, err)
+			assert.Len(t, people, cnt-cnt/2)
+		})
+	}
+}
+
+/* Test the create relation endpoint hammered by parallel requests
+
+   Many candidate fathers are assigned to the same child in parallel. Only one of the relations
+   may be created (the validate-and-insert sequence must be atomic). */
+func TestConcurrentRelationRequests(t *testing.T) {
+	const cnt = 50
+
+	for name, store := range testConcurrentStores(t) {
+		t.Run(name, func(t *testing.T) {
+			router := setupRouter(store)
+
+			require.Nil(t, store.insertPerson(personRecord{"C", "Jan", "Nowak", gMale, 0}))
+
+			for i := 0; i < cnt; i++ {
+				require.Nil(t, store.insertPerson(
+					personRecord{fmt.Sprintf("F%d", i), "Adam", "Nowak", gMale, 0}))
+			}
+
+			codes := make([]int, cnt)
+
+			testRunParallel(cnt, func(idx int) {
+				res := testMakeRequest(
+					router, "POST", fmt.Sprintf("/people/F%d/relations", idx),
+					testJsonBody(t, testItRelationJson{Pid: "C", Type: relFather}))
+				codes[idx] = res.Code
+			})
+
+			created := 0
+
+			for _, code := range codes {
+				if code == http.StatusCreated {
+					created++
+				} else {
+					assert.Equal(t, http.StatusBadRequest, code)
+				}
+			}
+
+			assert.Equal(t, 1, created)
+
+			fathers, err := store.queryRelationsByData("", relFather, "C")
+
+			assert.Nil(t, err)
+			assert.Len(t, fathers, 1)
+		})
+	}
+}
+
+/* Test the delete person endpoint competing with the create relation endpoint
+
+   No relation may refer to a deleted person (the relation deletion cascade and the relation
+   validation must be atomic) */
+func TestConcurrentDeleteAndRelate(t *testing.T) {
+	const cnt = 50
+
+	for name, store := range testConcurrentStores(t) {
+		t.Run(name, func(t *testing.T) {
+			router := setupRouter(store)
+
+			require.Nil(t, store.insertPerson(personRecord{"H", "Jan", "Nowak", gMale, 0}))
+
+			for i := 0; i < cnt; i++ {
+				require.Nil(t, store.insertPerson(
+					personRecord{fmt.Sprintf("W%d", i), "Anna", "Nowak", gFemale, 0}))
+			}
+
+			testRunParallel(cnt+1, func(idx int) {
+				if idx == cnt {
+					res := testMakeRequest(router, "DELETE", "/people/H", nil)
+					assert.Equal(t, http.StatusOK, res.Code)
+					return
+				}
+
+				res := testMakeRequest(
+					router, "POST", "/people/H/relations",
+					testJsonBody(t, testItRelationJson{Pid: fmt.Sprintf("W%d", idx), Type: relHusband}))
+				assert.Contains(t, []int{http.StatusCreated, http.StatusBadRequest}, res.Code)
+			})
+
+			relations, err := store.queryRelationsByData("H", "", "")
+
+			assert.Nil(t, err)
+			assert.Empty(t, relations)
+		})
+	}
+}
+
+/* Test the read-only views of the stores
+
+   1. A view doesn't block another view of the same store
+   2. Traversals run in parallel with the person modifications */
+func TestConcurrentViews(t *testing.T) {
+	const cnt = 20
+
+	for name, store := range testConcurrentStores(t) {
+		t.Run(name, func(t *testing.T) {
+			router := setupRouter(store)
+
+			// Case 1: Nested views
+
+			err := store.view(func(Store) error {
+				done := make(chan error, 1)
+
+				go func() { done <- store.view(func(Store) error { return nil }) }()
+
+				select {
+				case err := <-done:
+					return err
+				case <-time.After(5 * time.Second):
+					return errors.New("the view is blocked by another view")
+				}
+			})
+
+			assert.Nil(t, err)
+
+			// Case 2: Traversals and modifications
+
+			res := testMakeRequest(router, "POST", "/people", testJsonBody(t, testPersonJson{
+				Id: "P0", Given: "Jan", Surname: "Nowak", Gender: gMale}))
+			require.Equal(t, http.StatusCreated, res.Code)
+
+			testRunParallel(2*cnt, func(idx int) {
+				if idx%2 == 0 {
+					res := testMakeRequest(router, "POST", "/people", testJsonBody(t, testPersonJson{
+						Id: fmt.Sprintf("P%d", idx+1), Given: "Anna", Surname: "Nowak", Gender: gFemale}))
+					assert.Equal(t, http.StatusCreated, res.Code)
+				} else {
+					res := testMakeRequest(router, "GET", "/people/P0/ancestors", nil)
+					assert.Equal(t, http.StatusOK, res.Code)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+/* This file defines the connection path search
+
+   Any two people are connected if there is a chain of relations leading from one of them to the
+   other one. The relations of all the types are followed in both directions (e.g. from a child to
+   its father, from a wife to her husband and vice versa), so the connection may go through the
+   marriages, the step relatives and the long chains of the in-laws.
+
+   The shortest connection is found using the breadth first search. The relations of every person
+   are followed in the order of their ids, so the same connection is found every time. */
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+/* A structure used to extract the identifiers of the two people from a URI */
+type connectionUri struct {
+	Pid   string `uri:"pid" binding:"required,alphanum|uuid"`
+	Other string `uri:"other" binding:"required,alphanum|uuid"`
+}
+
+/* Single step of the connection path */
+type connectionStepPayload struct {
+	Person fullPersonPayload `json:"person"`
+	// The relation leading from the person of the previous step (missing in the first step)
+	Relation *relationPayload `json:"relation,omitempty"`
+}
+
+/* Response of the connection path query */
+type connectionPayload struct {
+	Person fullPersonPayload `json:"person"`
+	Other  fullPersonPayload `json:"other"`
+	// Number of the relations on the path
+	Length int `json:"length"`
+	// Steps leading from the person (the first step) to the other person (the last step)
+	Path []connectionStepPayload `json:"path"`
+}
+
+/* Find the shortest connection path of two people
+
+   The function must be called from the function passed to the store view (or update) method.
+
+   Params:
+   * tx - the store (as passed to the function run by the store view or update method)
+   * pid - the person identifier
+   * other - the other person identifier
+
+   Return:
+   * the connection path (valid only if both people were found, they are connected and no error
+     occurred)
+   * success flag (true if both people were found and false otherwise)
+   * connection flag (true if the people are connected and false otherwise)
+   * error (if occurred and nil otherwise) */
+func queryConnection(tx Store, pid string, other string) (connectionPayload, bool, bool, error) {
+	cache := newFamilyCache(tx)
+
+	person, found, err := cache.getPerson(pid)
+	if !found || err != nil {
+		return connectionPayload{}, found, false, err
+	}
+
+	otherPerson, found, err := cache.getPerson(other)
+	if !found || err != nil {
+		return connectionPayload{}, found, false, err
+	}
+
+	// The relations leading to the visited people (uninitialized for the first person):
+	reachedBy := map[string]relationRecord{pid: {}}
+	queue := []string{pid}
+
+	for len(queue) > 0 {
+		if _, found := reachedBy[other]; found {
+			break
+		}
+
+		current := queue[0]
+		queue = queue[1:]
+
+		relations, err := cache.getRelations(current)
+		if err != nil {
+			return connectionPayload{}, true, false, err
+		}
+
+		for _, r := range relations {
+			next := r.Pid1
+
+			if next == current {
+				next = r.Pid2
+			}
+
+			if _, found := reachedBy[next]; found {
+				continue
+			}
+
+			if _, found, err := cache.getPerson(next); err != nil {
+				return connectionPayload{}, true, false, err
+			} else if !found {
+				log.Warnf("The relative (%s) of person (%s) doesn't exist", next, current)
+				continue
+			}
+
+			reachedBy[next] = r
+			queue = append(queue, next)
+		}
+	}
+
+	if _, found := reachedBy[other]; !found {
+		return connectionPayload{}, true, false, nil
+	}
+
+	// Follow the relations back from the other person:
+	steps := []connectionStepPayload{}
+
+	for current := other; current != pid; {
+		r := reachedBy[current]
+		record := cache.people[current] // All the visited people are cached
+		relation := r.toPayload()
+
+		steps = append(steps, connectionStepPayload{record.toPayload(), &relation})
+
+		if current == r.Pid1 {
+			current = r.Pid2
+		} else {
+			current = r.Pid1
+		}
+	}
+
+	steps = append(steps, connectionStepPayload{Person: person.toPayload()})
+
+	result := connectionPayload{
+		Person: person.toPayload(),
+		Other:  otherPerson.toPayload(),
+		Length: len(steps) - 1,
+		Path:   make([]connectionStepPayload, 0, len(steps)),
+	}
+
+	for idx := len(steps) - 1; idx >= 0; idx-- {
+		result.Path = append(result.Path, steps[idx])
+	}
+
+	return result, true, true, nil
+}
+
+/* Handle a connection path request
+
+   The function will extract the identifiers of the two people from the request URI
+   (connectionUri). The response lists the people and the relations leading from the first person
+   to the second one. */
+func retrieveConnection(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	var params connectionUri
+
+	if err := c.ShouldBindUri(&params); err != nil {
+		log.Infof("Uri parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": uriErrorMsg})
+		return
+	}
+
+	var result connectionPayload
+	var found, connected bool
+
+	// The search must see a consistent state of the relations:
+	err := getStore(c).view(func(tx Store) error {
+		var err error
+
+		result, found, connected, err = queryConnection(tx, params.Pid, params.Other)
+
+		return err
+	})
+
+	if !found && err == nil {
+		log.Infof("At least one of the people (%s, %s) doesn't exist", params.Pid, params.Other)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown person id"})
+		return
+	} else if err != nil {
+		log.Errorf("An error occurred during the connection path search attempt (%s)", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	} else if !connected {
+		log.Infof("The people (%s, %s) aren't connected", params.Pid, params.Other)
+		c.JSON(http.StatusNotFound, gin.H{"message": "The people aren't connected"})
+		return
+	}
+
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.JSON(http.StatusOK, result)
+
+	log.Infof("Found the connection path of the requested people (%s, %s) of length %d",
+		params.Pid, params.Other, result.Length)
+}
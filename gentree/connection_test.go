@@ -0,0 +1,120 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testConnectionStepJson struct {
+	Person   testPersonJson        `json:"person"`
+	Relation *testFullRelationJson `json:"relation"`
+}
+
+type testConnectionJson struct {
+	Person testPersonJson           `json:"person"`
+	Other  testPersonJson           `json:"other"`
+	Length int                      `json:"length"`
+	Path   []testConnectionStepJson `json:"path"`
+}
+
+func testConnectionRes(t *testing.T, res *httptest.ResponseRecorder) testConnectionJson {
+	payload := testConnectionJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+/* Extract the person ids and the relation ids of the connection path steps */
+func testConnectionSteps(payload testConnectionJson) ([]string, []int64) {
+	people, relations := []string{}, []int64{}
+
+	for _, step := range payload.Path {
+		people = append(people, step.Person.Id)
+
+		if step.Relation != nil {
+			relations = append(relations, step.Relation.Id)
+		}
+	}
+
+	return people, relations
+}
+
+/* Test the connection path search (the family is described by testKinshipStore)
+
+   1. Connection through the blood relatives
+   2. Connection through the marriages
+   3. The same person
+   4. Disconnected people
+   5. Unknown person */
+func TestRetrieveConnection(t *testing.T) {
+	router := setupRouter(testKinshipStore())
+
+	// Case 1: Blood relatives
+
+	res := testMakeRequest(router, "GET", "/people/A1/path/B2", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	payload := testConnectionRes(t, res)
+	people, relations := testConnectionSteps(payload)
+
+	assert.Equal(t, testPersonJson{"A1", "Tomasz", "Kowalski", gMale}, payload.Person)
+	assert.Equal(t, testPersonJson{"B2", "Jakub", "Zieliński", gMale}, payload.Other)
+	assert.Equal(t, 7, payload.Length)
+	assert.Equal(t, []string{"A1", "PA", "GA", "GGP", "GB", "PB", "B1", "B2"}, people)
+	assert.Equal(t, []int64{13, 9, 2, 4, 10, 15, 16}, relations)
+	assert.Nil(t, payload.Path[0].Relation)
+	assert.Equal(t, testFullRelationJson{2, "GGP", "GA", relFather}, *payload.Path[3].Relation)
+
+	// Case 2: Marriages (the husband relations are followed in both directions)
+
+	for _, tc := range []struct {
+		pid       string
+		other     string
+		people    []string
+		relations []int64
+	}{
+		{"W2", "HPB", []string{"W2", "HB", "PB", "HPB"}, []int64{8, 11, 12}},
+		{"HPB", "W2", []string{"HPB", "PB", "HB", "W2"}, []int64{12, 11, 8}},
+		{"WC", "WPA", []string{"WC", "GC", "GGP", "GA", "PA", "WPA"}, []int64{19, 17, 2, 9, 21}},
+	} {
+		res = testMakeRequest(router, "GET", "/people/"+tc.pid+"/path/"+tc.other, nil)
+
+		require.Equal(t, http.StatusOK, res.Code, tc)
+
+		payload = testConnectionRes(t, res)
+		people, relations = testConnectionSteps(payload)
+
+		assert.Equal(t, len(tc.relations), payload.Length, tc)
+		assert.Equal(t, tc.people, people, tc)
+		assert.Equal(t, tc.relations, relations, tc)
+	}
+
+	// Case 3: The same person
+
+	res = testMakeRequest(router, "GET", "/people/X/path/X", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	payload = testConnectionRes(t, res)
+
+	assert.Equal(t, 0, payload.Length)
+	assert.Equal(t,
+		[]testConnectionStepJson{{testPersonJson{"X", "", "", gUnknown}, nil}}, payload.Path)
+
+	// Case 4: Disconnected people
+
+	res = testMakeRequest(router, "GET", "/people/X/path/A1", nil)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, "The people aren't connected", testErrorRes(t, res).Message)
+
+	// Case 5: Unknown person
+
+	res = testMakeRequest(router, "GET", "/people/P9/path/A1", nil)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, "Unknown person id", testErrorRes(t, res).Message)
+}
@@ -0,0 +1,499 @@
+package main
+
+/* This file defines the CSV import and export of the people and relations
+
+   The people and the relations are kept in separate CSV documents. Their first row is the header
+   naming the columns (the JSON field names of the fullPersonPayload and relationPayload
+   structures). Every imported row is validated using the binding rules of the JSON handlers and
+   the rows failing the validation are listed in the import report.
+
+   The exported cells starting with a character making the spreadsheet applications interpret them
+   as a formula (e.g. "=HYPERLINK(...)") are prefixed with an apostrophe, which the import strips
+   again (see guardCsvCell). */
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Columns of the people and relations CSV documents (in the export order)
+var (
+	csvPersonColumns   = []string{"id", "given_names", "surname", "gender"}
+	csvRelationColumns = []string{"id", "pid1", "pid2", "type"}
+)
+
+// Columns that must be present in the imported CSV documents
+var (
+	csvRequiredPersonColumns   = []string{"id"}
+	csvRequiredRelationColumns = []string{"pid1", "pid2", "type"}
+)
+
+const (
+	// Leading characters making the spreadsheet applications interpret a cell as a formula (the
+	// tab and the carriage return may precede one)
+	csvFormulaChars = "=+-@\t\r"
+	// Prefix neutralizing the formula characters (displayed as a text cell by the applications)
+	csvFormulaGuard = "'"
+)
+
+/* Neutralize a cell value starting with a formula character (see unguardCsvCell)
+
+   The values looking like the guarded ones already (e.g. "'=x") are guarded once more, so that the
+   import restores them intact */
+func guardCsvCell(value string) string {
+	rest := strings.TrimLeft(value, csvFormulaGuard)
+
+	if rest != "" && strings.ContainsRune(csvFormulaChars, rune(rest[0])) {
+		return csvFormulaGuard + value
+	}
+
+	return value
+}
+
+/* Restore a cell value neutralized by guardCsvCell
+
+   The other values starting with an apostrophe (e.g. "'t Hooft") are kept intact */
+func unguardCsvCell(value string) string {
+	guarded, found := strings.CutPrefix(value, csvFormulaGuard)
+
+	if found && guardCsvCell(guarded) == value {
+		return guarded
+	}
+
+	return value
+}
+
+/* Error found in a single row of the imported CSV document */
+type csvRowErrorPayload struct {
+	// Line number of the row (the header is the line 1)
+	Row int `json:"row"`
+	// Name of the column holding the invalid value (empty if the error concerns the whole row)
+	Column string `json:"column,omitempty"`
+	Reason string `json:"reason"`
+}
+
+/* Summary of the CSV import */
+type csvImportReportPayload struct {
+	// Number of the data rows (the header excluded)
+	Rows     int `json:"rows"`
+	Imported int `json:"imported"`
+	// Rows identical to the existing records
+	Skipped int                  `json:"skipped"`
+	Errors  []csvRowErrorPayload `json:"errors"`
+}
+
+/* Data row of the imported CSV document */
+type csvRow struct {
+	line int
+	// Values keyed by the column names (missing optional columns map to empty strings)
+	values map[string]string
+}
+
+/* Read the CSV document
+
+   Params:
+   * in - the CSV document source
+   * columns - names of the supported columns
+   * required - names of the columns that must be present
+
+   Return:
+   * the data rows having the same number of fields as the header
+   * the errors of the rows having a different number of fields
+   * error (AppError with the errInvalidArgument code if the document or its header is malformed,
+     nil otherwise) */
+func readCsv(in io.Reader, columns []string, required []string) ([]csvRow, []csvRowErrorPayload, error) {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, AppError{errInvalidArgument, "Missing CSV header"}
+	} else if err != nil {
+		log.Infof("CSV header parsing error: %s", err)
+
+		return nil, nil, AppError{errInvalidArgument, "Malformed CSV document"}
+	}
+
+	// The spreadsheet applications tend to start the UTF-8 files with the byte order mark:
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	seen := map[string]bool{}
+
+	for idx, name := range header {
+		name = strings.TrimSpace(name)
+		header[idx] = name
+
+		if !containsStr(columns, name) {
+			return nil, nil, AppError{errInvalidArgument, fmt.Sprintf("Unknown CSV column (%s)", name)}
+		} else if seen[name] {
+			return nil, nil, AppError{errInvalidArgument, fmt.Sprintf("Duplicate CSV column (%s)", name)}
+		}
+
+		seen[name] = true
+	}
+
+	for _, name := range required {
+		if !seen[name] {
+			return nil, nil, AppError{errInvalidArgument, fmt.Sprintf("Missing CSV column (%s)", name)}
+		}
+	}
+
+	rows := []csvRow{}
+	rowErrors := []csvRowErrorPayload{}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Infof("CSV record parsing error: %s", err)
+
+			return nil, nil, AppError{errInvalidArgument, "Malformed CSV document"}
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		if len(record) != len(header) {
+			rowErrors = append(rowErrors, csvRowErrorPayload{line, "", fmt.Sprintf(
+				"The row has %d field(s) instead of %d", len(record), len(header))})
+			continue
+		}
+
+		row := csvRow{line, map[string]string{}}
+
+		for _, name := range columns {
+			row.values[name] = ""
+		}
+
+		for idx, value := range record {
+			row.values[header[idx]] = unguardCsvCell(strings.TrimSpace(value))
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, rowErrors, nil
+}
+
+/* Convert the binding validation error into the row errors (one per invalid field)
+
+   Params:
+   * line - the row line number
+   * payload - pointer to the validated payload structure (its JSON field names are the column
+     names)
+   * err - the error returned by the validator */
+func csvValidationErrors(line int, payload interface{}, err error) []csvRowErrorPayload {
+	var fieldErrors validator.ValidationErrors
+
+	if !errors.As(err, &fieldErrors) {
+		return []csvRowErrorPayload{{line, "", "Invalid row data"}}
+	}
+
+	typ := reflect.TypeOf(payload).Elem()
+	result := make([]csvRowErrorPayload, 0, len(fieldErrors))
+
+	for _, fe := range fieldErrors {
+		column := fe.Field()
+
+		if field, found := typ.FieldByName(fe.StructField()); found {
+			column, _, _ = strings.Cut(field.Tag.Get("json"), ",")
+		}
+
+		var reason string
+
+		// The alternative rules are reported as a whole (together with their parameters):
+		if values, found := strings.CutPrefix(fe.Tag(), "isdefault|oneof="); found {
+			reason = fmt.Sprintf("The value must be empty or one of: %s", values)
+		} else {
+			switch fe.Tag() {
+			case "required":
+				reason = "The value is required"
+			case "alphanum|uuid":
+				reason = "The value must be alphanumeric or a UUID"
+			case "oneof":
+				reason = fmt.Sprintf("The value must be one of: %s", fe.Param())
+			default:
+				reason = fmt.Sprintf("The value doesn't satisfy the %s rule", fe.Tag())
+			}
+		}
+
+		result = append(result, csvRowErrorPayload{line, column, reason})
+	}
+
+	return result
+}
+
+/* Import the single-record snapshot created out of a CSV row (see importSnapshot)
+
+   Return:
+   * the row error (nil if the record is imported or skipped)
+   * the skipped flag
+   * error (if occurred and nil otherwise) */
+func importCsvRecord(tx Store, gen relationIdGenerator, line int, snapshot snapshotPayload) (*csvRowErrorPayload, bool, error) {
+	report, err := importSnapshot(tx, gen, snapshot, importMerge)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(report.Rejected) > 0 {
+		return &csvRowErrorPayload{line, "", report.Rejected[0].Reason}, false, nil
+	}
+
+	return nil, report.SkippedPeople+report.SkippedRelations > 0, nil
+}
+
+/* Load a CSV document into the store
+
+   The rows are imported in order, like the records of a snapshot imported in the merge mode (see
+   importSnapshot). The empty mode only requires the store to be empty before the import. Invalid
+   rows don't abort the import; they are listed in the report instead.
+
+   Params:
+   * store - the store to import the document into
+   * gen - the relation id generator (see importSnapshot)
+   * in - the CSV document source
+   * mode - one of the importXxx constants
+   * columns - the supported columns
+   * required - the columns that must be present
+   * convert - function validating a row and converting it into a single-record snapshot (returns
+     the row errors instead if the row is invalid)
+
+   Return:
+   * the import report (valid only if no error occurred)
+   * error (AppError with the errInvalidArgument code if the document is malformed, AppError with
+     the errConflict code if the store isn't empty in the empty mode, other error if occurred, and
+     nil otherwise) */
+func loadCsv(store Store, gen relationIdGenerator, in io.Reader, mode string, columns []string, required []string, convert func(row csvRow) (snapshotPayload, []csvRowErrorPayload)) (csvImportReportPayload, error) {
+	rows, rowErrors, err := readCsv(in, columns, required)
+	if err != nil {
+		return csvImportReportPayload{}, err
+	}
+
+	report := csvImportReportPayload{Rows: len(rows) + len(rowErrors), Errors: rowErrors}
+
+	err = store.update(func(tx Store) error {
+		if mode != importMerge {
+			if empty, err := isStoreEmpty(tx); err != nil {
+				return err
+			} else if !empty {
+				return AppError{errConflict, "The store is not empty"}
+			}
+		}
+
+		for _, row := range rows {
+			snapshot, errs := convert(row)
+
+			if len(errs) > 0 {
+				report.Errors = append(report.Errors, errs...)
+				continue
+			}
+
+			rowError, skipped, err := importCsvRecord(tx, gen, row.line, snapshot)
+
+			if err != nil {
+				return err
+			} else if rowError != nil {
+				report.Errors = append(report.Errors, *rowError)
+			} else if skipped {
+				report.Skipped++
+			} else {
+				report.Imported++
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return csvImportReportPayload{}, err
+	}
+
+	// The rows with a wrong number of fields are reported first; restore the document order:
+	sort.SliceStable(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Row < report.Errors[j].Row
+	})
+
+	return report, nil
+}
+
+/* Load a people CSV document into the store (see loadCsv)
+
+   The rows are validated using the fullPersonPayload binding rules */
+func loadPeopleCsv(store Store, gen relationIdGenerator, in io.Reader, mode string) (csvImportReportPayload, error) {
+	report, err := loadCsv(store, gen, in, mode, csvPersonColumns, csvRequiredPersonColumns,
+		func(row csvRow) (snapshotPayload, []csvRowErrorPayload) {
+			person := fullPersonPayload{
+				row.values["id"], row.values["given_names"], row.values["surname"],
+				row.values["gender"]}
+
+			if err := binding.Validator.ValidateStruct(&person); err != nil {
+				return snapshotPayload{}, csvValidationErrors(row.line, &person, err)
+			}
+
+			return snapshotPayload{People: []fullPersonPayload{person}}, nil
+		})
+
+	if err == nil {
+		log.Infof("Imported %d people from CSV (%d rows skipped, %d errors)",
+			report.Imported, report.Skipped, len(report.Errors))
+	}
+
+	return report, err
+}
+
+/* Load a relations CSV document into the store (see loadCsv)
+
+   The rows are validated using the iitRelationPayload binding rules. The id column is optional;
+   the relations with no id (or an id already used) get new ones. */
+func loadRelationsCsv(store Store, gen relationIdGenerator, in io.Reader, mode string) (csvImportReportPayload, error) {
+	report, err := loadCsv(store, gen, in, mode, csvRelationColumns, csvRequiredRelationColumns,
+		func(row csvRow) (snapshotPayload, []csvRowErrorPayload) {
+			relation := iitRelationPayload{row.values["pid1"], row.values["pid2"], row.values["type"]}
+			rowErrors := []csvRowErrorPayload{}
+
+			var id int64
+
+			if value := row.values["id"]; value != "" {
+				var err error
+
+				if id, err = strconv.ParseInt(value, 10, 64); err != nil || id <= 0 {
+					rowErrors = append(rowErrors, csvRowErrorPayload{
+						row.line, "id", "The value must be a positive integer"})
+				}
+			}
+
+			if err := binding.Validator.ValidateStruct(&relation); err != nil {
+				rowErrors = append(rowErrors, csvValidationErrors(row.line, &relation, err)...)
+			}
+
+			if len(rowErrors) > 0 {
+				return snapshotPayload{}, rowErrors
+			}
+
+			return snapshotPayload{Relations: []relationPayload{
+				{Id: id, Pid1: relation.Pid1, Pid2: relation.Pid2, Type: relation.Type}}}, nil
+		})
+
+	if err == nil {
+		log.Infof("Imported %d relations from CSV (%d rows skipped, %d errors)",
+			report.Imported, report.Skipped, len(report.Errors))
+	}
+
+	return report, err
+}
+
+/* Write a CSV document made out of the snapshot of the whole store
+
+   Params:
+   * store - the store to be exported
+   * out - the CSV document destination
+   * columns - the header row
+   * records - function converting the snapshot into the data rows
+
+   Return:
+   * error (if occurred and nil otherwise) */
+func saveCsv(store Store, out io.Writer, columns []string, records func(snapshot snapshotPayload) [][]string) error {
+	var snapshot snapshotPayload
+
+	err := store.view(func(tx Store) error {
+		var err error
+
+		snapshot, err = exportSnapshot(tx)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(out)
+
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+
+	rows := records(snapshot)
+
+	for _, row := range rows {
+		for idx, value := range row {
+			row[idx] = guardCsvCell(value)
+		}
+	}
+
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+
+	return writer.Error()
+}
+
+/* Write the people CSV document of the whole store (see saveCsv) */
+func savePeopleCsv(store Store, out io.Writer) error {
+	return saveCsv(store, out, csvPersonColumns, func(snapshot snapshotPayload) [][]string {
+		records := make([][]string, 0, len(snapshot.People))
+
+		for _, p := range snapshot.People {
+			records = append(records, []string{p.Id, p.Given, p.Surname, p.Gender})
+		}
+
+		log.Infof("Exported %d people to CSV", len(records))
+
+		return records
+	})
+}
+
+/* Write the relations CSV document of the whole store (see saveCsv) */
+func saveRelationsCsv(store Store, out io.Writer) error {
+	return saveCsv(store, out, csvRelationColumns, func(snapshot snapshotPayload) [][]string {
+		records := make([][]string, 0, len(snapshot.Relations))
+
+		for _, r := range snapshot.Relations {
+			records = append(records, []string{strconv.FormatInt(r.Id, 10), r.Pid1, r.Pid2, r.Type})
+		}
+
+		log.Infof("Exported %d relations to CSV", len(records))
+
+		return records
+	})
+}
+
+/* Handle a people CSV export request */
+func exportPeopleCsv(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doExport(c, formatPeopleCsv)
+}
+
+/* Handle a relations CSV export request */
+func exportRelationsCsv(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doExport(c, formatRelationsCsv)
+}
+
+/* Handle a people CSV import request (see importGedcom)
+
+   The report lists the errors of the rows that weren't imported (see csvImportReportPayload) */
+func importPeopleCsv(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doImport(c, formatPeopleCsv)
+}
+
+/* Handle a relations CSV import request (see importPeopleCsv) */
+func importRelationsCsv(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doImport(c, formatRelationsCsv)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testCsvRowErrorJson struct {
+	Row    int    `json:"row"`
+	Column string `json:"column"`
+	Reason string `json:"reason"`
+}
+
+type testCsvImportReportJson struct {
+	Message string `json:"message"`
+	Report  struct {
+		Rows     int                   `json:"rows"`
+		Imported int                   `json:"imported"`
+		Skipped  int                   `json:"skipped"`
+		Errors   []testCsvRowErrorJson `json:"errors"`
+	} `json:"report"`
+}
+
+func testCsvImportReportRes(t *testing.T, res *httptest.ResponseRecorder) testCsvImportReportJson {
+	payload := testCsvImportReportJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+const testPeopleCsv = "\ufeffid,surname,given_names,gender\n" +
+	"P1,Kowalski,Jan,male\n" +
+	"P2,Nowak,\"Anna, Maria\",female\n" +
+	"P3,,Piotr,\n" +
+	"P-4,Wiśniewski,Adam,male\n" +
+	",Zielińska,Ewa,Female\n" +
+	"P6,Lewandowski\n" +
+	"P1,Kowalski,Jan,male\n" +
+	"P2,Nowak,Anna,female\n"
+
+const testRelationsCsv = "pid1,pid2,type\n" +
+	"P1,P3,father\n" +
+	"P2,P3,mother\n" +
+	"P1,P2,husband\n" +
+	"P1,P3,father\n" +
+	"P3,P1,father\n" +
+	"P1,P9,son\n"
+
+/* Test the CSV import and export
+
+   1. Import the people
+   2. Import the relations
+   3. Export the people and the relations
+   4. Import the exported documents into another store
+   5. Attempt to import the documents with invalid headers */
+func TestCsvImportExport(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	// Case 1: People
+
+	res := testMakeRequest(router, "POST", "/people.csv", strings.NewReader(testPeopleCsv))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report := testCsvImportReportRes(t, res).Report
+
+	assert.Equal(t, 8, report.Rows)
+	assert.Equal(t, 3, report.Imported)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, []testCsvRowErrorJson{
+		{5, "id", "The value must be alphanumeric or a UUID"},
+		{6, "id", "The value is required"},
+		{6, "gender", "The value must be empty or one of: male female unknown"},
+		{7, "", "The row has 2 field(s) instead of 4"},
+		{9, "", "Person (P2) already exists"},
+	}, report.Errors)
+
+	assert.Equal(t, personRecord{"P1", "Jan", "Kowalski", gMale, 1}, store.people["P1"])
+	assert.Equal(t, personRecord{"P2", "Anna, Maria", "Nowak", gFemale, 1}, store.people["P2"])
+	assert.Equal(t, personRecord{"P3", "Piotr", "", gUnknown, 1}, store.people["P3"])
+
+	// Case 2: Relations
+
+	res = testMakeRequest(router, "POST", "/relations.csv", strings.NewReader(testRelationsCsv))
+
+	assert.Equal(t, http.StatusConflict, res.Code)
+
+	res = testMakeRequest(
+		router, "POST", "/relations.csv?mode=merge", strings.NewReader(testRelationsCsv))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report = testCsvImportReportRes(t, res).Report
+
+	assert.Equal(t, 6, report.Rows)
+	assert.Equal(t, 3, report.Imported)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, []testCsvRowErrorJson{
+		{6, "", "Relation (P3, father, P1) is invalid"},
+		{7, "type", "The value must be one of: father mother husband"},
+	}, report.Errors)
+	assert.Len(t, store.relations, 3)
+
+	// Case 3: Export
+
+	res = testMakeRequest(router, "GET", "/people.csv", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", res.Header().Get("Content-Type"))
+	assert.Equal(t, "id,given_names,surname,gender\n"+
+		"P1,Jan,Kowalski,male\n"+
+		"P2,\"Anna, Maria\",Nowak,female\n"+
+		"P3,Piotr,,unknown\n", res.Body.String())
+
+	people := res.Body.String()
+
+	res = testMakeRequest(router, "GET", "/relations.csv", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	relations := res.Body.String()
+	lines := strings.Split(strings.TrimSpace(relations), "\n")
+
+	require.Len(t, lines, 4)
+	assert.Equal(t, "id,pid1,pid2,type", lines[0])
+
+	// Case 4: Round trip
+
+	target := newMemoryStore(nil, nil)
+	targetRouter := setupRouter(target)
+
+	res = testMakeRequest(targetRouter, "POST", "/people.csv", strings.NewReader(people))
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, testCsvImportReportRes(t, res).Report.Errors)
+
+	res = testMakeRequest(
+		targetRouter, "POST", "/relations.csv?mode=merge", strings.NewReader(relations))
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, testCsvImportReportRes(t, res).Report.Errors)
+	assert.Equal(t, store.people, target.people)
+	assert.Equal(t, store.relations, target.relations)
+
+	// Case 5: Invalid headers
+
+	for _, tc := range []struct {
+		url     string
+		data    string
+		message string
+	}{
+		{"/people.csv", "", "Missing CSV header"},
+		{"/people.csv", "id,name\nP7,Jan\n", "Unknown CSV column (name)"},
+		{"/people.csv", "surname\nKowalski\n", "Missing CSV column (id)"},
+		{"/relations.csv", "pid1,pid2,type,pid2\n", "Duplicate CSV column (pid2)"},
+		{"/relations.csv", "pid1,pid2,type\n\"P1,P2,father\n", "Malformed CSV document"},
+	} {
+		res = testMakeRequest(router, "POST", tc.url+"?mode=merge", strings.NewReader(tc.data))
+
+		assert.Equal(t, http.StatusBadRequest, res.Code, tc.data)
+		assert.Equal(t, tc.message, testErrorRes(t, res).Message, tc.data)
+	}
+}
+
+/* Test the CSV export and import of the cells interpreted as formulas by the spreadsheets
+
+   1. Export the people with names starting with the formula characters (the cells are guarded)
+   2. Import the exported document into another store (the guards are stripped) */
+func TestCsvFormulaCells(t *testing.T) {
+	store := newMemoryStore(map[string]personRecord{
+		"P1": {"P1", "=HYPERLINK(\"http://example.com\")", "+48", gMale, 1},
+		"P2": {"P2", "@Anna", "-", gFemale, 1},
+		"P3": {"P3", "'=Jan", "'t Hooft", gMale, 1},
+		"P4": {"P4", "\t=Jan", "\r=Nowak", gUnknown, 1},
+	}, nil)
+
+	// Case 1: Export
+
+	res := testMakeRequest(setupRouter(store), "GET", "/people.csv", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "id,given_names,surname,gender\n"+
+		"P1,\"'=HYPERLINK(\"\"http://example.com\"\")\",'+48,male\n"+
+		"P2,'@Anna,'-,female\n"+
+		"P3,''=Jan,'t Hooft,male\n"+
+		"P4,'\t=Jan,\"'\r=Nowak\",unknown\n", res.Body.String())
+
+	// Case 2: Round trip
+
+	target := newMemoryStore(nil, nil)
+
+	res = testMakeRequest(
+		setupRouter(target), "POST", "/people.csv", strings.NewReader(res.Body.String()))
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, testCsvImportReportRes(t, res).Report.Errors)
+	assert.Equal(t, store.people, target.people)
+}
@@ -0,0 +1,264 @@
+package main
+
+/* This file defines the descendants traversal
+
+   The descendants are found by following the father and mother relations downward. Every
+   descendant gets its d'Aboville number: the person itself has the number 1 and the n-th child of
+   the person with the number x has the number x.n (e.g. 1.2.1 is the first child of the second
+   child). The children are ordered as returned by familyCache.getChildren.
+
+   The same descendant may be reached through several lines (e.g. when the descendants married each
+   other). Such a descendant is listed once for every line and its later entries refer to the first
+   one (in the d'Aboville order). */
+
+import (
+	"fmt"
+	"github.com/gin-contrib/location"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Default traversal depth (in generations) of the descendants query
+const defaultDescendantsDepth = 5
+
+// Maximum number of the descendant entries
+const maxDescendantEntries = 10000
+
+// Shapes of the descendants query response
+const (
+	// Nested entries (the children are included in the entries of their parents)
+	shapeTree = "tree"
+	// Flat, paginated list of the entries (in the d'Aboville order)
+	shapeList = "list"
+)
+
+/* The structure used to extract the descendants query parameters from a request query (the
+   pagination parameters are extracted separately, see paginationQuery) */
+type descendantsQuery struct {
+	Depth int    `form:"depth" binding:"isdefault|min=1,max=30"`
+	Shape string `form:"shape" binding:"isdefault|oneof=tree list"`
+}
+
+/* Single entry of the descendants structure */
+type descendantPayload struct {
+	Person     fullPersonPayload `json:"person"`
+	Generation int               `json:"generation"`
+	Daboville  string            `json:"daboville"`
+	// d'Aboville number of the first entry of the same descendant (set for the other entries only)
+	SameAs string `json:"same_as,omitempty"`
+	// Entries of the children (the tree shape only)
+	Children []descendantPayload `json:"children,omitempty"`
+}
+
+/* Result of the descendants traversal */
+type descendantsResult struct {
+	Person fullPersonPayload
+	// Entries of the children of the person (nested)
+	Descendants []descendantPayload
+	// Number of all the entries
+	Count int
+	// Set if the entry limit was reached (some descendants are missing)
+	Truncated bool
+}
+
+/* Find the descendants of a person
+
+   The function must be called from the function passed to the store view (or update) method.
+
+   Params:
+   * tx - the store (as passed to the function run by the store view or update method)
+   * pid - the person identifier
+   * depth - the number of generations to be traversed
+
+   Return:
+   * the descendants (valid only if the person was found and no error occurred)
+   * success flag (true if the person was found and false otherwise)
+   * error (if occurred and nil otherwise) */
+func queryDescendants(tx Store, pid string, depth int) (descendantsResult, bool, error) {
+	cache := newFamilyCache(tx)
+
+	root, found, err := cache.getPerson(pid)
+	if !found || err != nil {
+		return descendantsResult{}, found, err
+	}
+
+	result := descendantsResult{Person: root.toPayload()}
+	first := map[string]string{pid: "1"}
+
+	// Create the entries of the children of a person (depth first, so that the first entry of
+	// every descendant is the first one in the d'Aboville order):
+	var expand func(pid string, number string, generation int) ([]descendantPayload, error)
+
+	expand = func(pid string, number string, generation int) ([]descendantPayload, error) {
+		children, err := cache.getChildren(pid)
+		if err != nil {
+			return nil, err
+		}
+
+		entries := []descendantPayload{}
+
+		for idx, childPid := range children {
+			if result.Count >= maxDescendantEntries {
+				result.Truncated = true
+				break
+			}
+
+			child, found, err := cache.getPerson(childPid)
+			if err != nil {
+				return nil, err
+			} else if !found {
+				log.Warnf("The child (%s) of person (%s) doesn't exist", childPid, pid)
+				continue
+			}
+
+			entry := descendantPayload{
+				Person:     child.toPayload(),
+				Generation: generation,
+				Daboville:  fmt.Sprintf("%s.%d", number, idx+1),
+			}
+
+			if firstNumber, found := first[childPid]; found {
+				entry.SameAs = firstNumber
+			} else {
+				first[childPid] = entry.Daboville
+			}
+
+			result.Count++
+
+			if generation < depth {
+				if entry.Children, err = expand(childPid, entry.Daboville, generation+1); err != nil {
+					return nil, err
+				}
+			}
+
+			entries = append(entries, entry)
+		}
+
+		return entries, nil
+	}
+
+	if result.Descendants, err = expand(pid, "1", 1); err != nil {
+		return descendantsResult{}, true, err
+	}
+
+	return result, true, nil
+}
+
+/* Flatten the nested descendant entries (in the d'Aboville order, with no children included) */
+func flattenDescendants(entries []descendantPayload) []descendantPayload {
+	result := []descendantPayload{}
+
+	for _, entry := range entries {
+		children := entry.Children
+		entry.Children = nil
+
+		result = append(result, entry)
+		result = append(result, flattenDescendants(children)...)
+	}
+
+	return result
+}
+
+/* Handle a retrieve person descendants request
+
+   The function will extract the person id from the request URI (specifyPersonUri), the traversal
+   depth and the response shape from the request query (descendantsQuery), and the pagination
+   parameters (used by the list shape only) from the request query as well (paginationQuery) */
+func retrievePersonDescendants(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	var params specifyPersonUri
+
+	if err := c.ShouldBindUri(&params); err != nil {
+		log.Infof("Uri parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": uriErrorMsg})
+		return
+	}
+
+	var query descendantsQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Infof("Query parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": queryErrorMsg})
+		return
+	}
+
+	var pagQuery paginationQuery
+
+	if err := c.ShouldBindQuery(&pagQuery); err != nil {
+		log.Infof("Pagination query parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": queryErrorMsg})
+		return
+	}
+
+	if query.Depth == 0 {
+		query.Depth = defaultDescendantsDepth
+	}
+
+	if query.Shape == "" {
+		query.Shape = shapeTree
+	}
+
+	var result descendantsResult
+	var found bool
+
+	// The traversal must see a consistent state of the relations:
+	err := getStore(c).view(func(tx Store) error {
+		var err error
+
+		result, found, err = queryDescendants(tx, params.Pid, query.Depth)
+
+		return err
+	})
+
+	if !found && err == nil {
+		log.Infof("The person with given id (%s) doesn't exist", params.Pid)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown person id"})
+		return
+	} else if err != nil {
+		log.Errorf("An error occurred during the descendants retrieval attempt (%s)", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	}
+
+	c.Header("Access-Control-Allow-Origin", "*")
+
+	if query.Shape == shapeTree {
+		c.JSON(http.StatusOK, gin.H{
+			"person":      result.Person,
+			"depth":       query.Depth,
+			"descendants": result.Descendants,
+			"truncated":   result.Truncated,
+		})
+
+		log.Infof("Found %d descendant entries of the requested person (%s)",
+			result.Count, params.Pid)
+		return
+	}
+
+	entries := flattenDescendants(result.Descendants)
+	pagData := pagQuery.toPaginationData()
+
+	first := minInt(pagData.PageIdx*pagData.PageSize, len(entries))
+	last := minInt((pagData.PageIdx+1)*pagData.PageSize, len(entries))
+
+	pagData.TotalCnt = len(entries)
+
+	reqUrl := location.Get(c)
+	reqUrl.Path = fmt.Sprintf("/people/%s/descendants", params.Pid)
+	reqUrl.RawQuery = url.Values{
+		"depth": {strconv.Itoa(query.Depth)}, "shape": {shapeList}}.Encode()
+
+	c.JSON(http.StatusOK, gin.H{
+		"person":     result.Person,
+		"depth":      query.Depth,
+		"pagination": pagData.getJson(*reqUrl),
+		"records":    entries[first:last],
+		"truncated":  result.Truncated,
+	})
+
+	log.Infof("Found %d descendant entries of the requested person (%s)", len(entries), params.Pid)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testDescendantJson struct {
+	Person     testPersonJson       `json:"person"`
+	Generation int                  `json:"generation"`
+	Daboville  string               `json:"daboville"`
+	SameAs     string               `json:"same_as"`
+	Children   []testDescendantJson `json:"children"`
+}
+
+type testDescendantsJson struct {
+	Person      testPersonJson       `json:"person"`
+	Depth       int                  `json:"depth"`
+	Descendants []testDescendantJson `json:"descendants"`
+	Pagination  testPaginationJson   `json:"pagination"`
+	Records     []testDescendantJson `json:"records"`
+	Truncated   bool                 `json:"truncated"`
+}
+
+func testDescendantsRes(t *testing.T, res *httptest.ResponseRecorder) testDescendantsJson {
+	payload := testDescendantsJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+/* Create a store with a clan of 16 descendant entries (X is reached through two lines)
+
+   R -> C1 -> G1 .. G10, G1 -> X
+     -> C2 -> H1 -> X
+     -> C3 */
+func testClanStore() *memoryStore {
+	people := map[string]personRecord{
+		"R":  {"R", "Jan", "Kowalski", gMale, 1},
+		"C1": {"C1", "Adam", "Kowalski", gMale, 1},
+		"C2": {"C2", "Ewa", "Kowalska", gFemale, 1},
+		"C3": {"C3", "Piotr", "Kowalski", gMale, 1},
+		"H1": {"H1", "Anna", "Nowak", gFemale, 1},
+		"X":  {"X", "Zofia", "Kowalska", gFemale, 1},
+	}
+
+	relations := map[int64]relationRecord{
+		1:  {1, "R", "C1", relFather, 1},
+		2:  {2, "R", "C2", relFather, 1},
+		3:  {3, "R", "C3", relFather, 1},
+		20: {20, "C2", "H1", relMother, 1},
+		30: {30, "G1", "X", relFather, 1},
+		31: {31, "H1", "X", relMother, 1},
+	}
+
+	for idx := 1; idx <= 10; idx++ {
+		pid := fmt.Sprintf("G%d", idx)
+		people[pid] = personRecord{pid, "", "Kowalski", gMale, 1}
+		relations[int64(9+idx)] = relationRecord{int64(9 + idx), "C1", pid, relFather, 1}
+	}
+
+	return newMemoryStore(people, relations)
+}
+
+/* Test the descendants traversal
+
+   1. Tree shape (default)
+   2. Tree shape with limited depth
+   3. List shape (paginated)
+   4. Invalid shape
+   5. Unknown person */
+func TestRetrievePersonDescendants(t *testing.T) {
+	router := setupRouter(testClanStore())
+
+	// Case 1: Tree shape
+
+	res := testMakeRequest(router, "GET", "/people/R/descendants", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	payload := testDescendantsRes(t, res)
+
+	assert.Equal(t, testPersonJson{"R", "Jan", "Kowalski", gMale}, payload.Person)
+	assert.Equal(t, defaultDescendantsDepth, payload.Depth)
+	assert.False(t, payload.Truncated)
+	require.Len(t, payload.Descendants, 3)
+
+	c1 := payload.Descendants[0]
+
+	assert.Equal(t, "C1", c1.Person.Id)
+	assert.Equal(t, "1.1", c1.Daboville)
+	assert.Equal(t, 1, c1.Generation)
+	require.Len(t, c1.Children, 10)
+	assert.Equal(t, "1.1.10", c1.Children[9].Daboville)
+	assert.Equal(t, []testDescendantJson{
+		{testPersonJson{"X", "Zofia", "Kowalska", gFemale}, 3, "1.1.1.1", "", nil},
+	}, c1.Children[0].Children)
+	assert.Equal(t, []testDescendantJson{
+		{testPersonJson{"X", "Zofia", "Kowalska", gFemale}, 3, "1.2.1.1", "1.1.1.1", nil},
+	}, payload.Descendants[1].Children[0].Children)
+	assert.Equal(t, "1.3", payload.Descendants[2].Daboville)
+	assert.Empty(t, payload.Descendants[2].Children)
+
+	// Case 2: Limited depth
+
+	res = testMakeRequest(router, "GET", "/people/R/descendants?depth=2", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	payload = testDescendantsRes(t, res)
+
+	assert.Len(t, payload.Descendants[0].Children, 10)
+	assert.Empty(t, payload.Descendants[0].Children[0].Children)
+
+	// Case 3: List shape
+
+	res = testMakeRequest(router, "GET", "/people/R/descendants?shape=list&limit=10", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	payload = testDescendantsRes(t, res)
+
+	assert.Empty(t, payload.Descendants)
+	require.Len(t, payload.Records, 10)
+	assert.Equal(t, "1.1", payload.Records[0].Daboville)
+	assert.Equal(t, "1.1.1.1", payload.Records[2].Daboville)
+	assert.Empty(t, payload.Records[0].Children)
+	assert.Empty(t, payload.Pagination.PrevUrl)
+	assert.Equal(t, "http://example.com/people/R/descendants?depth=5&limit=10&page=1&shape=list",
+		payload.Pagination.NextUrl)
+
+	res = testMakeRequest(router, "GET", payload.Pagination.NextUrl, nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	payload = testDescendantsRes(t, res)
+
+	numbers := []string{}
+
+	for _, r := range payload.Records {
+		numbers = append(numbers, r.Daboville+"="+r.Person.Id+"/"+r.SameAs)
+	}
+
+	assert.Equal(t, []string{
+		"1.1.9=G9/", "1.1.10=G10/", "1.2=C2/", "1.2.1=H1/", "1.2.1.1=X/1.1.1.1", "1.3=C3/"}, numbers)
+	assert.Empty(t, payload.Pagination.NextUrl)
+
+	// Case 4: Invalid shape
+
+	res = testMakeRequest(router, "GET", "/people/R/descendants?shape=graph", nil)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, queryErrorMsg, testErrorRes(t, res).Message)
+
+	// Case 5: Unknown person
+
+	res = testMakeRequest(router, "GET", "/people/P9/descendants", nil)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, "Unknown person id", testErrorRes(t, res).Message)
+}
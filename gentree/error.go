@@ -19,6 +19,8 @@ const (
 	uriErrorMsg = "URI validation error"
 	// At least one query parameters was invalid
 	queryErrorMsg = "Query validation error"
+	// The If-Match header didn't match the current record revision
+	preconditionErrorMsg = "Record revision mismatch"
 )
 
 // Error codes to be used with the AppError structure:
@@ -29,6 +31,12 @@ const (
 	errIdGenerationFailed
 	// Function arguments are invalid (e.g. out of bounds)
 	errInvalidArgument
+	// The record to be modified doesn't exist
+	errRecordNotFound
+	// The record revision doesn't match the revision expected by the client (see etag.go)
+	errRevisionMismatch
+	// The operation conflicts with the current state of the data (e.g. trash item restoration)
+	errConflict
 )
 
 type AppError struct {
@@ -39,3 +47,10 @@ type AppError struct {
 func (e AppError) Error() string {
 	return fmt.Sprintf("%s#%d: %s", appCode, e.Code, e.msg)
 }
+
+/* Check if the error is an application error with the given code */
+func isAppError(err error, code int) bool {
+	appErr, ok := err.(AppError)
+
+	return ok && appErr.Code == code
+}
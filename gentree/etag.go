@@ -0,0 +1,52 @@
+package main
+
+/* This file defines the functions mapping the record revisions to HTTP entity tags
+
+   The entity tag of a record is its revision number (e.g. "3"). The clients send it back in the
+   If-Match header of the modification requests to make sure they don't overwrite a revision they
+   haven't seen (optimistic concurrency control). */
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+/* Compose the entity tag of the given record revision
+
+   Return:
+   * quoted, strong entity tag */
+func makeETag(rev int64) string {
+	return fmt.Sprintf("\"%d\"", rev)
+}
+
+/* Check the record revision against the If-Match header of the request
+
+   The check passes if the header is missing, if it is "*", or if it lists the entity tag of the
+   revision. Weak entity tags never match (If-Match requires the strong comparison).
+
+   Params:
+   * c - gin context
+   * rev - the current revision of the record to be modified
+
+   Return:
+   * error (AppError with the errRevisionMismatch code if the check failed and nil otherwise) */
+func checkIfMatch(c *gin.Context, rev int64) error {
+	header := c.GetHeader("If-Match")
+
+	if header == "" {
+		return nil
+	}
+
+	etag := makeETag(rev)
+
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == etag {
+			return nil
+		}
+	}
+
+	return AppError{
+		errRevisionMismatch,
+		fmt.Sprintf("The If-Match header (%s) doesn't match the revision (%s)", header, etag)}
+}
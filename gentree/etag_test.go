@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+/* Test the If-Match header check
+
+   1. Missing header
+   2. Matching headers (single tag, tag list, wildcard)
+   3. Not matching headers (other tag, weak tag, unquoted tag) */
+func TestCheckIfMatch(t *testing.T) {
+	testCheck := func(header string) error {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("PUT", "/people/P1", nil)
+
+		if header != "" {
+			c.Request.Header.Set("If-Match", header)
+		}
+
+		return checkIfMatch(c, 3)
+	}
+
+	// Case 1: Missing header
+
+	assert.Nil(t, testCheck(""))
+
+	// Case 2: Matching headers
+
+	assert.Nil(t, testCheck(`"3"`))
+	assert.Nil(t, testCheck(`"1", "3"`))
+	assert.Nil(t, testCheck(`"1","3"`))
+	assert.Nil(t, testCheck("*"))
+
+	// Case 3: Not matching headers
+
+	for _, header := range []string{`"4"`, `W/"3"`, "3", `"1", "2"`} {
+		err := testCheck(header)
+
+		assert.True(t, isAppError(err, errRevisionMismatch), header)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+/* This file defines the cache of the family data used by the traversals of the family tree (see
+   ancestors.go, descendants.go, kinship.go and connection.go) */
+
+import (
+	"sort"
+)
+
+/* Cache of the people, their parents, children and spouses retrieved during a traversal
+
+   The cache must be used only within a single call of the store view or update method */
+type familyCache struct {
+	tx     Store
+	people map[string]personRecord
+	// The father and the mother relations of the people (uninitialized if the parent isn't known)
+	parents  map[string][2]relationRecord
+	children map[string][]string
+	// The husband relations of the people
+	spouses map[string][]relationRecord
+	// All the relations of the people (of any type, in both directions)
+	relations map[string][]relationRecord
+}
+
+func newFamilyCache(tx Store) *familyCache {
+	return &familyCache{
+		tx, map[string]personRecord{}, map[string][2]relationRecord{}, map[string][]string{},
+		map[string][]relationRecord{}, map[string][]relationRecord{}}
+}
+
+/* Retrieve a person record (see Store.getPerson) */
+func (fc *familyCache) getPerson(pid string) (personRecord, bool, error) {
+	if person, found := fc.people[pid]; found {
+		return person, true, nil
+	}
+
+	person, found, err := fc.tx.getPerson(pid)
+
+	if found && err == nil {
+		fc.people[pid] = person
+	}
+
+	return person, found, err
+}
+
+/* Retrieve the father and mother relations of a person
+
+   Return:
+   * the father and mother relations (uninitialized if the parent is not known)
+   * error (if occurred and nil otherwise) */
+func (fc *familyCache) getParentRelations(pid string) ([2]relationRecord, error) {
+	if parents, found := fc.parents[pid]; found {
+		return parents, nil
+	}
+
+	var parents [2]relationRecord
+
+	for idx, typ := range []string{relFather, relMother} {
+		relations, err := fc.tx.queryRelationsByData("", typ, pid)
+		if err != nil {
+			return parents, err
+		}
+
+		// The relation validation doesn't allow more than one parent of each type:
+		if len(relations) > 0 {
+			parents[idx] = relations[0]
+		}
+	}
+
+	fc.parents[pid] = parents
+
+	return parents, nil
+}
+
+/* Retrieve the ids of the parents of a person
+
+   Return:
+   * the father and mother ids (an empty string if the parent is not known)
+   * error (if occurred and nil otherwise) */
+func (fc *familyCache) getParents(pid string) ([2]string, error) {
+	relations, err := fc.getParentRelations(pid)
+
+	return [2]string{relations[0].Pid1, relations[1].Pid1}, err
+}
+
+/* Retrieve the ids of the children of a person
+
+   The children are ordered by the ids of the father and mother relations (the order in which the
+   relations were recorded, unless the relation ids were assigned by an import)
+
+   Return:
+   * the children ids (empty if the person has no children)
+   * error (if occurred and nil otherwise) */
+func (fc *familyCache) getChildren(pid string) ([]string, error) {
+	if children, found := fc.children[pid]; found {
+		return children, nil
+	}
+
+	relations := []relationRecord{}
+
+	for _, typ := range []string{relFather, relMother} {
+		found, err := fc.tx.queryRelationsByData(pid, typ, "")
+		if err != nil {
+			return nil, err
+		}
+
+		relations = append(relations, found...)
+	}
+
+	sort.Slice(relations, func(i, j int) bool { return relations[i].Id < relations[j].Id })
+
+	children := make([]string, 0, len(relations))
+
+	for _, r := range relations {
+		children = append(children, r.Pid2)
+	}
+
+	fc.children[pid] = children
+
+	return children, nil
+}
+
+/* Retrieve the husband relations of a person (both the ones of a husband and of a wife)
+
+   Return:
+   * the relations ordered by id (empty if the person has no spouses)
+   * error (if occurred and nil otherwise) */
+func (fc *familyCache) getSpouseRelations(pid string) ([]relationRecord, error) {
+	if spouses, found := fc.spouses[pid]; found {
+		return spouses, nil
+	}
+
+	husbands, err := fc.tx.queryRelationsByData("", relHusband, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	wives, err := fc.tx.queryRelationsByData(pid, relHusband, "")
+	if err != nil {
+		return nil, err
+	}
+
+	spouses := append(husbands, wives...)
+
+	sort.Slice(spouses, func(i, j int) bool { return spouses[i].Id < spouses[j].Id })
+
+	fc.spouses[pid] = spouses
+
+	return spouses, nil
+}
+
+/* Retrieve all the relations of a person (of any type, both the ones in which the person is the
+   first and the second one)
+
+   Return:
+   * the relations ordered by id (empty if the person has no relations)
+   * error (if occurred and nil otherwise) */
+func (fc *familyCache) getRelations(pid string) ([]relationRecord, error) {
+	if relations, found := fc.relations[pid]; found {
+		return relations, nil
+	}
+
+	first, err := fc.tx.queryRelationsByData(pid, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	second, err := fc.tx.queryRelationsByData("", "", pid)
+	if err != nil {
+		return nil, err
+	}
+
+	relations := append(first, second...)
+
+	sort.Slice(relations, func(i, j int) bool { return relations[i].Id < relations[j].Id })
+
+	fc.relations[pid] = relations
+
+	return relations, nil
+}
@@ -0,0 +1,322 @@
+package main
+
+/* This file defines the GEDCOM line structure shared by the GEDCOM import and export
+
+   The GEDCOM file is a sequence of lines, each one consisting of a level number, an optional
+   cross-reference identifier, a tag and an optional value. The lines of a higher level following
+   a line are its substructures.
+
+   Two dialects are supported: GEDCOM 5.5.1 and GEDCOM 7. They differ mostly in the value encoding
+   (e.g. GEDCOM 7 has no CONC lines and escapes only the leading '@' character of a value). */
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Supported GEDCOM versions (the dialects)
+const (
+	gedcomVersion551 = "5.5.1"
+	gedcomVersion7   = "7.0"
+)
+
+// GEDCOM 7 pointer standing for a missing record
+const gedcomVoidPointer = "@VOID@"
+
+/* Single GEDCOM line together with its substructures
+
+   The CONC and CONT substructures are not kept; their values are joined with the parent value
+   instead. The JSON encoding of the line is used to store the preserved extension structures (see
+   gedcomExtension). */
+type gedcomLine struct {
+	Level int `json:"level"`
+	// Cross-reference identifier including the '@' delimiters (empty if not specified)
+	Xref     string        `json:"xref,omitempty"`
+	Tag      string        `json:"tag"`
+	Value    string        `json:"value,omitempty"`
+	Children []*gedcomLine `json:"children,omitempty"`
+	// Number of the line in the file (starting from 1)
+	LineNo int `json:"-"`
+}
+
+/* Find the first substructure with the given tag
+
+   Return:
+   * the substructure (nil if not found) */
+func (l *gedcomLine) child(tag string) *gedcomLine {
+	for _, c := range l.Children {
+		if c.Tag == tag {
+			return c
+		}
+	}
+
+	return nil
+}
+
+/* Check if the line value is a pointer to a record (e.g. @I1@) */
+func isGedcomPointer(value string) bool {
+	return len(value) > 2 && strings.HasPrefix(value, "@") && strings.HasSuffix(value, "@") &&
+		!strings.HasPrefix(value, "@#")
+}
+
+/* Determine the GEDCOM version of a file given its records
+
+   The version is taken from the header (HEAD.GEDC.VERS). The files without the version are
+   treated as GEDCOM 5.5.1 ones.
+
+   Return:
+   * one of the gedcomVersionXxx constants */
+func gedcomVersion(records []*gedcomLine) string {
+	if len(records) == 0 || records[0].Tag != "HEAD" {
+		return gedcomVersion551
+	}
+
+	if gedc := records[0].child("GEDC"); gedc != nil {
+		if vers := gedc.child("VERS"); vers != nil && strings.HasPrefix(vers.Value, "7") {
+			return gedcomVersion7
+		}
+	}
+
+	return gedcomVersion551
+}
+
+/* Parse a GEDCOM file
+
+   The function accepts all the line terminators allowed by the standard (CR, LF, CR LF and
+   LF CR) and skips the leading white space of the lines, as many programs indent the lines with
+   the level. The UTF-8 byte order mark is skipped. The UTF-16 encoded files are not supported.
+   The values are decoded according to the character set of the file (see decodeGedcom). The
+   escaped '@' characters are decoded according to the file version (see gedcomVersion).
+
+   Return:
+   * the level 0 records (nil if an error occurred)
+   * error (AppError with the errInvalidArgument code if the file is malformed, other error if
+     occurred, and nil otherwise) */
+func parseGedcom(r io.Reader) ([]*gedcomLine, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, []byte{0xfe, 0xff}) || bytes.HasPrefix(data, []byte{0xff, 0xfe}) {
+		return nil, AppError{errInvalidArgument, "UTF-16 encoded GEDCOM files are not supported"}
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	text := strings.NewReplacer("\r\n", "\n", "\n\r", "\n", "\r", "\n").Replace(string(data))
+
+	records := []*gedcomLine{}
+	// The last line of every level up to the current one:
+	stack := []*gedcomLine{}
+
+	for idx, raw := range strings.Split(text, "\n") {
+		lineNo := idx + 1
+		raw = strings.TrimLeft(raw, " \t")
+
+		if raw == "" {
+			continue
+		}
+
+		line, err := parseGedcomLine(raw, lineNo)
+		if err != nil {
+			return nil, err
+		}
+
+		if line.Level > len(stack) {
+			return nil, AppError{
+				errInvalidArgument,
+				fmt.Sprintf("Unexpected GEDCOM line level (%d) at line %d", line.Level, lineNo)}
+		}
+
+		if line.Level == 0 {
+			records = append(records, line)
+			stack = []*gedcomLine{line}
+			continue
+		}
+
+		parent := stack[line.Level-1]
+
+		switch line.Tag {
+		case "CONC":
+			parent.Value += line.Value
+			continue
+		case "CONT":
+			parent.Value += "\n" + line.Value
+			continue
+		}
+
+		parent.Children = append(parent.Children, line)
+		stack = append(stack[:line.Level], line)
+	}
+
+	if err := decodeGedcom(records); err != nil {
+		return nil, err
+	}
+
+	unescapeGedcom(records, gedcomVersion(records))
+
+	return records, nil
+}
+
+/* Decode the escaped '@' characters of the line values (the pointers are left intact)
+
+   GEDCOM 5.5.1 doubles every '@' character of a value, while GEDCOM 7 doubles only the leading
+   one of every (CONT joined) value line */
+func unescapeGedcom(lines []*gedcomLine, version string) {
+	for _, line := range lines {
+		if !isGedcomPointer(line.Value) {
+			if version == gedcomVersion7 {
+				texts := strings.Split(line.Value, "\n")
+
+				for idx, text := range texts {
+					if strings.HasPrefix(text, "@@") {
+						texts[idx] = text[1:]
+					}
+				}
+
+				line.Value = strings.Join(texts, "\n")
+			} else {
+				line.Value = strings.ReplaceAll(line.Value, "@@", "@")
+			}
+		}
+
+		unescapeGedcom(line.Children, version)
+	}
+}
+
+/* Parse a single, non-empty GEDCOM line (without the terminator and the leading white space) */
+func parseGedcomLine(raw string, lineNo int) (*gedcomLine, error) {
+	malformed := AppError{errInvalidArgument, fmt.Sprintf("Malformed GEDCOM line %d", lineNo)}
+
+	levelStr, rest, _ := strings.Cut(raw, " ")
+
+	level, err := strconv.Atoi(levelStr)
+	if err != nil || level < 0 || rest == "" {
+		return nil, malformed
+	}
+
+	line := &gedcomLine{Level: level, LineNo: lineNo}
+
+	if strings.HasPrefix(rest, "@") {
+		line.Xref, rest, _ = strings.Cut(rest, " ")
+
+		if !isGedcomPointer(line.Xref) {
+			return nil, malformed
+		}
+	}
+
+	line.Tag, line.Value, _ = strings.Cut(rest, " ")
+
+	if line.Tag == "" {
+		return nil, malformed
+	}
+
+	return line, nil
+}
+
+// Maximum number of the value bytes written in a single GEDCOM line (the rest is written in the
+// CONC lines)
+const gedcomMaxValueLen = 200
+
+/* Writer of the GEDCOM lines
+
+   The first write error is kept (see the err field); the following writes are skipped. */
+type gedcomWriter struct {
+	out io.Writer
+	// One of the gedcomVersionXxx constants
+	version string
+	err     error
+}
+
+/* Write a GEDCOM line together with the CONT and CONC lines needed for a multiline or a long
+   value (GEDCOM 7 has no line length limit, so only the CONT lines are written in its case)
+
+   Params:
+   * level - the line level
+   * xref - the cross-reference identifier including the '@' delimiters (or an empty string)
+   * tag - the line tag
+   * value - the line value (a pointer or a text; the '@' characters of a text are escaped) */
+func (w *gedcomWriter) line(level int, xref string, tag string, value string) {
+	if isGedcomPointer(value) {
+		w.write(level, xref, tag, value)
+		return
+	}
+
+	if w.version == gedcomVersion7 {
+		for idx, text := range strings.Split(value, "\n") {
+			if strings.HasPrefix(text, "@") {
+				text = "@" + text
+			}
+
+			if idx == 0 {
+				w.write(level, xref, tag, text)
+			} else {
+				w.write(level+1, "", "CONT", text)
+			}
+		}
+
+		return
+	}
+
+	for idx, text := range strings.Split(strings.ReplaceAll(value, "@", "@@"), "\n") {
+		chunk, rest := splitGedcomValue(text)
+
+		if idx == 0 {
+			w.write(level, xref, tag, chunk)
+		} else {
+			w.write(level+1, "", "CONT", chunk)
+		}
+
+		for rest != "" {
+			chunk, rest = splitGedcomValue(rest)
+			w.write(level+1, "", "CONC", chunk)
+		}
+	}
+}
+
+/* Write a single GEDCOM line */
+func (w *gedcomWriter) write(level int, xref string, tag string, value string) {
+	if w.err != nil {
+		return
+	}
+
+	line := strconv.Itoa(level)
+
+	if xref != "" {
+		line += " " + xref
+	}
+
+	line += " " + tag
+
+	if value != "" {
+		line += " " + value
+	}
+
+	_, w.err = io.WriteString(w.out, line+"\n")
+}
+
+/* Split the (escaped) value into the part fitting a single line and the rest
+
+   The value is split neither inside a UTF-8 sequence nor inside an escaped '@' character */
+func splitGedcomValue(value string) (string, string) {
+	if len(value) <= gedcomMaxValueLen {
+		return value, ""
+	}
+
+	end := gedcomMaxValueLen
+
+	for !utf8.RuneStart(value[end]) {
+		end--
+	}
+
+	if ats := len(value[:end]) - len(strings.TrimRight(value[:end], "@")); ats%2 == 1 {
+		end--
+	}
+
+	return value[:end], value[end:]
+}
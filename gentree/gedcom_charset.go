@@ -0,0 +1,136 @@
+package main
+
+/* This file defines the decoding of the GEDCOM character sets
+
+   The GEDCOM 5.5.1 files specify their character set in the header (HEAD.CHAR). Besides UTF-8 and
+   ASCII, the ANSEL (ANSI Z39.47, the default character set of the older GEDCOM versions) and ANSI
+   (Windows-1252) files are accepted; their line values are decoded into UTF-8 by the parser. The
+   ANSEL combining diacritical marks precede the base characters (unlike the Unicode ones), so
+   they are moved after them and the result is normalized (e.g. 0xE2 0x61 becomes 'á'). The
+   GEDCOM 7 files are always encoded using UTF-8. */
+
+import (
+	"fmt"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+)
+
+// Supported character sets (the HEAD.CHAR values)
+const (
+	gedcomCharsetUtf8  = "UTF-8"
+	gedcomCharsetAscii = "ASCII"
+	gedcomCharsetAnsel = "ANSEL"
+	gedcomCharsetAnsi  = "ANSI"
+)
+
+// Unicode counterparts of the ANSEL spacing characters (outside of the ASCII range)
+var anselCharacters = map[byte]rune{
+	0xA1: 'Ł', 0xA2: 'Ø', 0xA3: 'Đ', 0xA4: 'Þ', 0xA5: 'Æ', 0xA6: 'Œ', 0xA7: 'ʹ', 0xA8: '·',
+	0xA9: '♭', 0xAA: '®', 0xAB: '±', 0xAC: 'Ơ', 0xAD: 'Ư', 0xAE: 'ʼ', 0xB0: 'ʻ', 0xB1: 'ł',
+	0xB2: 'ø', 0xB3: 'đ', 0xB4: 'þ', 0xB5: 'æ', 0xB6: 'œ', 0xB7: 'ʺ', 0xB8: 'ı', 0xB9: '£',
+	0xBA: 'ð', 0xBC: 'ơ', 0xBD: 'ư', 0xBE: '□', 0xBF: '■', 0xC0: '°', 0xC1: 'ℓ', 0xC2: '℗',
+	0xC3: '©', 0xC4: '♯', 0xC5: '¿', 0xC6: '¡', 0xC7: 'ß', 0xC8: '€', 0xCF: 'ß',
+}
+
+// Unicode counterparts of the ANSEL combining diacritical marks
+var anselCombiningMarks = map[byte]rune{
+	0xE0: '\u0309', 0xE1: '\u0300', 0xE2: '\u0301', 0xE3: '\u0302', 0xE4: '\u0303',
+	0xE5: '\u0304', 0xE6: '\u0306', 0xE7: '\u0307', 0xE8: '\u0308', 0xE9: '\u030C',
+	0xEA: '\u030A', 0xEB: '\uFE20', 0xEC: '\uFE21', 0xED: '\u0315', 0xEE: '\u030B',
+	0xEF: '\u0310', 0xF0: '\u0327', 0xF1: '\u0328', 0xF2: '\u0323', 0xF3: '\u0324',
+	0xF4: '\u0325', 0xF5: '\u0333', 0xF6: '\u0332', 0xF7: '\u0326', 0xF8: '\u031C',
+	0xF9: '\u032E', 0xFA: '\uFE22', 0xFB: '\uFE23', 0xFE: '\u0313',
+}
+
+/* Determine the character set of a file given its records
+
+   Return:
+   * the character set (upper case; UTF-8 if the header doesn't specify it) */
+func gedcomCharset(records []*gedcomLine) string {
+	if len(records) == 0 || records[0].Tag != "HEAD" {
+		return gedcomCharsetUtf8
+	}
+
+	if char := records[0].child("CHAR"); char != nil {
+		return strings.ToUpper(strings.TrimSpace(char.Value))
+	}
+
+	return gedcomCharsetUtf8
+}
+
+/* Decode an ANSEL encoded string (the undefined characters are replaced with U+FFFD) */
+func decodeAnsel(text string) string {
+	var result strings.Builder
+	// The combining marks waiting for their base character:
+	marks := []rune{}
+
+	for idx := 0; idx < len(text); idx++ {
+		b := text[idx]
+
+		if mark, found := anselCombiningMarks[b]; found {
+			marks = append(marks, mark)
+			continue
+		}
+
+		if b < 0x80 {
+			result.WriteByte(b)
+		} else if char, found := anselCharacters[b]; found {
+			result.WriteRune(char)
+		} else {
+			result.WriteRune('\uFFFD')
+		}
+
+		for _, mark := range marks {
+			result.WriteRune(mark)
+		}
+
+		marks = marks[:0]
+	}
+
+	for _, mark := range marks {
+		result.WriteRune(mark)
+	}
+
+	return norm.NFC.String(result.String())
+}
+
+/* Decode the line values of the records according to the file character set (see gedcomCharset)
+
+   Return:
+   * error (AppError with the errInvalidArgument code if the character set is not supported, and
+     nil otherwise) */
+func decodeGedcom(records []*gedcomLine) error {
+	var decode func(string) string
+
+	switch charset := gedcomCharset(records); charset {
+	case gedcomCharsetUtf8, gedcomCharsetAscii:
+		return nil
+	case gedcomCharsetAnsel:
+		decode = decodeAnsel
+	case gedcomCharsetAnsi:
+		decoder := charmap.Windows1252.NewDecoder()
+
+		decode = func(text string) string {
+			// The Windows-1252 decoder never fails (the undefined characters are replaced)
+			decoded, _ := decoder.String(text)
+			return decoded
+		}
+	default:
+		return AppError{
+			errInvalidArgument, fmt.Sprintf("The %s character set is not supported", charset)}
+	}
+
+	var decodeLines func(lines []*gedcomLine)
+
+	decodeLines = func(lines []*gedcomLine) {
+		for _, line := range lines {
+			line.Value = decode(line.Value)
+			decodeLines(line.Children)
+		}
+	}
+
+	decodeLines(records)
+
+	return nil
+}
@@ -0,0 +1,446 @@
+package main
+
+/* This file defines the GEDCOM 5.5.1 and GEDCOM 7 export
+
+   The people are written as the individual (INDI) records using their ids as the
+   cross-reference identifiers. The ids not allowed as the identifiers (GEDCOM 7 allows only the
+   upper case letters, the digits and the '_' character, and GEDCOM 5.5.1 at most 20 characters)
+   are written as the external identifiers instead (see gedcomPersonIdType). The relations are
+   written as the family (FAM) records:
+   * Every husband relation makes a family of the couple, which contains all the children having
+     both the husband as the father and the wife as the mother
+   * The remaining children of a person make a single-parent family of the person
+
+   The GEDCOM import creates the same relations out of such families (see convertGedcom). The
+   preserved GEDCOM extensions of the people are written back to their individual records. */
+
+import (
+	"archive/zip"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Cross-reference identifier of the submitter record required by the standard (the identifiers
+// containing the '_' character never collide with the person ids)
+const gedcomSubmitterXref = "@U_1@"
+
+// Type of the external identifiers holding the person ids (the GEDCOM 7 EXID structures and the
+// GEDCOM 5.5.1 gedcom551PersonIdTag extensions)
+const gedcomPersonIdType = "https://github.com/dariusz-walczak/owl_gentree/person-id"
+
+// Tag of the GEDCOM 5.5.1 extension holding the person id (no external identifiers in 5.5.1; the
+// common _UID extension holds the GUIDs of the other applications, so it isn't used)
+const gedcom551PersonIdTag = "_GENTREE_ID"
+
+// Maximum length of the GEDCOM 5.5.1 cross-reference identifiers (without the '@' delimiters)
+const gedcom551MaxXrefLen = 20
+
+// Pattern of the person ids usable as the GEDCOM 7 cross-reference identifiers
+var gedcom7XrefPattern = regexp.MustCompile(`^[A-Z0-9]+$`)
+
+/* Family written as a FAM record */
+type gedcomFamily struct {
+	Xref     string
+	Husband  string
+	Wife     string
+	Children []string
+}
+
+/* Make the GEDCOM cross-reference identifiers of the people
+
+   The person ids too long for GEDCOM 5.5.1 (see gedcom551MaxXrefLen) or, in the GEDCOM 7 case,
+   not matching the gedcom7XrefPattern (and the one colliding with the void pointer) are replaced
+   with the generated identifiers (the '_' character makes them distinct from the person ids).
+
+   Params:
+   * people - the exported people
+   * version - one of the gedcomVersionXxx constants
+
+   Return:
+   * the cross-reference identifiers (including the '@' delimiters) keyed by the person ids */
+func gedcomPersonXrefs(people []fullPersonPayload, version string) map[string]string {
+	xrefs := make(map[string]string, len(people))
+	cnt := 0
+
+	for _, person := range people {
+		xref := "@" + person.Id + "@"
+
+		if (version == gedcomVersion7 &&
+			(!gedcom7XrefPattern.MatchString(person.Id) || xref == gedcomVoidPointer)) ||
+			(version == gedcomVersion551 && len(person.Id) > gedcom551MaxXrefLen) {
+			cnt++
+			xref = fmt.Sprintf("@I_%d@", cnt)
+		}
+
+		xrefs[person.Id] = xref
+	}
+
+	return xrefs
+}
+
+/* Map a person gender onto a GEDCOM sex value */
+func gedcomSex(gender string) string {
+	switch gender {
+	case gMale:
+		return "M"
+	case gFemale:
+		return "F"
+	}
+
+	return "U"
+}
+
+/* Group the relations into families
+
+   Return:
+   * the families (the couples first, in the husband relation order, followed by the single-parent
+     families, in the parent id order) */
+func groupGedcomFamilies(relations []relationPayload) []*gedcomFamily {
+	fathers := map[string]string{}
+	mothers := map[string]string{}
+	children := []string{}
+
+	families := []*gedcomFamily{}
+	couples := map[[2]string]*gedcomFamily{}
+
+	for _, r := range relations {
+		switch r.Type {
+		case relHusband:
+			if _, found := couples[[2]string{r.Pid1, r.Pid2}]; !found {
+				family := &gedcomFamily{Husband: r.Pid1, Wife: r.Pid2}
+				couples[[2]string{r.Pid1, r.Pid2}] = family
+				families = append(families, family)
+			}
+		case relFather, relMother:
+			if fathers[r.Pid2] == "" && mothers[r.Pid2] == "" {
+				children = append(children, r.Pid2)
+			}
+
+			if r.Type == relFather {
+				fathers[r.Pid2] = r.Pid1
+			} else {
+				mothers[r.Pid2] = r.Pid1
+			}
+		}
+	}
+
+	singles := map[string]*gedcomFamily{}
+
+	single := func(parent string, male bool) *gedcomFamily {
+		if _, found := singles[parent]; !found {
+			singles[parent] = &gedcomFamily{}
+
+			if male {
+				singles[parent].Husband = parent
+			} else {
+				singles[parent].Wife = parent
+			}
+		}
+
+		return singles[parent]
+	}
+
+	for _, child := range children {
+		father, mother := fathers[child], mothers[child]
+
+		if family, found := couples[[2]string{father, mother}]; found {
+			family.Children = append(family.Children, child)
+			continue
+		}
+
+		if father != "" {
+			family := single(father, true)
+			family.Children = append(family.Children, child)
+		}
+
+		if mother != "" {
+			family := single(mother, false)
+			family.Children = append(family.Children, child)
+		}
+	}
+
+	parents := make([]string, 0, len(singles))
+
+	for parent := range singles {
+		parents = append(parents, parent)
+	}
+
+	sort.Strings(parents)
+
+	for _, parent := range parents {
+		families = append(families, singles[parent])
+	}
+
+	for idx, family := range families {
+		// The '_' character makes the identifiers distinct from the person ones:
+		family.Xref = fmt.Sprintf("@F_%d@", idx+1)
+		sort.Strings(family.Children)
+	}
+
+	return families
+}
+
+/* Write a GEDCOM structure (extension) together with all its substructures
+
+   Params:
+   * w - the writer
+   * level - the structure level
+   * line - the structure (its own level is ignored) */
+func writeGedcomStructure(w *gedcomWriter, level int, line *gedcomLine) {
+	w.line(level, "", line.Tag, line.Value)
+
+	for _, child := range line.Children {
+		writeGedcomStructure(w, level+1, child)
+	}
+}
+
+/* Write the GEDCOM file header
+
+   The GEDCOM 7 header defines the extension tags having a known URI (HEAD.SCHMA) */
+func writeGedcomHeader(w *gedcomWriter, snapshot snapshotPayload) {
+	w.line(0, "", "HEAD", "")
+
+	if w.version == gedcomVersion7 {
+		w.line(1, "", "GEDC", "")
+		w.line(2, "", "VERS", gedcomVersion7)
+
+		schema := map[string]string{}
+
+		for _, extensions := range snapshot.GedcomExtensions {
+			for _, extension := range extensions {
+				if extension.Uri != "" {
+					schema[extension.Line.Tag] = extension.Uri
+				}
+			}
+		}
+
+		if len(schema) > 0 {
+			tags := make([]string, 0, len(schema))
+
+			for tag := range schema {
+				tags = append(tags, tag)
+			}
+
+			sort.Strings(tags)
+
+			w.line(1, "", "SCHMA", "")
+
+			for _, tag := range tags {
+				w.line(2, "", "TAG", tag+" "+schema[tag])
+			}
+		}
+	}
+
+	w.line(1, "", "SOUR", "GENTREE")
+	w.line(2, "", "NAME", "gentree")
+	w.line(1, "", "DATE", strings.ToUpper(snapshot.ExportedAt.Format("2 Jan 2006")))
+	w.line(1, "", "SUBM", gedcomSubmitterXref)
+
+	if w.version != gedcomVersion7 {
+		w.line(1, "", "GEDC", "")
+		w.line(2, "", "VERS", gedcomVersion551)
+		w.line(2, "", "FORM", "LINEAGE-LINKED")
+		w.line(1, "", "CHAR", "UTF-8")
+	}
+}
+
+/* Write the snapshot document as a GEDCOM file
+
+   Params:
+   * out - the GEDCOM file destination
+   * snapshot - the snapshot document
+   * version - one of the gedcomVersionXxx constants
+
+   Return:
+   * error (if occurred and nil otherwise) */
+func writeGedcom(out io.Writer, snapshot snapshotPayload, version string) error {
+	w := &gedcomWriter{out: out, version: version}
+	families := groupGedcomFamilies(snapshot.Relations)
+	xrefs := gedcomPersonXrefs(snapshot.People, version)
+
+	// Family links of the individuals keyed by the person ids:
+	spouseLinks := map[string][]string{}
+	childLinks := map[string][]string{}
+
+	for _, family := range families {
+		for _, parent := range []string{family.Husband, family.Wife} {
+			if parent != "" {
+				spouseLinks[parent] = append(spouseLinks[parent], family.Xref)
+			}
+		}
+
+		for _, child := range family.Children {
+			childLinks[child] = append(childLinks[child], family.Xref)
+		}
+	}
+
+	writeGedcomHeader(w, snapshot)
+
+	w.line(0, gedcomSubmitterXref, "SUBM", "")
+	w.line(1, "", "NAME", "gentree")
+
+	for _, person := range snapshot.People {
+		w.line(0, xrefs[person.Id], "INDI", "")
+
+		if person.Given != "" || person.Surname != "" {
+			w.line(1, "", "NAME", strings.TrimSpace(
+				person.Given+" /"+strings.ReplaceAll(person.Surname, "/", "")+"/"))
+
+			if person.Given != "" {
+				w.line(2, "", "GIVN", person.Given)
+			}
+
+			if person.Surname != "" {
+				w.line(2, "", "SURN", person.Surname)
+			}
+		}
+
+		w.line(1, "", "SEX", gedcomSex(person.Gender))
+
+		for _, xref := range childLinks[person.Id] {
+			w.line(1, "", "FAMC", xref)
+		}
+
+		for _, xref := range spouseLinks[person.Id] {
+			w.line(1, "", "FAMS", xref)
+		}
+
+		if xrefs[person.Id] != "@"+person.Id+"@" {
+			if version == gedcomVersion7 {
+				w.line(1, "", "EXID", person.Id)
+			} else {
+				w.line(1, "", gedcom551PersonIdTag, person.Id)
+			}
+
+			w.line(2, "", "TYPE", gedcomPersonIdType)
+		}
+
+		for _, extension := range snapshot.GedcomExtensions[person.Id] {
+			writeGedcomStructure(w, 1, &extension.Line)
+		}
+	}
+
+	for _, family := range families {
+		w.line(0, family.Xref, "FAM", "")
+
+		if family.Husband != "" {
+			w.line(1, "", "HUSB", xrefs[family.Husband])
+		}
+
+		if family.Wife != "" {
+			w.line(1, "", "WIFE", xrefs[family.Wife])
+		}
+
+		for _, child := range family.Children {
+			w.line(1, "", "CHIL", xrefs[child])
+		}
+	}
+
+	w.line(0, "", "TRLR", "")
+
+	return w.err
+}
+
+/* Write the GEDCOM file of the whole store
+
+   Params:
+   * store - the store to be exported
+   * out - the GEDCOM file destination
+   * version - one of the gedcomVersionXxx constants
+
+   Return:
+   * error (if occurred and nil otherwise) */
+func saveGedcomVersion(store Store, out io.Writer, version string) error {
+	var snapshot snapshotPayload
+
+	err := store.view(func(tx Store) error {
+		var err error
+
+		snapshot, err = exportSnapshot(tx)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeGedcom(out, snapshot, version); err != nil {
+		return err
+	}
+
+	log.Infof("Exported %d people and %d relations to GEDCOM %s",
+		len(snapshot.People), len(snapshot.Relations), version)
+
+	return nil
+}
+
+/* Write the GEDCOM 5.5.1 file of the whole store (see saveGedcomVersion) */
+func saveGedcom(store Store, out io.Writer) error {
+	return saveGedcomVersion(store, out, gedcomVersion551)
+}
+
+/* Write the GEDCOM 7 file of the whole store (see saveGedcomVersion) */
+func saveGedcom7(store Store, out io.Writer) error {
+	return saveGedcomVersion(store, out, gedcomVersion7)
+}
+
+/* Write the GEDZIP archive of the whole store
+
+   The archive contains only the GEDCOM 7 file (see gedzipGedcomName), as gentree stores no media */
+func saveGedzip(store Store, out io.Writer) error {
+	archive := zip.NewWriter(out)
+
+	file, err := archive.Create(gedzipGedcomName)
+	if err != nil {
+		return err
+	}
+
+	if err := saveGedcom7(store, file); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+/* The structure used to extract the GEDCOM export parameters from a request query */
+type gedcomExportQuery struct {
+	Version string `form:"version" binding:"isdefault|oneof=5.5.1 7.0"`
+}
+
+/* Handle a GEDCOM export request
+
+   The response is a GEDCOM file containing all the people and relations. The GEDCOM version is
+   taken from the request query (gedcomExportQuery; 5.5.1 is the default one). */
+func exportGedcom(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	var query gedcomExportQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Infof("Query parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": queryErrorMsg})
+		return
+	}
+
+	if query.Version == gedcomVersion7 {
+		doExport(c, formatGedcom7)
+	} else {
+		doExport(c, formatGedcom)
+	}
+}
+
+/* Handle a GEDZIP export request
+
+   The response is a GEDZIP archive containing the GEDCOM 7 file of all the people and relations */
+func exportGedzip(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doExport(c, formatGedzip)
+}
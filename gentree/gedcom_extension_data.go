@@ -0,0 +1,67 @@
+package main
+
+/* This file defines the storage representation of the GEDCOM extension structures and the
+   in-memory store functions maintaining them */
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+)
+
+/* Storage representation of a GEDCOM extension structure
+
+   The GEDCOM import keeps the substructures of the individual records having the extension tags
+   (starting with the '_' character), which gentree doesn't understand, so that the GEDCOM export
+   can write them back. The JSON encoding of the structure is used by the journal files and the
+   SQLite database. */
+type gedcomExtension struct {
+	// URI defining the extension tag (GEDCOM 7 only; empty if not known)
+	Uri string `json:"uri,omitempty"`
+	// The extension structure (level 1) together with all its substructures
+	Line gedcomLine `json:"line"`
+}
+
+/* Retrieve the GEDCOM extension structures of a person
+
+   Return:
+   * slice of the extension structures in the original order (empty if there are none)
+   * error (if occurred and nil otherwise) */
+func (s *memoryStore) getGedcomExtensions(pid string) ([]gedcomExtension, error) {
+	log.Debugf("Retrieving the GEDCOM extensions of person (%s)", pid)
+
+	if extensions, found := s.gedcomExtensions[pid]; found {
+		return extensions, nil
+	}
+
+	return []gedcomExtension{}, nil
+}
+
+/* Replace the GEDCOM extension structures of a person (an empty slice removes them)
+
+   Return:
+   * error (if the person record doesn't exist and nil otherwise) */
+func (s *memoryStore) setGedcomExtensions(pid string, extensions []gedcomExtension) error {
+	log.Debugf("Setting %d GEDCOM extension(s) of person (%s)", len(extensions), pid)
+
+	if _, found := s.people[pid]; !found {
+		return AppError{errRecordNotFound, fmt.Sprintf("Person record (%s) not found", pid)}
+	}
+
+	old, found := s.gedcomExtensions[pid]
+
+	if len(extensions) == 0 {
+		delete(s.gedcomExtensions, pid)
+	} else {
+		s.gedcomExtensions[pid] = extensions
+	}
+
+	s.onUndo(func() {
+		if found {
+			s.gedcomExtensions[pid] = old
+		} else {
+			delete(s.gedcomExtensions, pid)
+		}
+	})
+
+	return nil
+}
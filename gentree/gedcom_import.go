@@ -0,0 +1,484 @@
+package main
+
+/* This file defines the GEDCOM 5.5.1 and GEDCOM 7 import
+
+   The individual (INDI) records are mapped to the person records and the family (FAM) records to
+   the husband, father and mother relations. The extension substructures of the individuals (the
+   level 1 tags starting with the '_' character) are preserved (see gedcomExtension). The other
+   records and tags are skipped and listed in the import report. This includes the extensions
+   found elsewhere (e.g. in the family records or the extension records like "0 @X1@ _FOO"), as
+   the families are not stored (see groupGedcomFamilies) and the other records have nothing to be
+   attached to. The import report warns about such extensions. */
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"sort"
+	"strings"
+)
+
+/* Summary of the GEDCOM import */
+type gedcomImportReportPayload struct {
+	importReportPayload
+	// GEDCOM version detected in the file header (one of the gedcomVersionXxx constants)
+	Version string `json:"version"`
+	// Number of occurrences of the skipped tags keyed by the tag path (e.g. INDI.BIRT)
+	SkippedTags map[string]int `json:"skipped_tags"`
+	// Number of occurrences of the preserved extension tags keyed by the tag path (e.g. INDI._UID;
+	// the skipped extension tags are listed in the SkippedTags field)
+	PreservedTags map[string]int `json:"preserved_tags"`
+	Warnings      []string       `json:"warnings"`
+}
+
+// Name of the GEDCOM file in the GEDZIP archive
+const gedzipGedcomName = "gedcom.ged"
+
+/* Check if the string is a valid person id */
+func isValidPersonId(pid string) bool {
+	return binding.Validator.ValidateStruct(&specifyPersonUri{pid}) == nil
+}
+
+/* Make a person id out of a GEDCOM cross-reference identifier
+
+   The identifier is used as it is (without the '@' delimiters) if it is a valid person id (e.g.
+   the ones written by the GEDCOM export). Otherwise, the characters not allowed in the person ids
+   (all but the ASCII letters and digits) are removed (e.g. @I-12@ becomes I12). */
+func gedcomPersonId(xref string) string {
+	pid := strings.Trim(xref, "@")
+
+	if isValidPersonId(pid) {
+		return pid
+	}
+
+	var id strings.Builder
+
+	for _, r := range pid {
+		if isAlphanum(string(r)) {
+			id.WriteRune(r)
+		}
+	}
+
+	return id.String()
+}
+
+/* Split a GEDCOM personal name (e.g. "Jan Maria /Kowalski/") into the given names and the surname
+
+   The text following the surname (e.g. a suffix) is dropped */
+func splitGedcomName(name string) (string, string) {
+	given, rest, found := strings.Cut(name, "/")
+	if !found {
+		return strings.TrimSpace(name), ""
+	}
+
+	surname, _, _ := strings.Cut(rest, "/")
+
+	return strings.TrimSpace(given), strings.TrimSpace(surname)
+}
+
+/* Map a GEDCOM sex value onto the person gender */
+func gedcomGender(sex string) string {
+	switch strings.ToUpper(strings.TrimSpace(sex)) {
+	case "M":
+		return gMale
+	case "F":
+		return gFemale
+	}
+
+	return gUnknown
+}
+
+/* Read the extension tag definitions of a GEDCOM 7 file (HEAD.SCHMA.TAG)
+
+   Return:
+   * the URIs keyed by the extension tags (empty if the file defines none) */
+func gedcomSchema(records []*gedcomLine) map[string]string {
+	schema := map[string]string{}
+
+	if len(records) == 0 || records[0].Tag != "HEAD" {
+		return schema
+	}
+
+	if schma := records[0].child("SCHMA"); schma != nil {
+		for _, line := range schma.Children {
+			if tag, uri, found := strings.Cut(line.Value, " "); line.Tag == "TAG" && found {
+				schema[tag] = strings.TrimSpace(uri)
+			}
+		}
+	}
+
+	return schema
+}
+
+/* Copy a GEDCOM line together with its substructures, dropping the line numbers (meaningless
+   once the line is stored) */
+func copyGedcomLine(line *gedcomLine) gedcomLine {
+	result := *line
+	result.LineNo = 0
+	result.Children = nil
+
+	for _, child := range line.Children {
+		copied := copyGedcomLine(child)
+		result.Children = append(result.Children, &copied)
+	}
+
+	return result
+}
+
+/* Check if the line is an external identifier holding a valid person id (see
+   gedcomPersonIdType) */
+func isGedcomPersonIdLine(line *gedcomLine) bool {
+	typ := line.child("TYPE")
+
+	return typ != nil && typ.Value == gedcomPersonIdType && isValidPersonId(line.Value)
+}
+
+/* Convert an individual record into a person payload
+
+   The person id is taken from the external identifier written by the GEDCOM export (see
+   gedcomPersonIdType) or, if there is none, made out of the cross-reference identifier.
+
+   Params:
+   * rec - the INDI record
+   * schema - the extension tag URIs (see gedcomSchema)
+   * skip - function recording a skipped tag (given its path)
+
+   Return:
+   * the person payload
+   * the preserved extension substructures (in order) */
+func convertGedcomIndividual(rec *gedcomLine, schema map[string]string, skip func(path string)) (fullPersonPayload, []gedcomExtension) {
+	person := fullPersonPayload{Id: gedcomPersonId(rec.Xref), Gender: gUnknown}
+	extensions := []gedcomExtension{}
+	named := false
+
+	for _, line := range rec.Children {
+		switch line.Tag {
+		case "NAME":
+			// Only the first (preferred) name is imported:
+			if named {
+				skip("INDI.NAME")
+				continue
+			}
+
+			named = true
+			person.Given, person.Surname = splitGedcomName(line.Value)
+
+			for _, part := range line.Children {
+				switch part.Tag {
+				case "GIVN":
+					person.Given = part.Value
+				case "SURN":
+					person.Surname = part.Value
+				default:
+					skip("INDI.NAME." + part.Tag)
+				}
+			}
+
+		case "SEX":
+			person.Gender = gedcomGender(line.Value)
+
+		case "FAMC", "FAMS":
+			// The family links duplicate the family records (which are the source of relations)
+
+		case "EXID":
+			if isGedcomPersonIdLine(line) {
+				person.Id = line.Value
+			} else {
+				skip("INDI.EXID")
+			}
+
+		default:
+			if line.Tag == gedcom551PersonIdTag && isGedcomPersonIdLine(line) {
+				person.Id = line.Value
+			} else if strings.HasPrefix(line.Tag, "_") {
+				extensions = append(extensions, gedcomExtension{schema[line.Tag], copyGedcomLine(line)})
+			} else {
+				skip("INDI." + line.Tag)
+			}
+		}
+	}
+
+	return person, extensions
+}
+
+/* Check if the tag is one of the family record tags pointing to the family members */
+func isFamilyMemberTag(tag string) bool {
+	return tag == "HUSB" || tag == "WIFE" || tag == "CHIL"
+}
+
+/* Convert the GEDCOM records into a snapshot document
+
+   The individuals without a usable identifier and the family members referencing unknown
+   individuals are rejected already here.
+
+   Return:
+   * the snapshot document (with no header)
+   * the conversion report (listing the skipped tags, the warnings and the rejected records) */
+func convertGedcom(records []*gedcomLine) (snapshotPayload, gedcomImportReportPayload) {
+	snapshot := snapshotPayload{
+		People:           []fullPersonPayload{},
+		Relations:        []relationPayload{},
+		GedcomExtensions: map[string][]gedcomExtension{},
+	}
+	report := gedcomImportReportPayload{
+		importReportPayload: importReportPayload{Rejected: []importRejectionPayload{}},
+		Version:             gedcomVersion(records),
+		SkippedTags:         map[string]int{},
+		PreservedTags:       map[string]int{},
+		Warnings:            []string{},
+	}
+	schema := gedcomSchema(records)
+
+	skip := func(path string) {
+		report.SkippedTags[path]++
+	}
+
+	rejectPerson := func(person fullPersonPayload, reason string) {
+		report.Rejected = append(
+			report.Rejected, importRejectionPayload{Person: &person, Reason: reason})
+	}
+
+	rejectRelation := func(relation relationPayload, reason string) {
+		report.Rejected = append(
+			report.Rejected, importRejectionPayload{Relation: &relation, Reason: reason})
+	}
+
+	// Person ids keyed by the cross-reference identifiers of the imported individuals:
+	pids := map[string]string{}
+	// Cross-reference identifiers keyed by the person ids:
+	xrefs := map[string]string{}
+
+	for _, rec := range records {
+		switch rec.Tag {
+		case "HEAD", "TRLR":
+
+		case "INDI":
+			person, extensions := convertGedcomIndividual(rec, schema, skip)
+
+			if person.Id == "" {
+				person.Id = rec.Xref
+				rejectPerson(person, fmt.Sprintf(
+					"Individual at line %d has no usable identifier", rec.LineNo))
+				continue
+			}
+
+			if other, found := xrefs[person.Id]; found {
+				rejectPerson(person, fmt.Sprintf(
+					"Individual (%s) identifier collides with another one (%s)", rec.Xref, other))
+				continue
+			}
+
+			pids[rec.Xref] = person.Id
+			xrefs[person.Id] = rec.Xref
+			snapshot.People = append(snapshot.People, person)
+
+			if len(extensions) > 0 {
+				snapshot.GedcomExtensions[person.Id] = extensions
+			}
+
+			for _, extension := range extensions {
+				report.PreservedTags["INDI."+extension.Line.Tag]++
+			}
+
+		case "FAM":
+
+		default:
+			skip(rec.Tag)
+		}
+	}
+
+	for _, rec := range records {
+		if rec.Tag != "FAM" {
+			continue
+		}
+
+		var husband, wife *gedcomLine
+		children := []*gedcomLine{}
+
+		for _, line := range rec.Children {
+			switch {
+			case line.Value == gedcomVoidPointer && isFamilyMemberTag(line.Tag):
+				// The member is explicitly unknown (GEDCOM 7)
+			case line.Tag == "HUSB" && husband == nil:
+				husband = line
+			case line.Tag == "WIFE" && wife == nil:
+				wife = line
+			case line.Tag == "CHIL":
+				children = append(children, line)
+			default:
+				skip("FAM." + line.Tag)
+			}
+		}
+
+		// Add the relation if both the people are known (reject it otherwise):
+		relate := func(first *gedcomLine, typ string, second *gedcomLine) {
+			relation := relationPayload{Pid1: first.Value, Pid2: second.Value, Type: typ}
+			pid1, found1 := pids[first.Value]
+			pid2, found2 := pids[second.Value]
+
+			if !found1 || !found2 {
+				rejectRelation(relation, fmt.Sprintf(
+					"Family (%s) references an unknown or rejected individual", rec.Xref))
+				return
+			}
+
+			relation.Pid1, relation.Pid2 = pid1, pid2
+			snapshot.Relations = append(snapshot.Relations, relation)
+		}
+
+		if husband != nil && wife != nil {
+			relate(husband, relHusband, wife)
+		}
+
+		for _, child := range children {
+			if husband != nil {
+				relate(husband, relFather, child)
+			}
+
+			if wife != nil {
+				relate(wife, relMother, child)
+			}
+		}
+	}
+
+	if dropped := skippedGedcomExtensions(report.SkippedTags); len(dropped) > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(
+			"Only the extensions of the individuals are preserved; the other extensions are "+
+				"skipped (%s)", strings.Join(dropped, ", ")))
+	}
+
+	return snapshot, report
+}
+
+/* List the skipped tag paths ending with an extension tag (in the alphabetical order) */
+func skippedGedcomExtensions(skipped map[string]int) []string {
+	paths := []string{}
+
+	for path := range skipped {
+		if idx := strings.LastIndex(path, "."); strings.HasPrefix(path[idx+1:], "_") {
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+/* Load a GEDCOM file into the store
+
+   The converted records are imported using the importSnapshot function, so they are subject to
+   the same rules (e.g. the relations are checked by the validateRelation function). The relations
+   get new ids.
+
+   Params:
+   * store - the store to import the file into
+   * gen - the relation id generator
+   * in - the GEDCOM file source
+   * mode - one of the importXxx constants
+
+   Return:
+   * the import report (valid only if no error occurred)
+   * error (AppError with the errInvalidArgument code if the file is malformed, see
+     importSnapshot for the other errors) */
+func loadGedcom(store Store, gen relationIdGenerator, in io.Reader, mode string) (gedcomImportReportPayload, error) {
+	records, err := parseGedcom(in)
+	if err != nil {
+		return gedcomImportReportPayload{}, err
+	}
+
+	snapshot, report := convertGedcom(records)
+
+	err = store.update(func(tx Store) error {
+		imported, err := importSnapshot(tx, gen, snapshot, mode)
+
+		rejected := append(report.Rejected, imported.Rejected...)
+		report.importReportPayload = imported
+		report.Rejected = rejected
+
+		return err
+	})
+
+	if err != nil {
+		return gedcomImportReportPayload{}, err
+	}
+
+	log.Infof("Imported %d people and %d relations from GEDCOM %s (%d records rejected)",
+		report.ImportedPeople, report.ImportedRelations, report.Version, len(report.Rejected))
+
+	return report, nil
+}
+
+/* Load a GEDZIP archive into the store
+
+   The archive must contain the GEDCOM file (see gedzipGedcomName) in its root directory. The other
+   files (the media) are skipped, as gentree doesn't store any media, and listed in the report
+   warnings. See loadGedcom for the parameters and the return values. */
+func loadGedzip(store Store, gen relationIdGenerator, in io.Reader, mode string) (gedcomImportReportPayload, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return gedcomImportReportPayload{}, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return gedcomImportReportPayload{}, AppError{errInvalidArgument, "Malformed GEDZIP archive"}
+	}
+
+	var gedcom *zip.File
+	warnings := []string{}
+
+	for _, file := range archive.File {
+		if file.Name == gedzipGedcomName {
+			gedcom = file
+		} else if !file.FileInfo().IsDir() {
+			warnings = append(warnings, fmt.Sprintf(
+				"The archive file (%s) is skipped; the media files are not supported", file.Name))
+		}
+	}
+
+	if gedcom == nil {
+		return gedcomImportReportPayload{}, AppError{
+			errInvalidArgument,
+			fmt.Sprintf("The GEDZIP archive contains no %s file", gedzipGedcomName)}
+	}
+
+	file, err := gedcom.Open()
+	if err != nil {
+		return gedcomImportReportPayload{}, AppError{errInvalidArgument, "Malformed GEDZIP archive"}
+	}
+
+	defer file.Close()
+
+	report, err := loadGedcom(store, gen, file, mode)
+	if err != nil {
+		return gedcomImportReportPayload{}, err
+	}
+
+	report.Warnings = append(report.Warnings, warnings...)
+
+	return report, nil
+}
+
+/* Handle a GEDCOM import request
+
+   The function will retrieve the GEDCOM file (either version) from the request payload or from
+   the "file" field of the multipart form, and the import mode from the request query
+   (importQuery). Either all the valid records are imported or none of them (when an error
+   occurs). */
+func importGedcom(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doImport(c, formatGedcom)
+}
+
+/* Handle a GEDZIP import request (see importGedcom) */
+func importGedzip(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doImport(c, formatGedzip)
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testGedcomImportReportJson struct {
+	Message string `json:"message"`
+	Report  struct {
+		ImportedPeople    int                       `json:"imported_people"`
+		ImportedRelations int                       `json:"imported_relations"`
+		SkippedRelations  int                       `json:"skipped_relations"`
+		Rejected          []testImportRejectionJson `json:"rejected"`
+		Version           string                    `json:"version"`
+		SkippedTags       map[string]int            `json:"skipped_tags"`
+		PreservedTags     map[string]int            `json:"preserved_tags"`
+		Warnings          []string                  `json:"warnings"`
+	} `json:"report"`
+}
+
+func testGedcomImportReportRes(t *testing.T, res *httptest.ResponseRecorder) testGedcomImportReportJson {
+	payload := testGedcomImportReportJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+const testGedcomFile = `0 HEAD
+1 SOUR TEST
+1 GEDC
+2 VERS 5.5.1
+2 FORM LINEAGE-LINKED
+1 CHAR ANSEL
+0 @I1@ INDI
+1 NAME Jan /Kowalski/
+1 SEX M
+1 BIRT
+2 DATE 1 JAN 1900
+1 FAMS @F1@
+0 @I2@ INDI
+1 NAME Anna Maria /Nowak/
+2 GIVN Anna
+2 NICK Ania
+1 NAME Anna /Kowalska/
+1 SEX F
+1 FAMS @F1@
+0 @I-3@ INDI
+1 NAME Ewa /Kowalska/
+1 SEX F
+1 FAMC @F1@
+0 @I4@ INDI
+1 NAME Piotr
+1 SEX U
+1 FAMC @F1@
+0 @F1@ FAM
+1 HUSB @I1@
+1 WIFE @I2@
+1 CHIL @I-3@
+1 CHIL @I4@
+1 CHIL @I9@
+1 MARR
+2 DATE 1920
+0 @F2@ FAM
+1 HUSB @I4@
+1 CHIL @I-3@
+0 @N1@ NOTE A long
+1 CONC  note
+1 CONT with two lines
+0 TRLR
+`
+
+/* Test the GEDCOM parser
+
+   1. Parse a valid file (including the CONC and CONT lines)
+   2. Attempt to parse a file with a level gap
+   3. Attempt to parse a malformed line */
+func TestParseGedcom(t *testing.T) {
+	// Case 1: Valid file
+
+	records, err := parseGedcom(strings.NewReader(
+		"\xef\xbb\xbf" + strings.ReplaceAll(testGedcomFile, "\n", "\r\n")))
+
+	require.Nil(t, err)
+	require.Len(t, records, 9)
+	assert.Equal(t, "HEAD", records[0].Tag)
+	assert.Equal(t, "@I1@", records[1].Xref)
+	assert.Equal(t, "INDI", records[1].Tag)
+	assert.Equal(t, "Jan /Kowalski/", records[1].child("NAME").Value)
+	assert.Equal(t, "1 JAN 1900", records[1].child("BIRT").child("DATE").Value)
+	assert.Equal(t, 2, records[1].child("BIRT").child("DATE").Level)
+	assert.Equal(t, "A long note\nwith two lines", records[7].Value)
+	assert.Empty(t, records[7].Children)
+
+	// Case 2: Level gap
+
+	_, err = parseGedcom(strings.NewReader("0 HEAD\n2 VERS 5.5.1\n"))
+
+	assert.True(t, isAppError(err, errInvalidArgument))
+	assert.Contains(t, err.Error(), "line 2")
+
+	// Case 3: Malformed line
+
+	_, err = parseGedcom(strings.NewReader("0 HEAD\n1\n"))
+
+	assert.True(t, isAppError(err, errInvalidArgument))
+}
+
+/* Test the decoding of the GEDCOM character sets
+
+   1. Parse an ANSEL file (the combining marks precede the base characters)
+   2. Parse an ANSI (Windows-1252) file
+   3. Parse a UTF-8 file (the values are left intact)
+   4. Attempt to parse a file using an unsupported character set */
+func TestParseGedcomCharsets(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		charset string
+		value   string
+		decoded string
+	}{
+		// Case 1: ANSEL
+		{"ansel", "ANSEL", "Micha\xb1 /Wi\xe2sniewski/ \xe8A\xe3\xe2e @@ \xe1",
+			"Michał /Wiśniewski/ Äế @ ̀"},
+		// Case 2: ANSI
+		{"ansi", "ansi", "Bj\xf6rn /Fran\xe7ois/ \x80", "Björn /François/ €"},
+		// Case 3: UTF-8
+		{"utf-8", "UTF-8", "Michał /Wiśniewski/", "Michał /Wiśniewski/"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			records, err := parseGedcom(strings.NewReader(
+				"0 HEAD\n1 CHAR " + tc.charset + "\n0 @I1@ INDI\n1 NAME " + tc.value + "\n"))
+
+			require.Nil(t, err)
+			require.Len(t, records, 2)
+			assert.Equal(t, tc.decoded, records[1].child("NAME").Value)
+		})
+	}
+
+	// Case 4: Unsupported character set
+
+	_, err := parseGedcom(strings.NewReader("0 HEAD\n1 CHAR IBMPC\n0 TRLR\n"))
+
+	assert.True(t, isAppError(err, errInvalidArgument))
+	assert.Equal(t, "The IBMPC character set is not supported", err.(AppError).msg)
+}
+
+/* Test the GEDCOM import request
+
+   1. Upload a file using a multipart form
+   2. Attempt to import the file again into the non-empty store
+   3. Attempt to import a malformed file */
+func TestGedcomImportRequest(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	// Case 1: Multipart upload
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile("file", "tree.ged")
+	require.Nil(t, err)
+
+	_, err = part.Write([]byte(testGedcomFile))
+	require.Nil(t, err)
+	require.Nil(t, form.Close())
+
+	res := testMakeRequestWithHeaders(router, "POST", "/import/gedcom", body,
+		map[string]string{"Content-Type": form.FormDataContentType()})
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report := testGedcomImportReportRes(t, res).Report
+
+	assert.Equal(t, 4, report.ImportedPeople)
+	assert.Equal(t, 5, report.ImportedRelations)
+	assert.Equal(t, map[string]int{
+		"INDI.BIRT":      1,
+		"INDI.NAME":      1,
+		"INDI.NAME.NICK": 1,
+		"FAM.MARR":       1,
+		"NOTE":           1,
+	}, report.SkippedTags)
+	assert.Empty(t, report.Warnings)
+	assert.Equal(t, []testImportRejectionJson{
+		{Relation: &testFullRelationJson{0, "@I1@", "@I9@", relFather},
+			Reason: "Family (@F1@) references an unknown or rejected individual"},
+		{Relation: &testFullRelationJson{0, "@I2@", "@I9@", relMother},
+			Reason: "Family (@F1@) references an unknown or rejected individual"},
+		{Relation: &testFullRelationJson{0, "I4", "I3", relFather},
+			Reason: "Relation (I4, father, I3) is invalid"},
+	}, report.Rejected)
+
+	assert.Equal(t, personRecord{"I1", "Jan", "Kowalski", gMale, 1}, store.people["I1"])
+	assert.Equal(t, personRecord{"I2", "Anna", "Nowak", gFemale, 1}, store.people["I2"])
+	assert.Equal(t, personRecord{"I3", "Ewa", "Kowalska", gFemale, 1}, store.people["I3"])
+	assert.Equal(t, personRecord{"I4", "Piotr", "", gUnknown, 1}, store.people["I4"])
+
+	for _, r := range []relationRecord{
+		{0, "I1", "I2", relHusband, 0},
+		{0, "I1", "I3", relFather, 0},
+		{0, "I2", "I3", relMother, 0},
+		{0, "I1", "I4", relFather, 0},
+		{0, "I2", "I4", relMother, 0},
+	} {
+		_, found, err := queryRelationByData(store, r.Pid1, r.Type, r.Pid2)
+
+		assert.Nil(t, err)
+		assert.True(t, found, r)
+	}
+
+	// Case 2: Non-empty store
+
+	res = testMakeRequest(router, "POST", "/import/gedcom", strings.NewReader(testGedcomFile))
+
+	assert.Equal(t, http.StatusConflict, res.Code)
+
+	// Case 3: Malformed file
+
+	res = testMakeRequest(
+		router, "POST", "/import/gedcom?mode=merge", strings.NewReader("0 HEAD\n2 CHAR UTF-8\n"))
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, "Unexpected GEDCOM line level (2) at line 2", testErrorRes(t, res).Message)
+	assert.Len(t, store.people, 4)
+}
+
+/* Test if the GEDCOM export output round-trips through the GEDCOM import
+
+   The store contains a married couple with common children, a remarriage, a child of unmarried
+   parents, a child with a single parent and a childless single person. The names contain the
+   characters needing special treatment. */
+func TestGedcomExportRoundTrip(t *testing.T) {
+	const uuidPid = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+	source := newMemoryStore(nil, nil)
+
+	people := []personRecord{
+		{"P1", "Jan", "Kowalski", gMale, 0},
+		{"P2", "Anna", "Nowak", gFemale, 0},
+		{"P3", "Ewa", "Kowalska", gFemale, 0},
+		{"P4", "Adam @ Home", "Kowalski/Nowak", gMale, 0},
+		{"P5", "Maria", "Wiśniewska", gFemale, 0},
+		{"P6", "Zofia", "", gFemale, 0},
+		{"P7", strings.Repeat("Bartłomiej @ ", 30), "Zieliński", gMale, 0},
+		{"P8", "", "", gUnknown, 0},
+		{uuidPid, "Piotr", "Kowalski", gMale, 0},
+	}
+
+	relations := []relationRecord{
+		{1, "P1", "P2", relHusband, 0},
+		{2, "P1", "P3", relFather, 0},
+		{3, "P2", "P3", relMother, 0},
+		{4, "P1", "P5", relHusband, 0},
+		{5, "P1", "P4", relFather, 0},
+		{6, "P5", "P4", relMother, 0},
+		{7, "P4", "P6", relFather, 0},
+		{8, "P3", "P6", relMother, 0},
+		{9, "P1", uuidPid, relFather, 0},
+		{10, "P5", "P7", relMother, 0},
+	}
+
+	for _, p := range people {
+		require.Nil(t, source.insertPerson(p))
+	}
+
+	for _, r := range relations {
+		require.Nil(t, source.insertRelation(r))
+	}
+
+	res := testMakeRequest(setupRouter(source), "GET", "/export.ged", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/x-gedcom; charset=utf-8", res.Header().Get("Content-Type"))
+
+	data := res.Body.String()
+
+	assert.True(t, strings.HasPrefix(data, "0 HEAD\n"))
+	assert.True(t, strings.HasSuffix(data, "0 TRLR\n"))
+	assert.Contains(t, data, "\n1 NAME Adam @@ Home /KowalskiNowak/\n")
+	assert.Contains(t, data, "\n2 CONC ")
+	assert.Contains(t, data, "\n0 @I_1@ INDI\n")
+	assert.Contains(t, data, "\n1 _GENTREE_ID "+uuidPid+"\n2 TYPE "+gedcomPersonIdType+"\n")
+
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		assert.LessOrEqual(t, len(line), 255)
+
+		// The cross-reference identifiers are limited to 20 characters:
+		for _, field := range strings.Fields(line) {
+			if strings.HasPrefix(field, "@") && strings.HasSuffix(field, "@") {
+				assert.LessOrEqual(t, len(field), 22, line)
+			}
+		}
+	}
+
+	target := newMemoryStore(nil, nil)
+
+	res = testMakeRequest(setupRouter(target), "POST", "/import/gedcom", strings.NewReader(data))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report := testGedcomImportReportRes(t, res).Report
+
+	assert.Empty(t, report.Rejected)
+	assert.Equal(t, map[string]int{"SUBM": 1}, report.SkippedTags)
+	assert.Empty(t, report.PreservedTags)
+	assert.Equal(t, len(people), report.ImportedPeople)
+	assert.Equal(t, len(relations), report.ImportedRelations)
+
+	for _, p := range people {
+		p.Rev = 1
+		assert.Equal(t, p, target.people[p.Id])
+	}
+
+	for _, r := range relations {
+		_, found, err := queryRelationByData(target, r.Pid1, r.Type, r.Pid2)
+
+		assert.Nil(t, err)
+		assert.True(t, found, r)
+	}
+}
+
+const testGedcom7File = `0 HEAD
+1 GEDC
+2 VERS 7.0
+1 SCHMA
+2 TAG _UID https://example.com/uid
+0 @I1@ INDI
+1 NAME Jan @ Home /Kowalski/
+1 SEX M
+1 _UID @@1234
+2 _SRC First line
+3 CONT @@second line
+1 _LEGACY Old data
+0 @I2@ INDI
+1 NAME Anna /Nowak/
+1 SEX F
+1 EXID p2
+2 TYPE https://github.com/dariusz-walczak/owl_gentree/person-id
+0 @I3@ INDI
+1 NAME Alex
+1 SEX X
+0 @F1@ FAM
+1 HUSB @VOID@
+1 WIFE @I2@
+1 CHIL @I1@
+0 TRLR
+`
+
+/* Test the GEDCOM 7 import and export
+
+   1. Import a GEDCOM 7 file (the version is detected from the header)
+   2. Export the data as a GEDCOM 7 file
+   3. Export the data as a GEDCOM 5.5.1 file
+   4. Attempt to export the data using an unknown version */
+func TestGedcom7ImportExport(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	// Case 1: Import
+
+	res := testMakeRequest(router, "POST", "/import/gedcom", strings.NewReader(testGedcom7File))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report := testGedcomImportReportRes(t, res).Report
+
+	assert.Equal(t, gedcomVersion7, report.Version)
+	assert.Equal(t, 3, report.ImportedPeople)
+	assert.Equal(t, 1, report.ImportedRelations)
+	assert.Empty(t, report.Rejected)
+	assert.Empty(t, report.SkippedTags)
+	assert.Equal(t, map[string]int{"INDI._UID": 1, "INDI._LEGACY": 1}, report.PreservedTags)
+
+	assert.Equal(t, personRecord{"I1", "Jan @ Home", "Kowalski", gMale, 1}, store.people["I1"])
+	assert.Equal(t, personRecord{"p2", "Anna", "Nowak", gFemale, 1}, store.people["p2"])
+	assert.Equal(t, personRecord{"I3", "Alex", "", gUnknown, 1}, store.people["I3"])
+
+	extensions, err := store.getGedcomExtensions("I1")
+
+	require.Nil(t, err)
+	require.Len(t, extensions, 2)
+	assert.Equal(t, "https://example.com/uid", extensions[0].Uri)
+	assert.Equal(t, "@1234", extensions[0].Line.Value)
+	assert.Equal(t, "First line\n@second line", extensions[0].Line.Children[0].Value)
+	assert.Equal(t, "", extensions[1].Uri)
+
+	// Case 2: GEDCOM 7 export
+
+	res = testMakeRequest(router, "GET", "/export.ged?version=7.0", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	data := res.Body.String()
+
+	assert.True(t, strings.HasPrefix(data, "0 HEAD\n1 GEDC\n2 VERS 7.0\n1 SCHMA\n"))
+	assert.Contains(t, data, "\n2 TAG _UID https://example.com/uid\n")
+	assert.Contains(t, data, "\n1 NAME Jan @ Home /Kowalski/\n")
+	assert.Contains(t, data, "\n1 _UID @@1234\n2 _SRC First line\n3 CONT @@second line\n")
+	assert.Contains(t, data, "\n0 @I_1@ INDI\n")
+	assert.Contains(t, data, "\n1 EXID p2\n2 TYPE "+gedcomPersonIdType+"\n")
+	assert.Contains(t, data, "\n1 WIFE @I_1@\n1 CHIL @I1@\n")
+	assert.NotContains(t, data, "CHAR")
+
+	// Case 3: GEDCOM 5.5.1 export
+
+	res = testMakeRequest(router, "GET", "/export.ged", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	data = res.Body.String()
+
+	assert.Contains(t, data, "\n2 VERS 5.5.1\n")
+	assert.Contains(t, data, "\n1 _UID @@1234\n")
+	assert.NotContains(t, data, "SCHMA")
+
+	// Case 4: Unknown version
+
+	res = testMakeRequest(router, "GET", "/export.ged?version=5.5", nil)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+/* Test if the extensions found outside the individual records are reported as skipped
+
+   1. Import a file with the family and record level extensions */
+func TestGedcomImportSkippedExtensions(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	// Case 1: Family and record level extensions
+
+	file := strings.Replace(testGedcom7File, "0 TRLR\n",
+		"1 _MSTAT Married\n0 @X1@ _PLAC Warsaw\n1 _MAP 52N 21E\n0 TRLR\n", 1)
+
+	res := testMakeRequest(router, "POST", "/import/gedcom", strings.NewReader(file))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report := testGedcomImportReportRes(t, res).Report
+
+	assert.Equal(t, 3, report.ImportedPeople)
+	assert.Equal(t, map[string]int{"FAM._MSTAT": 1, "_PLAC": 1}, report.SkippedTags)
+	assert.Equal(t, map[string]int{"INDI._UID": 1, "INDI._LEGACY": 1}, report.PreservedTags)
+	assert.Equal(t, []string{"Only the extensions of the individuals are preserved; the other "+
+		"extensions are skipped (FAM._MSTAT, _PLAC)"}, report.Warnings)
+}
+
+/* Test if the GUIDs written by the other applications aren't taken for the person ids
+
+   1. Import a GEDCOM 5.5.1 file with the _UID extensions (one of them typed as the person id) */
+func TestGedcomImportForeignUid(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+
+	// Case 1: The _UID extensions are preserved and the ids are made out of the cross-references
+
+	file := "0 HEAD\n1 GEDC\n2 VERS 5.5.1\n0 @I1@ INDI\n1 NAME Jan /Kowalski/\n" +
+		"1 _UID 0A1B2C3D4E5F\n0 @I2@ INDI\n1 NAME Anna /Nowak/\n1 _UID P9\n" +
+		"2 TYPE " + gedcomPersonIdType + "\n0 TRLR\n"
+
+	res := testMakeRequest(setupRouter(store), "POST", "/import/gedcom", strings.NewReader(file))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report := testGedcomImportReportRes(t, res).Report
+
+	assert.Equal(t, 2, report.ImportedPeople)
+	assert.Equal(t, map[string]int{"INDI._UID": 2}, report.PreservedTags)
+	assert.Contains(t, store.people, "I1")
+	assert.Contains(t, store.people, "I2")
+	assert.NotContains(t, store.people, "P9")
+
+	extensions, err := store.getGedcomExtensions("I2")
+
+	require.Nil(t, err)
+	require.Len(t, extensions, 1)
+	assert.Equal(t, "P9", extensions[0].Line.Value)
+}
+
+/* Test if the GEDZIP export output round-trips through the GEDZIP import
+
+   The archive is extended with a media file before the import, which is expected to be skipped */
+func TestGedzipRoundTrip(t *testing.T) {
+	const uuidPid = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+	source := newMemoryStore(nil, nil)
+
+	people := []personRecord{
+		{"P1", "Jan", "Kowalski", gMale, 0},
+		{"p2", "@nna", "Nowak", gFemale, 0},
+		{uuidPid, "Ewa", "Kowalska", gFemale, 0},
+	}
+
+	for _, p := range people {
+		require.Nil(t, source.insertPerson(p))
+	}
+
+	require.Nil(t, source.insertRelation(relationRecord{1, "P1", "p2", relHusband, 0}))
+	require.Nil(t, source.insertRelation(relationRecord{2, "P1", uuidPid, relFather, 0}))
+	require.Nil(t, source.insertRelation(relationRecord{3, "p2", uuidPid, relMother, 0}))
+
+	extensions := []gedcomExtension{
+		{"https://example.com/uid", gedcomLine{Level: 1, Tag: "_UID", Value: "ABC"}},
+	}
+
+	require.Nil(t, source.setGedcomExtensions(uuidPid, extensions))
+
+	res := testMakeRequest(setupRouter(source), "GET", "/export.gdz", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/zip", res.Header().Get("Content-Type"))
+
+	exported, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+	require.Nil(t, err)
+	require.Len(t, exported.File, 1)
+	assert.Equal(t, gedzipGedcomName, exported.File[0].Name)
+
+	body := &bytes.Buffer{}
+	archive := zip.NewWriter(body)
+
+	for _, file := range exported.File {
+		require.Nil(t, archive.Copy(file))
+	}
+
+	media, err := archive.Create("media/photo.jpg")
+	require.Nil(t, err)
+
+	_, err = media.Write([]byte("JPEG"))
+	require.Nil(t, err)
+	require.Nil(t, archive.Close())
+
+	target := newMemoryStore(nil, nil)
+
+	res = testMakeRequest(setupRouter(target), "POST", "/import/gedzip", body)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report := testGedcomImportReportRes(t, res).Report
+
+	assert.Equal(t, gedcomVersion7, report.Version)
+	assert.Empty(t, report.Rejected)
+	assert.Equal(t, map[string]int{"SUBM": 1}, report.SkippedTags)
+	assert.Len(t, report.Warnings, 1)
+	assert.Contains(t, report.Warnings[0], "media/photo.jpg")
+	assert.Equal(t, 3, report.ImportedRelations)
+
+	for _, p := range people {
+		p.Rev = 1
+		assert.Equal(t, p, target.people[p.Id])
+	}
+
+	stored, err := target.getGedcomExtensions(uuidPid)
+
+	assert.Nil(t, err)
+	assert.Equal(t, extensions, stored)
+
+	// An archive without the GEDCOM file is rejected:
+	body = &bytes.Buffer{}
+	require.Nil(t, zip.NewWriter(body).Close())
+
+	res = testMakeRequest(setupRouter(target), "POST", "/import/gedzip?mode=merge", body)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
@@ -0,0 +1,446 @@
+package main
+
+/* This file defines the GEDCOM X (JSON) import and export
+
+   The GEDCOM X persons are mapped to the person records (the first name form of the preferred
+   name and the gender only) and the relationships to the relation records:
+   * ParentChild (person1 is the parent) to the father or mother relation (depending on the parent
+     gender)
+   * Couple to the husband relation (the male partner is the husband)
+
+   The person ids are made out of the GEDCOM X person ids the same way as out of the GEDCOM
+   cross-reference identifiers (see gedcomPersonId), e.g. the FamilySearch id KWCB-HZV becomes
+   KWCBHZV. The other GEDCOM X data (facts, sources, etc.) is not supported. */
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Media type of the GEDCOM X JSON documents
+const gedcomxMediaType = "application/x-gedcomx-v1+json"
+
+// GEDCOM X type URIs
+const (
+	gedcomxMale        = "http://gedcomx.org/Male"
+	gedcomxFemale      = "http://gedcomx.org/Female"
+	gedcomxUnknown     = "http://gedcomx.org/Unknown"
+	gedcomxGiven       = "http://gedcomx.org/Given"
+	gedcomxSurname     = "http://gedcomx.org/Surname"
+	gedcomxParentChild = "http://gedcomx.org/ParentChild"
+	gedcomxCouple      = "http://gedcomx.org/Couple"
+)
+
+/* GEDCOM X document (only the supported part of the model) */
+type gedcomxDocument struct {
+	Persons       []gedcomxPerson       `json:"persons,omitempty"`
+	Relationships []gedcomxRelationship `json:"relationships,omitempty"`
+}
+
+type gedcomxPerson struct {
+	Id     string        `json:"id"`
+	Gender *gedcomxType  `json:"gender,omitempty"`
+	Names  []gedcomxName `json:"names,omitempty"`
+}
+
+/* Structure having only the type (e.g. the gender) */
+type gedcomxType struct {
+	Type string `json:"type"`
+}
+
+type gedcomxName struct {
+	Preferred bool              `json:"preferred,omitempty"`
+	NameForms []gedcomxNameForm `json:"nameForms"`
+}
+
+type gedcomxNameForm struct {
+	FullText string            `json:"fullText,omitempty"`
+	Parts    []gedcomxNamePart `json:"parts,omitempty"`
+}
+
+type gedcomxNamePart struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type gedcomxRelationship struct {
+	Id      string                   `json:"id,omitempty"`
+	Type    string                   `json:"type"`
+	Person1 gedcomxResourceReference `json:"person1"`
+	Person2 gedcomxResourceReference `json:"person2"`
+}
+
+/* Reference to a person (the local references have the form of "#" followed by the person id) */
+type gedcomxResourceReference struct {
+	Resource string `json:"resource"`
+}
+
+/* Make a GEDCOM X reference to a person of the same document */
+func gedcomxPersonRef(pid string) gedcomxResourceReference {
+	return gedcomxResourceReference{"#" + pid}
+}
+
+/* Convert a person payload into a GEDCOM X person */
+func gedcomxFromPerson(person fullPersonPayload) gedcomxPerson {
+	result := gedcomxPerson{Id: person.Id, Gender: &gedcomxType{gedcomxUnknown}}
+
+	switch person.Gender {
+	case gMale:
+		result.Gender.Type = gedcomxMale
+	case gFemale:
+		result.Gender.Type = gedcomxFemale
+	}
+
+	if person.Given != "" || person.Surname != "" {
+		form := gedcomxNameForm{FullText: strings.TrimSpace(person.Given + " " + person.Surname)}
+
+		if person.Given != "" {
+			form.Parts = append(form.Parts, gedcomxNamePart{gedcomxGiven, person.Given})
+		}
+
+		if person.Surname != "" {
+			form.Parts = append(form.Parts, gedcomxNamePart{gedcomxSurname, person.Surname})
+		}
+
+		result.Names = []gedcomxName{{Preferred: true, NameForms: []gedcomxNameForm{form}}}
+	}
+
+	return result
+}
+
+/* Convert a GEDCOM X person into a person payload
+
+   The person id is made out of the GEDCOM X id (see gedcomPersonId; empty if there is no usable
+   one). The preferred name (or the first one if none is preferred) is used. If its first name form
+   has no name parts, the full text is used as the given names. */
+func (p *gedcomxPerson) toPayload() fullPersonPayload {
+	person := fullPersonPayload{Id: gedcomPersonId(p.Id), Gender: gUnknown}
+
+	if p.Gender != nil {
+		switch p.Gender.Type {
+		case gedcomxMale:
+			person.Gender = gMale
+		case gedcomxFemale:
+			person.Gender = gFemale
+		}
+	}
+
+	if len(p.Names) == 0 {
+		return person
+	}
+
+	name := p.Names[0]
+
+	for _, n := range p.Names {
+		if n.Preferred {
+			name = n
+			break
+		}
+	}
+
+	if len(name.NameForms) == 0 {
+		return person
+	}
+
+	form := name.NameForms[0]
+
+	if len(form.Parts) == 0 {
+		person.Given = strings.TrimSpace(form.FullText)
+	}
+
+	for _, part := range form.Parts {
+		switch part.Type {
+		case gedcomxGiven:
+			person.Given = strings.TrimSpace(person.Given + " " + part.Value)
+		case gedcomxSurname:
+			person.Surname = strings.TrimSpace(person.Surname + " " + part.Value)
+		}
+	}
+
+	return person
+}
+
+/* Convert the snapshot document into a GEDCOM X document
+
+   The father and mother relations become the ParentChild relationships and the husband relations
+   the Couple ones. The relationship ids are the relation ids. */
+func gedcomxFromSnapshot(snapshot snapshotPayload) gedcomxDocument {
+	doc := gedcomxDocument{
+		Persons:       make([]gedcomxPerson, 0, len(snapshot.People)),
+		Relationships: make([]gedcomxRelationship, 0, len(snapshot.Relations)),
+	}
+
+	for _, person := range snapshot.People {
+		doc.Persons = append(doc.Persons, gedcomxFromPerson(person))
+	}
+
+	for _, r := range snapshot.Relations {
+		typ := gedcomxParentChild
+
+		if r.Type == relHusband {
+			typ = gedcomxCouple
+		}
+
+		doc.Relationships = append(doc.Relationships, gedcomxRelationship{
+			strconv.FormatInt(r.Id, 10), typ, gedcomxPersonRef(r.Pid1), gedcomxPersonRef(r.Pid2)})
+	}
+
+	return doc
+}
+
+/* Convert the GEDCOM X document into a snapshot document
+
+   The persons without a usable identifier (or with one colliding with another person) and the
+   relationships of the unsupported types, referencing unknown people, or requiring a gender that
+   can't be determined are rejected already here. The relationship ids being positive integers are
+   kept (see importSnapshot).
+
+   Params:
+   * doc - the GEDCOM X document
+   * gender - function returning the gender of a person not included in the document (an empty
+     string if the person doesn't exist)
+
+   Return:
+   * the snapshot document (with no header; valid only if no error occurred)
+   * the rejected persons and relationships
+   * error (returned by the gender function, nil otherwise) */
+func convertGedcomx(doc gedcomxDocument, gender func(pid string) (string, error)) (snapshotPayload, []importRejectionPayload, error) {
+	snapshot := snapshotPayload{People: []fullPersonPayload{}, Relations: []relationPayload{}}
+	rejected := []importRejectionPayload{}
+	// Person ids keyed by the GEDCOM X ids of the persons (empty for the rejected ones):
+	pids := map[string]string{}
+	// GEDCOM X ids keyed by the person ids:
+	ids := map[string]string{}
+	genders := map[string]string{}
+
+	for _, p := range doc.Persons {
+		person := p.toPayload()
+
+		reject := func(reason string) {
+			person.Id = p.Id
+			pids[p.Id] = ""
+			rejected = append(rejected, importRejectionPayload{Person: &person, Reason: reason})
+		}
+
+		if person.Id == "" {
+			reject(fmt.Sprintf("Person (%s) has no usable identifier", p.Id))
+			continue
+		}
+
+		if other, found := ids[person.Id]; found {
+			reject(fmt.Sprintf(
+				"Person (%s) identifier collides with another one (%s)", p.Id, other))
+			continue
+		}
+
+		pids[p.Id] = person.Id
+		ids[person.Id] = p.Id
+		snapshot.People = append(snapshot.People, person)
+		genders[person.Id] = person.Gender
+	}
+
+	// Retrieve the id and the gender of a referenced person (an empty gender if the person is
+	// unknown; the persons not included in the document are looked up by their person ids):
+	lookup := func(ref gedcomxResourceReference) (string, string, error) {
+		id, local := strings.CutPrefix(ref.Resource, "#")
+		if !local {
+			return ref.Resource, "", nil
+		}
+
+		if pid, found := pids[id]; found && pid != "" {
+			return pid, genders[pid], nil
+		} else if found {
+			return id, "", nil
+		}
+
+		g, err := gender(id)
+
+		return id, g, err
+	}
+
+	for _, rel := range doc.Relationships {
+		id, _ := strconv.ParseInt(rel.Id, 10, 64)
+
+		pid1, gender1, err := lookup(rel.Person1)
+		if err != nil {
+			return snapshotPayload{}, nil, err
+		}
+
+		pid2, gender2, err := lookup(rel.Person2)
+		if err != nil {
+			return snapshotPayload{}, nil, err
+		}
+
+		relation := relationPayload{Id: id, Pid1: pid1, Pid2: pid2, Type: rel.Type}
+
+		reject := func(reason string) {
+			rejected = append(rejected, importRejectionPayload{Relation: &relation, Reason: reason})
+		}
+
+		if gender1 == "" || gender2 == "" {
+			reject(fmt.Sprintf(
+				"Relationship (%s) references an unknown individual", rel.Id))
+			continue
+		}
+
+		switch {
+		case rel.Type == gedcomxParentChild && gender1 == gMale:
+			relation.Type = relFather
+		case rel.Type == gedcomxParentChild && gender1 == gFemale:
+			relation.Type = relMother
+		case rel.Type == gedcomxCouple && gender1 == gMale && gender2 == gFemale:
+			relation.Type = relHusband
+		case rel.Type == gedcomxCouple && gender1 == gFemale && gender2 == gMale:
+			relation.Type = relHusband
+			relation.Pid1, relation.Pid2 = pid2, pid1
+		case rel.Type == gedcomxParentChild || rel.Type == gedcomxCouple:
+			reject(fmt.Sprintf(
+				"Relationship (%s) requires the people of a known gender", rel.Id))
+			continue
+		default:
+			reject(fmt.Sprintf("Relationship type (%s) is not supported", rel.Type))
+			continue
+		}
+
+		snapshot.Relations = append(snapshot.Relations, relation)
+	}
+
+	return snapshot, rejected, nil
+}
+
+/* Load a GEDCOM X document into the store
+
+   The converted records are imported using the importSnapshot function, so they are subject to
+   the same rules (e.g. the relations are checked by the validateRelation function).
+
+   Params:
+   * store - the store to import the document into
+   * gen - the relation id generator
+   * in - the GEDCOM X document source
+   * mode - one of the importXxx constants
+
+   Return:
+   * the import report (valid only if no error occurred)
+   * error (AppError with the errInvalidArgument code if the document is malformed, see
+     importSnapshot for the other errors) */
+func loadGedcomx(store Store, gen relationIdGenerator, in io.Reader, mode string) (importReportPayload, error) {
+	var doc gedcomxDocument
+
+	if err := json.NewDecoder(in).Decode(&doc); err != nil {
+		log.Infof("GEDCOM X document unmarshalling error: %s", err)
+
+		return importReportPayload{}, AppError{errInvalidArgument, "Malformed GEDCOM X document"}
+	}
+
+	var report importReportPayload
+
+	err := store.update(func(tx Store) error {
+		snapshot, rejected, err := convertGedcomx(doc, func(pid string) (string, error) {
+			person, found, err := tx.getPerson(pid)
+			if !found {
+				return "", err
+			}
+
+			return person.Gender, err
+		})
+
+		if err != nil {
+			return err
+		}
+
+		report, err = importSnapshot(tx, gen, snapshot, mode)
+		report.Rejected = append(rejected, report.Rejected...)
+
+		return err
+	})
+
+	if err != nil {
+		return importReportPayload{}, err
+	}
+
+	log.Infof("Imported %d people and %d relations from GEDCOM X (%d records rejected)",
+		report.ImportedPeople, report.ImportedRelations, len(report.Rejected))
+
+	return report, nil
+}
+
+/* Write the GEDCOM X document of the whole store
+
+   Params:
+   * store - the store to be exported
+   * out - the GEDCOM X document destination
+
+   Return:
+   * error (if occurred and nil otherwise) */
+func saveGedcomx(store Store, out io.Writer) error {
+	var snapshot snapshotPayload
+
+	err := store.view(func(tx Store) error {
+		var err error
+
+		snapshot, err = exportSnapshot(tx)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(gedcomxFromSnapshot(snapshot)); err != nil {
+		return err
+	}
+
+	log.Infof("Exported %d people and %d relations to GEDCOM X",
+		len(snapshot.People), len(snapshot.Relations))
+
+	return nil
+}
+
+/* Check if the client prefers the GEDCOM X representation of the response (the Accept header)
+
+   The offered type with the highest quality value wins (the first one listed if the values are
+   equal, see negotiateLanguage). JSON is the default representation, also selected by the wildcard
+   ranges and used when the client accepts none of the offered types. */
+func isGedcomxAccepted(c *gin.Context) bool {
+	gedcomx, selectedQuality := false, 0.0
+
+	for _, item := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, quality := parseAcceptItem(item)
+
+		if quality <= selectedQuality {
+			continue
+		}
+
+		switch mediaType {
+		case gedcomxMediaType:
+			gedcomx, selectedQuality = true, quality
+		case gin.MIMEJSON, "application/*", "*/*":
+			gedcomx, selectedQuality = false, quality
+		}
+	}
+
+	return gedcomx
+}
+
+/* Handle a GEDCOM X export request */
+func exportGedcomx(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doExport(c, formatGedcomx)
+}
+
+/* Handle a GEDCOM X import request (see importGedcom) */
+func importGedcomx(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doImport(c, formatGedcomx)
+}
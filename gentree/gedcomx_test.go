@@ -0,0 +1,278 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testGedcomxNamePartJson struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type testGedcomxPersonJson struct {
+	Id     string `json:"id"`
+	Gender struct {
+		Type string `json:"type"`
+	} `json:"gender"`
+	Names []struct {
+		NameForms []struct {
+			FullText string                    `json:"fullText"`
+			Parts    []testGedcomxNamePartJson `json:"parts"`
+		} `json:"nameForms"`
+	} `json:"names"`
+}
+
+type testGedcomxJson struct {
+	Persons       []testGedcomxPersonJson `json:"persons"`
+	Relationships []struct {
+		Id      string `json:"id"`
+		Type    string `json:"type"`
+		Person1 struct {
+			Resource string `json:"resource"`
+		} `json:"person1"`
+	} `json:"relationships"`
+}
+
+func testGedcomxRes(t *testing.T, res *httptest.ResponseRecorder) testGedcomxJson {
+	payload := testGedcomxJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+const testGedcomxDocument = `{
+  "persons": [
+    {"id": "P1", "gender": {"type": "http://gedcomx.org/Male"},
+     "names": [{"nameForms": [{"fullText": "Johnny K."}]},
+               {"preferred": true, "nameForms": [{"fullText": "Jan Kowalski", "parts": [
+                 {"type": "http://gedcomx.org/Given", "value": "Jan"},
+                 {"type": "http://gedcomx.org/Surname", "value": "Kowalski"}]}]}]},
+    {"id": "P2", "gender": {"type": "http://gedcomx.org/Female"},
+     "names": [{"nameForms": [{"fullText": "Anna"}]}]},
+    {"id": "P3", "gender": {"type": "http://gedcomx.org/Unknown"}},
+    {"id": "P4"}
+  ],
+  "relationships": [
+    {"id": "10", "type": "http://gedcomx.org/Couple",
+     "person1": {"resource": "#P2"}, "person2": {"resource": "#P1"}},
+    {"id": "11", "type": "http://gedcomx.org/ParentChild",
+     "person1": {"resource": "#P1"}, "person2": {"resource": "#P3"}},
+    {"id": "R12", "type": "http://gedcomx.org/ParentChild",
+     "person1": {"resource": "#P2"}, "person2": {"resource": "#P3"}},
+    {"id": "13", "type": "http://gedcomx.org/ParentChild",
+     "person1": {"resource": "#P3"}, "person2": {"resource": "#P4"}},
+    {"id": "14", "type": "http://gedcomx.org/EnslavedBy",
+     "person1": {"resource": "#P3"}, "person2": {"resource": "#P1"}},
+    {"id": "15", "type": "http://gedcomx.org/ParentChild",
+     "person1": {"resource": "#P9"}, "person2": {"resource": "#P4"}}
+  ]
+}`
+
+/* Test the GEDCOM X import and export
+
+   1. Import a GEDCOM X document
+   2. Export the data as a GEDCOM X document (the snapshot export isn't affected by the Accept
+      header)
+   3. Import the exported document into another store
+   4. Attempt to import a malformed document */
+func TestGedcomxImportExport(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	// Case 1: Import
+
+	res := testMakeRequestWithHeaders(router, "POST", "/import/gedcomx",
+		strings.NewReader(testGedcomxDocument), map[string]string{"Content-Type": gedcomxMediaType})
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report := testImportReportRes(t, res).Report
+
+	assert.Equal(t, 4, report.ImportedPeople)
+	assert.Equal(t, 3, report.ImportedRelations)
+	assert.Equal(t, []testImportRejectionJson{
+		{Relation: &testFullRelationJson{13, "P3", "P4", gedcomxParentChild},
+			Reason: "Relationship (13) requires the people of a known gender"},
+		{Relation: &testFullRelationJson{14, "P3", "P1", "http://gedcomx.org/EnslavedBy"},
+			Reason: "Relationship type (http://gedcomx.org/EnslavedBy) is not supported"},
+		{Relation: &testFullRelationJson{15, "P9", "P4", gedcomxParentChild},
+			Reason: "Relationship (15) references an unknown individual"},
+	}, report.Rejected)
+
+	assert.Equal(t, personRecord{"P1", "Jan", "Kowalski", gMale, 1}, store.people["P1"])
+	assert.Equal(t, personRecord{"P2", "Anna", "", gFemale, 1}, store.people["P2"])
+	assert.Equal(t, personRecord{"P3", "", "", gUnknown, 1}, store.people["P3"])
+	assert.Equal(t, relationRecord{10, "P1", "P2", relHusband, 1}, store.relations[10])
+	assert.Equal(t, relationRecord{11, "P1", "P3", relFather, 1}, store.relations[11])
+
+	_, found, err := queryRelationByData(store, "P2", relMother, "P3")
+
+	assert.Nil(t, err)
+	assert.True(t, found)
+
+	// Case 2: Export
+
+	res = testMakeRequestWithHeaders(
+		router, "GET", "/export", nil, map[string]string{"Accept": gedcomxMediaType})
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/json; charset=utf-8", res.Header().Get("Content-Type"))
+	assert.Empty(t, res.Header().Get("Vary"))
+
+	res = testMakeRequest(router, "GET", "/export.gedcomx", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, gedcomxMediaType, res.Header().Get("Content-Type"))
+
+	doc := testGedcomxRes(t, res)
+
+	require.Len(t, doc.Persons, 4)
+	assert.Equal(t, "P1", doc.Persons[0].Id)
+	assert.Equal(t, gedcomxMale, doc.Persons[0].Gender.Type)
+	assert.Equal(t, "Jan Kowalski", doc.Persons[0].Names[0].NameForms[0].FullText)
+	assert.Equal(t, []testGedcomxNamePartJson{{gedcomxGiven, "Jan"}, {gedcomxSurname, "Kowalski"}},
+		doc.Persons[0].Names[0].NameForms[0].Parts)
+	assert.Empty(t, doc.Persons[2].Names)
+	assert.Equal(t, gedcomxUnknown, doc.Persons[2].Gender.Type)
+	require.Len(t, doc.Relationships, 3)
+	assert.Equal(t, "10", doc.Relationships[0].Id)
+	assert.Equal(t, gedcomxCouple, doc.Relationships[0].Type)
+	assert.Equal(t, "#P1", doc.Relationships[0].Person1.Resource)
+
+	// Case 3: Round trip
+
+	target := newMemoryStore(nil, nil)
+
+	res = testMakeRequest(setupRouter(target), "POST", "/import/gedcomx", res.Body)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, testImportReportRes(t, res).Report.Rejected)
+	assert.Equal(t, store.people, target.people)
+	assert.Equal(t, store.relations, target.relations)
+
+	// Case 4: Malformed document
+
+	res = testMakeRequest(router, "POST", "/import/gedcomx?mode=merge", strings.NewReader("{"))
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, "Malformed GEDCOM X document", testErrorRes(t, res).Message)
+}
+
+/* Test the GEDCOM X import of the documents using the FamilySearch person ids
+
+   1. Import a couple identified by the FamilySearch ids (the ids are made valid)
+   2. Check the persons rejected due to their ids and the relationships referencing them */
+func TestGedcomxImportForeignIds(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	document := `{
+  "persons": [
+    {"id": "KWCB-HZV", "gender": {"type": "http://gedcomx.org/Male"},
+     "names": [{"nameForms": [{"fullText": "Jan Kowalski"}]}]},
+    {"id": "KWCB-HZW", "gender": {"type": "http://gedcomx.org/Female"},
+     "names": [{"nameForms": [{"fullText": "Anna Kowalska"}]}]},
+    {"id": "KWCBHZV", "gender": {"type": "http://gedcomx.org/Male"}},
+    {"id": "--", "gender": {"type": "http://gedcomx.org/Male"}}
+  ],
+  "relationships": [
+    {"type": "http://gedcomx.org/Couple",
+     "person1": {"resource": "#KWCB-HZW"}, "person2": {"resource": "#KWCB-HZV"}},
+    {"id": "R2", "type": "http://gedcomx.org/ParentChild",
+     "person1": {"resource": "#KWCBHZV"}, "person2": {"resource": "#KWCB-HZW"}}
+  ]
+}`
+
+	res := testMakeRequest(
+		setupRouter(store), "POST", "/import/gedcomx", strings.NewReader(document))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report := testImportReportRes(t, res).Report
+
+	// Case 1: Couple
+
+	assert.Equal(t, 2, report.ImportedPeople)
+	assert.Equal(t, 1, report.ImportedRelations)
+	assert.Equal(t, personRecord{"KWCBHZV", "Jan Kowalski", "", gMale, 1},
+		store.people["KWCBHZV"])
+	assert.Equal(t, personRecord{"KWCBHZW", "Anna Kowalska", "", gFemale, 1},
+		store.people["KWCBHZW"])
+
+	_, found, err := queryRelationByData(store, "KWCBHZV", relHusband, "KWCBHZW")
+
+	assert.Nil(t, err)
+	assert.True(t, found)
+
+	// Case 2: Rejected persons
+
+	assert.Equal(t, []testImportRejectionJson{
+		{Person: &testPersonJson{Id: "KWCBHZV", Gender: gMale},
+			Reason: "Person (KWCBHZV) identifier collides with another one (KWCB-HZV)"},
+		{Person: &testPersonJson{Id: "--", Gender: gMale},
+			Reason: "Person (--) has no usable identifier"},
+		{Relation: &testFullRelationJson{0, "KWCBHZV", "KWCBHZW", gedcomxParentChild},
+			Reason: "Relationship (R2) references an unknown individual"},
+	}, report.Rejected)
+}
+
+/* Test the content negotiation of the retrieve person request
+
+   1. GEDCOM X requested
+   2. No preference (JSON is returned)
+   3. Both accepted, JSON preferred
+   4. Quality values (the order of the types doesn't matter) */
+func TestGedcomxRetrievePerson(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	store.putPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 1})
+	router := setupRouter(store)
+
+	// Case 1: GEDCOM X
+
+	res := testMakeRequestWithHeaders(router, "GET", "/people/P1", nil,
+		map[string]string{"Accept": gedcomxMediaType + ", application/json;q=0.5"})
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, gedcomxMediaType, res.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", res.Header().Get("Vary"))
+	assert.Equal(t, makeETag(1), res.Header().Get("ETag"))
+
+	doc := testGedcomxRes(t, res)
+
+	require.Len(t, doc.Persons, 1)
+	assert.Equal(t, "P1", doc.Persons[0].Id)
+	assert.Equal(t, gedcomxMale, doc.Persons[0].Gender.Type)
+
+	// Case 2: No preference
+
+	res = testMakeRequest(router, "GET", "/people/P1", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/json; charset=utf-8", res.Header().Get("Content-Type"))
+	assert.Equal(t, testPersonJson{"P1", "Jan", "Kowalski", gMale}, testPersonRes(t, res))
+
+	// Case 3: JSON preferred
+
+	res = testMakeRequestWithHeaders(router, "GET", "/people/P1", nil,
+		map[string]string{"Accept": "application/json, " + gedcomxMediaType})
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/json; charset=utf-8", res.Header().Get("Content-Type"))
+
+	// Case 4: Quality values
+
+	for accept, contentType := range map[string]string{
+		gedcomxMediaType + ";q=0.1, application/json": "application/json; charset=utf-8",
+		"*/*;q=0.5, " + gedcomxMediaType:              gedcomxMediaType,
+		"application/json;q=0.5, " + gedcomxMediaType: gedcomxMediaType,
+		gedcomxMediaType + ";q=0, text/html":           "application/json; charset=utf-8",
+	} {
+		res = testMakeRequestWithHeaders(
+			router, "GET", "/people/P1", nil, map[string]string{"Accept": accept})
+
+		require.Equal(t, http.StatusOK, res.Code, accept)
+		assert.Equal(t, contentType, res.Header().Get("Content-Type"), accept)
+	}
+}
@@ -0,0 +1,552 @@
+package main
+
+/* This file defines the Gramps XML import and export
+
+   The Gramps people are mapped to the person records and the families to the relations (the
+   married couples to the husband relations and the child references to the father and mother
+   relations). The other Gramps data (events, places, sources, etc.) is not supported.
+
+   Every Gramps person is identified by a handle. The handles of the imported people are kept by
+   the store (see setGrampsHandle), so that importing the same people again updates the existing
+   records instead of duplicating them. The people without a handle are exported with handles made
+   out of the store instance identifier and their ids (see grampsExportHandlePrefix). The import
+   recognizes such handles only if they were made by the same store, so the people exported by
+   another store never overwrite the local people with the same ids. */
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"strings"
+)
+
+// Namespace and document type declaration of the written Gramps XML documents
+const (
+	grampsNamespace = "http://gramps-project.org/xml/1.7.1/"
+	grampsDoctype   = `<!DOCTYPE database PUBLIC "-//Gramps//DTD Gramps XML 1.7.1//EN" ` +
+		`"http://gramps-project.org/xml/1.7.1/grampsxml.dtd">`
+)
+
+// Prefix of the handles made by the export (see grampsExportHandlePrefix)
+const grampsHandlePrefix = "_gentree_"
+
+/* Compose the prefix of the person handles made by the export of a store (followed by the person
+   id) */
+func grampsExportHandlePrefix(instance string) string {
+	return grampsHandlePrefix + instance + "_"
+}
+
+// Gramps family relationship types making the husband relation
+var grampsCoupleTypes = map[string]bool{"": true, "Married": true, "Unknown": true}
+
+/* Gramps XML document (only the supported part of the model) */
+type grampsDatabase struct {
+	XMLName  xml.Name       `xml:"database"`
+	Xmlns    string         `xml:"xmlns,attr,omitempty"`
+	Header   grampsHeader   `xml:"header"`
+	People   []grampsPerson `xml:"people>person"`
+	Families []grampsFamily `xml:"families>family"`
+}
+
+type grampsHeader struct {
+	Created struct {
+		Date    string `xml:"date,attr"`
+		Version string `xml:"version,attr"`
+	} `xml:"created"`
+}
+
+type grampsPerson struct {
+	Handle   string       `xml:"handle,attr"`
+	Change   int64        `xml:"change,attr"`
+	Id       string       `xml:"id,attr,omitempty"`
+	Gender   string       `xml:"gender"`
+	Names    []grampsName `xml:"name"`
+	ChildOf  []grampsRef  `xml:"childof"`
+	ParentIn []grampsRef  `xml:"parentin"`
+}
+
+type grampsName struct {
+	// Set to "1" for the alternative names
+	Alt      string          `xml:"alt,attr,omitempty"`
+	Type     string          `xml:"type,attr,omitempty"`
+	First    string          `xml:"first,omitempty"`
+	Surnames []grampsSurname `xml:"surname"`
+}
+
+type grampsSurname struct {
+	// Set to "0" for the secondary surnames
+	Prim  string `xml:"prim,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+/* Reference to another object (by handle) */
+type grampsRef struct {
+	Hlink string `xml:"hlink,attr"`
+}
+
+type grampsFamily struct {
+	Handle   string      `xml:"handle,attr"`
+	Change   int64       `xml:"change,attr"`
+	Id       string      `xml:"id,attr,omitempty"`
+	Rel      *grampsRel  `xml:"rel"`
+	Father   *grampsRef  `xml:"father"`
+	Mother   *grampsRef  `xml:"mother"`
+	Children []grampsRef `xml:"childref"`
+}
+
+/* Relationship type of a family (e.g. Married) */
+type grampsRel struct {
+	Type string `xml:"type,attr"`
+}
+
+/* Summary of the Gramps import */
+type grampsImportReportPayload struct {
+	importReportPayload
+	// People with the known handles updated with the imported data
+	UpdatedPeople int `json:"updated_people"`
+}
+
+/* Convert a Gramps person into a person payload (with no id)
+
+   The primary name (the first one not marked as alternative) and its primary surname are used */
+func (p *grampsPerson) toPayload() fullPersonPayload {
+	person := fullPersonPayload{Gender: gUnknown}
+
+	switch p.Gender {
+	case "M":
+		person.Gender = gMale
+	case "F":
+		person.Gender = gFemale
+	}
+
+	for _, name := range p.Names {
+		if name.Alt == "1" {
+			continue
+		}
+
+		person.Given = strings.TrimSpace(name.First)
+
+		for _, surname := range name.Surnames {
+			if surname.Prim != "0" {
+				person.Surname = strings.TrimSpace(surname.Value)
+				break
+			}
+		}
+
+		break
+	}
+
+	return person
+}
+
+/* Read a Gramps XML document (either gzip compressed or not)
+
+   Return:
+   * the document (valid only if no error occurred)
+   * error (AppError with the errInvalidArgument code if the document is malformed, other error if
+     occurred, and nil otherwise) */
+func readGramps(in io.Reader) (grampsDatabase, error) {
+	var db grampsDatabase
+
+	reader := bufio.NewReader(in)
+	malformed := AppError{errInvalidArgument, "Malformed Gramps XML document"}
+
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		unzipped, err := gzip.NewReader(reader)
+		if err != nil {
+			return db, malformed
+		}
+
+		defer unzipped.Close()
+
+		in = unzipped
+	} else {
+		in = reader
+	}
+
+	if err := xml.NewDecoder(in).Decode(&db); err != nil {
+		log.Infof("Gramps XML document unmarshalling error: %s", err)
+
+		return db, malformed
+	}
+
+	return db, nil
+}
+
+/* Load the Gramps people and families into the store
+
+   The people with the known handles (assigned by a previous import or made by the export) update
+   the existing records. The other people are inserted using their Gramps ids or, if the ids can't
+   be used, the alphanumeric characters of their handles as the person ids. The relations are
+   imported using the importSnapshot function (in the merge mode), so they are subject to the same
+   rules (e.g. the relations are checked by the validateRelation function).
+
+   The function must be called from the function passed to the store update method.
+
+   Params:
+   * tx - the store (as passed to the function run by the store update method)
+   * gen - the relation id generator
+   * db - the Gramps XML document
+   * mode - one of the importXxx constants
+
+   Return:
+   * the import report (valid only if no error occurred)
+   * error (AppError with the errConflict code if the store isn't empty in the empty mode, other
+     error if occurred, and nil otherwise) */
+func importGrampsDatabase(tx Store, gen relationIdGenerator, db grampsDatabase, mode string) (grampsImportReportPayload, error) {
+	report := grampsImportReportPayload{
+		importReportPayload: importReportPayload{Rejected: []importRejectionPayload{}}}
+
+	if mode != importMerge {
+		if empty, err := isStoreEmpty(tx); err != nil {
+			return report, err
+		} else if !empty {
+			return report, AppError{errConflict, "The store is not empty"}
+		}
+	}
+
+	handles, err := tx.queryGrampsHandles()
+	if err != nil {
+		return report, err
+	}
+
+	instance, err := tx.getInstanceId()
+	if err != nil {
+		return report, err
+	}
+
+	prefix := grampsExportHandlePrefix(instance)
+
+	// Person ids keyed by the known handles:
+	pids := make(map[string]string, len(handles))
+
+	for pid, handle := range handles {
+		pids[handle] = pid
+	}
+
+	for _, gp := range db.People {
+		person := gp.toPayload()
+
+		reject := func(reason string) {
+			report.Rejected = append(
+				report.Rejected, importRejectionPayload{Person: &person, Reason: reason})
+		}
+
+		pid, found := pids[gp.Handle]
+
+		if id, generated := strings.CutPrefix(gp.Handle, prefix); !found && generated {
+			if _, exists, err := tx.getPerson(id); exists {
+				pid, found = id, true
+			} else if err != nil {
+				return report, err
+			}
+		}
+
+		if found {
+			person.Id = pid
+
+			existing, _, err := tx.getPerson(pid)
+			if err != nil {
+				return report, err
+			}
+
+			existing.Rev = 0
+
+			if existing == person.toRecord() {
+				report.SkippedPeople++
+			} else if err := tx.updatePerson(person.toRecord()); err != nil {
+				return report, err
+			} else {
+				report.UpdatedPeople++
+			}
+
+			pids[gp.Handle] = pid
+			continue
+		}
+
+		if gp.Handle == "" {
+			person.Id = gp.Id
+			reject("Person has no handle")
+			continue
+		}
+
+		for _, candidate := range []string{gp.Id, gedcomPersonId(gp.Handle)} {
+			if !isValidPersonId(candidate) {
+				continue
+			}
+
+			if used, err := isPersonIdUsed(tx, candidate); err != nil {
+				return report, err
+			} else if !used {
+				person.Id = candidate
+				break
+			}
+		}
+
+		if person.Id == "" {
+			person.Id = gp.Id
+			reject(fmt.Sprintf("Person (%s) has no usable identifier", gp.Handle))
+			continue
+		}
+
+		if err := tx.insertPerson(person.toRecord()); err != nil {
+			return report, err
+		}
+
+		if err := tx.setGrampsHandle(person.Id, gp.Handle); err != nil {
+			return report, err
+		}
+
+		pids[gp.Handle] = person.Id
+		report.ImportedPeople++
+	}
+
+	relations := []relationPayload{}
+
+	for _, family := range db.Families {
+		// Add the relation if both the people are known (reject it otherwise):
+		relate := func(first string, typ string, second string) {
+			relation := relationPayload{Pid1: first, Pid2: second, Type: typ}
+			pid1, found1 := pids[first]
+			pid2, found2 := pids[second]
+
+			if !found1 || !found2 {
+				report.Rejected = append(report.Rejected, importRejectionPayload{
+					Relation: &relation,
+					Reason: fmt.Sprintf(
+						"Family (%s) references an unknown or rejected person", family.Handle)})
+				return
+			}
+
+			relation.Pid1, relation.Pid2 = pid1, pid2
+			relations = append(relations, relation)
+		}
+
+		relType := ""
+
+		if family.Rel != nil {
+			relType = family.Rel.Type
+		}
+
+		if family.Father != nil && family.Mother != nil && grampsCoupleTypes[relType] {
+			relate(family.Father.Hlink, relHusband, family.Mother.Hlink)
+		}
+
+		for _, child := range family.Children {
+			if family.Father != nil {
+				relate(family.Father.Hlink, relFather, child.Hlink)
+			}
+
+			if family.Mother != nil {
+				relate(family.Mother.Hlink, relMother, child.Hlink)
+			}
+		}
+	}
+
+	imported, err := importSnapshot(tx, gen, snapshotPayload{Relations: relations}, importMerge)
+	if err != nil {
+		return report, err
+	}
+
+	report.ImportedRelations = imported.ImportedRelations
+	report.SkippedRelations = imported.SkippedRelations
+	report.Rejected = append(report.Rejected, imported.Rejected...)
+
+	return report, nil
+}
+
+/* Load a Gramps XML document (a .gramps file) into the store (see importGrampsDatabase)
+
+   Params:
+   * store - the store to import the document into
+   * gen - the relation id generator
+   * in - the document source (either gzip compressed or not)
+   * mode - one of the importXxx constants
+
+   Return:
+   * the import report (valid only if no error occurred)
+   * error (AppError with the errInvalidArgument code if the document is malformed, see
+     importGrampsDatabase for the other errors) */
+func loadGramps(store Store, gen relationIdGenerator, in io.Reader, mode string) (grampsImportReportPayload, error) {
+	db, err := readGramps(in)
+	if err != nil {
+		return grampsImportReportPayload{}, err
+	}
+
+	var report grampsImportReportPayload
+
+	err = store.update(func(tx Store) error {
+		var err error
+
+		report, err = importGrampsDatabase(tx, gen, db, mode)
+
+		return err
+	})
+
+	if err != nil {
+		return grampsImportReportPayload{}, err
+	}
+
+	log.Infof("Imported %d people (%d updated) and %d relations from Gramps XML "+
+		"(%d records rejected)", report.ImportedPeople, report.UpdatedPeople,
+		report.ImportedRelations, len(report.Rejected))
+
+	return report, nil
+}
+
+/* Convert the snapshot document into a Gramps XML document
+
+   The relations are grouped into families like in the GEDCOM export (see groupGedcomFamilies).
+   The handles of the people without one are made using the exporting store instance identifier
+   (see grampsExportHandlePrefix). */
+func grampsFromSnapshot(snapshot snapshotPayload, instance string) grampsDatabase {
+	db := grampsDatabase{
+		Xmlns:    grampsNamespace,
+		People:   make([]grampsPerson, 0, len(snapshot.People)),
+		Families: []grampsFamily{},
+	}
+	db.Header.Created.Date = snapshot.ExportedAt.Format("2006-01-02")
+	db.Header.Created.Version = "gentree"
+
+	change := snapshot.ExportedAt.Unix()
+
+	handle := func(pid string) string {
+		if h, found := snapshot.GrampsHandles[pid]; found {
+			return h
+		}
+
+		return grampsExportHandlePrefix(instance) + pid
+	}
+
+	childLinks := map[string][]grampsRef{}
+	parentLinks := map[string][]grampsRef{}
+
+	for idx, family := range groupGedcomFamilies(snapshot.Relations) {
+		gf := grampsFamily{
+			Handle: fmt.Sprintf("%sF_%s_%s", grampsHandlePrefix, family.Husband, family.Wife),
+			Change: change,
+			Id:     fmt.Sprintf("F%04d", idx+1),
+		}
+		gf.Rel = &grampsRel{"Unknown"}
+
+		if family.Husband != "" && family.Wife != "" {
+			gf.Rel.Type = "Married"
+		}
+
+		if family.Husband != "" {
+			gf.Father = &grampsRef{handle(family.Husband)}
+			parentLinks[family.Husband] = append(parentLinks[family.Husband], grampsRef{gf.Handle})
+		}
+
+		if family.Wife != "" {
+			gf.Mother = &grampsRef{handle(family.Wife)}
+			parentLinks[family.Wife] = append(parentLinks[family.Wife], grampsRef{gf.Handle})
+		}
+
+		for _, child := range family.Children {
+			gf.Children = append(gf.Children, grampsRef{handle(child)})
+			childLinks[child] = append(childLinks[child], grampsRef{gf.Handle})
+		}
+
+		db.Families = append(db.Families, gf)
+	}
+
+	for _, person := range snapshot.People {
+		gp := grampsPerson{
+			Handle:   handle(person.Id),
+			Change:   change,
+			Id:       person.Id,
+			Gender:   "U",
+			Names:    []grampsName{{Type: "Birth Name", First: person.Given}},
+			ChildOf:  childLinks[person.Id],
+			ParentIn: parentLinks[person.Id],
+		}
+
+		switch person.Gender {
+		case gMale:
+			gp.Gender = "M"
+		case gFemale:
+			gp.Gender = "F"
+		}
+
+		if person.Surname != "" {
+			gp.Names[0].Surnames = []grampsSurname{{Value: person.Surname}}
+		}
+
+		db.People = append(db.People, gp)
+	}
+
+	return db
+}
+
+/* Write the Gramps XML document (a gzip compressed .gramps file) of the whole store
+
+   Params:
+   * store - the store to be exported
+   * out - the document destination
+
+   Return:
+   * error (if occurred and nil otherwise) */
+func saveGramps(store Store, out io.Writer) error {
+	var snapshot snapshotPayload
+	var instance string
+
+	err := store.view(func(tx Store) error {
+		var err error
+
+		if snapshot, err = exportSnapshot(tx); err != nil {
+			return err
+		}
+
+		instance, err = tx.getInstanceId()
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	zipped := gzip.NewWriter(out)
+
+	if _, err := io.WriteString(zipped, xml.Header+grampsDoctype+"\n"); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(zipped)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(grampsFromSnapshot(snapshot, instance)); err != nil {
+		return err
+	}
+
+	if err := zipped.Close(); err != nil {
+		return err
+	}
+
+	log.Infof("Exported %d people and %d relations to Gramps XML",
+		len(snapshot.People), len(snapshot.Relations))
+
+	return nil
+}
+
+/* Handle a Gramps XML export request
+
+   The response is a gzip compressed Gramps XML document containing all the people and
+   relations */
+func exportGramps(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doExport(c, formatGramps)
+}
+
+/* Handle a Gramps XML import request (see importGedcom) */
+func importGramps(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doImport(c, formatGramps)
+}
@@ -0,0 +1,81 @@
+package main
+
+/* This file defines the in-memory store functions maintaining the Gramps handles of the people
+   (see gramps.go) */
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+)
+
+/* Query the Gramps handles of the people
+
+   Return:
+   * the handles keyed by the person ids (a copy; empty if there are none)
+   * error (if occurred and nil otherwise) */
+func (s *memoryStore) queryGrampsHandles() (map[string]string, error) {
+	log.Debugf("Retrieving the Gramps handles")
+
+	handles := make(map[string]string, len(s.grampsHandles))
+
+	for pid, handle := range s.grampsHandles {
+		handles[pid] = handle
+	}
+
+	return handles, nil
+}
+
+/* Retrieve the Gramps handle of a person
+
+   Return:
+   * the handle (empty if the person has none)
+   * error (if occurred and nil otherwise) */
+func (s *memoryStore) getGrampsHandle(pid string) (string, error) {
+	log.Debugf("Retrieving the Gramps handle of person (%s)", pid)
+
+	return s.grampsHandles[pid], nil
+}
+
+/* Assign a Gramps handle to a person (an empty handle removes the assignment)
+
+   Return:
+   * error (if the person record doesn't exist or the handle is assigned to another person, and
+     nil otherwise) */
+func (s *memoryStore) setGrampsHandle(pid string, handle string) error {
+	log.Debugf("Setting the Gramps handle (%s) of person (%s)", handle, pid)
+
+	if _, found := s.people[pid]; !found {
+		return AppError{errRecordNotFound, fmt.Sprintf("Person record (%s) not found", pid)}
+	}
+
+	if other, found := s.grampsPids[handle]; found && other != pid {
+		return AppError{
+			errDuplicateFound, fmt.Sprintf("Gramps handle (%s) is already assigned", handle)}
+	}
+
+	old, found := s.grampsHandles[pid]
+
+	if found {
+		delete(s.grampsPids, old)
+	}
+
+	if handle == "" {
+		delete(s.grampsHandles, pid)
+	} else {
+		s.grampsHandles[pid] = handle
+		s.grampsPids[handle] = pid
+	}
+
+	s.onUndo(func() {
+		delete(s.grampsPids, handle)
+
+		if found {
+			s.grampsHandles[pid] = old
+			s.grampsPids[old] = pid
+		} else {
+			delete(s.grampsHandles, pid)
+		}
+	})
+
+	return nil
+}
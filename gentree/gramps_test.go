@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testGrampsImportReportJson struct {
+	Message string `json:"message"`
+	Report  struct {
+		ImportedPeople    int                       `json:"imported_people"`
+		UpdatedPeople     int                       `json:"updated_people"`
+		SkippedPeople     int                       `json:"skipped_people"`
+		ImportedRelations int                       `json:"imported_relations"`
+		SkippedRelations  int                       `json:"skipped_relations"`
+		Rejected          []testImportRejectionJson `json:"rejected"`
+	} `json:"report"`
+}
+
+func testGrampsImportReportRes(t *testing.T, res *httptest.ResponseRecorder) testGrampsImportReportJson {
+	payload := testGrampsImportReportJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+/* Compress the data using gzip */
+func testGzip(t *testing.T, data string) io.Reader {
+	buf := &bytes.Buffer{}
+	zipped := gzip.NewWriter(buf)
+
+	_, err := zipped.Write([]byte(data))
+	require.Nil(t, err)
+	require.Nil(t, zipped.Close())
+
+	return buf
+}
+
+const testGrampsFile = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE database PUBLIC "-//Gramps//DTD Gramps XML 1.7.1//EN"
+"http://gramps-project.org/xml/1.7.1/grampsxml.dtd">
+<database xmlns="http://gramps-project.org/xml/1.7.1/">
+  <header>
+    <created date="2024-05-01" version="5.2.0"/>
+  </header>
+  <people>
+    <person handle="_a1" change="1714550400" id="I0001">
+      <gender>M</gender>
+      <name type="Birth Name">
+        <first>Jan</first>
+        <surname>Kowalski</surname>
+      </name>
+      <parentin hlink="_f1"/>
+    </person>
+    <person handle="_b2" change="1714550400" id="I0002">
+      <gender>F</gender>
+      <name alt="1" type="Married Name">
+        <first>Anna</first>
+        <surname>Kowalska</surname>
+      </name>
+      <name type="Birth Name">
+        <first>Anna Maria</first>
+        <surname prim="0">Wiśniewska</surname>
+        <surname>Nowak</surname>
+      </name>
+      <parentin hlink="_f1"/>
+    </person>
+    <person handle="_c3" change="1714550400">
+      <gender>U</gender>
+      <name type="Birth Name">
+        <first>Piotr</first>
+      </name>
+      <childof hlink="_f1"/>
+    </person>
+  </people>
+  <families>
+    <family handle="_f1" change="1714550400" id="F0001">
+      <rel type="Married"/>
+      <father hlink="_a1"/>
+      <mother hlink="_b2"/>
+      <childref hlink="_c3"/>
+      <childref hlink="_x9"/>
+    </family>
+    <family handle="_f2" change="1714550400" id="F0002">
+      <rel type="Unmarried"/>
+      <father hlink="_c3"/>
+      <mother hlink="_b2"/>
+    </family>
+  </families>
+</database>
+`
+
+/* Test the Gramps XML import and export
+
+   1. Import a Gramps XML document
+   2. Import a modified version of the document again (the people are updated, not duplicated)
+   3. Export the data and import it back (nothing changes)
+   4. Attempt to import a malformed document
+   5. Import the exported data into another store (the handles made by the export don't match the
+      people of the other store) */
+func TestGrampsImportExport(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	// Case 1: Import
+
+	res := testMakeRequest(router, "POST", "/import/gramps", strings.NewReader(testGrampsFile))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report := testGrampsImportReportRes(t, res).Report
+
+	assert.Equal(t, 3, report.ImportedPeople)
+	assert.Equal(t, 3, report.ImportedRelations)
+	assert.Equal(t, []testImportRejectionJson{
+		{Relation: &testFullRelationJson{0, "_a1", "_x9", relFather},
+			Reason: "Family (_f1) references an unknown or rejected person"},
+		{Relation: &testFullRelationJson{0, "_b2", "_x9", relMother},
+			Reason: "Family (_f1) references an unknown or rejected person"},
+	}, report.Rejected)
+
+	assert.Equal(t, personRecord{"I0001", "Jan", "Kowalski", gMale, 1}, store.people["I0001"])
+	assert.Equal(t, personRecord{"I0002", "Anna Maria", "Nowak", gFemale, 1}, store.people["I0002"])
+	assert.Equal(t, personRecord{"c3", "Piotr", "", gUnknown, 1}, store.people["c3"])
+	assert.Equal(t, map[string]string{"I0001": "_a1", "I0002": "_b2", "c3": "_c3"},
+		store.grampsHandles)
+
+	_, found, err := queryRelationByData(store, "I0001", relHusband, "I0002")
+
+	assert.Nil(t, err)
+	assert.True(t, found)
+
+	// Case 2: Repeated import
+
+	modified := strings.Replace(testGrampsFile, "<first>Jan</first>", "<first>Janusz</first>", 1)
+
+	res = testMakeRequest(router, "POST", "/import/gramps?mode=merge", testGzip(t, modified))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report = testGrampsImportReportRes(t, res).Report
+
+	assert.Equal(t, 0, report.ImportedPeople)
+	assert.Equal(t, 1, report.UpdatedPeople)
+	assert.Equal(t, 2, report.SkippedPeople)
+	assert.Equal(t, 0, report.ImportedRelations)
+	assert.Equal(t, 3, report.SkippedRelations)
+	assert.Len(t, store.people, 3)
+	assert.Equal(t, personRecord{"I0001", "Janusz", "Kowalski", gMale, 2}, store.people["I0001"])
+
+	// Case 3: Export
+
+	res = testMakeRequest(router, "POST", "/people", testJsonBody(t, testPersonJson{
+		Id: "P9", Given: "Ewa", Surname: "Kowalska", Gender: gFemale}))
+
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	res = testMakeRequest(router, "POST", "/people/I0001/relations", testJsonBody(t,
+		testItRelationJson{Pid: "P9", Type: relFather}))
+
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	res = testMakeRequest(router, "GET", "/export.gramps", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	exported := res.Body.String()
+	unzipped, err := gzip.NewReader(strings.NewReader(exported))
+	require.Nil(t, err)
+
+	var db grampsDatabase
+	require.Nil(t, xml.NewDecoder(unzipped).Decode(&db))
+
+	assert.Equal(t, grampsNamespace, db.Xmlns)
+	require.Len(t, db.People, 4)
+	assert.Equal(t, "_a1", db.People[0].Handle)
+	assert.Equal(t, grampsExportHandlePrefix(store.instanceId)+"P9", db.People[2].Handle)
+	assert.Equal(t, []grampsRef{{db.Families[1].Handle}}, db.People[2].ChildOf)
+	require.Len(t, db.Families, 2)
+	assert.Equal(t, "Married", db.Families[0].Rel.Type)
+	assert.Equal(t, &grampsRef{"_a1"}, db.Families[0].Father)
+	assert.Equal(t, []grampsRef{{"_c3"}}, db.Families[0].Children)
+
+	res = testMakeRequest(router, "POST", "/import/gramps?mode=merge", strings.NewReader(exported))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report = testGrampsImportReportRes(t, res).Report
+
+	assert.Equal(t, 0, report.ImportedPeople)
+	assert.Equal(t, 0, report.UpdatedPeople)
+	assert.Equal(t, 4, report.SkippedPeople)
+	assert.Equal(t, 0, report.ImportedRelations)
+	assert.Empty(t, report.Rejected)
+	assert.Len(t, store.people, 4)
+
+	// Case 4: Malformed document
+
+	res = testMakeRequest(router, "POST", "/import/gramps?mode=merge", strings.NewReader("<database"))
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, "Malformed Gramps XML document", testErrorRes(t, res).Message)
+
+	// Case 5: Another store
+
+	other := newMemoryStore(map[string]personRecord{
+		"P9": {Id: "P9", Given: "Zofia", Surname: "Nowak", Gender: gFemale, Rev: 1}}, nil)
+
+	res = testMakeRequest(
+		setupRouter(other), "POST", "/import/gramps?mode=merge", strings.NewReader(exported))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report = testGrampsImportReportRes(t, res).Report
+
+	assert.Equal(t, 4, report.ImportedPeople)
+	assert.Equal(t, 0, report.UpdatedPeople)
+	assert.Equal(t, personRecord{"P9", "Zofia", "Nowak", gFemale, 1}, other.people["P9"])
+	assert.Len(t, other.people, 5)
+}
+
+/* Test if the Gramps handle mapping survives a deletion and a restoration of a person
+
+   1. Import a Gramps XML document
+   2. Delete a person and restore them from the trash
+   3. Import the document again (no person is duplicated) */
+func TestGrampsImportTrashRoundTrip(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	// Case 1: Import
+
+	res := testMakeRequest(router, "POST", "/import/gramps", strings.NewReader(testGrampsFile))
+
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Len(t, store.people, 3)
+
+	// Case 2: Deletion and restoration
+
+	res = testMakeRequest(router, "DELETE", "/people/I0001", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.NotContains(t, store.grampsHandles, "I0001")
+
+	res = testMakeRequest(router, "POST",
+		fmt.Sprintf("/trash/%d/restore", testTrashIdRes(t, res).TrashId), nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "_a1", store.grampsHandles["I0001"])
+
+	// Case 3: Repeated import
+
+	res = testMakeRequest(
+		router, "POST", "/import/gramps?mode=merge", strings.NewReader(testGrampsFile))
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	report := testGrampsImportReportRes(t, res).Report
+
+	assert.Equal(t, 0, report.ImportedPeople)
+	assert.Equal(t, 3, report.SkippedPeople)
+	assert.Len(t, store.people, 3)
+}
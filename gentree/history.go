@@ -0,0 +1,321 @@
+package main
+
+/* This file defines the request handlers exposing the record revision histories */
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+/* Single field modification of a record revision
+
+   The field name is the name used by the JSON payload of the record (e.g. "given_names") */
+type fieldChangePayload struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+/* Person revision payload returned by the retrievePersonHistory handler */
+type personRevisionPayload struct {
+	Rev     int64                `json:"rev"`
+	Time    time.Time            `json:"time"`
+	Op      string               `json:"op"`
+	Person  fullPersonPayload    `json:"person"`
+	Changes []fieldChangePayload `json:"changes"`
+}
+
+/* Relation revision payload returned by the retrieveRelationHistory handler */
+type relationRevisionPayload struct {
+	Rev      int64                `json:"rev"`
+	Time     time.Time            `json:"time"`
+	Op       string               `json:"op"`
+	Relation relationPayload      `json:"relation"`
+	Changes  []fieldChangePayload `json:"changes"`
+}
+
+/* The structure used to extract person id and revision number from a URI */
+type specifyPersonRevisionUri struct {
+	Pid string `uri:"pid" binding:"required,alphanum|uuid"`
+	Rev int64  `uri:"rev" binding:"required,min=1"`
+}
+
+/* The structure used to extract relation id and revision number from a URI */
+type specifyRelationRevisionUri struct {
+	Rid int64 `uri:"rid" binding:"required"`
+	Rev int64 `uri:"rev" binding:"required,min=1"`
+}
+
+/* Compose the list of field modifications between two field value lists
+
+   Params:
+   * names - the field names
+   * old - the old field values (in the order of names)
+   * new - the new field values (in the order of names)
+
+   Return:
+   * slice of changes (only the modified fields) */
+func diffFields(names []string, old []string, new []string) []fieldChangePayload {
+	changes := []fieldChangePayload{}
+
+	for i, name := range names {
+		if old[i] != new[i] {
+			changes = append(changes, fieldChangePayload{name, old[i], new[i]})
+		}
+	}
+
+	return changes
+}
+
+/* Convert a person revision history to payload
+
+   The changes of every revision are computed against the preceding revision. A record that
+   doesn't exist (before its creation or after its deletion) is treated as a record with all the
+   fields empty.
+
+   Returns:
+   * slice of revision payload structures (oldest first) */
+func personHistoryToPayload(history []personRevision) []personRevisionPayload {
+	payload := make([]personRevisionPayload, 0, len(history))
+	prev := personRecord{}
+
+	for _, rev := range history {
+		curr := rev.Person
+
+		if rev.Op == revDelete {
+			curr = personRecord{}
+		}
+
+		payload = append(payload, personRevisionPayload{
+			Rev:    rev.Person.Rev,
+			Time:   rev.Time,
+			Op:     rev.Op,
+			Person: rev.Person.toPayload(),
+			Changes: diffFields(
+				[]string{"given_names", "surname", "gender"},
+				[]string{prev.Given, prev.Surname, prev.Gender},
+				[]string{curr.Given, curr.Surname, curr.Gender}),
+		})
+
+		prev = curr
+	}
+
+	return payload
+}
+
+/* Convert a relation revision history to payload (see personHistoryToPayload)
+
+   Returns:
+   * slice of revision payload structures (oldest first) */
+func relationHistoryToPayload(history []relationRevision) []relationRevisionPayload {
+	payload := make([]relationRevisionPayload, 0, len(history))
+	prev := relationRecord{}
+
+	for _, rev := range history {
+		curr := rev.Relation
+
+		if rev.Op == revDelete {
+			curr = relationRecord{}
+		}
+
+		payload = append(payload, relationRevisionPayload{
+			Rev:      rev.Relation.Rev,
+			Time:     rev.Time,
+			Op:       rev.Op,
+			Relation: rev.Relation.toPayload(),
+			Changes: diffFields(
+				[]string{"pid1", "pid2", "type"},
+				[]string{prev.Pid1, prev.Pid2, prev.Type},
+				[]string{curr.Pid1, curr.Pid2, curr.Type}),
+		})
+
+		prev = curr
+	}
+
+	return payload
+}
+
+/* Handle a retrieve person history request
+
+   The function will extract the person id from the request URI (specifyPersonUri). The history of
+   a deleted person is available as well. */
+func retrievePersonHistory(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	var params specifyPersonUri
+
+	if err := c.ShouldBindUri(&params); err != nil {
+		log.Infof("Uri parameters unmarshalling error: %s", err)
+
+		c.JSON(http.StatusBadRequest, gin.H{"message": uriErrorMsg})
+		return
+	}
+
+	history, err := getStore(c).queryPersonHistory(params.Pid)
+
+	if err != nil {
+		log.Errorf("An error occurred during the person history retrieval attempt (%s)", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	} else if len(history) == 0 {
+		log.Infof("The person with given id (%s) has no history", params.Pid)
+
+		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown person id"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"records": personHistoryToPayload(history)})
+
+	log.Infof("Found %d revision(s) of the person (%s) record", len(history), params.Pid)
+}
+
+/* Handle a retrieve relation history request
+
+   The function will extract the relation id from the request URI (specifyRelationUri). The history
+   of a deleted relation is available as well. */
+func retrieveRelationHistory(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	var params specifyRelationUri
+
+	if err := c.ShouldBindUri(&params); err != nil {
+		log.Infof("Uri parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": uriErrorMsg})
+		return
+	}
+
+	history, err := getStore(c).queryRelationHistory(params.Rid)
+
+	if err != nil {
+		log.Errorf("An error occurred during the relation history retrieval attempt (%s)", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	} else if len(history) == 0 {
+		log.Infof("The relation with given id (%d) has no history", params.Rid)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown relation id"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"records": relationHistoryToPayload(history)})
+
+	log.Infof("Found %d revision(s) of the relation (%d) record", len(history), params.Rid)
+}
+
+/* Handle a restore person revision request
+
+   The function will extract the person id and the revision number from the request URI
+   (specifyPersonRevisionUri). The person record is replaced with the revision data the same way
+   the replacePerson handler replaces it with the payload data (including the If-Match header
+   check). The deletion revisions can't be restored. */
+func restorePersonRevision(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	var params specifyPersonRevisionUri
+
+	if err := c.ShouldBindUri(&params); err != nil {
+		log.Infof("Uri parameters unmarshalling error: %s", err)
+
+		c.JSON(http.StatusBadRequest, gin.H{"message": uriErrorMsg})
+		return
+	}
+
+	history, err := getStore(c).queryPersonHistory(params.Pid)
+
+	if err != nil {
+		log.Errorf("An error occurred during the person history retrieval attempt (%s)", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	}
+
+	for _, rev := range history {
+		if rev.Person.Rev != params.Rev {
+			continue
+		}
+
+		if rev.Op == revDelete {
+			log.Infof("The person (%s) revision (%d) is a deletion", params.Pid, params.Rev)
+
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Deletion revision can't be restored"})
+			return
+		}
+
+		person := noidPersonPayload{rev.Person.Given, rev.Person.Surname, rev.Person.Gender}
+
+		if err := binding.Validator.ValidateStruct(&person); err != nil {
+			log.Infof("Person revision data validation error: %s", err)
+
+			c.JSON(http.StatusBadRequest, gin.H{"message": payloadErrorMsg})
+			return
+		}
+
+		log.Infof("Restoring the person (%s) revision (%d)", params.Pid, params.Rev)
+
+		doReplacePerson(c, params.Pid, person)
+		return
+	}
+
+	log.Infof("The person (%s) revision (%d) doesn't exist", params.Pid, params.Rev)
+
+	c.JSON(http.StatusNotFound, gin.H{"message": "Unknown revision"})
+}
+
+/* Handle a restore relation revision request
+
+   The function will extract the relation id and the revision number from the request URI
+   (specifyRelationRevisionUri). The relation record is replaced with the revision data the same
+   way the replaceRelation handler replaces it with the payload data (including the If-Match
+   header check). Unlike the payload data, the revision is checked against the current data (see
+   checkRelationReplacement), as the people it refers to may have changed since. The deletion
+   revisions can't be restored. */
+func restoreRelationRevision(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	var params specifyRelationRevisionUri
+
+	if err := c.ShouldBindUri(&params); err != nil {
+		log.Infof("Uri parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": uriErrorMsg})
+		return
+	}
+
+	history, err := getStore(c).queryRelationHistory(params.Rid)
+
+	if err != nil {
+		log.Errorf("An error occurred during the relation history retrieval attempt (%s)", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	}
+
+	for _, rev := range history {
+		if rev.Relation.Rev != params.Rev {
+			continue
+		}
+
+		if rev.Op == revDelete {
+			log.Infof("The relation (%d) revision (%d) is a deletion", params.Rid, params.Rev)
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Deletion revision can't be restored"})
+			return
+		}
+
+		relation := iitRelationPayload{rev.Relation.Pid1, rev.Relation.Pid2, rev.Relation.Type}
+
+		if err := binding.Validator.ValidateStruct(&relation); err != nil {
+			log.Infof("Relation revision data validation error: %s", err)
+			c.JSON(http.StatusBadRequest, gin.H{"message": payloadErrorMsg})
+			return
+		}
+
+		log.Infof("Restoring the relation (%d) revision (%d)", params.Rid, params.Rev)
+
+		doReplaceRelation(c, params.Rid, relation, true)
+		return
+	}
+
+	log.Infof("The relation (%d) revision (%d) doesn't exist", params.Rid, params.Rev)
+	c.JSON(http.StatusNotFound, gin.H{"message": "Unknown revision"})
+}
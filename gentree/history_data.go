@@ -0,0 +1,135 @@
+package main
+
+/* This file defines the record revision history data structures and the in-memory store functions
+   maintaining the history */
+
+import (
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// Revision operation codes
+const (
+	revCreate = "create"
+	revUpdate = "update"
+	revDelete = "delete"
+)
+
+/* Past (or current) state of a person record
+
+   The JSON encoding of the revision is used by the journal snapshot files (see journal_store.go) */
+type personRevision struct {
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	// Record state after the modification (or right before it in the case of deletion); the Rev
+	// field of the record identifies the revision
+	Person personRecord `json:"person"`
+}
+
+/* Past (or current) state of a relation record
+
+   The JSON encoding of the revision is used by the journal snapshot files (see journal_store.go) */
+type relationRevision struct {
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	// Record state after the modification (or right before it in the case of deletion); the Rev
+	// field of the record identifies the revision
+	Relation relationRecord `json:"relation"`
+}
+
+/* Retrieve the time of the modifications being made
+
+   Return:
+   * the store timestamp (if set) or the current time */
+func (s *memoryStore) modificationTime() time.Time {
+	if !s.timestamp.IsZero() {
+		return s.timestamp
+	}
+
+	return time.Now().UTC()
+}
+
+/* Compute the revision number of a newly inserted person record
+
+   The revision numbers of a record re-created with the id of a deleted one continue the history
+   of the deleted record, so that the entity tags of the two are never equal */
+func (s *memoryStore) nextPersonRev(pid string) int64 {
+	history := s.personHistory[pid]
+
+	if len(history) == 0 {
+		return 1
+	}
+
+	return history[len(history)-1].Person.Rev + 1
+}
+
+/* Compute the revision number of a newly inserted relation record (see nextPersonRev) */
+func (s *memoryStore) nextRelationRev(id int64) int64 {
+	history := s.relationHistory[id]
+
+	if len(history) == 0 {
+		return 1
+	}
+
+	return history[len(history)-1].Relation.Rev + 1
+}
+
+/* Append a revision to the person record history
+
+   Params:
+   * op - the revision operation code
+   * person - the record state (see personRevision) */
+func (s *memoryStore) recordPersonRevision(op string, person personRecord) {
+	log.Tracef("Recording person record (%s) revision %d (%s)", person.Id, person.Rev, op)
+
+	cnt := len(s.personHistory[person.Id])
+
+	s.personHistory[person.Id] = append(
+		s.personHistory[person.Id], personRevision{s.modificationTime(), op, person})
+	s.onUndo(func() {
+		if cnt == 0 {
+			delete(s.personHistory, person.Id)
+		} else {
+			s.personHistory[person.Id] = s.personHistory[person.Id][:cnt]
+		}
+	})
+}
+
+/* Append a revision to the relation record history (see recordPersonRevision) */
+func (s *memoryStore) recordRelationRevision(op string, relation relationRecord) {
+	log.Tracef("Recording relation record (%d) revision %d (%s)", relation.Id, relation.Rev, op)
+
+	cnt := len(s.relationHistory[relation.Id])
+
+	s.relationHistory[relation.Id] = append(
+		s.relationHistory[relation.Id], relationRevision{s.modificationTime(), op, relation})
+	s.onUndo(func() {
+		if cnt == 0 {
+			delete(s.relationHistory, relation.Id)
+		} else {
+			s.relationHistory[relation.Id] = s.relationHistory[relation.Id][:cnt]
+		}
+	})
+}
+
+/* Query the revision history of a person record
+
+   Return:
+   * slice of revisions, oldest first (empty if the record never existed)
+   * error (if occurred and nil otherwise) */
+func (s *memoryStore) queryPersonHistory(pid string) ([]personRevision, error) {
+	log.Debugf("Retrieving the person record (%s) history", pid)
+
+	return append([]personRevision{}, s.personHistory[pid]...), nil
+}
+
+/* Query the revision history of a relation record
+
+   Return:
+   * slice of revisions, oldest first (empty if the record never existed)
+   * error (if occurred and nil otherwise) */
+func (s *memoryStore) queryRelationHistory(id int64) ([]relationRevision, error) {
+	log.Debugf("Retrieving the relation record (%d) history", id)
+
+	return append([]relationRevision{}, s.relationHistory[id]...), nil
+}
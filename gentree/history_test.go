@@ -0,0 +1,375 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testFieldChangeJson struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type testPersonRevisionJson struct {
+	Rev     int64                 `json:"rev"`
+	Time    time.Time             `json:"time"`
+	Op      string                `json:"op"`
+	Person  testPersonJson        `json:"person"`
+	Changes []testFieldChangeJson `json:"changes"`
+}
+
+type testPersonHistoryJson struct {
+	Records []testPersonRevisionJson `json:"records"`
+}
+
+func testPersonHistoryRes(t *testing.T, res *httptest.ResponseRecorder) testPersonHistoryJson {
+	payload := testPersonHistoryJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+type testRelationRevisionJson struct {
+	Rev      int64                 `json:"rev"`
+	Op       string                `json:"op"`
+	Relation testFullRelationJson  `json:"relation"`
+	Changes  []testFieldChangeJson `json:"changes"`
+}
+
+type testRelationHistoryJson struct {
+	Records []testRelationRevisionJson `json:"records"`
+}
+
+func testRelationHistoryRes(t *testing.T, res *httptest.ResponseRecorder) testRelationHistoryJson {
+	payload := testRelationHistoryJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+/* Test if every store variant records the revision history and keeps it across restarts
+
+   1. Create, update, delete, and re-create a person and a relation
+   2. Check the history of the records
+   3. Check if the journal store restores the history (with the original timestamps) both from the
+      journal and from the snapshot */
+func TestStoreHistory(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "gentree.journal")
+	journal := testOpenJournalStore(t, journalPath)
+
+	stores := map[string]Store{
+		"memory":  newMemoryStore(nil, nil),
+		"journal": journal,
+		"sqlite":  testOpenSqliteStore(t, filepath.Join(t.TempDir(), "gentree.db")),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			// Case 1: Modifications
+
+			require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+			require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+			require.Nil(t, store.updatePerson(personRecord{"P1", "Janusz", "Kowalski", gMale, 0}))
+			require.Nil(t, store.insertRelation(relationRecord{1, "P1", "P2", relHusband, 0}))
+			require.Nil(t, store.update(func(tx Store) error {
+				if _, err := tx.deleteRelationsByPerson("P1"); err != nil {
+					return err
+				}
+
+				return tx.removePerson("P1")
+			}))
+			require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+			require.Nil(t, store.insertRelation(relationRecord{1, "P1", "P2", relHusband, 0}))
+
+			// Case 2: History
+
+			person, _, err := store.getPerson("P1")
+
+			assert.Nil(t, err)
+			assert.Equal(t, int64(4), person.Rev)
+
+			people, err := store.queryPersonHistory("P1")
+
+			assert.Nil(t, err)
+			require.Len(t, people, 4)
+
+			for i, expected := range []personRevision{
+				{Op: revCreate, Person: personRecord{"P1", "Jan", "Kowalski", gMale, 1}},
+				{Op: revUpdate, Person: personRecord{"P1", "Janusz", "Kowalski", gMale, 2}},
+				{Op: revDelete, Person: personRecord{"P1", "Janusz", "Kowalski", gMale, 3}},
+				{Op: revCreate, Person: personRecord{"P1", "Jan", "Kowalski", gMale, 4}},
+			} {
+				assert.Equal(t, expected.Op, people[i].Op)
+				assert.Equal(t, expected.Person, people[i].Person)
+				assert.WithinDuration(t, time.Now(), people[i].Time, time.Minute)
+			}
+
+			relations, err := store.queryRelationHistory(1)
+
+			assert.Nil(t, err)
+			require.Len(t, relations, 3)
+			assert.Equal(t, revDelete, relations[1].Op)
+			assert.Equal(t, relationRecord{1, "P1", "P2", relHusband, 3}, relations[2].Relation)
+
+			missing, err := store.queryPersonHistory("P9")
+
+			assert.Nil(t, err)
+			assert.Empty(t, missing)
+
+			// Case 3: Journal restart
+
+			if name != "journal" {
+				return
+			}
+
+			require.Nil(t, journal.close())
+			journal = testOpenJournalStore(t, journalPath)
+
+			restored, err := journal.queryPersonHistory("P1")
+
+			assert.Nil(t, err)
+			assert.Equal(t, people, restored)
+
+			require.Nil(t, journal.compact())
+			require.Nil(t, journal.close())
+			journal = testOpenJournalStore(t, journalPath)
+
+			restored, err = journal.queryPersonHistory("P1")
+
+			assert.Nil(t, err)
+			assert.Equal(t, people, restored)
+			assert.Len(t, journal.relationHistory[1], 3)
+		})
+	}
+}
+
+/* Test the person history endpoint
+
+   1. Modify a person using the person endpoints and check the history with the changes
+   2. Delete the person and check if the history is still available
+   3. Check the history of a person that never existed */
+func TestRetrievePersonHistoryRequest(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	// Case 1: Modifications
+
+	res := testMakeRequest(router, "POST", "/people", testJsonBody(t, testPersonJson{
+		Id: "P1", Given: "Jan", Surname: "Kowalski", Gender: gMale}))
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	res = testMakeRequest(router, "PUT", "/people/P1", testJsonBody(t, testPersonJson{
+		Given: "Janina", Surname: "Kowalski", Gender: gFemale}))
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = testMakeRequest(router, "GET", "/people/P1/history", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	history := testPersonHistoryRes(t, res)
+
+	require.Len(t, history.Records, 2)
+	assert.Equal(t, int64(1), history.Records[0].Rev)
+	assert.Equal(t, revCreate, history.Records[0].Op)
+	assert.Equal(t, []testFieldChangeJson{
+		{"given_names", "", "Jan"},
+		{"surname", "", "Kowalski"},
+		{"gender", "", gMale}}, history.Records[0].Changes)
+	assert.Equal(t, int64(2), history.Records[1].Rev)
+	assert.Equal(t, revUpdate, history.Records[1].Op)
+	assert.Equal(t, "Janina", history.Records[1].Person.Given)
+	assert.Equal(t, []testFieldChangeJson{
+		{"given_names", "Jan", "Janina"},
+		{"gender", gMale, gFemale}}, history.Records[1].Changes)
+	assert.False(t, history.Records[1].Time.Before(history.Records[0].Time))
+
+	// Case 2: Deletion
+
+	res = testMakeRequest(router, "DELETE", "/people/P1", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = testMakeRequest(router, "GET", "/people/P1/history", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	history = testPersonHistoryRes(t, res)
+
+	require.Len(t, history.Records, 3)
+	assert.Equal(t, revDelete, history.Records[2].Op)
+	assert.Equal(t, "Janina", history.Records[2].Person.Given)
+	assert.Equal(t, []testFieldChangeJson{
+		{"given_names", "Janina", ""},
+		{"surname", "Kowalski", ""},
+		{"gender", gFemale, ""}}, history.Records[2].Changes)
+
+	// Case 3: Unknown person
+
+	res = testMakeRequest(router, "GET", "/people/P2/history", nil)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, "Unknown person id", testErrorRes(t, res).Message)
+}
+
+/* Test the restore person revision endpoint
+
+   1. Restore a previous revision
+   2. Attempt to restore a revision with a stale If-Match header
+   3. Attempt to restore a missing revision
+   4. Attempt to restore a revision of a deleted person and a deletion revision */
+func TestRestorePersonRevisionRequest(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.updatePerson(personRecord{"P1", "Janina", "Nowak", gFemale, 0}))
+
+	// Case 1: Restore
+
+	res := testMakeRequest(router, "POST", "/people/P1/history/1/restore", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `"3"`, res.Header().Get("ETag"))
+	assert.Equal(t, personRecord{"P1", "Jan", "Kowalski", gMale, 3}, store.people["P1"])
+	assert.Len(t, store.personHistory["P1"], 3)
+
+	// Case 2: Stale If-Match header
+
+	res = testMakeRequestWithHeaders(
+		router, "POST", "/people/P1/history/2/restore", nil, map[string]string{"If-Match": `"2"`})
+
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code)
+	assert.Equal(t, "Jan", store.people["P1"].Given)
+
+	// Case 3: Missing revision
+
+	res = testMakeRequest(router, "POST", "/people/P1/history/7/restore", nil)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, "Unknown revision", testErrorRes(t, res).Message)
+
+	res = testMakeRequest(router, "POST", "/people/P1/history/0/restore", nil)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	// Case 4: Deleted person
+
+	require.Nil(t, store.removePerson("P1"))
+
+	res = testMakeRequest(router, "POST", "/people/P1/history/2/restore", nil)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, "Unknown person id", testErrorRes(t, res).Message)
+
+	res = testMakeRequest(router, "POST", "/people/P1/history/4/restore", nil)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, "Deletion revision can't be restored", testErrorRes(t, res).Message)
+}
+
+/* Test the relation history and restore relation revision endpoints
+
+   1. Check the history of a modified relation
+   2. Restore a previous revision
+   3. Check the history of a relation that never existed */
+func TestRelationHistoryRequests(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Kowalska", gFemale, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{1, "P1", "P2", relHusband, 0}))
+	require.Nil(t, store.updateRelation(relationRecord{1, "P2", "P1", relMother, 0}))
+
+	// Case 1: History
+
+	res := testMakeRequest(router, "GET", "/relations/1/history", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	history := testRelationHistoryRes(t, res)
+
+	require.Len(t, history.Records, 2)
+	assert.Equal(t, testFullRelationJson{1, "P1", "P2", relHusband}, history.Records[0].Relation)
+	assert.Equal(t, []testFieldChangeJson{
+		{"pid1", "P1", "P2"},
+		{"pid2", "P2", "P1"},
+		{"type", relHusband, relMother}}, history.Records[1].Changes)
+
+	// Case 2: Restore
+
+	res = testMakeRequestWithHeaders(
+		router, "POST", "/relations/1/history/1/restore", nil, map[string]string{"If-Match": `"2"`})
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, relationRecord{1, "P1", "P2", relHusband, 3}, store.relations[1])
+
+	// Case 3: Unknown relation
+
+	res = testMakeRequest(router, "GET", "/relations/2/history", nil)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, "Unknown relation id", testErrorRes(t, res).Message)
+}
+
+/* Test the restore relation revision endpoint with the revisions conflicting with the current data
+
+   1. Restore a revision adding another father of the same person
+   2. Restore a revision referring to a deleted person
+   3. Replace the relation with the same data using the replace relation endpoint (the payload
+      isn't checked against the current data, only the restored revisions are) */
+func TestRestoreRelationRevisionConflict(t *testing.T) {
+	setup := func() *memoryStore {
+		store := newMemoryStore(nil, nil)
+
+		require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+		require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Kowalska", gFemale, 0}))
+		require.Nil(t, store.insertPerson(personRecord{"P3", "Adam", "Kowalski", gMale, 0}))
+		require.Nil(t, store.insertPerson(personRecord{"P4", "Piotr", "Nowak", gMale, 0}))
+		require.Nil(t, store.insertRelation(relationRecord{1, "P1", "P3", relFather, 0}))
+		require.Nil(t, store.updateRelation(relationRecord{1, "P2", "P3", relMother, 0}))
+		require.Nil(t, store.insertRelation(relationRecord{2, "P4", "P3", relFather, 0}))
+
+		return store
+	}
+
+	store := setup()
+	router := setupRouter(store)
+
+	// Case 1: Another father
+
+	res := testMakeRequest(router, "POST", "/relations/1/history/1/restore", nil)
+
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.Equal(t, "Relation (P1, father, P3) is invalid", testErrorRes(t, res).Message)
+	assert.Equal(t, relationRecord{1, "P2", "P3", relMother, 2}, store.relations[1])
+
+	// Case 2: Deleted person
+
+	res = testMakeRequest(router, "DELETE", "/relations/2", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = testMakeRequest(router, "DELETE", "/people/P1", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	res = testMakeRequest(router, "POST", "/relations/1/history/1/restore", nil)
+
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.Equal(t, "Relation (P1, father, P3) is invalid", testErrorRes(t, res).Message)
+	assert.Equal(t, relationRecord{1, "P2", "P3", relMother, 2}, store.relations[1])
+
+	// Case 3: Replace relation endpoint
+
+	store = setup()
+
+	res = testMakeRequest(setupRouter(store), "PUT", "/relations/1", testJsonBody(t,
+		testIitRelationJson{Pid1: "P1", Pid2: "P3", Type: relFather}))
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, relationRecord{1, "P1", "P3", relFather, 3}, store.relations[1])
+}
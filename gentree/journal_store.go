@@ -0,0 +1,718 @@
+package main
+
+/* This file defines the journaling implementation of the Store interface
+
+   The journal store keeps the data in memory (see memoryStore) and appends every modification to
+   a journal file before the modifying store method returns. At startup, the in-memory data is
+   rebuilt by replaying the journal. To keep the journal file short, the data is periodically
+   compacted into a snapshot file, and the journal is truncated. The store instance identifier is
+   kept in a separate file written when the journal is created. */
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Journal entry operation codes
+const (
+	jopInsertPerson            = "insert_person"
+	jopUpdatePerson            = "update_person"
+	jopRemovePerson            = "remove_person"
+	jopInsertRelation          = "insert_relation"
+	jopUpdateRelation          = "update_relation"
+	jopRemoveRelation          = "remove_relation"
+	jopDeleteRelationsByPerson = "delete_relations_by_person"
+	jopInsertTrash             = "insert_trash"
+	jopRemoveTrash             = "remove_trash"
+	jopPurgeTrash              = "purge_trash"
+	jopSetGedcomExtensions     = "set_gedcom_extensions"
+	jopSetGrampsHandle         = "set_gramps_handle"
+	// Multiple modifications performed by a single update call
+	jopBatch = "batch"
+)
+
+/* Version of the snapshot file format
+
+   Version history:
+   1. Initial format
+   2. Record revision histories added
+   3. Trash added
+   4. GEDCOM extensions added
+   5. Gramps handles added */
+const journalSnapshotVersion = 5
+
+/* Single modification recorded in the journal file
+
+   The journal file contains one JSON encoded entry per line. Depending on the operation, only some
+   of the optional fields are set. */
+type journalEntry struct {
+	// Sequence number of the entry (increasing, never reset by the compaction)
+	Seq      int64           `json:"seq"`
+	Time     time.Time       `json:"time"`
+	Op       string          `json:"op"`
+	Person   *personRecord   `json:"person,omitempty"`
+	Relation *relationRecord `json:"relation,omitempty"`
+	Pid      string          `json:"pid,omitempty"`
+	Rid      int64           `json:"rid,omitempty"`
+	Trash    *trashRecord    `json:"trash,omitempty"`
+	TrashId  int64           `json:"trash_id,omitempty"`
+	// Time limit of the trash purge
+	Before *time.Time `json:"before,omitempty"`
+	// GEDCOM extensions of the person (an empty list removes them)
+	Extensions []gedcomExtension `json:"extensions,omitempty"`
+	// Gramps handle of the person (an empty handle removes it)
+	Handle string `json:"handle,omitempty"`
+	// Modifications of the batch entry (in order)
+	Batch []journalEntry `json:"batch,omitempty"`
+}
+
+/* Content of the snapshot file
+
+   The snapshot contains the complete data state after applying the journal entries up to the given
+   sequence number (inclusive) */
+type journalSnapshot struct {
+	Version   int              `json:"version"`
+	Seq       int64            `json:"seq"`
+	People    []personRecord   `json:"people"`
+	Relations []relationRecord `json:"relations"`
+	// Revision histories of all the records (in order within each record)
+	PersonHistory   []personRevision   `json:"person_history"`
+	RelationHistory []relationRevision `json:"relation_history"`
+	Trash           []trashRecord      `json:"trash"`
+	LastTrashId     int64              `json:"last_trash_id"`
+	// GEDCOM extensions keyed by the person ids
+	GedcomExtensions map[string][]gedcomExtension `json:"gedcom_extensions,omitempty"`
+	// Gramps handles keyed by the person ids
+	GrampsHandles map[string]string `json:"gramps_handles,omitempty"`
+}
+
+/* Journaling implementation of the Store interface
+
+   The query methods are provided by the embedded in-memory store. The modification methods apply
+   the modification to the in-memory store and record it in the journal (see the update method).
+   Like the memory store, the journal store isn't safe for concurrent use (see lockingStore); the
+   mutex only protects the data against the periodic compaction. */
+type journalStore struct {
+	*memoryStore
+
+	// Serializes the modifications and the compaction
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+	// Size of the journal file including the last complete entry
+	size int64
+	// Sequence number of the last journal entry
+	seq int64
+	// Modifications of the running update call (nil if no update call is running)
+	pending []journalEntry
+	// Closed when the store is closed to stop the periodic compaction
+	done chan struct{}
+}
+
+/* Compose the snapshot file path from the journal file path */
+func journalSnapshotPath(path string) string {
+	return path + ".snapshot"
+}
+
+/* Compose the instance identifier file path from the journal file path */
+func journalInstancePath(path string) string {
+	return path + ".instance"
+}
+
+/* Open the journal (and create it if necessary) and rebuild the data by replaying it
+
+   Params:
+   * path - the journal file path (the snapshot file path is derived from it)
+   * compactInterval - interval of the periodic compaction (zero disables the compaction)
+
+   Return:
+   * the store (nil if an error occurred)
+   * error (if occurred and nil otherwise) */
+func openJournalStore(path string, compactInterval time.Duration) (*journalStore, error) {
+	log.Debugf("Opening the journal (%s)", path)
+
+	s := &journalStore{memoryStore: newMemoryStore(nil, nil), path: path, done: make(chan struct{})}
+
+	if err := s.loadInstanceId(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s.file, s.size = file, info.Size()
+
+	log.Infof(
+		"Restored %d person(s) and %d relation(s) from the journal (last entry: %d)",
+		len(s.people), len(s.relations), s.seq)
+
+	if compactInterval > 0 {
+		go s.compactPeriodically(compactInterval)
+	}
+
+	return s, nil
+}
+
+/* Load the store instance identifier (and record the generated one if there is none yet) */
+func (s *journalStore) loadInstanceId() error {
+	data, err := os.ReadFile(journalInstancePath(s.path))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Debugf("No store instance identifier found")
+
+		return writeFileSync(journalInstancePath(s.path), []byte(s.instanceId))
+	} else if err != nil {
+		return err
+	}
+
+	s.instanceId = strings.TrimSpace(string(data))
+
+	return nil
+}
+
+/* Load the snapshot file (if it exists) into the in-memory store */
+func (s *journalStore) loadSnapshot() error {
+	data, err := os.ReadFile(journalSnapshotPath(s.path))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Debugf("No journal snapshot found")
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var snapshot journalSnapshot
+
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+
+	// The older versions lack some of the data, but are still readable:
+	if snapshot.Version < 1 || snapshot.Version > journalSnapshotVersion {
+		return AppError{
+			errInvalidArgument,
+			fmt.Sprintf("Unsupported journal snapshot version (%d)", snapshot.Version)}
+	}
+
+	for _, p := range snapshot.People {
+		s.putPerson(p)
+	}
+
+	for _, r := range snapshot.Relations {
+		s.putRelation(r)
+	}
+
+	for _, rev := range snapshot.PersonHistory {
+		s.personHistory[rev.Person.Id] = append(s.personHistory[rev.Person.Id], rev)
+	}
+
+	for _, rev := range snapshot.RelationHistory {
+		s.relationHistory[rev.Relation.Id] = append(s.relationHistory[rev.Relation.Id], rev)
+	}
+
+	for _, item := range snapshot.Trash {
+		s.trash[item.Id] = item
+	}
+
+	s.lastTrashId = snapshot.LastTrashId
+
+	for pid, extensions := range snapshot.GedcomExtensions {
+		s.gedcomExtensions[pid] = extensions
+	}
+
+	for pid, handle := range snapshot.GrampsHandles {
+		s.grampsHandles[pid] = handle
+		s.grampsPids[handle] = pid
+	}
+
+	s.seq = snapshot.Seq
+
+	return nil
+}
+
+/* Apply the journal entries newer than the loaded snapshot to the in-memory store
+
+   An incomplete last line (a result of a crash during the entry write) is discarded. Any other
+   malformed line makes the replay fail. */
+func (s *journalStore) replay() error {
+	file, err := os.OpenFile(s.path, os.O_RDWR, 0)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Debugf("No journal found")
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64 = 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Warnf("Discarding the incomplete last journal entry (offset: %d)", offset)
+
+				return file.Truncate(offset)
+			}
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var entry journalEntry
+
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return AppError{
+				errInvalidArgument,
+				fmt.Sprintf("Malformed journal entry (offset: %d): %s", offset, err)}
+		}
+
+		offset += int64(len(line))
+
+		if entry.Seq <= s.seq {
+			// Already included in the snapshot
+			continue
+		}
+
+		// The revisions must be recorded with the original modification time:
+		s.timestamp = entry.Time
+		err = s.apply(entry)
+		s.timestamp = time.Time{}
+
+		if err != nil {
+			return fmt.Errorf("journal entry #%d replay failed: %w", entry.Seq, err)
+		}
+
+		s.seq = entry.Seq
+	}
+}
+
+/* Apply a journal entry to the in-memory store */
+func (s *journalStore) apply(entry journalEntry) error {
+	if (entry.Person == nil && (entry.Op == jopInsertPerson || entry.Op == jopUpdatePerson)) ||
+		(entry.Relation == nil && (entry.Op == jopInsertRelation || entry.Op == jopUpdateRelation)) ||
+		(entry.Trash == nil && entry.Op == jopInsertTrash) ||
+		(entry.Before == nil && entry.Op == jopPurgeTrash) {
+		return AppError{errInvalidArgument, fmt.Sprintf("Incomplete journal entry (%s)", entry.Op)}
+	}
+
+	switch entry.Op {
+	case jopInsertPerson:
+		return s.memoryStore.insertPerson(*entry.Person)
+	case jopUpdatePerson:
+		return s.memoryStore.updatePerson(*entry.Person)
+	case jopRemovePerson:
+		return s.memoryStore.removePerson(entry.Pid)
+	case jopInsertRelation:
+		return s.memoryStore.insertRelation(*entry.Relation)
+	case jopUpdateRelation:
+		return s.memoryStore.updateRelation(*entry.Relation)
+	case jopRemoveRelation:
+		return s.memoryStore.removeRelation(entry.Rid)
+	case jopDeleteRelationsByPerson:
+		_, err := s.memoryStore.deleteRelationsByPerson(entry.Pid)
+		return err
+	case jopInsertTrash:
+		// The identifiers are assigned in order, so the replay must reproduce the recorded one:
+		if id, err := s.memoryStore.insertTrash(*entry.Trash); err != nil {
+			return err
+		} else if id != entry.Trash.Id {
+			return AppError{
+				errInvalidArgument,
+				fmt.Sprintf("Trash item identifier mismatch (%d != %d)", id, entry.Trash.Id)}
+		}
+
+		return nil
+	case jopRemoveTrash:
+		return s.memoryStore.removeTrash(entry.TrashId)
+	case jopPurgeTrash:
+		_, err := s.memoryStore.purgeTrash(*entry.Before)
+		return err
+	case jopSetGedcomExtensions:
+		return s.memoryStore.setGedcomExtensions(entry.Pid, entry.Extensions)
+	case jopSetGrampsHandle:
+		return s.memoryStore.setGrampsHandle(entry.Pid, entry.Handle)
+	case jopBatch:
+		for _, sub := range entry.Batch {
+			if err := s.apply(sub); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return AppError{errInvalidArgument, fmt.Sprintf("Unknown journal operation (%s)", entry.Op)}
+}
+
+/* Append an entry to the journal and flush it to the disk
+
+   The function assigns the entry sequence number and time (the time of the modifications, see the
+   update method). If the write fails (e.g. the disk is full), the part of the entry that might
+   have been written is removed, so that the next entry doesn't follow an incomplete line. The
+   caller must hold the mutex. */
+func (s *journalStore) append(entry journalEntry) error {
+	entry.Seq = s.seq + 1
+	entry.Time = s.timestamp
+
+	for i := range entry.Batch {
+		entry.Batch[i].Seq = entry.Seq
+		entry.Batch[i].Time = entry.Time
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	data = append(data, '\n')
+
+	if _, err := s.file.Write(data); err != nil {
+		return s.discardPartialEntry(err)
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return s.discardPartialEntry(err)
+	}
+
+	s.seq = entry.Seq
+	s.size += int64(len(data))
+
+	return nil
+}
+
+/* Truncate the journal to its last complete entry after a failed write
+
+   The journal is truncated using its path, because the file opened for writing might be unusable
+   after the failure.
+
+   Params:
+   * err - the write error
+
+   Return:
+   * the write error */
+func (s *journalStore) discardPartialEntry(err error) error {
+	if truncErr := os.Truncate(s.path, s.size); truncErr != nil {
+		log.Errorf("The journal can't be truncated after a failed write (%s)", truncErr)
+	} else {
+		log.Warnf("Discarded the journal entry that failed to be written (%s)", err)
+	}
+
+	return err
+}
+
+/* Run the given function with the store itself and record its modifications in the journal
+
+   The modifications are applied to the in-memory store immediately, but they are recorded in the
+   journal only when the function succeeds. Multiple modifications are recorded as a single batch
+   entry, so that they are replayed all or none even if the server crashes during the journal
+   write. If the function or the journal write fails, the in-memory store modifications are
+   reverted. Nested calls are a part of the outermost call. */
+func (s *journalStore) update(fn func(tx Store) error) error {
+	if s.pending != nil {
+		return fn(s)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pending = []journalEntry{}
+	defer func() { s.pending = nil }()
+
+	// All the modifications are recorded (both in the journal and in the revision histories) with
+	// the same time:
+	s.timestamp = time.Now().UTC()
+	defer func() { s.timestamp = time.Time{} }()
+
+	// The embedded memory store update method reverts the modifications on failure:
+	return s.memoryStore.update(func(Store) error {
+		if err := fn(s); err != nil {
+			return err
+		}
+
+		if len(s.pending) == 0 {
+			return nil
+		}
+
+		entry := s.pending[0]
+
+		if len(s.pending) > 1 {
+			entry = journalEntry{Op: jopBatch, Batch: s.pending}
+		}
+
+		if err := s.append(entry); err != nil {
+			log.Errorf("Failed to append an entry to the journal (%s)", err)
+
+			return err
+		}
+
+		return nil
+	})
+}
+
+/* Run the given function with the store itself (see memoryStore.view)
+
+   The store is passed instead of the embedded memory store, so that the function can't bypass
+   the journal */
+func (s *journalStore) view(fn func(tx Store) error) error {
+	return fn(s)
+}
+
+/* Apply a modification to the in-memory store and schedule its recording in the journal
+
+   Modifications requested outside of the update method are wrapped with it */
+func (s *journalStore) modify(entry journalEntry) error {
+	if s.pending == nil {
+		return s.update(func(Store) error { return s.modify(entry) })
+	}
+
+	if err := s.apply(entry); err != nil {
+		return err
+	}
+
+	s.pending = append(s.pending, entry)
+
+	return nil
+}
+
+func (s *journalStore) insertPerson(person personRecord) error {
+	return s.modify(journalEntry{Op: jopInsertPerson, Person: &person})
+}
+
+func (s *journalStore) updatePerson(person personRecord) error {
+	return s.modify(journalEntry{Op: jopUpdatePerson, Person: &person})
+}
+
+func (s *journalStore) removePerson(pid string) error {
+	return s.modify(journalEntry{Op: jopRemovePerson, Pid: pid})
+}
+
+func (s *journalStore) setGedcomExtensions(pid string, extensions []gedcomExtension) error {
+	return s.modify(journalEntry{Op: jopSetGedcomExtensions, Pid: pid, Extensions: extensions})
+}
+
+func (s *journalStore) setGrampsHandle(pid string, handle string) error {
+	return s.modify(journalEntry{Op: jopSetGrampsHandle, Pid: pid, Handle: handle})
+}
+
+func (s *journalStore) insertRelation(relation relationRecord) error {
+	return s.modify(journalEntry{Op: jopInsertRelation, Relation: &relation})
+}
+
+func (s *journalStore) updateRelation(relation relationRecord) error {
+	return s.modify(journalEntry{Op: jopUpdateRelation, Relation: &relation})
+}
+
+func (s *journalStore) removeRelation(id int64) error {
+	return s.modify(journalEntry{Op: jopRemoveRelation, Rid: id})
+}
+
+func (s *journalStore) deleteRelationsByPerson(pid string) (int64, error) {
+	var cnt int64
+
+	// The number of the deleted relations is known only after the deletion, so the modify method
+	// (applying the entry on its own) can't be used here:
+	err := s.update(func(Store) error {
+		var err error
+
+		if cnt, err = s.memoryStore.deleteRelationsByPerson(pid); err != nil {
+			return err
+		}
+
+		s.pending = append(s.pending, journalEntry{Op: jopDeleteRelationsByPerson, Pid: pid})
+
+		return nil
+	})
+
+	return cnt, err
+}
+
+func (s *journalStore) insertTrash(item trashRecord) (int64, error) {
+	// The identifier and time are assigned by the in-memory store, and they must be recorded in
+	// the journal, so the modify method can't be used here (see deleteRelationsByPerson):
+	err := s.update(func(Store) error {
+		var err error
+
+		if item.Id, err = s.memoryStore.insertTrash(item); err != nil {
+			return err
+		}
+
+		item.Time = s.trash[item.Id].Time
+		s.pending = append(s.pending, journalEntry{Op: jopInsertTrash, Trash: &item})
+
+		return nil
+	})
+
+	return item.Id, err
+}
+
+func (s *journalStore) removeTrash(id int64) error {
+	return s.modify(journalEntry{Op: jopRemoveTrash, TrashId: id})
+}
+
+func (s *journalStore) purgeTrash(before time.Time) (int64, error) {
+	var cnt int64
+
+	err := s.update(func(Store) error {
+		var err error
+
+		if cnt, err = s.memoryStore.purgeTrash(before); err != nil {
+			return err
+		}
+
+		s.pending = append(s.pending, journalEntry{Op: jopPurgeTrash, Before: &before})
+
+		return nil
+	})
+
+	return cnt, err
+}
+
+/* Write the current data state to the snapshot file and truncate the journal
+
+   The snapshot is written to a temporary file first, and then renamed, so that a crash never
+   leaves a partially written snapshot. If a crash occurs after the rename but before the journal
+   truncation, the journal entries already included in the snapshot are skipped on replay thanks to
+   the sequence numbers. */
+func (s *journalStore) compact() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	log.Debugf("Compacting the journal (last entry: %d)", s.seq)
+
+	snapshot := journalSnapshot{
+		Version:   journalSnapshotVersion,
+		Seq:       s.seq,
+		People:    make([]personRecord, 0, len(s.people)),
+		Relations: make([]relationRecord, 0, len(s.relations)),
+	}
+
+	for _, p := range s.people {
+		snapshot.People = append(snapshot.People, p)
+	}
+
+	for _, r := range s.relations {
+		snapshot.Relations = append(snapshot.Relations, r)
+	}
+
+	for _, history := range s.personHistory {
+		snapshot.PersonHistory = append(snapshot.PersonHistory, history...)
+	}
+
+	for _, history := range s.relationHistory {
+		snapshot.RelationHistory = append(snapshot.RelationHistory, history...)
+	}
+
+	snapshot.Trash = make([]trashRecord, 0, len(s.trash))
+
+	for _, item := range s.trash {
+		snapshot.Trash = append(snapshot.Trash, item)
+	}
+
+	snapshot.LastTrashId = s.lastTrashId
+	snapshot.GedcomExtensions = s.gedcomExtensions
+	snapshot.GrampsHandles = s.grampsHandles
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := journalSnapshotPath(s.path) + ".tmp"
+
+	if err := writeFileSync(tmpPath, data); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, journalSnapshotPath(s.path)); err != nil {
+		return err
+	}
+
+	if err := s.file.Truncate(0); err != nil {
+		return err
+	}
+
+	s.size = 0
+
+	log.Infof("Compacted the journal (last entry: %d)", s.seq)
+
+	return s.file.Sync()
+}
+
+/* Write data to a file and flush the file to the disk */
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+/* Compact the journal in the given intervals until the store is closed */
+func (s *journalStore) compactPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.compact(); err != nil {
+				log.Errorf("An error occurred during the journal compaction attempt (%s)", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+/* Stop the periodic compaction and close the journal file */
+func (s *journalStore) close() error {
+	close(s.done)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.file.Close()
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/* Open a journal store with the periodic compaction disabled
+
+   The store is closed automatically at the end of the test */
+func testOpenJournalStore(t *testing.T, path string) *journalStore {
+	store, err := openJournalStore(path, 0)
+	require.Nil(t, err)
+
+	t.Cleanup(func() { store.file.Close() })
+
+	return store
+}
+
+/* Test if the modifications are recorded in the journal and restored on replay
+
+   1. Modify the data and re-open the journal
+   2. Check if a failed modification isn't recorded in the journal */
+func TestJournalStoreReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gentree.journal")
+
+	store := testOpenJournalStore(t, path)
+
+	// Case 1: Replay of the modifications
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P3", "Adam", "Kowalski", gMale, 0}))
+	require.Nil(t, store.updatePerson(personRecord{"P2", "Anna", "Kowalska", gFemale, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{1, "P1", "P3", relFather, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{2, "P2", "P3", relFather, 0}))
+	require.Nil(t, store.updateRelation(relationRecord{2, "P2", "P3", relMother, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{3, "P1", "P2", relHusband, 0}))
+	require.Nil(t, store.removeRelation(3))
+
+	require.Nil(t, store.close())
+
+	store = testOpenJournalStore(t, path)
+
+	assert.Equal(t, int64(9), store.seq)
+	assert.Equal(t, map[string]personRecord{
+		"P1": {"P1", "Jan", "Kowalski", gMale, 1},
+		"P2": {"P2", "Anna", "Kowalska", gFemale, 2},
+		"P3": {"P3", "Adam", "Kowalski", gMale, 1}}, store.people)
+	assert.Equal(t, map[int64]relationRecord{
+		1: {1, "P1", "P3", relFather, 1},
+		2: {2, "P2", "P3", relMother, 2}}, store.relations)
+
+	// Case 2: Failed modifications
+
+	err := store.insertPerson(personRecord{"P1", "Janina", "Kowalska", gFemale, 0})
+
+	assert.Equal(t, errDuplicateFound, err.(AppError).Code)
+
+	err = store.updateRelation(relationRecord{3, "P1", "P2", relHusband, 0})
+
+	assert.Equal(t, errRecordNotFound, err.(AppError).Code)
+
+	err = store.removePerson("P4")
+
+	assert.Equal(t, errRecordNotFound, err.(AppError).Code)
+
+	assert.Equal(t, int64(9), store.seq)
+
+	require.Nil(t, store.close())
+
+	store = testOpenJournalStore(t, path)
+
+	assert.Equal(t, int64(9), store.seq)
+	assert.Equal(t, "Jan", store.people["P1"].Given)
+}
+
+/* Test the delete person endpoint cascade recording in the journal */
+func TestJournalStoreDeletePersonRequest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gentree.journal")
+
+	store := testOpenJournalStore(t, path)
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P3", "Adam", "Kowalski", gMale, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{1, "P1", "P3", relFather, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{2, "P2", "P3", relMother, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{3, "P1", "P2", relHusband, 0}))
+
+	router := setupRouter(store)
+
+	res := testMakeRequest(router, "DELETE", "/people/P1", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	require.Nil(t, store.close())
+
+	store = testOpenJournalStore(t, path)
+
+	assert.Len(t, store.people, 2)
+	assert.Equal(t, map[int64]relationRecord{2: {2, "P2", "P3", relMother, 1}}, store.relations)
+}
+
+/* Test the journal compaction
+
+   1. Compact the journal and check if the data is restored from the snapshot
+   2. Check if the entries recorded after the compaction are replayed on top of the snapshot
+   3. Check if the entries already included in the snapshot are skipped (the case of a crash
+      between the snapshot creation and the journal truncation) */
+func TestJournalStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gentree.journal")
+
+	store := testOpenJournalStore(t, path)
+
+	// Case 1: Compaction
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{1, "P1", "P2", relHusband, 0}))
+
+	journal, err := os.ReadFile(path)
+	require.Nil(t, err)
+
+	require.Nil(t, store.compact())
+
+	info, err := os.Stat(path)
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+
+	require.Nil(t, store.close())
+
+	store = testOpenJournalStore(t, path)
+
+	assert.Equal(t, int64(3), store.seq)
+	assert.Len(t, store.people, 2)
+	assert.Len(t, store.relations, 1)
+
+	// Case 2: Entries recorded after the compaction
+
+	require.Nil(t, store.updatePerson(personRecord{"P2", "Anna", "Kowalska", gFemale, 0}))
+	require.Nil(t, store.close())
+
+	store = testOpenJournalStore(t, path)
+
+	assert.Equal(t, int64(4), store.seq)
+	assert.Equal(t, "Kowalska", store.people["P2"].Surname)
+
+	require.Nil(t, store.close())
+
+	// Case 3: Entries included in the snapshot
+
+	require.Nil(t, os.WriteFile(path, journal, 0o644))
+
+	store = testOpenJournalStore(t, path)
+
+	assert.Equal(t, int64(3), store.seq)
+	assert.Len(t, store.people, 2)
+	assert.Equal(t, "Nowak", store.people["P2"].Surname)
+}
+
+/* Test the replay of a damaged journal
+
+   1. An incomplete last entry is discarded
+   2. A malformed entry in the middle of the journal makes the replay fail */
+func TestJournalStoreDamaged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gentree.journal")
+
+	store := testOpenJournalStore(t, path)
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.close())
+
+	// Case 1: Incomplete last entry
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.Nil(t, err)
+	_, err = file.WriteString(`{"seq":2,"op":"insert_pers`)
+	require.Nil(t, err)
+	require.Nil(t, file.Close())
+
+	store = testOpenJournalStore(t, path)
+
+	assert.Equal(t, int64(1), store.seq)
+	assert.Len(t, store.people, 1)
+
+	require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+	require.Nil(t, store.close())
+
+	store = testOpenJournalStore(t, path)
+
+	assert.Equal(t, int64(2), store.seq)
+	assert.Len(t, store.people, 2)
+
+	require.Nil(t, store.close())
+
+	// Case 2: Malformed entry
+
+	journal, err := os.ReadFile(path)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(path, append([]byte("{]\n"), journal...), 0o644))
+
+	_, err = openJournalStore(path, 0)
+
+	assert.Equal(t, errInvalidArgument, err.(AppError).Code)
+}
+
+/* Test the journal write failure handling
+
+   1. A failed entry write leaves a half-written entry that is removed
+   2. The next entry is recorded and replayed correctly */
+func TestJournalStoreWriteFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gentree.journal")
+
+	store := testOpenJournalStore(t, path)
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+
+	// Case 1: Failed write (the half of the entry is written before the write fails)
+
+	file := store.file
+
+	writer, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.Nil(t, err)
+	_, err = writer.WriteString(`{"seq":2,"op":"insert_pers`)
+	require.Nil(t, err)
+	require.Nil(t, writer.Close())
+
+	store.file, err = os.Open(path)
+	require.Nil(t, err)
+
+	assert.NotNil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+	assert.NotContains(t, store.people, "P2")
+	require.Nil(t, store.file.Close())
+
+	journal, err := os.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, byte('\n'), journal[len(journal)-1])
+
+	// Case 2: Next entry
+
+	store.file = file
+
+	require.Nil(t, store.insertPerson(personRecord{"P3", "Adam", "Kowalski", gMale, 0}))
+	require.Nil(t, store.close())
+
+	store = testOpenJournalStore(t, path)
+
+	assert.Equal(t, int64(2), store.seq)
+	assert.Len(t, store.people, 2)
+	assert.Contains(t, store.people, "P3")
+
+	require.Nil(t, store.close())
+}
+
+/* Test the GEDCOM extensions and Gramps handles recording in the journal
+
+   1. Set the extensions and the handle, and re-open the journal
+   2. Compact the journal and re-open it
+   3. Remove the person and check if the extensions and the handle are removed as well */
+func TestJournalStoreImportMappings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gentree.journal")
+
+	store := testOpenJournalStore(t, path)
+
+	extensions := []gedcomExtension{
+		{"https://example.com/uid", gedcomLine{Level: 1, Tag: "_UID", Value: "ABC",
+			Children: []*gedcomLine{{Level: 2, Tag: "_SRC", Value: "@test"}}}},
+	}
+
+	// Case 1: Replay
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.setGedcomExtensions("P1", extensions))
+	require.Nil(t, store.setGrampsHandle("P1", "_a1"))
+
+	err := store.setGedcomExtensions("P2", extensions)
+
+	assert.True(t, isAppError(err, errRecordNotFound))
+
+	require.Nil(t, store.close())
+
+	store = testOpenJournalStore(t, path)
+
+	stored, err := store.getGedcomExtensions("P1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, extensions, stored)
+	assert.Equal(t, map[string]string{"P1": "_a1"}, store.grampsHandles)
+
+	// Case 2: Compaction
+
+	require.Nil(t, store.compact())
+	require.Nil(t, store.close())
+
+	store = testOpenJournalStore(t, path)
+
+	stored, err = store.getGedcomExtensions("P1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, extensions, stored)
+	assert.Equal(t, map[string]string{"P1": "_a1"}, store.grampsHandles)
+
+	// Case 3: Person removal
+
+	require.Nil(t, store.removePerson("P1"))
+	require.Nil(t, store.close())
+
+	store = testOpenJournalStore(t, path)
+
+	assert.Empty(t, store.gedcomExtensions)
+	assert.Empty(t, store.grampsHandles)
+}
+
+/* Test if the store instance identifier survives re-opening the journal
+
+   1. A new journal gets an instance identifier
+   2. The identifier doesn't change when the journal is re-opened
+   3. Another journal gets another identifier */
+func TestJournalStoreInstanceId(t *testing.T) {
+	dir := t.TempDir()
+
+	// Case 1: New journal
+
+	store := testOpenJournalStore(t, filepath.Join(dir, "gentree.journal"))
+
+	id, err := store.getInstanceId()
+
+	require.Nil(t, err)
+	assert.Len(t, id, 32)
+
+	// Case 2: Re-opened journal
+
+	require.Nil(t, store.close())
+
+	store = testOpenJournalStore(t, filepath.Join(dir, "gentree.journal"))
+
+	reopened, err := store.getInstanceId()
+
+	assert.Nil(t, err)
+	assert.Equal(t, id, reopened)
+
+	// Case 3: Another journal
+
+	other, err := testOpenJournalStore(t, filepath.Join(dir, "other.journal")).getInstanceId()
+
+	assert.Nil(t, err)
+	assert.NotEqual(t, id, other)
+}
@@ -0,0 +1,469 @@
+package main
+
+/* This file defines the kinship calculator
+
+   The blood relationship of two people is determined by their most recent common ancestors (found
+   by following the father and mother relations upward): the numbers of generations between the
+   common ancestors and each of the two people define the relationship (e.g. 2 and 3 generations
+   make the first cousins once removed). A single common ancestor makes a half relationship (e.g.
+   the half-siblings), but only if the children of the ancestor on both lines have two recorded
+   parents (otherwise the other common ancestor may just be missing). If the people aren't blood
+   relatives, the relationships by marriage (the husband relations) are tried: the person may be
+   married to a blood relative of the other person, or may be a blood relative of the spouse of
+   the other person.
+
+   The relationship terms are defined in kinship_terms.go (English) and kinship_terms_pl.go
+   (Polish). The language is selected using the Accept-Language header (see language.go). */
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+)
+
+// Maximum number of generations traversed upward from each of the two people
+const maxKinshipDepth = 30
+
+// Kinds of the kinship
+const (
+	kinBlood = "blood"
+	// The person is married to a blood relative (or to the other person itself)
+	kinSpouseOfRelative = "spouse_of_relative"
+	// The person is a blood relative of the spouse of the other person
+	kinRelativeOfSpouse = "relative_of_spouse"
+)
+
+/* A structure used to extract the identifiers of the two people from a URI */
+type kinshipUri struct {
+	Pid   string `uri:"pid" binding:"required,alphanum|uuid"`
+	Other string `uri:"other" binding:"required,alphanum|uuid"`
+}
+
+/* Kinship of a person to another person
+
+   For the relationships by marriage, the generations are counted between the common ancestors and
+   the blood relatives (i.e. the spouse takes the place of the person or the other person) */
+type kinship struct {
+	Kind string
+	// Gender of the person (the relationship terms depend on it)
+	Gender string
+	// Numbers of generations between the common ancestors and the two blood relatives
+	GenerationsPerson int
+	GenerationsOther  int
+	// Identifiers of the most recent common ancestors (ordered)
+	Ancestors []string
+	// Set if the relationship is a half one (see the file description)
+	Half bool
+	// Identifier of the spouse making the relationship by marriage (empty for the blood kinship)
+	Spouse string
+	// Genders of the other person and of the spouse (empty for the blood kinship)
+	OtherGender  string
+	SpouseGender string
+	// Genders of the ancestors of the two blood relatives below the common ancestors (starting
+	// with the parents; some relationship terms depend on them, e.g. the Polish ones)
+	LinePerson []string
+	LineOther  []string
+	// Identifiers of the relations leading from the person to the other person
+	Path []int64
+}
+
+/* Line of descent from an ancestor */
+type kinshipLine struct {
+	generations int
+	// Identifiers of the relations leading from the descendant up to the ancestor
+	path []int64
+	// Identifiers of the people on the line (starting with the parent, ending with the ancestor)
+	people []string
+}
+
+/* Kinship calculator (valid only within a single call of the store view or update method) */
+type kinshipFinder struct {
+	cache *familyCache
+	// The ancestor lines keyed by the descendant and the ancestor ids
+	lines map[string]map[string]kinshipLine
+}
+
+func newKinshipFinder(tx Store) *kinshipFinder {
+	return &kinshipFinder{newFamilyCache(tx), map[string]map[string]kinshipLine{}}
+}
+
+/* Find the shortest lines of descent of a person from all its ancestors (the person itself
+   included, with no generations) */
+func (f *kinshipFinder) ancestorLines(pid string) (map[string]kinshipLine, error) {
+	if lines, found := f.lines[pid]; found {
+		return lines, nil
+	}
+
+	lines := map[string]kinshipLine{pid: {0, []int64{}, []string{}}}
+	level := []string{pid}
+
+	for generation := 1; generation <= maxKinshipDepth && len(level) > 0; generation++ {
+		next := []string{}
+
+		for _, child := range level {
+			parents, err := f.cache.getParentRelations(child)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, r := range parents {
+				if r.Pid1 == "" {
+					continue
+				}
+
+				if _, found := lines[r.Pid1]; found {
+					continue
+				}
+
+				path := append(append([]int64{}, lines[child].path...), r.Id)
+				people := append(append([]string{}, lines[child].people...), r.Pid1)
+				lines[r.Pid1] = kinshipLine{generation, path, people}
+				next = append(next, r.Pid1)
+			}
+		}
+
+		level = next
+	}
+
+	f.lines[pid] = lines
+
+	return lines, nil
+}
+
+/* Find the blood kinship of two people
+
+   The common ancestors with the smallest sum of the generations are the most recent ones.
+
+   Return:
+   * the kinship (valid only if found; the gender is not set)
+   * success flag (true if the people are blood relatives and false otherwise)
+   * error (if occurred and nil otherwise) */
+func (f *kinshipFinder) blood(pid string, other string) (kinship, bool, error) {
+	personLines, err := f.ancestorLines(pid)
+	if err != nil {
+		return kinship{}, false, err
+	}
+
+	otherLines, err := f.ancestorLines(other)
+	if err != nil {
+		return kinship{}, false, err
+	}
+
+	common := []string{}
+
+	for ancestor := range personLines {
+		if _, found := otherLines[ancestor]; found {
+			common = append(common, ancestor)
+		}
+	}
+
+	if len(common) == 0 {
+		return kinship{}, false, nil
+	}
+
+	sort.Strings(common)
+
+	result := kinship{Kind: kinBlood, GenerationsPerson: -1}
+
+	for _, ancestor := range common {
+		up, down := personLines[ancestor].generations, otherLines[ancestor].generations
+
+		switch {
+		case result.GenerationsPerson < 0 ||
+			up+down < result.GenerationsPerson+result.GenerationsOther ||
+			(up+down == result.GenerationsPerson+result.GenerationsOther &&
+				up < result.GenerationsPerson):
+			result.GenerationsPerson, result.GenerationsOther = up, down
+			result.Ancestors = []string{ancestor}
+		case up == result.GenerationsPerson && down == result.GenerationsOther:
+			result.Ancestors = append(result.Ancestors, ancestor)
+		}
+	}
+
+	// The path leads up from the person to the first common ancestor and down to the other person:
+	ancestor := result.Ancestors[0]
+	downPath := otherLines[ancestor].path
+
+	result.Path = append([]int64{}, personLines[ancestor].path...)
+
+	for idx := len(downPath) - 1; idx >= 0; idx-- {
+		result.Path = append(result.Path, downPath[idx])
+	}
+
+	if len(result.Ancestors) == 1 && result.GenerationsPerson > 0 && result.GenerationsOther > 0 {
+		result.Half, err = f.parentsKnown(
+			branchChild(pid, personLines[ancestor]), branchChild(other, otherLines[ancestor]))
+		if err != nil {
+			return kinship{}, false, err
+		}
+	}
+
+	if result.LinePerson, err = f.lineGenders(personLines[ancestor]); err != nil {
+		return kinship{}, false, err
+	}
+
+	if result.LineOther, err = f.lineGenders(otherLines[ancestor]); err != nil {
+		return kinship{}, false, err
+	}
+
+	return result, true, nil
+}
+
+/* Retrieve the genders of the people on the line of descent (the ancestor excluded) */
+func (f *kinshipFinder) lineGenders(line kinshipLine) ([]string, error) {
+	genders := []string{}
+
+	for idx := 0; idx < len(line.people)-1; idx++ {
+		person, _, err := f.cache.getPerson(line.people[idx])
+		if err != nil {
+			return nil, err
+		}
+
+		genders = append(genders, person.Gender)
+	}
+
+	return genders, nil
+}
+
+/* Identify the child of the ancestor on the line of descent (the descendant itself if the
+   ancestor is its parent) */
+func branchChild(pid string, line kinshipLine) string {
+	if line.generations < 2 {
+		return pid
+	}
+
+	return line.people[line.generations-2]
+}
+
+/* Check if all the given people have both the father and the mother recorded */
+func (f *kinshipFinder) parentsKnown(pids ...string) (bool, error) {
+	for _, pid := range pids {
+		parents, err := f.cache.getParents(pid)
+		if err != nil {
+			return false, err
+		} else if parents[0] == "" || parents[1] == "" {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+/* Identify the spouse in a husband relation of a person */
+func spouseOf(pid string, r relationRecord) string {
+	if r.Pid1 == pid {
+		return r.Pid2
+	}
+
+	return r.Pid1
+}
+
+/* Find the kinship of a person to another person
+
+   The blood kinship is preferred. Otherwise, the closest relationship by marriage is returned.
+
+   Return:
+   * the kinship (valid only if found)
+   * success flag (true if the people are related and false otherwise)
+   * error (if occurred and nil otherwise) */
+func (f *kinshipFinder) find(person personRecord, other personRecord) (kinship, bool, error) {
+	if result, found, err := f.blood(person.Id, other.Id); found || err != nil {
+		result.Gender = person.Gender
+		return result, found, err
+	}
+
+	spouseGender := func(pid string) (string, error) {
+		spouse, _, err := f.cache.getPerson(pid)
+
+		return spouse.Gender, err
+	}
+
+	var best kinship
+	found := false
+
+	consider := func(candidate kinship) {
+		if !found || candidate.GenerationsPerson+candidate.GenerationsOther <
+			best.GenerationsPerson+best.GenerationsOther {
+			best, found = candidate, true
+		}
+	}
+
+	spouses, err := f.cache.getSpouseRelations(person.Id)
+	if err != nil {
+		return kinship{}, false, err
+	}
+
+	for _, r := range spouses {
+		spouse := spouseOf(person.Id, r)
+
+		candidate, related, err := f.blood(spouse, other.Id)
+		if err != nil {
+			return kinship{}, false, err
+		} else if related {
+			candidate.Kind, candidate.Spouse = kinSpouseOfRelative, spouse
+			candidate.Path = append([]int64{r.Id}, candidate.Path...)
+
+			if candidate.SpouseGender, err = spouseGender(spouse); err != nil {
+				return kinship{}, false, err
+			}
+
+			consider(candidate)
+		}
+	}
+
+	spouses, err = f.cache.getSpouseRelations(other.Id)
+	if err != nil {
+		return kinship{}, false, err
+	}
+
+	for _, r := range spouses {
+		spouse := spouseOf(other.Id, r)
+
+		candidate, related, err := f.blood(person.Id, spouse)
+		if err != nil {
+			return kinship{}, false, err
+		} else if related {
+			candidate.Kind, candidate.Spouse = kinRelativeOfSpouse, spouse
+			candidate.Path = append(candidate.Path, r.Id)
+
+			if candidate.SpouseGender, err = spouseGender(spouse); err != nil {
+				return kinship{}, false, err
+			}
+
+			consider(candidate)
+		}
+	}
+
+	best.Gender = person.Gender
+	best.OtherGender = other.Gender
+
+	return best, found, nil
+}
+
+/* Response of the kinship query */
+type kinshipPayload struct {
+	Person  fullPersonPayload `json:"person"`
+	Other   fullPersonPayload `json:"other"`
+	Related bool              `json:"related"`
+	// Relationship of the person to the other person (e.g. "first cousin once removed")
+	Relationship string `json:"relationship,omitempty"`
+	// One of the kinXxx constants
+	Kind   string `json:"kind,omitempty"`
+	Spouse string `json:"spouse,omitempty"`
+	// The most recent common ancestors
+	CommonAncestors []fullPersonPayload `json:"common_ancestors"`
+	// Numbers of generations between the common ancestors and each side (see kinship)
+	GenerationsPerson int `json:"generations_person"`
+	GenerationsOther  int `json:"generations_other"`
+	// Identifiers of the relations leading from the person to the other person
+	Path []int64 `json:"path"`
+}
+
+/* Find the kinship of a person to another person and describe it
+
+   The function must be called from the function passed to the store view (or update) method.
+
+   Params:
+   * tx - the store (as passed to the function run by the store view or update method)
+   * pid - the person identifier
+   * other - the other person identifier
+   * language - the language of the relationship term (one of kinshipLanguages)
+
+   Return:
+   * the kinship description (valid only if both people were found and no error occurred)
+   * success flag (true if both people were found and false otherwise)
+   * error (if occurred and nil otherwise) */
+func queryKinship(tx Store, pid string, other string, language string) (kinshipPayload, bool, error) {
+	finder := newKinshipFinder(tx)
+
+	person, found, err := finder.cache.getPerson(pid)
+	if !found || err != nil {
+		return kinshipPayload{}, found, err
+	}
+
+	otherPerson, found, err := finder.cache.getPerson(other)
+	if !found || err != nil {
+		return kinshipPayload{}, found, err
+	}
+
+	result := kinshipPayload{
+		Person:          person.toPayload(),
+		Other:           otherPerson.toPayload(),
+		CommonAncestors: []fullPersonPayload{},
+		Path:            []int64{},
+	}
+
+	k, related, err := finder.find(person, otherPerson)
+	if err != nil || !related {
+		return result, true, err
+	}
+
+	for _, ancestorPid := range k.Ancestors {
+		ancestor, found, err := finder.cache.getPerson(ancestorPid)
+		if err != nil {
+			return kinshipPayload{}, true, err
+		} else if found {
+			result.CommonAncestors = append(result.CommonAncestors, ancestor.toPayload())
+		}
+	}
+
+	result.Related = true
+	result.Relationship = kinshipTerms[language](k)
+	result.Kind = k.Kind
+	result.Spouse = k.Spouse
+	result.GenerationsPerson = k.GenerationsPerson
+	result.GenerationsOther = k.GenerationsOther
+	result.Path = k.Path
+
+	return result, true, nil
+}
+
+/* Handle a kinship request
+
+   The function will extract the identifiers of the two people from the request URI (kinshipUri).
+   The response describes the relationship of the first person to the second one, in the language
+   selected using the Accept-Language header (see negotiateLanguage). */
+func retrieveKinship(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	var params kinshipUri
+
+	if err := c.ShouldBindUri(&params); err != nil {
+		log.Infof("Uri parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": uriErrorMsg})
+		return
+	}
+
+	language := negotiateLanguage(c, kinshipLanguages)
+
+	var result kinshipPayload
+	var found bool
+
+	// The traversals must see a consistent state of the relations:
+	err := getStore(c).view(func(tx Store) error {
+		var err error
+
+		result, found, err = queryKinship(tx, params.Pid, params.Other, language)
+
+		return err
+	})
+
+	if !found && err == nil {
+		log.Infof("At least one of the people (%s, %s) doesn't exist", params.Pid, params.Other)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown person id"})
+		return
+	} else if err != nil {
+		log.Errorf("An error occurred during the kinship calculation attempt (%s)", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	}
+
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Content-Language", language)
+	c.Header("Vary", "Accept-Language")
+	c.JSON(http.StatusOK, result)
+
+	log.Infof("Found the kinship of the requested people (%s, %s): %s",
+		params.Pid, params.Other, result.Relationship)
+}
@@ -0,0 +1,205 @@
+package main
+
+/* This file defines the relationship terms describing the kinship (see kinship.go)
+
+   The blood relationship terms depend on the numbers of generations between the common ancestors
+   and the person (x) and the other person (y):
+   * x = 0 - the person is an ancestor (parent, grandparent, great-grandparent, ...)
+   * y = 0 - the person is a descendant (child, grandchild, great-grandchild, ...)
+   * x = y = 1 - the sibling
+   * x = 1 - the uncle or aunt (granduncle, great-granduncle, ...)
+   * y = 1 - the nephew or niece (grandnephew, great-grandnephew, ...)
+   * otherwise - the cousin of the min(x, y) - 1 degree, |x - y| times removed
+
+   The half relationships (see kinship.go) of the siblings, the uncles and aunts, and the nephews
+   and nieces get the "half-" prefix (e.g. "half-sister", "half-granduncle").
+
+   The relationships by marriage are the "in-law" variants of the blood relationship terms, except
+   for the spouse (married to the other person itself) and the step relatives (the spouse of an
+   ancestor and the descendant of the spouse).
+
+   The terms of the other languages are defined in the kinship_terms_<language>.go files. */
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Languages of the relationship terms (the first one is the default, see negotiateLanguage)
+var kinshipLanguages = []string{"en", "pl"}
+
+// Functions describing the kinship in the supported languages
+var kinshipTerms = map[string]func(k kinship) string{
+	"en": englishKinshipTerm,
+	"pl": polishKinshipTerm,
+}
+
+/* Gender variants of an English relationship term */
+type englishTerm struct {
+	male   string
+	female string
+	// The gender neutral variant (empty if there is none; both variants are listed then)
+	neutral string
+	// Text following the term and its suffix (e.g. " once removed")
+	tail string
+}
+
+/* Add the prefix and the suffix to all the variants */
+func (t englishTerm) decorate(prefix string, suffix string) englishTerm {
+	decorated := englishTerm{tail: t.tail}
+
+	decorated.male = prefix + t.male + suffix
+	decorated.female = prefix + t.female + suffix
+
+	if t.neutral != "" {
+		decorated.neutral = prefix + t.neutral + suffix
+	}
+
+	return decorated
+}
+
+/* Select the variant of the given gender */
+func (t englishTerm) forGender(gender string) string {
+	switch {
+	case gender == gMale:
+		return t.male + t.tail
+	case gender == gFemale:
+		return t.female + t.tail
+	case t.neutral != "":
+		return t.neutral + t.tail
+	}
+
+	return t.male + t.tail + " or " + t.female + t.tail
+}
+
+// Base terms of the blood relationships
+var (
+	englishParent  = englishTerm{male: "father", female: "mother", neutral: "parent"}
+	englishChild   = englishTerm{male: "son", female: "daughter", neutral: "child"}
+	englishSibling = englishTerm{male: "brother", female: "sister", neutral: "sibling"}
+	englishUncle   = englishTerm{male: "uncle", female: "aunt"}
+	englishNephew  = englishTerm{male: "nephew", female: "niece"}
+	englishSpouse  = englishTerm{male: "husband", female: "wife", neutral: "spouse"}
+	englishCousin  = englishTerm{male: "cousin", female: "cousin", neutral: "cousin"}
+)
+
+// Ordinal words used by the cousin terms
+var englishOrdinals = []string{
+	"first", "second", "third", "fourth", "fifth", "sixth", "seventh", "eighth", "ninth", "tenth"}
+
+/* Format the ordinal number using digits (e.g. 3rd, 11th, 22nd) */
+func englishOrdinalNumber(n int) string {
+	suffix := "th"
+
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+/* Format the ordinal number using words (the digits are used above ten) */
+func englishOrdinalWord(n int) string {
+	if n >= 1 && n <= len(englishOrdinals) {
+		return englishOrdinals[n-1]
+	}
+
+	return englishOrdinalNumber(n)
+}
+
+/* Make the prefix of the given number of the "great" generations (e.g. "great-great-") */
+func englishGreats(n int) string {
+	if n >= 3 {
+		return englishOrdinalNumber(n) + " great-"
+	}
+
+	return strings.Repeat("great-", n)
+}
+
+/* Make the "removed" part of the cousin term */
+func englishRemoved(n int) string {
+	switch n {
+	case 0:
+		return ""
+	case 1:
+		return " once removed"
+	case 2:
+		return " twice removed"
+	}
+
+	return fmt.Sprintf(" %d times removed", n)
+}
+
+/* Make the blood relationship term (see the file description)
+
+   Params:
+   * x - number of generations between the common ancestors and the person
+   * y - number of generations between the common ancestors and the other person */
+func englishBloodTerm(x int, y int) englishTerm {
+	// Add the "grand" and "great" prefixes to the term of a relative n generations away from the
+	// closest one (e.g. the parent or the uncle):
+	extend := func(term englishTerm, n int) englishTerm {
+		if n == 0 {
+			return term
+		}
+
+		return term.decorate(englishGreats(n-1)+"grand", "")
+	}
+
+	switch {
+	case x == 0 && y == 0:
+		return englishTerm{male: "self", female: "self", neutral: "self"}
+	case x == 0:
+		return extend(englishParent, y-1)
+	case y == 0:
+		return extend(englishChild, x-1)
+	case x == 1 && y == 1:
+		return englishSibling
+	case x == 1:
+		return extend(englishUncle, y-2)
+	case y == 1:
+		return extend(englishNephew, x-2)
+	}
+
+	term := englishCousin.decorate(englishOrdinalWord(min(x, y)-1)+" ", "")
+	term.tail = englishRemoved(max(x, y) - min(x, y))
+
+	return term
+}
+
+/* Describe the kinship of a person to another person in English (e.g. "sister-in-law") */
+func englishKinshipTerm(k kinship) string {
+	x, y := k.GenerationsPerson, k.GenerationsOther
+	term := englishBloodTerm(x, y)
+
+	// The step relatives are the spouses of the ancestors and the descendants of the spouses:
+	step := func(term englishTerm) englishTerm {
+		if strings.HasPrefix(term.male, "grand") || strings.Contains(term.male, "great") {
+			return term.decorate("step-", "")
+		}
+
+		return term.decorate("step", "")
+	}
+
+	switch {
+	case k.Kind == kinBlood && k.Half && (x == 1 || y == 1):
+		term = term.decorate("half-", "")
+	case k.Kind == kinSpouseOfRelative && x == 0 && y == 0:
+		term = englishSpouse
+	case k.Kind == kinSpouseOfRelative && x == 0:
+		term = step(term)
+	case k.Kind == kinRelativeOfSpouse && y == 0:
+		term = step(term)
+	case k.Kind != kinBlood:
+		term = term.decorate("", "-in-law")
+	}
+
+	return term.forGender(k.Gender)
+}
@@ -0,0 +1,288 @@
+package main
+
+/* This file defines the Polish relationship terms describing the kinship (see kinship.go)
+
+   The Polish terms follow the same generation scheme as the English ones (see kinship_terms.go),
+   but they are more granular. Some of them depend on the genders of the relatives linking the two
+   people, e.g.:
+   * stryj (the brother of the father) and wuj (the brother of the mother)
+   * bratanek (the son of the brother) and siostrzeniec (the son of the sister)
+   * brat stryjeczny (the son of the brother of the father), brat wujeczny (the son of the brother
+     of the mother) and brat cioteczny (the son of the sister of a parent)
+   * stryjenka (the wife of the stryj) and wujenka (the wife of the wuj)
+   * teść (the father of the wife) and świekr (the father of the husband)
+   * szwagier (the husband of the sister or the brother of the spouse), bratowa (the wife of the
+     brother) and szwagierka (the sister of the spouse)
+
+   The half relationships (see kinship.go) are described using the "przyrodni" adjective, e.g.
+   "brat przyrodni" (the half-brother), "siostra przyrodnia ojca" (the half-sister of the father)
+   and "syn brata przyrodniego" (the son of the half-brother). The specific uncle and nephew terms
+   (e.g. stryj, bratanek) aren't used for them.
+
+   The distant relationships by marriage have no specific terms (the "powinowaty" term is used). */
+
+import (
+	"fmt"
+	"strings"
+)
+
+/* Gender variants of a Polish relationship term */
+type polishTerm struct {
+	male   string
+	female string
+	// The gender neutral variant (empty if there is none; both variants are listed then)
+	neutral string
+}
+
+/* Select the variant of the given gender */
+func (t polishTerm) forGender(gender string) string {
+	switch {
+	case gender == gMale:
+		return t.male
+	case gender == gFemale:
+		return t.female
+	case t.neutral != "":
+		return t.neutral
+	}
+
+	return t.male + " lub " + t.female
+}
+
+// Ordinal words (in the genitive case) used by the cousin terms
+var polishOrdinals = []string{
+	"pierwszego", "drugiego", "trzeciego", "czwartego", "piątego", "szóstego", "siódmego",
+	"ósmego", "dziewiątego", "dziesiątego"}
+
+/* Format the degree of the cousin relationship (e.g. "drugiego stopnia") */
+func polishDegree(n int) string {
+	if n >= 1 && n <= len(polishOrdinals) {
+		return polishOrdinals[n-1] + " stopnia"
+	}
+
+	return fmt.Sprintf("%d. stopnia", n)
+}
+
+/* Format the number of generations (e.g. "2 pokolenia", "5 pokoleń") */
+func polishGenerations(n int) string {
+	switch {
+	case n == 1:
+		return "1 pokolenie"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return fmt.Sprintf("%d pokolenia", n)
+	}
+
+	return fmt.Sprintf("%d pokoleń", n)
+}
+
+/* Make the term of the ancestor n generations up (e.g. "pradziadek" for n = 3)
+
+   Params:
+   * n - number of generations (at least 1)
+   * genitive - select the genitive case (e.g. "pradziadka") */
+func polishAncestor(n int, genitive bool) polishTerm {
+	switch {
+	case n == 1 && genitive:
+		return polishTerm{"ojca", "matki", "rodzica"}
+	case n == 1:
+		return polishTerm{"ojciec", "matka", "rodzic"}
+	}
+
+	pra := strings.Repeat("pra", n-2)
+
+	if genitive {
+		return polishTerm{male: pra + "dziadka", female: pra + "babci"}
+	}
+
+	return polishTerm{male: pra + "dziadek", female: pra + "babcia"}
+}
+
+/* Make the term of the descendant n generations down (e.g. "prawnuk" for n = 3)
+
+   Params:
+   * n - number of generations (at least 1)
+   * genitive - select the genitive case (e.g. "prawnuka") */
+func polishDescendant(n int, genitive bool) polishTerm {
+	switch {
+	case n == 1 && genitive:
+		return polishTerm{"syna", "córki", "dziecka"}
+	case n == 1:
+		return polishTerm{"syn", "córka", "dziecko"}
+	}
+
+	pra := strings.Repeat("pra", n-2)
+
+	if genitive {
+		return polishTerm{male: pra + "wnuka", female: pra + "wnuczki"}
+	}
+
+	return polishTerm{male: pra + "wnuk", female: pra + "wnuczka"}
+}
+
+/* Retrieve the gender of the relative on a line of descent (see kinship; gUnknown if missing) */
+func lineGender(line []string, idx int) string {
+	if idx < 0 || idx >= len(line) {
+		return gUnknown
+	}
+
+	return line[idx]
+}
+
+/* Make the Polish blood relationship term (see the file description) */
+func polishBloodTerm(k kinship) polishTerm {
+	x, y := k.GenerationsPerson, k.GenerationsOther
+
+	switch {
+	case x == 0 && y == 0:
+		return polishTerm{"ta sama osoba", "ta sama osoba", "ta sama osoba"}
+	case x == 0:
+		return polishAncestor(y, false)
+	case y == 0:
+		return polishDescendant(x, false)
+	case x == 1 && y == 1 && k.Half:
+		return polishTerm{male: "brat przyrodni", female: "siostra przyrodnia"}
+	case x == 1 && y == 1:
+		return polishTerm{male: "brat", female: "siostra"}
+	case x == 1 && y == 2 && !k.Half:
+		// The uncle depends on the parent of the other person:
+		switch lineGender(k.LineOther, 0) {
+		case gMale:
+			return polishTerm{male: "stryj", female: "ciotka"}
+		case gFemale:
+			return polishTerm{male: "wuj", female: "ciotka"}
+		}
+
+		return polishTerm{male: "stryj lub wuj", female: "ciotka"}
+	case x == 1:
+		// The sibling of the ancestor of the other person (e.g. "brat babci"):
+		ancestor := polishAncestor(y-1, true).forGender(lineGender(k.LineOther, y-2))
+		term := polishTerm{male: "brat " + ancestor, female: "siostra " + ancestor}
+
+		if k.Half {
+			term = polishTerm{
+				male: "brat przyrodni " + ancestor, female: "siostra przyrodnia " + ancestor}
+		}
+
+		return term
+	case x == 2 && y == 1 && !k.Half:
+		// The nephew depends on the parent of the person:
+		switch lineGender(k.LinePerson, 0) {
+		case gMale:
+			return polishTerm{"bratanek", "bratanica", "dziecko brata"}
+		case gFemale:
+			return polishTerm{"siostrzeniec", "siostrzenica", "dziecko siostry"}
+		}
+
+		return polishTerm{"bratanek lub siostrzeniec", "bratanica lub siostrzenica", ""}
+	case y == 1:
+		// The descendant of the sibling of the other person (e.g. "wnuczka siostry"):
+		siblings := polishTerm{male: "brata", female: "siostry"}
+
+		if k.Half {
+			siblings = polishTerm{male: "brata przyrodniego", female: "siostry przyrodniej"}
+		}
+
+		sibling := siblings.forGender(lineGender(k.LinePerson, x-2))
+		term := polishDescendant(x-1, false)
+
+		return polishTerm{male: term.male + " " + sibling, female: term.female + " " + sibling}
+	}
+
+	// The first cousins depend on the parents of both people:
+	if x == 2 && y == 2 {
+		parent, otherParent := lineGender(k.LinePerson, 0), lineGender(k.LineOther, 0)
+
+		switch {
+		case parent == gFemale:
+			return polishTerm{male: "brat cioteczny", female: "siostra cioteczna"}
+		case parent == gMale && otherParent == gMale:
+			return polishTerm{male: "brat stryjeczny", female: "siostra stryjeczna"}
+		case parent == gMale && otherParent == gFemale:
+			return polishTerm{male: "brat wujeczny", female: "siostra wujeczna"}
+		}
+	}
+
+	degree := polishDegree(min(x, y) - 1)
+	term := polishTerm{male: "kuzyn " + degree, female: "kuzynka " + degree}
+
+	// The person is closer to the common ancestors than the other person if it is older:
+	switch generations := polishGenerations(max(x, y) - min(x, y)); {
+	case x < y:
+		term.male += ", starszy o " + generations
+		term.female += ", starsza o " + generations
+	case x > y:
+		term.male += ", młodszy o " + generations
+		term.female += ", młodsza o " + generations
+	}
+
+	return term
+}
+
+/* Describe the kinship of a person to another person in Polish (e.g. "bratowa") */
+func polishKinshipTerm(k kinship) string {
+	x, y := k.GenerationsPerson, k.GenerationsOther
+	affine := polishTerm{male: "powinowaty", female: "powinowata"}
+	term := polishBloodTerm(k)
+
+	// The generations are counted from the spouse of the person:
+	if k.Kind == kinSpouseOfRelative {
+		switch {
+		case x == 0 && y == 0:
+			term = polishTerm{"mąż", "żona", "małżonek"}
+		case x == 0 && y == 1:
+			term = polishTerm{male: "ojczym", female: "macocha"}
+		case x == 0:
+			ancestor := polishAncestor(y, false)
+			term = polishTerm{male: "przybrany " + ancestor.male, female: "przybrana " + ancestor.female}
+		case x == 1 && y == 0:
+			term = polishTerm{male: "zięć", female: "synowa"}
+		case y == 0:
+			// The spouse of the descendant (e.g. "mąż wnuczki"):
+			descendant := polishDescendant(x, true).forGender(k.SpouseGender)
+			term = polishTerm{male: "mąż " + descendant, female: "żona " + descendant}
+		case x == 1 && y == 1:
+			term = polishTerm{male: "szwagier", female: "bratowa"}
+		case x == 1 && y == 2:
+			// The wife of the uncle depends on the parent of the other person:
+			switch lineGender(k.LineOther, 0) {
+			case gMale:
+				term = polishTerm{male: "wuj", female: "stryjenka"}
+			case gFemale:
+				term = polishTerm{male: "wuj", female: "wujenka"}
+			default:
+				term = polishTerm{male: "wuj", female: "stryjenka lub wujenka"}
+			}
+		default:
+			term = affine
+		}
+	}
+
+	// The generations are counted to the spouse of the other person:
+	if k.Kind == kinRelativeOfSpouse {
+		switch {
+		case x == 0 && y == 1:
+			// The parents of the husband have their own terms:
+			if k.OtherGender == gFemale {
+				term = polishTerm{male: "świekr", female: "świekra"}
+			} else {
+				term = polishTerm{male: "teść", female: "teściowa"}
+			}
+		case x == 0:
+			// The ancestor of the spouse (e.g. "babcia żony"):
+			spouse := polishTerm{"męża", "żony", "małżonka"}.forGender(k.SpouseGender)
+			ancestor := polishAncestor(y, false)
+			term = polishTerm{male: ancestor.male + " " + spouse, female: ancestor.female + " " + spouse}
+		case x == 1 && y == 0:
+			term = polishTerm{male: "pasierb", female: "pasierbica"}
+		case y == 0:
+			descendant := polishDescendant(x, false)
+			term = polishTerm{
+				male: "przybrany " + descendant.male, female: "przybrana " + descendant.female}
+		case x == 1 && y == 1:
+			term = polishTerm{male: "szwagier", female: "szwagierka"}
+		default:
+			term = affine
+		}
+	}
+
+	return term.forGender(k.Gender)
+}
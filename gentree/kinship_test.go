@@ -0,0 +1,348 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testKinshipJson struct {
+	Person            testPersonJson   `json:"person"`
+	Other             testPersonJson   `json:"other"`
+	Related           bool             `json:"related"`
+	Relationship      string           `json:"relationship"`
+	Kind              string           `json:"kind"`
+	Spouse            string           `json:"spouse"`
+	CommonAncestors   []testPersonJson `json:"common_ancestors"`
+	GenerationsPerson int              `json:"generations_person"`
+	GenerationsOther  int              `json:"generations_other"`
+	Path              []int64          `json:"path"`
+}
+
+func testKinshipRes(t *testing.T, res *httptest.ResponseRecorder) testKinshipJson {
+	payload := testKinshipJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+/* Create a store with a family of four generations
+
+   GGP + GGM -> GA (+ WA) -> PA (+ WPA) -> A1 -> A2
+             -> GB (+ HB) -> PB (+ HPB) -> B1 -> B2
+             -> GC (+ WC) -> PC
+   GA -> PE (the mother is not recorded)
+   HB + W2 -> PD (the half-brother of PB) */
+func testKinshipStore() *memoryStore {
+	return newMemoryStore(
+		map[string]personRecord{
+			"GGP": {"GGP", "Jan", "Kowalski", gMale, 1},
+			"GGM": {"GGM", "Maria", "Kowalska", gFemale, 1},
+			"GA":  {"GA", "Adam", "Kowalski", gMale, 1},
+			"WA":  {"WA", "Ewa", "Kowalska", gFemale, 1},
+			"GB":  {"GB", "Anna", "Nowak", gFemale, 1},
+			"HB":  {"HB", "Piotr", "Nowak", gMale, 1},
+			"W2":  {"W2", "Zofia", "Nowak", gFemale, 1},
+			"PA":  {"PA", "Paweł", "Kowalski", gMale, 1},
+			"PB":  {"PB", "Joanna", "Wiśniewska", gFemale, 1},
+			"HPB": {"HPB", "Marek", "Wiśniewski", gMale, 1},
+			"A1":  {"A1", "Tomasz", "Kowalski", gMale, 1},
+			"A2":  {"A2", "Alicja", "Kowalska", gFemale, 1},
+			"B1":  {"B1", "Katarzyna", "Wiśniewska", gFemale, 1},
+			"B2":  {"B2", "Jakub", "Zieliński", gMale, 1},
+			"GC":  {"GC", "Stefan", "Kowalski", gMale, 1},
+			"WC":  {"WC", "Halina", "Kowalska", gFemale, 1},
+			"PC":  {"PC", "Michał", "Kowalski", gMale, 1},
+			"WPA": {"WPA", "Agnieszka", "Kowalska", gFemale, 1},
+			"PD":  {"PD", "Krzysztof", "Nowak", gMale, 1},
+			"PE":  {"PE", "Barbara", "Kowalska", gFemale, 1},
+			"X":   {"X", "", "", gUnknown, 1},
+		},
+		map[int64]relationRecord{
+			1:  {1, "GGP", "GGM", relHusband, 1},
+			2:  {2, "GGP", "GA", relFather, 1},
+			3:  {3, "GGM", "GA", relMother, 1},
+			4:  {4, "GGP", "GB", relFather, 1},
+			5:  {5, "GGM", "GB", relMother, 1},
+			6:  {6, "GA", "WA", relHusband, 1},
+			7:  {7, "HB", "GB", relHusband, 1},
+			8:  {8, "HB", "W2", relHusband, 1},
+			9:  {9, "GA", "PA", relFather, 1},
+			10: {10, "GB", "PB", relMother, 1},
+			11: {11, "HB", "PB", relFather, 1},
+			12: {12, "HPB", "PB", relHusband, 1},
+			13: {13, "PA", "A1", relFather, 1},
+			14: {14, "A1", "A2", relFather, 1},
+			15: {15, "PB", "B1", relMother, 1},
+			16: {16, "B1", "B2", relMother, 1},
+			17: {17, "GGP", "GC", relFather, 1},
+			18: {18, "GGM", "GC", relMother, 1},
+			19: {19, "GC", "WC", relHusband, 1},
+			20: {20, "GC", "PC", relFather, 1},
+			21: {21, "PA", "WPA", relHusband, 1},
+			22: {22, "HB", "PD", relFather, 1},
+			23: {23, "W2", "PD", relMother, 1},
+			24: {24, "GA", "PE", relFather, 1},
+		})
+}
+
+/* Test the kinship calculation
+
+   1. Blood relationships
+   2. Relationships by marriage
+   3. Details of the cousin relationship
+   4. Unrelated people
+   5. Unknown person */
+func TestRetrieveKinship(t *testing.T) {
+	router := setupRouter(testKinshipStore())
+
+	// Case 1 and 2: Relationships
+
+	for _, tc := range []struct {
+		pid          string
+		other        string
+		relationship string
+		kind         string
+	}{
+		{"A1", "A1", "self", kinBlood},
+		{"GGP", "GA", "father", kinBlood},
+		{"GGM", "A1", "great-grandmother", kinBlood},
+		{"A2", "GGP", "great-great-granddaughter", kinBlood},
+		{"GA", "GB", "brother", kinBlood},
+		{"GB", "PA", "aunt", kinBlood},
+		{"GB", "A2", "great-grandaunt", kinBlood},
+		{"B1", "GA", "grandniece", kinBlood},
+		{"PA", "PB", "first cousin", kinBlood},
+		{"A1", "B2", "second cousin once removed", kinBlood},
+		{"A2", "B1", "second cousin once removed", kinBlood},
+		{"A2", "PB", "first cousin twice removed", kinBlood},
+		{"PD", "PB", "half-brother", kinBlood},
+		{"PB", "PD", "half-sister", kinBlood},
+		{"PD", "B1", "half-uncle", kinBlood},
+		{"B1", "PD", "half-niece", kinBlood},
+		{"PE", "PA", "sister", kinBlood},
+		{"X", "X", "self", kinBlood},
+		{"GGP", "GGM", "husband", kinSpouseOfRelative},
+		{"WA", "GB", "sister-in-law", kinSpouseOfRelative},
+		{"GB", "WA", "sister-in-law", kinRelativeOfSpouse},
+		{"W2", "PB", "stepmother", kinSpouseOfRelative},
+		{"PB", "W2", "stepdaughter", kinRelativeOfSpouse},
+		{"HB", "HPB", "father-in-law", kinRelativeOfSpouse},
+		{"HPB", "HB", "son-in-law", kinSpouseOfRelative},
+		{"HPB", "PA", "first cousin-in-law", kinSpouseOfRelative},
+		{"WA", "B1", "grandaunt-in-law", kinSpouseOfRelative},
+	} {
+		res := testMakeRequest(router, "GET", "/people/"+tc.pid+"/kinship/"+tc.other, nil)
+
+		require.Equal(t, http.StatusOK, res.Code, tc)
+
+		payload := testKinshipRes(t, res)
+
+		assert.True(t, payload.Related, tc)
+		assert.Equal(t, tc.relationship, payload.Relationship, tc)
+		assert.Equal(t, tc.kind, payload.Kind, tc)
+	}
+
+	// Case 3: Cousin details
+
+	res := testMakeRequest(router, "GET", "/people/A1/kinship/B2", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	payload := testKinshipRes(t, res)
+
+	assert.Equal(t, testPersonJson{"A1", "Tomasz", "Kowalski", gMale}, payload.Person)
+	assert.Equal(t, testPersonJson{"B2", "Jakub", "Zieliński", gMale}, payload.Other)
+	assert.Equal(t, []testPersonJson{
+		{"GGM", "Maria", "Kowalska", gFemale},
+		{"GGP", "Jan", "Kowalski", gMale},
+	}, payload.CommonAncestors)
+	assert.Equal(t, 3, payload.GenerationsPerson)
+	assert.Equal(t, 4, payload.GenerationsOther)
+	assert.Equal(t, []int64{13, 9, 3, 5, 10, 15, 16}, payload.Path)
+	assert.Empty(t, payload.Spouse)
+
+	res = testMakeRequest(router, "GET", "/people/WA/kinship/GB", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	payload = testKinshipRes(t, res)
+
+	assert.Equal(t, "GA", payload.Spouse)
+	assert.Equal(t, 1, payload.GenerationsPerson)
+	assert.Equal(t, 1, payload.GenerationsOther)
+	assert.Equal(t, []int64{6, 3, 5}, payload.Path)
+
+	// Case 4: Unrelated
+
+	res = testMakeRequest(router, "GET", "/people/X/kinship/A1", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	payload = testKinshipRes(t, res)
+
+	assert.False(t, payload.Related)
+	assert.Empty(t, payload.Relationship)
+	assert.Empty(t, payload.CommonAncestors)
+	assert.Empty(t, payload.Path)
+
+	// Case 5: Unknown person
+
+	res = testMakeRequest(router, "GET", "/people/A1/kinship/P9", nil)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, "Unknown person id", testErrorRes(t, res).Message)
+}
+
+/* Test the English relationship terms of the distant and gender neutral relatives */
+func TestEnglishKinshipTerm(t *testing.T) {
+	for _, tc := range []struct {
+		k    kinship
+		term string
+	}{
+		{kinship{Kind: kinBlood, Gender: gUnknown, GenerationsPerson: 0, GenerationsOther: 2},
+			"grandparent"},
+		{kinship{Kind: kinBlood, Gender: gMale, GenerationsPerson: 0, GenerationsOther: 5},
+			"3rd great-grandfather"},
+		{kinship{Kind: kinBlood, Gender: gUnknown, GenerationsPerson: 1, GenerationsOther: 4},
+			"great-granduncle or great-grandaunt"},
+		{kinship{Kind: kinBlood, Gender: gUnknown, GenerationsPerson: 2, GenerationsOther: 1},
+			"nephew or niece"},
+		{kinship{Kind: kinBlood, Gender: gUnknown, GenerationsPerson: 1, GenerationsOther: 3,
+			Half: true}, "half-granduncle or half-grandaunt"},
+		{kinship{Kind: kinBlood, Gender: gUnknown, GenerationsPerson: 1, GenerationsOther: 1,
+			Half: true}, "half-sibling"},
+		{kinship{Kind: kinBlood, Gender: gFemale, GenerationsPerson: 12, GenerationsOther: 17},
+			"11th cousin 5 times removed"},
+		{kinship{
+			Kind: kinRelativeOfSpouse, Gender: gUnknown, GenerationsPerson: 2, GenerationsOther: 1},
+			"nephew-in-law or niece-in-law"},
+		{kinship{
+			Kind: kinRelativeOfSpouse, Gender: gMale, GenerationsPerson: 2, GenerationsOther: 0},
+			"step-grandson"},
+		{kinship{
+			Kind: kinSpouseOfRelative, Gender: gMale, GenerationsPerson: 3, GenerationsOther: 3},
+			"second cousin-in-law"},
+	} {
+		assert.Equal(t, tc.term, englishKinshipTerm(tc.k), tc.k)
+	}
+}
+
+/* Test the localised kinship terms
+
+   1. Polish relationship terms
+   2. Language negotiation (the English terms are the default ones) */
+func TestRetrieveKinshipLocalised(t *testing.T) {
+	router := setupRouter(testKinshipStore())
+	polish := map[string]string{"Accept-Language": "pl-PL,pl;q=0.9,en;q=0.8"}
+
+	// Case 1: Polish relationship terms
+
+	for _, tc := range []struct {
+		pid          string
+		other        string
+		relationship string
+	}{
+		{"X", "X", "ta sama osoba"},
+		{"GGP", "GA", "ojciec"},
+		{"GGM", "A1", "prababcia"},
+		{"A2", "GGP", "praprawnuczka"},
+		{"GA", "GB", "brat"},
+		{"GB", "PA", "ciotka"},
+		{"GC", "PA", "stryj"},
+		{"GA", "PB", "wuj"},
+		{"GA", "B1", "brat babci"},
+		{"PA", "GB", "bratanek"},
+		{"PB", "GA", "siostrzenica"},
+		{"B1", "GA", "wnuczka siostry"},
+		{"PA", "PC", "brat stryjeczny"},
+		{"PA", "PB", "brat wujeczny"},
+		{"PB", "PA", "siostra cioteczna"},
+		{"A1", "B2", "kuzyn drugiego stopnia, starszy o 1 pokolenie"},
+		{"A2", "PB", "kuzynka pierwszego stopnia, młodsza o 2 pokolenia"},
+		{"PD", "PB", "brat przyrodni"},
+		{"PB", "PD", "siostra przyrodnia"},
+		{"PD", "B1", "brat przyrodni matki"},
+		{"B1", "PD", "córka siostry przyrodniej"},
+		{"PE", "PA", "siostra"},
+		{"GGP", "GGM", "mąż"},
+		{"WA", "GB", "bratowa"},
+		{"HB", "GA", "szwagier"},
+		{"GB", "WA", "szwagierka"},
+		{"WC", "PA", "stryjenka"},
+		{"WA", "PB", "wujenka"},
+		{"W2", "PB", "macocha"},
+		{"PB", "W2", "pasierbica"},
+		{"HB", "HPB", "teść"},
+		{"GA", "WPA", "świekr"},
+		{"HPB", "HB", "zięć"},
+		{"WPA", "GA", "synowa"},
+		{"WPA", "GGP", "żona wnuka"},
+		{"GGM", "WPA", "babcia męża"},
+		{"HPB", "PA", "powinowaty"},
+	} {
+		res := testMakeRequestWithHeaders(
+			router, "GET", "/people/"+tc.pid+"/kinship/"+tc.other, nil, polish)
+
+		require.Equal(t, http.StatusOK, res.Code, tc)
+		assert.Equal(t, "pl", res.Header().Get("Content-Language"), tc)
+		assert.Equal(t, tc.relationship, testKinshipRes(t, res).Relationship, tc)
+	}
+
+	// Case 2: Language negotiation
+
+	for _, tc := range []struct {
+		header       string
+		language     string
+		relationship string
+	}{
+		{"", "en", "first cousin"},
+		{"en-US", "en", "first cousin"},
+		{"de, pl;q=0.5", "pl", "brat wujeczny"},
+		{"de", "en", "first cousin"},
+	} {
+		res := testMakeRequestWithHeaders(
+			router, "GET", "/people/PA/kinship/PB", nil, map[string]string{"Accept-Language": tc.header})
+
+		require.Equal(t, http.StatusOK, res.Code, tc)
+		assert.Equal(t, tc.language, res.Header().Get("Content-Language"), tc)
+		assert.Equal(t, "Accept-Language", res.Header().Get("Vary"), tc)
+		assert.Equal(t, tc.relationship, testKinshipRes(t, res).Relationship, tc)
+	}
+}
+
+/* Test the Polish relationship terms of the distant and gender neutral relatives */
+func TestPolishKinshipTerm(t *testing.T) {
+	for _, tc := range []struct {
+		k    kinship
+		term string
+	}{
+		{kinship{Kind: kinBlood, Gender: gUnknown, GenerationsPerson: 0, GenerationsOther: 1},
+			"rodzic"},
+		{kinship{Kind: kinBlood, Gender: gMale, GenerationsPerson: 0, GenerationsOther: 5},
+			"praprapradziadek"},
+		{kinship{Kind: kinBlood, Gender: gUnknown, GenerationsPerson: 1, GenerationsOther: 2,
+			LineOther: []string{gUnknown}}, "stryj lub wuj lub ciotka"},
+		{kinship{Kind: kinBlood, Gender: gUnknown, GenerationsPerson: 2, GenerationsOther: 1,
+			LinePerson: []string{gFemale}}, "dziecko siostry"},
+		{kinship{Kind: kinBlood, Gender: gUnknown, GenerationsPerson: 3, GenerationsOther: 1,
+			LinePerson: []string{gUnknown, gMale}, Half: true},
+			"wnuk brata przyrodniego lub wnuczka brata przyrodniego"},
+		{kinship{Kind: kinBlood, Gender: gMale, GenerationsPerson: 2, GenerationsOther: 2,
+			LinePerson: []string{gUnknown}, LineOther: []string{gMale}},
+			"kuzyn pierwszego stopnia"},
+		{kinship{Kind: kinBlood, Gender: gFemale, GenerationsPerson: 12, GenerationsOther: 17},
+			"kuzynka 11. stopnia, starsza o 5 pokoleń"},
+		{kinship{Kind: kinBlood, Gender: gMale, GenerationsPerson: 24, GenerationsOther: 2},
+			"kuzyn pierwszego stopnia, młodszy o 22 pokolenia"},
+		{kinship{Kind: kinRelativeOfSpouse, Gender: gFemale, GenerationsPerson: 0,
+			GenerationsOther: 1, OtherGender: gUnknown}, "teściowa"},
+		{kinship{Kind: kinRelativeOfSpouse, Gender: gMale, GenerationsPerson: 2,
+			GenerationsOther: 0}, "przybrany wnuk"},
+		{kinship{Kind: kinSpouseOfRelative, Gender: gUnknown, GenerationsPerson: 0,
+			GenerationsOther: 0}, "małżonek"},
+	} {
+		assert.Equal(t, tc.term, polishKinshipTerm(tc.k), tc.k)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+/* This file defines the selection of the response language (used by the localised texts, e.g. the
+   relationship terms, see kinship_terms.go)
+
+   The language is negotiated using the Accept-Language header of the request: the supported
+   language with the highest quality value is selected. The languages are compared by their primary
+   subtags only (e.g. "pl-PL" selects "pl"). */
+
+import (
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"strings"
+)
+
+/* Split an item of an Accept-like header (e.g. "pl-PL;q=0.8") into the value and its quality
+
+   Return:
+   * the value (lower case)
+   * the quality value (1 if missing, 0 if malformed) */
+func parseAcceptItem(item string) (string, float64) {
+	value, params, _ := strings.Cut(item, ";")
+	quality := 1.0
+
+	for _, param := range strings.Split(params, ";") {
+		if q, found := strings.CutPrefix(strings.TrimSpace(param), "q="); found {
+			var err error
+
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				quality = 0
+			}
+		}
+	}
+
+	return strings.ToLower(strings.TrimSpace(value)), quality
+}
+
+/* Select the response language using the Accept-Language header of the request
+
+   The first supported language is the default one. It is selected if the header is missing or
+   malformed, if it lists no supported language, or if it lists the "*" wildcard first.
+
+   Params:
+   * c - gin context
+   * supported - the primary subtags of the supported languages (lower case, e.g. "en")
+
+   Return:
+   * the selected language (one of the supported ones) */
+func negotiateLanguage(c *gin.Context, supported []string) string {
+	selected, selectedQuality := supported[0], 0.0
+
+	for _, item := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag, quality := parseAcceptItem(item)
+
+		// The ranges of the same quality are used in the order of their appearance:
+		if quality <= selectedQuality {
+			continue
+		}
+
+		primary, _, _ := strings.Cut(tag, "-")
+
+		if primary == "*" {
+			selected, selectedQuality = supported[0], quality
+		} else if containsStr(supported, primary) {
+			selected, selectedQuality = primary, quality
+		}
+	}
+
+	return selected
+}
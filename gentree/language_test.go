@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+/* Test the response language selection
+
+   1. Missing and malformed headers
+   2. Supported languages (regional variants, quality values, wildcard)
+   3. Unsupported languages */
+func TestNegotiateLanguage(t *testing.T) {
+	testNegotiate := func(header string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/people/P1/kinship/P2", nil)
+
+		if header != "" {
+			c.Request.Header.Set("Accept-Language", header)
+		}
+
+		return negotiateLanguage(c, []string{"en", "pl"})
+	}
+
+	// Case 1: Missing and malformed headers
+
+	assert.Equal(t, "en", testNegotiate(""))
+	assert.Equal(t, "en", testNegotiate(",;q=,"))
+	assert.Equal(t, "en", testNegotiate("pl;q=x"))
+
+	// Case 2: Supported languages
+
+	assert.Equal(t, "pl", testNegotiate("pl"))
+	assert.Equal(t, "pl", testNegotiate("PL-pl"))
+	assert.Equal(t, "pl", testNegotiate("pl-PL,pl;q=0.9,en-US;q=0.8,en;q=0.7"))
+	assert.Equal(t, "pl", testNegotiate("en;q=0.5, pl;q=0.6"))
+	assert.Equal(t, "en", testNegotiate("en-GB, pl"))
+	assert.Equal(t, "pl", testNegotiate("de, pl;q=0.8, *;q=0.5"))
+	assert.Equal(t, "en", testNegotiate("*, pl;q=0.8"))
+
+	// Case 3: Unsupported languages
+
+	assert.Equal(t, "en", testNegotiate("de"))
+	assert.Equal(t, "en", testNegotiate("de-AT, fr;q=0.5"))
+	assert.Equal(t, "en", testNegotiate("pl;q=0"))
+}
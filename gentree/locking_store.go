@@ -0,0 +1,220 @@
+package main
+
+/* This file defines the store decorator making other stores safe for concurrent use */
+
+import (
+	"sync"
+	"time"
+)
+
+/* Store decorator serializing the access to the decorated store
+
+   gin serves every request in a separate goroutine, so the stores not prepared for concurrent
+   access (e.g. memoryStore) must be wrapped with this decorator. The query methods and the view
+   method acquire a shared lock, while the modification methods and the update method acquire an
+   exclusive lock. */
+type lockingStore struct {
+	mutex sync.RWMutex
+	inner Store
+}
+
+/* Create a locking decorator of the given store */
+func newLockingStore(inner Store) *lockingStore {
+	return &lockingStore{inner: inner}
+}
+
+func (s *lockingStore) update(fn func(tx Store) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.update(fn)
+}
+
+func (s *lockingStore) view(fn func(tx Store) error) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.view(fn)
+}
+
+func (s *lockingStore) getPerson(pid string) (personRecord, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.getPerson(pid)
+}
+
+func (s *lockingStore) maxPersonSequence(prefix string) (int64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.maxPersonSequence(prefix)
+}
+
+func (s *lockingStore) queryPeople(pag paginationData, filter personFilter) (personList, paginationData, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.queryPeople(pag, filter)
+}
+
+func (s *lockingStore) insertPerson(person personRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.insertPerson(person)
+}
+
+func (s *lockingStore) updatePerson(person personRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.updatePerson(person)
+}
+
+func (s *lockingStore) removePerson(pid string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.removePerson(pid)
+}
+
+func (s *lockingStore) getGedcomExtensions(pid string) ([]gedcomExtension, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.getGedcomExtensions(pid)
+}
+
+func (s *lockingStore) setGedcomExtensions(pid string, extensions []gedcomExtension) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.setGedcomExtensions(pid, extensions)
+}
+
+func (s *lockingStore) queryGrampsHandles() (map[string]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.queryGrampsHandles()
+}
+
+func (s *lockingStore) getGrampsHandle(pid string) (string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.getGrampsHandle(pid)
+}
+
+func (s *lockingStore) setGrampsHandle(pid string, handle string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.setGrampsHandle(pid, handle)
+}
+
+func (s *lockingStore) getInstanceId() (string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.getInstanceId()
+}
+
+func (s *lockingStore) queryRelationById(id int64) (relationRecord, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.queryRelationById(id)
+}
+
+func (s *lockingStore) queryRelationsByPerson(pid string, pag paginationData) (relationList, paginationData, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.queryRelationsByPerson(pid, pag)
+}
+
+func (s *lockingStore) queryRelationsByData(pid1 string, typ string, pid2 string) ([]relationRecord, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.queryRelationsByData(pid1, typ, pid2)
+}
+
+func (s *lockingStore) insertRelation(relation relationRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.insertRelation(relation)
+}
+
+func (s *lockingStore) updateRelation(relation relationRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.updateRelation(relation)
+}
+
+func (s *lockingStore) removeRelation(id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.removeRelation(id)
+}
+
+func (s *lockingStore) deleteRelationsByPerson(pid string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.deleteRelationsByPerson(pid)
+}
+
+func (s *lockingStore) queryPersonHistory(pid string) ([]personRevision, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.queryPersonHistory(pid)
+}
+
+func (s *lockingStore) queryRelationHistory(id int64) ([]relationRevision, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.queryRelationHistory(id)
+}
+
+func (s *lockingStore) insertTrash(item trashRecord) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.insertTrash(item)
+}
+
+func (s *lockingStore) getTrash(id int64) (trashRecord, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.getTrash(id)
+}
+
+func (s *lockingStore) queryTrash(pag paginationData) (trashList, paginationData, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.inner.queryTrash(pag)
+}
+
+func (s *lockingStore) removeTrash(id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.removeTrash(id)
+}
+
+func (s *lockingStore) purgeTrash(before time.Time) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inner.purgeTrash(before)
+}
@@ -5,31 +5,101 @@ import (
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"os"
+	"time"
 )
 
+// Maximum interval between the trash purges
+const maxTrashPurgeInterval = time.Hour
+
 func configLogger(args AppArgs) {
 	log.SetLevel(args.LogLevel)
 	log.SetReportCaller(true)
 }
 
-func setupRouter() *gin.Engine {
+/* Optional router settings (the zero values stand for the defaults) */
+type routerConfig struct {
+	// Generator of the ids of the people created without an id (UUIDv4 if nil)
+	personIds personIdGenerator
+	// Generator of the ids of the new relations (time-ordered if nil)
+	relationIds relationIdGenerator
+}
+
+/* Create the gin router with the default settings
+
+   Params:
+   * store - the storage backend to be used by the request handlers */
+func setupRouter(store Store) *gin.Engine {
+	return setupConfiguredRouter(store, routerConfig{})
+}
+
+/* Create the gin router
+
+   Params:
+   * store - the storage backend to be used by the request handlers
+   * config - the router settings */
+func setupConfiguredRouter(store Store, config routerConfig) *gin.Engine {
+	if config.personIds == nil {
+		config.personIds, _ = newPersonIdGenerator(pidUuid4, "", 0)
+	}
+
+	if config.relationIds == nil {
+		config.relationIds, _ = newRelationIdGenerator(ridTime)
+	}
+
 	r := gin.Default()
 	r.Use(location.Default())
+	r.Use(storeMiddleware(store))
+	r.Use(personIdGeneratorMiddleware(config.personIds))
+	r.Use(relationIdGeneratorMiddleware(config.relationIds))
 
 	r.DELETE("/people/:pid", deletePerson)
 	r.GET("/people", retrievePeople)
+	r.GET("/people.csv", exportPeopleCsv)
 	r.GET("/people/:pid", retrievePerson)
 	r.POST("/people", createPerson)
+	r.POST("/people.csv", importPeopleCsv)
 	r.PUT("/people/:pid", replacePerson)
 
 	r.DELETE("/relations/:rid", deleteRelation)
 	r.GET("/relations", retrieveRelations)
+	r.GET("/relations.csv", exportRelationsCsv)
 	r.GET("/relations/:rid", retrieveRelation)
 	r.POST("/relations", createRelation)
+	r.POST("/relations.csv", importRelationsCsv)
 	r.PUT("/relations/:rid", replaceRelation)
 
 	r.GET("/people/:pid/relations", retrievePersonRelations)
 	r.POST("/people/:pid/relations", createPersonRelation)
+	r.GET("/people/:pid/ancestors", retrievePersonAncestors)
+	r.GET("/people/:pid/descendants", retrievePersonDescendants)
+	r.GET("/people/:pid/kinship/:other", retrieveKinship)
+	r.GET("/people/:pid/path/:other", retrieveConnection)
+
+	r.GET("/people/:pid/history", retrievePersonHistory)
+	r.POST("/people/:pid/history/:rev/restore", restorePersonRevision)
+	r.GET("/relations/:rid/history", retrieveRelationHistory)
+	r.POST("/relations/:rid/history/:rev/restore", restoreRelationRevision)
+
+	r.POST("/batch", applyBatch)
+
+	r.GET("/trash", retrieveTrash)
+	r.POST("/trash/:id/restore", restoreTrash)
+
+	r.GET("/export", exportDatabase)
+	r.GET("/export.ged", exportGedcom)
+	r.GET("/export.gdz", exportGedzip)
+	r.GET("/export.gedcomx", exportGedcomx)
+	r.GET("/export.gramps", exportGramps)
+	r.GET("/export.ttl", exportTurtle)
+	r.GET("/export.rdf", exportRdfXml)
+	r.GET("/export.jsonld", exportJsonld)
+	r.POST("/import", importDatabase)
+	r.POST("/import/gedcom", importGedcom)
+	r.POST("/import/gedzip", importGedzip)
+	r.POST("/import/gedcomx", importGedcomx)
+	r.POST("/import/gramps", importGramps)
+
+	r.GET("/ontology.ttl", retrieveOntology)
 
 	return r
 }
@@ -45,7 +115,48 @@ func main() {
 
 	log.Trace("Entry checkpoint")
 
-	router := setupRouter()
+	store, err := openStore(args)
+
+	if err != nil {
+		log.Fatalf("An error occurred during the store opening attempt (%s)", err)
+	}
+
+	relationIds, err := newRelationIdGenerator(args.RelationIdScheme)
+
+	if err != nil {
+		log.Fatalf("An error occurred during the relation id generator creation attempt (%s)", err)
+	}
+
+	switch args.Command {
+	case cmdExport:
+		if err := runExportCommand(store, args.SnapshotPath, args.DataFormat, args.BaseUrl); err != nil {
+			log.Fatalf("An error occurred during the export attempt (%s)", err)
+		}
+
+		return
+	case cmdImport:
+		if err := runImportCommand(
+			store, relationIds, args.SnapshotPath, args.DataFormat, args.ImportMode); err != nil {
+			log.Fatalf("An error occurred during the import attempt (%s)", err)
+		}
+
+		return
+	}
+
+	if args.TrashRetention > 0 {
+		go purgeTrashPeriodically(
+			store, args.TrashRetention, min(args.TrashRetention, maxTrashPurgeInterval))
+	}
+
+	personIds, err := newPersonIdGenerator(
+		args.PersonIdScheme, args.PersonIdPrefix, args.PersonIdWidth)
+
+	if err != nil {
+		log.Fatalf("An error occurred during the person id generator creation attempt (%s)", err)
+	}
+
+	router := setupConfiguredRouter(
+		store, routerConfig{personIds: personIds, relationIds: relationIds})
 
 	if err := router.Run(); err != nil {
 		log.Fatalf("An error occurred during the gin server run attempt (%s)", err)
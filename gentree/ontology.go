@@ -0,0 +1,143 @@
+package main
+
+/* This file defines the gentree ontology used by the RDF export (see rdf.go)
+
+   The ontology is published by the server (see retrieveOntology), so that the exported documents
+   can be loaded into a triple store together with the property definitions needed by a reasoner
+   (e.g. the inverse properties). The ontology IRI is the URL it is published at (see
+   ontologyIri), so the owl:imports statements of the exported documents resolve. The terms use a
+   fixed namespace instead, so the documents exported by different servers share them. */
+
+import (
+	"fmt"
+	"github.com/gin-contrib/location"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// Namespace of the terms defined by the gentree ontology
+const ontologyNamespace = "https://github.com/dariusz-walczak/owl_gentree/ontology#"
+
+// Path of the ontology document published by the server (relative to the server base URL)
+const ontologyPath = "ontology.ttl"
+
+/* Make the IRI of the gentree ontology (the URL of the ontology document)
+
+   Params:
+   * baseUrl - the server base URL (ending with the '/' character, see requestBaseUrl) */
+func ontologyIri(baseUrl string) string {
+	return baseUrl + ontologyPath
+}
+
+// The ontology document (Turtle; the ontology IRI is to be substituted)
+const ontologyTurtle = `@prefix gt: <` + ontologyNamespace + `> .
+@prefix owl: <http://www.w3.org/2002/07/owl#> .
+@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .
+@prefix rdfs: <http://www.w3.org/2000/01/rdf-schema#> .
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<%s> a owl:Ontology ;
+    rdfs:label "gentree ontology"@en ;
+    rdfs:comment "Terms of the family trees exported by the gentree server"@en ;
+    owl:versionInfo "1" .
+
+# Classes
+
+gt:Person a owl:Class ;
+    rdfs:label "person"@en ;
+    rdfs:comment "A person recorded in the family tree"@en .
+
+gt:Male a owl:Class ;
+    rdfs:subClassOf gt:Person ;
+    rdfs:label "male"@en .
+
+gt:Female a owl:Class ;
+    rdfs:subClassOf gt:Person ;
+    rdfs:label "female"@en ;
+    owl:disjointWith gt:Male .
+
+# Data properties
+
+gt:personId a owl:DatatypeProperty , owl:FunctionalProperty ;
+    rdfs:label "person id"@en ;
+    rdfs:comment "Identifier of the person in the gentree server"@en ;
+    rdfs:domain gt:Person ;
+    rdfs:range xsd:string .
+
+gt:givenNames a owl:DatatypeProperty ;
+    rdfs:label "given names"@en ;
+    rdfs:domain gt:Person ;
+    rdfs:range xsd:string .
+
+gt:surname a owl:DatatypeProperty ;
+    rdfs:label "surname"@en ;
+    rdfs:domain gt:Person ;
+    rdfs:range xsd:string .
+
+# Object properties (the exported documents use hasFather, hasMother and hasHusband only; the
+# other properties are inferred)
+
+gt:hasParent a owl:ObjectProperty ;
+    rdfs:label "has parent"@en ;
+    rdfs:domain gt:Person ;
+    rdfs:range gt:Person ;
+    owl:inverseOf gt:hasChild .
+
+gt:hasChild a owl:ObjectProperty ;
+    rdfs:label "has child"@en ;
+    rdfs:domain gt:Person ;
+    rdfs:range gt:Person ;
+    owl:inverseOf gt:hasParent .
+
+gt:hasFather a owl:ObjectProperty , owl:FunctionalProperty ;
+    rdfs:subPropertyOf gt:hasParent ;
+    rdfs:label "has father"@en ;
+    rdfs:comment "Exported for every father relation (the child is the subject)"@en ;
+    rdfs:range gt:Male .
+
+gt:hasMother a owl:ObjectProperty , owl:FunctionalProperty ;
+    rdfs:subPropertyOf gt:hasParent ;
+    rdfs:label "has mother"@en ;
+    rdfs:comment "Exported for every mother relation (the child is the subject)"@en ;
+    rdfs:range gt:Female .
+
+gt:hasSpouse a owl:ObjectProperty , owl:SymmetricProperty ;
+    rdfs:label "has spouse"@en ;
+    rdfs:domain gt:Person ;
+    rdfs:range gt:Person .
+
+gt:hasHusband a owl:ObjectProperty ;
+    rdfs:subPropertyOf gt:hasSpouse ;
+    rdfs:label "has husband"@en ;
+    rdfs:comment "Exported for every husband relation (the wife is the subject)"@en ;
+    rdfs:domain gt:Female ;
+    rdfs:range gt:Male ;
+    owl:inverseOf gt:hasWife .
+
+gt:hasWife a owl:ObjectProperty ;
+    rdfs:subPropertyOf gt:hasSpouse ;
+    rdfs:label "has wife"@en ;
+    rdfs:domain gt:Male ;
+    rdfs:range gt:Female ;
+    owl:inverseOf gt:hasHusband .
+`
+
+/* Compose the server base URL (ending with the '/' character) out of the request location */
+func requestBaseUrl(c *gin.Context) string {
+	u := location.Get(c)
+	u.Path, u.RawQuery, u.Fragment = "/", "", ""
+
+	return u.String()
+}
+
+/* Handle an ontology retrieval request
+
+   The response is the Turtle document of the gentree ontology */
+func retrieveOntology(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doc := fmt.Sprintf(ontologyTurtle, ontologyIri(requestBaseUrl(c)))
+
+	c.Data(http.StatusOK, "text/turtle; charset=utf-8", []byte(doc))
+}
@@ -0,0 +1,347 @@
+package main
+
+/* This file defines the ordered index of the in-memory records: a B-tree of the record keys with
+   the subtree sizes maintained in the nodes (so that a page of keys can be found by its offset
+   without visiting the preceding keys) */
+
+import (
+	"cmp"
+	"slices"
+)
+
+/* Minimum degree of the B-tree
+
+   Every node except the root has between btreeDegree-1 and 2*btreeDegree-1 keys */
+const btreeDegree = 32
+
+type btreeNode[K cmp.Ordered] struct {
+	keys []K
+	// Child nodes (nil in the leaf nodes; len(keys)+1 in the internal ones)
+	children []*btreeNode[K]
+	// Number of the keys in the subtree rooted in the node
+	size int
+}
+
+/* Ordered set of the record keys
+
+   The operations cost O(log n), and the retrieval of a key range by its offset costs
+   O(log n + range length). The zero value is an empty index. The index isn't safe for concurrent
+   modification (just like the in-memory store). */
+type orderedIndex[K cmp.Ordered] struct {
+	root *btreeNode[K]
+}
+
+/* Create an ordered index containing the given keys */
+func newOrderedIndex[K cmp.Ordered](keys []K) *orderedIndex[K] {
+	idx := &orderedIndex[K]{}
+
+	for _, key := range keys {
+		idx.insert(key)
+	}
+
+	return idx
+}
+
+func (n *btreeNode[K]) leaf() bool {
+	return n.children == nil
+}
+
+/* Retrieve the number of keys in the index */
+func (idx *orderedIndex[K]) len() int {
+	if idx.root == nil {
+		return 0
+	}
+
+	return idx.root.size
+}
+
+/* Check if the index contains the key */
+func (idx *orderedIndex[K]) has(key K) bool {
+	for n := idx.root; n != nil; {
+		i, found := slices.BinarySearch(n.keys, key)
+
+		if found {
+			return true
+		} else if n.leaf() {
+			return false
+		}
+
+		n = n.children[i]
+	}
+
+	return false
+}
+
+/* Add the key to the index
+
+   Return:
+   * true if the key was added and false if the index already contained it */
+func (idx *orderedIndex[K]) insert(key K) bool {
+	// The sizes are updated on the way down, so the key mustn't be there:
+	if idx.has(key) {
+		return false
+	}
+
+	if idx.root == nil {
+		idx.root = &btreeNode[K]{keys: []K{key}, size: 1}
+		return true
+	}
+
+	if len(idx.root.keys) == 2*btreeDegree-1 {
+		root := &btreeNode[K]{children: []*btreeNode[K]{idx.root}, size: idx.root.size}
+		root.splitChild(0)
+		idx.root = root
+	}
+
+	idx.root.insertNonFull(key)
+
+	return true
+}
+
+/* Split the full child node at the given index into two nodes (the median key is moved to the
+   node, which mustn't be full) */
+func (n *btreeNode[K]) splitChild(i int) {
+	child := n.children[i]
+	median := child.keys[btreeDegree-1]
+
+	right := &btreeNode[K]{keys: slices.Clone(child.keys[btreeDegree:])}
+	right.size = len(right.keys)
+
+	if !child.leaf() {
+		right.children = slices.Clone(child.children[btreeDegree:])
+
+		for _, c := range right.children {
+			right.size += c.size
+		}
+
+		child.children = child.children[:btreeDegree]
+	}
+
+	child.keys = child.keys[:btreeDegree-1]
+	child.size -= right.size + 1
+
+	n.keys = slices.Insert(n.keys, i, median)
+	n.children = slices.Insert(n.children, i+1, right)
+}
+
+/* Insert the key (not present yet) into the subtree of a node that isn't full */
+func (n *btreeNode[K]) insertNonFull(key K) {
+	n.size++
+
+	i, _ := slices.BinarySearch(n.keys, key)
+
+	if n.leaf() {
+		n.keys = slices.Insert(n.keys, i, key)
+		return
+	}
+
+	if len(n.children[i].keys) == 2*btreeDegree-1 {
+		n.splitChild(i)
+
+		if key > n.keys[i] {
+			i++
+		}
+	}
+
+	n.children[i].insertNonFull(key)
+}
+
+/* Remove the key from the index
+
+   Return:
+   * true if the key was removed and false if the index didn't contain it */
+func (idx *orderedIndex[K]) remove(key K) bool {
+	// The sizes are updated on the way down, so the key must be there:
+	if !idx.has(key) {
+		return false
+	}
+
+	idx.root.remove(key)
+
+	if len(idx.root.keys) == 0 {
+		if idx.root.leaf() {
+			idx.root = nil
+		} else {
+			idx.root = idx.root.children[0]
+		}
+	}
+
+	return true
+}
+
+/* Remove the key (present in the subtree) from the subtree of a node having at least btreeDegree
+   keys (unless it is the root) */
+func (n *btreeNode[K]) remove(key K) {
+	n.size--
+
+	i, found := slices.BinarySearch(n.keys, key)
+
+	if n.leaf() {
+		n.keys = slices.Delete(n.keys, i, i+1)
+		return
+	}
+
+	if found {
+		if len(n.children[i].keys) >= btreeDegree {
+			// Replace the key with its predecessor:
+			n.keys[i] = n.children[i].max()
+			n.children[i].remove(n.keys[i])
+		} else if len(n.children[i+1].keys) >= btreeDegree {
+			// Replace the key with its successor:
+			n.keys[i] = n.children[i+1].min()
+			n.children[i+1].remove(n.keys[i])
+		} else {
+			n.merge(i)
+			n.children[i].remove(key)
+		}
+
+		return
+	}
+
+	if len(n.children[i].keys) < btreeDegree {
+		i = n.fill(i)
+	}
+
+	n.children[i].remove(key)
+}
+
+func (n *btreeNode[K]) min() K {
+	for !n.leaf() {
+		n = n.children[0]
+	}
+
+	return n.keys[0]
+}
+
+func (n *btreeNode[K]) max() K {
+	for !n.leaf() {
+		n = n.children[len(n.children)-1]
+	}
+
+	return n.keys[len(n.keys)-1]
+}
+
+/* Make the child node at the given index have at least btreeDegree keys by moving a key from a
+   sibling or merging the child with a sibling
+
+   Return:
+   * index of the child node covering the key range of the original child */
+func (n *btreeNode[K]) fill(i int) int {
+	if i > 0 && len(n.children[i-1].keys) >= btreeDegree {
+		n.rotateRight(i - 1)
+		return i
+	}
+
+	if i < len(n.keys) && len(n.children[i+1].keys) >= btreeDegree {
+		n.rotateLeft(i)
+		return i
+	}
+
+	if i < len(n.keys) {
+		n.merge(i)
+		return i
+	}
+
+	n.merge(i - 1)
+
+	return i - 1
+}
+
+/* Move the last key of the child at the given index up, and the separating key down to the
+   beginning of the next child */
+func (n *btreeNode[K]) rotateRight(i int) {
+	left, right := n.children[i], n.children[i+1]
+
+	right.keys = slices.Insert(right.keys, 0, n.keys[i])
+	n.keys[i] = left.keys[len(left.keys)-1]
+	left.keys = left.keys[:len(left.keys)-1]
+
+	moved := 1
+
+	if !left.leaf() {
+		child := left.children[len(left.children)-1]
+		left.children = left.children[:len(left.children)-1]
+		right.children = slices.Insert(right.children, 0, child)
+		moved += child.size
+	}
+
+	left.size -= moved
+	right.size += moved
+}
+
+/* Move the first key of the child following the given index up, and the separating key down to
+   the end of the child at the index */
+func (n *btreeNode[K]) rotateLeft(i int) {
+	left, right := n.children[i], n.children[i+1]
+
+	left.keys = append(left.keys, n.keys[i])
+	n.keys[i] = right.keys[0]
+	right.keys = slices.Delete(right.keys, 0, 1)
+
+	moved := 1
+
+	if !right.leaf() {
+		child := right.children[0]
+		right.children = slices.Delete(right.children, 0, 1)
+		left.children = append(left.children, child)
+		moved += child.size
+	}
+
+	left.size += moved
+	right.size -= moved
+}
+
+/* Merge the child at the given index, the separating key, and the following child into one node */
+func (n *btreeNode[K]) merge(i int) {
+	left, right := n.children[i], n.children[i+1]
+
+	left.keys = append(append(left.keys, n.keys[i]), right.keys...)
+	left.children = append(left.children, right.children...)
+	left.size += right.size + 1
+
+	n.keys = slices.Delete(n.keys, i, i+1)
+	n.children = slices.Delete(n.children, i+1, i+2)
+}
+
+/* Retrieve a range of keys in the increasing order
+
+   Params:
+   * offset - number of the smallest keys to be skipped
+   * count - maximum number of keys to be returned
+
+   Return:
+   * slice of keys (empty if the offset exceeds the key count) */
+func (idx *orderedIndex[K]) slice(offset int, count int) []K {
+	result := make([]K, 0, max(0, min(count, idx.len()-offset)))
+
+	if idx.root != nil && offset >= 0 {
+		idx.root.collect(&offset, count, &result)
+	}
+
+	return result
+}
+
+/* Append the keys of the subtree to the result (skipping the first *skip keys and stopping when
+   the result has the requested count) */
+func (n *btreeNode[K]) collect(skip *int, count int, result *[]K) {
+	if *skip >= n.size {
+		*skip -= n.size
+		return
+	}
+
+	for i := 0; i <= len(n.keys) && len(*result) < count; i++ {
+		if !n.leaf() {
+			n.children[i].collect(skip, count, result)
+		}
+
+		if i == len(n.keys) || len(*result) == count {
+			break
+		}
+
+		if *skip > 0 {
+			*skip--
+		} else {
+			*result = append(*result, n.keys[i])
+		}
+	}
+}
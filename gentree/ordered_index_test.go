@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+/* Check the B-tree invariants of the subtree (key order, node fill, subtree sizes)
+
+   Return:
+   * the depth of the subtree leaves */
+func testCheckBtreeNode[K int64 | string](t *testing.T, n *btreeNode[K], root bool) int {
+	require.True(t, slices.IsSorted(n.keys))
+	require.LessOrEqual(t, len(n.keys), 2*btreeDegree-1)
+
+	if !root {
+		require.GreaterOrEqual(t, len(n.keys), btreeDegree-1)
+	}
+
+	if n.leaf() {
+		require.Equal(t, len(n.keys), n.size)
+		return 1
+	}
+
+	require.Len(t, n.children, len(n.keys)+1)
+
+	size := len(n.keys)
+	depth := -1
+
+	for i, c := range n.children {
+		if i > 0 {
+			require.Less(t, n.keys[i-1], c.min())
+		}
+
+		if i < len(n.keys) {
+			require.Greater(t, n.keys[i], c.max())
+		}
+
+		d := testCheckBtreeNode(t, c, false)
+
+		if depth >= 0 {
+			require.Equal(t, depth, d)
+		}
+
+		depth = d
+		size += c.size
+	}
+
+	require.Equal(t, size, n.size)
+
+	return depth + 1
+}
+
+/* Test the ordered index against a sorted slice
+
+   1. Insert random keys (including duplicates)
+   2. Remove random keys (including missing ones)
+   3. Remove all the keys */
+func TestOrderedIndex(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	idx := &orderedIndex[int64]{}
+	expected := []int64{}
+
+	check := func() {
+		if idx.root != nil {
+			testCheckBtreeNode(t, idx.root, true)
+		}
+
+		assert.Equal(t, len(expected), idx.len())
+		assert.Equal(t, expected, idx.slice(0, len(expected)+1))
+
+		for _, offset := range []int{0, 1, 63, len(expected) / 2, len(expected) - 5} {
+			if offset < 0 || offset > len(expected) {
+				continue
+			}
+
+			last := minInt(offset+20, len(expected))
+
+			assert.Equal(t, expected[offset:last], idx.slice(offset, 20), "offset: %d", offset)
+		}
+
+		assert.Empty(t, idx.slice(len(expected), 20))
+	}
+
+	// Case 1: Insertion
+
+	for i := 0; i < 20000; i++ {
+		key := rnd.Int63n(30000)
+		pos, found := slices.BinarySearch(expected, key)
+
+		assert.Equal(t, !found, idx.insert(key))
+
+		if !found {
+			expected = slices.Insert(expected, pos, key)
+		}
+	}
+
+	check()
+
+	// Case 2: Removal
+
+	for i := 0; i < 10000; i++ {
+		key := rnd.Int63n(30000)
+		pos, found := slices.BinarySearch(expected, key)
+
+		assert.Equal(t, found, idx.remove(key))
+		assert.False(t, idx.has(key))
+
+		if found {
+			expected = slices.Delete(expected, pos, pos+1)
+		}
+	}
+
+	check()
+
+	// Case 3: Removal of all the keys
+
+	rnd.Shuffle(len(expected), func(i, j int) { expected[i], expected[j] = expected[j], expected[i] })
+
+	for _, key := range expected {
+		assert.True(t, idx.remove(key))
+	}
+
+	expected = []int64{}
+
+	check()
+	assert.Nil(t, idx.root)
+}
+
+/* Benchmark the retrieval of a people page (the middle one) with the store size growing up to 1M
+   people */
+func BenchmarkQueryPeople(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000, 1000000} {
+		people := make(map[string]personRecord, size)
+
+		for i := 0; i < size; i++ {
+			pid := fmt.Sprintf("P%07d", i)
+			people[pid] = personRecord{pid, "Given", "Surname", gMale, 1}
+		}
+
+		store := newMemoryStore(people, nil)
+		pag := paginationData{size / 40, 20, 0, 10, 100}
+
+		b.Run(fmt.Sprintf("people=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := store.queryPeople(pag, personFilter{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+/* Benchmark the retrieval of a relations page (the middle one) with the store size growing up to
+   2M relations */
+func BenchmarkQueryAllRelations(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000, 1000000} {
+		store := testMakeTreeStore(size)
+		pag := paginationData{size / 20, 20, 0, 10, 100}
+
+		b.Run(fmt.Sprintf("people=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := store.queryRelationsByPerson("", pag); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+/* Benchmark the insertion and removal of a person (the ordered index maintenance included) */
+func BenchmarkInsertRemovePerson(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000, 1000000} {
+		people := make(map[string]personRecord, size)
+
+		for i := 0; i < size; i++ {
+			pid := fmt.Sprintf("P%07d", 2*i)
+			people[pid] = personRecord{pid, "Given", "Surname", gMale, 1}
+		}
+
+		store := newMemoryStore(people, nil)
+		person := personRecord{fmt.Sprintf("P%07d", size+1), "Given", "Surname", gMale, 0}
+
+		b.Run(fmt.Sprintf("people=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := store.insertPerson(person); err != nil {
+					b.Fatal(err)
+				}
+
+				if err := store.removePerson(person.Id); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
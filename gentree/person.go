@@ -54,7 +54,17 @@ func (p *fullPersonPayload) toRecord() personRecord {
 		gender = gUnknown
 	}
 
-	return personRecord{p.Id, p.Given, p.Surname, gender}
+	return personRecord{p.Id, p.Given, p.Surname, gender, 0}
+}
+
+/* Intermediate structure used to bind the create person payload
+
+   The server generates the person id if the id field is missing (see personIdGenerator) */
+type optidPersonPayload struct {
+	Id      string `json:"id" binding:"omitempty,alphanum|uuid"`
+	Given   string `json:"given_names"`
+	Surname string `json:"surname"`
+	Gender  string `json:"gender" binding:"isdefault|oneof=male female unknown"`
 }
 
 /* Intermediate structure used to bind person payload when the person id field is not expected */
@@ -125,20 +135,51 @@ func makeRetrievePersonUrl(c *gin.Context, pid string) string {
 
 /* Handle a create person request
 
-   The function will retrieve all the input data from the request payload (fullPersonPayload) */
+   The function will retrieve all the input data from the request payload (optidPersonPayload). If
+   the payload has no id, the server generates one. */
 func createPerson(c *gin.Context) {
 	log.Trace("Entry checkpoint")
 
-	var person fullPersonPayload
+	var payload optidPersonPayload
 
-	if err := c.ShouldBindJSON(&person); err != nil {
+	if err := c.ShouldBindJSON(&payload); err != nil {
 		log.Infof("New person data unmarshalling error: %s", err)
 
 		c.JSON(http.StatusBadRequest, gin.H{"message": payloadErrorMsg})
 		return
 	}
 
-	if _, found, err := getPerson(person.Id); found {
+	person := fullPersonPayload{payload.Id, payload.Given, payload.Surname, payload.Gender}
+
+	if person.Id == "" {
+		// The id generation and the insertion must be atomic, so that the id can't be taken in
+		// between:
+		err := getStore(c).update(func(tx Store) error {
+			var err error
+
+			if person.Id, err = getPersonIdGenerator(c).nextPersonId(tx); err != nil {
+				return err
+			}
+
+			return tx.insertPerson(person.toRecord())
+		})
+
+		if err != nil {
+			log.Errorf("An error occurred during the person insertion attempt (%s)", err)
+
+			c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+			return
+		}
+
+		c.Header("Location", makeRetrievePersonUrl(c, person.Id))
+		c.JSON(http.StatusCreated, gin.H{"message": "ok", "pid": person.Id})
+
+		log.Infof("Created a new person (%s) record with a generated id", person.Id)
+		return
+	}
+
+	// The insertion fails if the person exists, so no separate (racy) existence check is needed:
+	if err := getStore(c).insertPerson(person.toRecord()); isAppError(err, errDuplicateFound) {
 		log.Infof("A person with given id (%s) already exists", person.Id)
 
 		c.JSON(
@@ -149,16 +190,14 @@ func createPerson(c *gin.Context) {
 			})
 		return
 	} else if err != nil {
-		log.Errorf("An error occurred during the person retrieval attempt (%s)", err)
+		log.Errorf("An error occurred during the person insertion attempt (%s)", err)
 
 		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
 		return
 	}
 
-	people[person.Id] = person.toRecord()
-
 	c.Header("Location", makeRetrievePersonUrl(c, person.Id))
-	c.JSON(http.StatusCreated, gin.H{"message": "ok"})
+	c.JSON(http.StatusCreated, gin.H{"message": "ok", "pid": person.Id})
 
 	log.Infof("Created a new person (%s) record", person.Id)
 }
@@ -179,7 +218,7 @@ func replacePerson(c *gin.Context) {
 		return
 	}
 
-	_, found, err := getPerson(params.Pid)
+	_, found, err := getStore(c).getPerson(params.Pid)
 
 	if !found {
 		log.Infof("The person with given id (%s) doesn't exist and can't be replaced", params.Pid)
@@ -202,11 +241,64 @@ func replacePerson(c *gin.Context) {
 		return
 	}
 
-	people[params.Pid] = person.toRecord(params.Pid)
+	doReplacePerson(c, params.Pid, person)
+}
+
+/* Lower level, shared implementation of the replace person handlers
+
+   The upper-level handlers (replacePerson and restorePersonRevision) are adapters taking the new
+   person data from different sources and passing them to this function
+
+   Params:
+   * c - gin context
+   * pid - the person identifier
+   * person - the new person data (already validated) */
+func doReplacePerson(c *gin.Context, pid string, person noidPersonPayload) {
+	log.Trace("Entry checkpoint")
+
+	var current personRecord
 
+	// The revision check and the update must be atomic:
+	err := getStore(c).update(func(tx Store) error {
+		var found bool
+		var err error
+
+		// The person might have been deleted in the meantime:
+		if current, found, err = tx.getPerson(pid); err != nil {
+			return err
+		} else if !found {
+			return AppError{errRecordNotFound, fmt.Sprintf("Person record (%s) not found", pid)}
+		}
+
+		if err := checkIfMatch(c, current.Rev); err != nil {
+			return err
+		}
+
+		return tx.updatePerson(person.toRecord(pid))
+	})
+
+	if isAppError(err, errRecordNotFound) {
+		log.Infof("The person with given id (%s) doesn't exist and can't be replaced", pid)
+
+		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown person id"})
+		return
+	} else if isAppError(err, errRevisionMismatch) {
+		log.Infof("The person (%s) can't be replaced (%s)", pid, err)
+
+		c.Header("ETag", makeETag(current.Rev))
+		c.JSON(http.StatusPreconditionFailed, gin.H{"message": preconditionErrorMsg})
+		return
+	} else if err != nil {
+		log.Errorf("An error occurred during the person update attempt (%s)", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	}
+
+	c.Header("ETag", makeETag(current.Rev+1))
 	c.JSON(http.StatusOK, gin.H{"message": "Person record replaced"})
 
-	log.Infof("Replaced the person (%s) record", params.Pid)
+	log.Infof("Replaced the person (%s) record", pid)
 }
 
 /* Handle a retrieve person request
@@ -224,7 +316,7 @@ func retrievePerson(c *gin.Context) {
 		return
 	}
 
-	person, found, err := getPerson(params.Pid)
+	person, found, err := getStore(c).getPerson(params.Pid)
 
 	if !found {
 		log.Infof("The person with given id (%s) doesn't exist", params.Pid)
@@ -239,7 +331,18 @@ func retrievePerson(c *gin.Context) {
 	}
 
 	c.Header("Access-Control-Allow-Origin", "*")
-	c.JSON(http.StatusOK, person.toPayload())
+	c.Header("Access-Control-Expose-Headers", "ETag")
+	c.Header("ETag", makeETag(person.Rev))
+	c.Header("Vary", "Accept")
+
+	if isGedcomxAccepted(c) {
+		// The JSON renderer keeps the content type set here:
+		c.Header("Content-Type", gedcomxMediaType)
+		c.JSON(http.StatusOK, gedcomxDocument{
+			Persons: []gedcomxPerson{gedcomxFromPerson(person.toPayload())}})
+	} else {
+		c.JSON(http.StatusOK, person.toPayload())
+	}
 
 	log.Infof("Found the requested person record (%s)", params.Pid)
 }
@@ -265,7 +368,7 @@ func retrievePeople(c *gin.Context) {
 	}
 
 	personFilter := searchQuery.toFilter(c.Request.URL.Query())
-	people, pagData, err := queryPeople(pagQuery.toPaginationData(), personFilter)
+	people, pagData, err := getStore(c).queryPeople(pagQuery.toPaginationData(), personFilter)
 
 	if err != nil {
 		log.Errorf("An error occurred during people retrieval attempt (%s)", err)
@@ -301,36 +404,52 @@ func deletePerson(c *gin.Context) {
 		return
 	}
 
-	_, found, err := getPerson(params.Pid)
+	var person personRecord
+	var found bool
+	var item trashRecord
+
+	// The relations must be moved to the trash together with the person, so that no relation of
+	// the person can be created in between:
+	err := getStore(c).update(func(tx Store) error {
+		var err error
+
+		if person, found, err = tx.getPerson(params.Pid); !found || err != nil {
+			return err
+		}
+
+		if err = checkIfMatch(c, person.Rev); err != nil {
+			return err
+		}
+
+		item, err = trashPerson(tx, person)
+
+		return err
+	})
 
 	if !found {
 		log.Infof("The person with given id (%s) doesn't exist", params.Pid)
 
 		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown person id"})
 		return
-	} else if err != nil {
-		log.Errorf("An error occurred during the person retrieval attempt (%s)", err)
+	} else if isAppError(err, errRevisionMismatch) {
+		log.Infof("The person (%s) can't be deleted (%s)", params.Pid, err)
 
-		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		c.Header("ETag", makeETag(person.Rev))
+		c.JSON(http.StatusPreconditionFailed, gin.H{"message": preconditionErrorMsg})
 		return
-	}
-
-	delCnt, err := deleteRelationsByPerson(params.Pid)
-
-	if err != nil {
-		log.Errorf("An error occurred during relations deletion attempt (%s)", err)
+	} else if err != nil {
+		log.Errorf("An error occurred during the person deletion attempt (%s)", err)
 
 		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
 		return
 	}
 
-	delete(people, params.Pid)
-
 	c.JSON(http.StatusOK, gin.H{
 		"message":              "Person deleted",
-		"deleted_relation_cnt": delCnt})
+		"deleted_relation_cnt": len(item.Relations),
+		"trash_id":             item.Id})
 
 	log.Infof(
-		"Deleted the requested person record (%s) and %d associated relation records",
-		params.Pid, delCnt)
+		"Moved the requested person record (%s) and %d associated relation records to the trash (%d)",
+		params.Pid, len(item.Relations), item.Id)
 }
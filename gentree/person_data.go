@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"net/url"
 	"sort"
@@ -13,18 +14,20 @@ const (
 	gUnknown = "unknown"
 )
 
-/* Storage representation of a person */
+/* Storage representation of a person
+
+   The JSON encoding of the record is used by the journal files (see journal_store.go) */
 type personRecord struct {
-	Id      string
-	Given   string
-	Surname string
-	Gender  string
+	Id      string `json:"id"`
+	Given   string `json:"given_names"`
+	Surname string `json:"surname"`
+	Gender  string `json:"gender"`
+	// Revision number assigned by the store (1 on insertion, incremented on every update)
+	Rev int64 `json:"rev"`
 }
 
 type personList []personRecord
 
-var people = map[string]personRecord{}
-
 /* Person filter specification */
 type personIdsFilter struct {
 	Value   []string
@@ -52,15 +55,41 @@ func (f *personFilter) updateQuery(vals url.Values) url.Values {
 	return vals
 }
 
+/* Store the person record in the people map and the ordered index
+
+   The function replaces the existing record with the same id (if any). It doesn't record the
+   modification in the undo log or in the history. */
+func (s *memoryStore) putPerson(person personRecord) {
+	s.people[person.Id] = person
+	s.personIds.insert(person.Id)
+}
+
+/* Remove the person record from the people map and the ordered index (see putPerson) */
+func (s *memoryStore) dropPerson(pid string) {
+	delete(s.people, pid)
+	s.personIds.remove(pid)
+}
+
+/* Retrieve the person records with the given identifiers (in the order of the identifiers) */
+func (s *memoryStore) peopleById(ids []string) personList {
+	result := make(personList, 0, len(ids))
+
+	for _, pid := range ids {
+		result = append(result, s.people[pid])
+	}
+
+	return result
+}
+
 /* Retrieve a person record by id
  * Returns:
  * * Person record structure (uninitialized if not found)
  * * Success flag (true if the record was found and false otherwise)
  * * Error (if occurred) */
-func getPerson(pid string) (personRecord, bool, error) {
+func (s *memoryStore) getPerson(pid string) (personRecord, bool, error) {
 	log.Debugf("Retrieving person record by id (%s)", pid)
 
-	person, found := people[pid]
+	person, found := s.people[pid]
 
 	if !found {
 		log.Debugf("Person record (%s) not found", pid)
@@ -82,28 +111,146 @@ func getPerson(pid string) (personRecord, bool, error) {
    * updated pagination data (empty if an error occurred; copy of the pag parameter with the total
      record count field updated otherwise)
    * error (if occurred and nil otherwise) */
-func queryPeople(pag paginationData, filter personFilter) (personList, paginationData, error) {
+func (s *memoryStore) queryPeople(pag paginationData, filter personFilter) (personList, paginationData, error) {
 	log.Debugf("Retrieving all the people")
 
 	if err := pag.validate(); err != nil {
 		return []personRecord{}, paginationData{}, err
 	}
 
-	// Extract slice of all the values (person records) of the person map
-	sorted := make(personList, 0, len(people))
+	if !filter.Ids.Enabled {
+		// The ordered index allows retrieving the page without visiting the preceding records:
+		pag.TotalCnt = s.personIds.len()
+
+		return s.peopleById(s.personIds.slice(pag.PageIdx*pag.PageSize, pag.PageSize)), pag, nil
+	}
+
+	// The filter lists the ids explicitly, so only the listed records are visited:
+	ids := make([]string, 0, len(filter.Ids.Value))
+
+	for _, pid := range filter.Ids.Value {
+		if _, found := s.people[pid]; found && !containsStr(ids, pid) {
+			ids = append(ids, pid)
+		}
+	}
+
+	sort.Strings(ids)
+
+	first := minInt(pag.PageIdx*pag.PageSize, len(ids))
+	last := minInt((pag.PageIdx+1)*pag.PageSize, len(ids))
+
+	pag.TotalCnt = len(ids)
+
+	return s.peopleById(ids[first:last]), pag, nil
+}
+
+/* Find the greatest sequence number used by the person ids of the given prefix
 
-	for _, r := range people {
-		if !filter.Ids.Enabled || containsStr(filter.Ids.Value, r.Id) {
-			sorted = append(sorted, r)
+   Both the existing records and the histories (covering the deleted records) are visited */
+func (s *memoryStore) maxPersonSequence(prefix string) (int64, error) {
+	log.Debugf("Retrieving the greatest person id sequence number (%s)", prefix)
+
+	var result int64 = 0
+
+	update := func(pid string) {
+		if seq, ok := parsePersonSequence(pid, prefix); ok && seq > result {
+			result = seq
 		}
 	}
 
-	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Id < sorted[j].Id })
+	for pid := range s.people {
+		update(pid)
+	}
+
+	for pid := range s.personHistory {
+		update(pid)
+	}
+
+	return result, nil
+}
+
+/* Store a new person record
+
+   The record revision is set to 1 or, if the record existed before, to the revision following the
+   last one in the history (the Rev field of the parameter is ignored)
+
+   Return:
+   * error (if the person id is already used and nil otherwise) */
+func (s *memoryStore) insertPerson(person personRecord) error {
+	log.Debugf("Inserting person record (%s)", person.Id)
+
+	if _, found := s.people[person.Id]; found {
+		return AppError{
+			errDuplicateFound, fmt.Sprintf("Person record (%s) already exists", person.Id)}
+	}
+
+	person.Rev = s.nextPersonRev(person.Id)
+
+	s.putPerson(person)
+	s.onUndo(func() { s.dropPerson(person.Id) })
+	s.recordPersonRevision(revCreate, person)
+
+	return nil
+}
+
+/* Overwrite an existing person record
+
+   The record revision is incremented (the Rev field of the parameter is ignored)
+
+   Return:
+   * error (if the person record doesn't exist and nil otherwise) */
+func (s *memoryStore) updatePerson(person personRecord) error {
+	log.Debugf("Updating person record (%s)", person.Id)
+
+	old, found := s.people[person.Id]
+
+	if !found {
+		return AppError{
+			errRecordNotFound, fmt.Sprintf("Person record (%s) not found", person.Id)}
+	}
+
+	person.Rev = old.Rev + 1
+
+	s.people[person.Id] = person
+	s.onUndo(func() { s.people[old.Id] = old })
+	s.recordPersonRevision(revUpdate, person)
+
+	return nil
+}
+
+/* Remove a person record
+
+   Return:
+   * error (if the person record doesn't exist and nil otherwise) */
+func (s *memoryStore) removePerson(pid string) error {
+	log.Debugf("Removing person record (%s)", pid)
+
+	old, found := s.people[pid]
+
+	if !found {
+		return AppError{errRecordNotFound, fmt.Sprintf("Person record (%s) not found", pid)}
+	}
+
+	s.dropPerson(pid)
+	s.onUndo(func() { s.putPerson(old) })
+
+	if extensions, found := s.gedcomExtensions[pid]; found {
+		delete(s.gedcomExtensions, pid)
+		s.onUndo(func() { s.gedcomExtensions[pid] = extensions })
+	}
 
-	first := minInt(pag.PageIdx*pag.PageSize, len(sorted))
-	last := minInt((pag.PageIdx+1)*pag.PageSize, len(sorted))
+	if handle, found := s.grampsHandles[pid]; found {
+		delete(s.grampsHandles, pid)
+		delete(s.grampsPids, handle)
+		s.onUndo(func() {
+			s.grampsHandles[pid] = handle
+			s.grampsPids[handle] = pid
+		})
+	}
 
-	pag.TotalCnt = len(sorted)
+	deleted := old
+	deleted.Rev++
+	s.recordPersonRevision(revDelete, deleted)
 
-	return sorted[first:last], pag, nil
+	return nil
 }
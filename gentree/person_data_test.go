@@ -6,12 +6,14 @@ import (
 )
 
 func TestGetPerson(t *testing.T) {
-	people = map[string]personRecord{
-		"P1": personRecord{"P1", "Jan", "Kowalski", gMale},
-		"P2": personRecord{"P2", "Anna", "Nowak", gFemale},
-		"P3": personRecord{"P3", "", "", gUnknown}}
+	people := map[string]personRecord{
+		"P1": personRecord{"P1", "Jan", "Kowalski", gMale, 0},
+		"P2": personRecord{"P2", "Anna", "Nowak", gFemale, 0},
+		"P3": personRecord{"P3", "", "", gUnknown, 0}}
 
-	person, found, err := getPerson("P2")
+	store := newMemoryStore(people, nil)
+
+	person, found, err := store.getPerson("P2")
 
 	assert.Equal(t, person.Id, "P2")
 	assert.Equal(t, person.Given, "Anna")
@@ -20,7 +22,7 @@ func TestGetPerson(t *testing.T) {
 	assert.True(t, found)
 	assert.Nil(t, err)
 
-	person, found, err = getPerson("P4")
+	person, found, err = store.getPerson("P4")
 
 	assert.Empty(t, person.Id)
 	assert.Empty(t, person.Given)
@@ -35,18 +37,20 @@ func TestGetPerson(t *testing.T) {
  * 1. All the records are returned when the person filter is at the defaults
  * 2. Only the requested records are returned then the person ids filter is used */
 func TestQueryPeople1Simple(t *testing.T) {
-	people = map[string]personRecord{
-		"P02": personRecord{"P02", "Anna", "Nowak", gFemale},
-		"P04": personRecord{"P04", "Jagoda", "Szewczyk", gFemale},
-		"P03": personRecord{"P03", "Antoni", "Michalak", gMale},
-		"P05": personRecord{"P05", "Eustachy", "Sobczak", gMale},
-		"P06": personRecord{"P06", "Blanka", "Baranowska", gFemale},
-		"P01": personRecord{"P01", "Jan", "Kowalski", gMale},
+	people := map[string]personRecord{
+		"P02": personRecord{"P02", "Anna", "Nowak", gFemale, 0},
+		"P04": personRecord{"P04", "Jagoda", "Szewczyk", gFemale, 0},
+		"P03": personRecord{"P03", "Antoni", "Michalak", gMale, 0},
+		"P05": personRecord{"P05", "Eustachy", "Sobczak", gMale, 0},
+		"P06": personRecord{"P06", "Blanka", "Baranowska", gFemale, 0},
+		"P01": personRecord{"P01", "Jan", "Kowalski", gMale, 0},
 	}
 
+	store := newMemoryStore(people, nil)
+
 	// Case 1: All the records returned without filtering
 
-	list, pagResult, err := queryPeople(paginationData{0, 10, 0, 10, 10}, personFilter{})
+	list, pagResult, err := store.queryPeople(paginationData{0, 10, 0, 10, 10}, personFilter{})
 
 	assert.Len(t, list, 6)
 	// The result table should be sorted by the person id field:
@@ -63,7 +67,7 @@ func TestQueryPeople1Simple(t *testing.T) {
 
 	// Case 2: Only the requested records returned with person ids filter
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    10,
@@ -89,9 +93,11 @@ func TestQueryPeople1Simple(t *testing.T) {
  * 1. Check the no filter scenario
  * 2. Check the person ids filter scenario */
 func TestQueryPeopleEmpty(t *testing.T) {
-	people = map[string]personRecord{}
+	people := map[string]personRecord{}
+
+	store := newMemoryStore(people, nil)
 
-	list, pagResult, err := queryPeople(
+	list, pagResult, err := store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    10,
@@ -106,7 +112,7 @@ func TestQueryPeopleEmpty(t *testing.T) {
 	assert.Equal(t, pagResult.TotalCnt, 0)
 	assert.Nil(t, err)
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    10,
@@ -132,17 +138,19 @@ func TestQueryPeopleEmpty(t *testing.T) {
  * 5. Check the all existing ids case
  * 6. Check the all existing ids case with some extra unknown ids */
 func TestQueryPeoplePidsFilter(t *testing.T) {
-	people = map[string]personRecord{
-		"y 002": personRecord{"y 002", "Zuzanna", "Dąbrowska", gFemale},
-		"y 001": personRecord{"y 001", "Bogumiła", "Bąk", gFemale},
-		"y 003": personRecord{"y 003", "Edward", "Szymczak", gMale},
-		"y 004": personRecord{"y 004", "Jerzy", "Sokołowski", gMale},
-		"y 005": personRecord{"y 005", "Lila", "Gajewska", gFemale},
+	people := map[string]personRecord{
+		"y 002": personRecord{"y 002", "Zuzanna", "Dąbrowska", gFemale, 0},
+		"y 001": personRecord{"y 001", "Bogumiła", "Bąk", gFemale, 0},
+		"y 003": personRecord{"y 003", "Edward", "Szymczak", gMale, 0},
+		"y 004": personRecord{"y 004", "Jerzy", "Sokołowski", gMale, 0},
+		"y 005": personRecord{"y 005", "Lila", "Gajewska", gFemale, 0},
 	}
 
+	store := newMemoryStore(people, nil)
+
 	// Case 1: Empty ids set
 
-	list, pagResult, err := queryPeople(
+	list, pagResult, err := store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    10,
@@ -160,7 +168,7 @@ func TestQueryPeoplePidsFilter(t *testing.T) {
 
 	// Case 2: Unknown id
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    10,
@@ -178,7 +186,7 @@ func TestQueryPeoplePidsFilter(t *testing.T) {
 
 	// Case 3: Known id
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    10,
@@ -197,7 +205,7 @@ func TestQueryPeoplePidsFilter(t *testing.T) {
 
 	// Case 4: Multiple ids, some unknown
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    10,
@@ -218,7 +226,7 @@ func TestQueryPeoplePidsFilter(t *testing.T) {
 
 	// Case 5: All existing ids are in the filter
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    10,
@@ -241,7 +249,7 @@ func TestQueryPeoplePidsFilter(t *testing.T) {
 
 	// Case 6: All existing ids and some unknown
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    10,
@@ -265,11 +273,13 @@ func TestQueryPeoplePidsFilter(t *testing.T) {
 }
 
 func TestQueryPeoplePaging(t *testing.T) {
-	people = map[string]personRecord{
-		"P01": personRecord{"P01", "Anna", "Kowalska", gFemale},
+	people := map[string]personRecord{
+		"P01": personRecord{"P01", "Anna", "Kowalska", gFemale, 0},
 	}
 
-	list, pagResult, err := queryPeople(
+	store := newMemoryStore(people, nil)
+
+	list, pagResult, err := store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    2,
@@ -285,7 +295,7 @@ func TestQueryPeoplePaging(t *testing.T) {
 	assert.Equal(t, pagResult.TotalCnt, 1)
 	assert.Nil(t, err)
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     1,
 			PageSize:    2,
@@ -300,9 +310,9 @@ func TestQueryPeoplePaging(t *testing.T) {
 	assert.Equal(t, pagResult.TotalCnt, 1)
 	assert.Nil(t, err)
 
-	people["P03"] = personRecord{"P03", "Żaneta", "Rutkowska", gFemale}
+	store.putPerson(personRecord{"P03", "Żaneta", "Rutkowska", gFemale, 0})
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    2,
@@ -319,7 +329,7 @@ func TestQueryPeoplePaging(t *testing.T) {
 	assert.Equal(t, pagResult.TotalCnt, 2)
 	assert.Nil(t, err)
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     1,
 			PageSize:    2,
@@ -334,9 +344,9 @@ func TestQueryPeoplePaging(t *testing.T) {
 	assert.Equal(t, pagResult.TotalCnt, 2)
 	assert.Nil(t, err)
 
-	people["P04"] = personRecord{"P04", "Anatol", "Chmielewski", gMale}
+	store.putPerson(personRecord{"P04", "Anatol", "Chmielewski", gMale, 0})
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    2,
@@ -353,7 +363,7 @@ func TestQueryPeoplePaging(t *testing.T) {
 	assert.Equal(t, pagResult.TotalCnt, 3)
 	assert.Nil(t, err)
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     1,
 			PageSize:    2,
@@ -369,7 +379,7 @@ func TestQueryPeoplePaging(t *testing.T) {
 	assert.Equal(t, pagResult.TotalCnt, 3)
 	assert.Nil(t, err)
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     2,
 			PageSize:    2,
@@ -385,9 +395,9 @@ func TestQueryPeoplePaging(t *testing.T) {
 	assert.Nil(t, err)
 
 	// Note that the 'P02' identifier puts this record on the first page
-	people["P02"] = personRecord{"P02", "Michał", "Jasiński", gMale}
+	store.putPerson(personRecord{"P02", "Michał", "Jasiński", gMale, 0})
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    2,
@@ -404,7 +414,7 @@ func TestQueryPeoplePaging(t *testing.T) {
 	assert.Equal(t, pagResult.TotalCnt, 4)
 	assert.Nil(t, err)
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     1,
 			PageSize:    2,
@@ -421,7 +431,7 @@ func TestQueryPeoplePaging(t *testing.T) {
 	assert.Equal(t, pagResult.TotalCnt, 4)
 	assert.Nil(t, err)
 
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     2,
 			PageSize:    2,
@@ -438,14 +448,16 @@ func TestQueryPeoplePaging(t *testing.T) {
 }
 
 func TestQueryPeopleValidation(t *testing.T) {
-	people = map[string]personRecord{
-		"P01": personRecord{"P01", "Anna", "Kowalska", gFemale},
-		"P02": personRecord{"P02", "Błażej", "Czerwiński", gMale},
-		"P03": personRecord{"P03", "Bianka", "Wysocka", gFemale},
+	people := map[string]personRecord{
+		"P01": personRecord{"P01", "Anna", "Kowalska", gFemale, 0},
+		"P02": personRecord{"P02", "Błażej", "Czerwiński", gMale, 0},
+		"P03": personRecord{"P03", "Bianka", "Wysocka", gFemale, 0},
 	}
 
+	store := newMemoryStore(people, nil)
+
 	// Page index smaller than 0:
-	list, pagResult, err := queryPeople(
+	list, pagResult, err := store.queryPeople(
 		paginationData{
 			PageIdx:     -1,
 			PageSize:    2,
@@ -461,7 +473,7 @@ func TestQueryPeopleValidation(t *testing.T) {
 	assert.ErrorIs(t, err, AppError{errInvalidArgument, "The page index is negative (-1)"})
 
 	// Page size smaller than the minimum
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    2,
@@ -478,7 +490,7 @@ func TestQueryPeopleValidation(t *testing.T) {
 		t, err, AppError{errInvalidArgument, "The page size (2) is out of bounds ([10, 100])"})
 
 	// Page size greater than the maximum
-	list, pagResult, err = queryPeople(
+	list, pagResult, err = store.queryPeople(
 		paginationData{
 			PageIdx:     0,
 			PageSize:    200,
@@ -0,0 +1,206 @@
+package main
+
+/* This file defines the generators of the identifiers of the people created without an id */
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/oklog/ulid"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Person id schemes (see newPersonIdGenerator)
+const (
+	pidUuid4    = "uuid4"
+	pidUuid7    = "uuid7"
+	pidUlid     = "ulid"
+	pidSequence = "sequence"
+)
+
+/* Generator of the person identifiers
+
+   The generated identifiers satisfy the person id validation rules (alphanum|uuid) */
+type personIdGenerator interface {
+	/* Generate a new person id
+
+	   The id is not used by any existing person record nor by a deleted one (so that the history
+	   and the trash of the deleted person stay unambiguous). The function must be called from the
+	   function passed to the store update method, so that the id can't be taken in between.
+
+	   Params:
+	   * tx - the store (as passed to the function run by the store update method)
+
+	   Return:
+	   * new person id (empty if an error occurred)
+	   * error (if occurred or when the generation failed and nil otherwise) */
+	nextPersonId(tx Store) (string, error)
+}
+
+/* Check if the person id is used by an existing or deleted person record */
+func isPersonIdUsed(tx Store, pid string) (bool, error) {
+	if _, found, err := tx.getPerson(pid); found || err != nil {
+		return found, err
+	}
+
+	history, err := tx.queryPersonHistory(pid)
+
+	return len(history) > 0, err
+}
+
+/* Generator of the random (or partially random) identifiers */
+type randomPersonIdGenerator struct {
+	generate func() (string, error)
+}
+
+func (g *randomPersonIdGenerator) nextPersonId(tx Store) (string, error) {
+	const maxAttempts = 5
+
+	for i := 0; i < maxAttempts; i++ {
+		pid, err := g.generate()
+		if err != nil {
+			return "", err
+		}
+
+		if used, err := isPersonIdUsed(tx, pid); err != nil {
+			return "", err
+		} else if !used {
+			return pid, nil
+		}
+	}
+
+	msg := fmt.Sprintf("Failed to generate person id in %d attempts", maxAttempts)
+
+	log.Warn(msg)
+
+	return "", AppError{errIdGenerationFailed, msg}
+}
+
+// Maximal number of the sequence number digits (so that the numbers fit into int64)
+const maxPersonSequenceDigits = 18
+
+/* Extract the sequence number from a person id consisting of the prefix followed by digits
+
+   Return:
+   * the sequence number (0 if the id doesn't match)
+   * success flag (true if the id matches and false otherwise) */
+func parsePersonSequence(pid string, prefix string) (int64, bool) {
+	digits, found := strings.CutPrefix(pid, prefix)
+
+	if !found || digits == "" || len(digits) > maxPersonSequenceDigits {
+		return 0, false
+	}
+
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+
+	seq, err := strconv.ParseInt(digits, 10, 64)
+
+	return seq, err == nil
+}
+
+/* Generator of the prefixed sequence numbers (e.g. I0001, I0002, ...)
+
+   The generator doesn't persist its state. When generating the first id, it continues after the
+   greatest number used by the store (see maxPersonSequence), so it doesn't probe all the used
+   numbers after a restart. The numbers taken later in another way (e.g. by the people created
+   with an explicit id) are skipped. */
+type sequencePersonIdGenerator struct {
+	prefix string
+	// Minimal number of digits (the numbers are padded with zeros)
+	width int
+
+	mutex sync.Mutex
+	next  int64
+	// Set once the next number is adjusted to the numbers used by the store
+	seeded bool
+}
+
+func (g *sequencePersonIdGenerator) nextPersonId(tx Store) (string, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if !g.seeded {
+		last, err := tx.maxPersonSequence(g.prefix)
+		if err != nil {
+			return "", err
+		}
+
+		g.next = max(g.next, last+1)
+		g.seeded = true
+	}
+
+	for {
+		pid := fmt.Sprintf("%s%0*d", g.prefix, g.width, g.next)
+
+		if used, err := isPersonIdUsed(tx, pid); err != nil {
+			return "", err
+		} else if !used {
+			// The number is consumed even if the record is not created in the end:
+			g.next++
+			return pid, nil
+		}
+
+		g.next++
+	}
+}
+
+/* Create the person id generator of the given scheme
+
+   Params:
+   * scheme - one of the pidXxx constants
+   * prefix - the sequence number prefix (used only by the sequence scheme)
+   * width - the minimal number of the sequence number digits (used only by the sequence scheme)
+
+   Return:
+   * the generator (nil if an error occurred)
+   * error (if the scheme is unknown and nil otherwise) */
+func newPersonIdGenerator(scheme string, prefix string, width int) (personIdGenerator, error) {
+	switch scheme {
+	case pidUuid4:
+		return &randomPersonIdGenerator{func() (string, error) {
+			id, err := uuid.NewRandom()
+			return id.String(), err
+		}}, nil
+	case pidUuid7:
+		return &randomPersonIdGenerator{func() (string, error) {
+			id, err := uuid.NewV7()
+			return id.String(), err
+		}}, nil
+	case pidUlid:
+		return &randomPersonIdGenerator{func() (string, error) {
+			id, err := ulid.New(ulid.Timestamp(time.Now()), rand.Reader)
+			return id.String(), err
+		}}, nil
+	case pidSequence:
+		return &sequencePersonIdGenerator{prefix: prefix, width: width, next: 1}, nil
+	}
+
+	return nil, AppError{errInvalidArgument, fmt.Sprintf("Unknown person id scheme (%s)", scheme)}
+}
+
+// The gin context key under which the person id generator is available to the request handlers
+const personIdGeneratorCtxKey = "gentree.personIdGenerator"
+
+/* Create a middleware making the given person id generator available to the request handlers
+
+   The handlers retrieve the generator using the getPersonIdGenerator function */
+func personIdGeneratorMiddleware(gen personIdGenerator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(personIdGeneratorCtxKey, gen)
+		c.Next()
+	}
+}
+
+/* Retrieve the person id generator assigned to the request context by the middleware */
+func getPersonIdGenerator(c *gin.Context) personIdGenerator {
+	return c.MustGet(personIdGeneratorCtxKey).(personIdGenerator)
+}
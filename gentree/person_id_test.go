@@ -0,0 +1,144 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin/binding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+/* Test the person id generators
+
+   1. Check if every scheme generates unique ids passing the person id validation
+   2. Check if the sequence generator skips the ids of the existing and deleted people
+   3. Check if a new sequence generator continues after the greatest number used by the store
+      (in-memory and SQLite), ignoring the ids of other forms
+   4. Check if an unknown scheme is rejected */
+func TestPersonIdGenerators(t *testing.T) {
+	// Case 1: Valid ids
+
+	for _, scheme := range []string{pidUuid4, pidUuid7, pidUlid, pidSequence} {
+		gen, err := newPersonIdGenerator(scheme, "I", 4)
+		require.Nil(t, err)
+
+		store := newMemoryStore(nil, nil)
+		used := map[string]bool{}
+
+		for i := 0; i < 100; i++ {
+			pid, err := gen.nextPersonId(store)
+
+			require.Nil(t, err, scheme)
+			assert.Nil(t, binding.Validator.ValidateStruct(&specifyPersonUri{pid}), scheme)
+			assert.False(t, used[pid], scheme)
+
+			used[pid] = true
+		}
+	}
+
+	// Case 2: Sequence
+
+	store := newMemoryStore(nil, nil)
+
+	require.Nil(t, store.insertPerson(personRecord{"I0001", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"I0002", "Anna", "Nowak", gFemale, 0}))
+	require.Nil(t, store.removePerson("I0002"))
+
+	gen, err := newPersonIdGenerator(pidSequence, "I", 4)
+	require.Nil(t, err)
+
+	pid, err := gen.nextPersonId(store)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "I0003", pid)
+
+	pid, err = gen.nextPersonId(store)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "I0004", pid)
+
+	// Case 3: Restart
+
+	stores := map[string]Store{
+		"memory": newMemoryStore(nil, nil),
+		"sqlite": testOpenSqliteStore(t, filepath.Join(t.TempDir(), "gentree.db")),
+	}
+
+	for name, store := range stores {
+		// The last id has too many digits to be a sequence number:
+		pids := []string{"I0001", "I0012", "I0013", "I9x", "X0099", "I1234567890123456789"}
+
+		for _, pid := range pids {
+			require.Nil(t, store.insertPerson(personRecord{pid, "Jan", "Kowalski", gMale, 0}), name)
+		}
+
+		require.Nil(t, store.removePerson("I0013"), name)
+
+		seq, err := store.maxPersonSequence("I")
+
+		assert.Nil(t, err, name)
+		assert.Equal(t, int64(13), seq, name)
+
+		gen, err = newPersonIdGenerator(pidSequence, "I", 4)
+		require.Nil(t, err)
+
+		pid, err = gen.nextPersonId(store)
+
+		assert.Nil(t, err, name)
+		assert.Equal(t, "I0014", pid, name)
+	}
+
+	// Case 4: Unknown scheme
+
+	_, err = newPersonIdGenerator("guid", "", 0)
+
+	assert.True(t, isAppError(err, errInvalidArgument))
+}
+
+/* Test the creation of people without an id
+
+   1. Create a person using the create person endpoint
+   2. Create a person using the batch endpoint */
+func TestCreatePersonRequestGeneratedId(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	gen, err := newPersonIdGenerator(pidSequence, "I", 4)
+	require.Nil(t, err)
+
+	router := setupConfiguredRouter(store, routerConfig{personIds: gen})
+
+	// Case 1: Create person endpoint
+
+	res := testMakeRequest(router, "POST", "/people", testJsonBody(t, testPersonJson{
+		Given: "Antoni", Surname: "Wiśniewski", Gender: gMale}))
+
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "http://example.com/people/I0001", res.Header().Get("Location"))
+
+	type testPidJson struct {
+		Pid string `json:"pid"`
+	}
+
+	payload := testPidJson{}
+	testJsonRes(t, res, &payload)
+
+	assert.Equal(t, "I0001", payload.Pid)
+	assert.Equal(t, personRecord{"I0001", "Antoni", "Wiśniewski", gMale, 1}, store.people["I0001"])
+
+	// Case 2: Batch endpoint
+
+	res = testMakeRequest(router, "POST", "/batch", testJsonBody(t, testBatchJson{
+		[]testBatchOperationJson{
+			{Op: bopCreatePerson, Person: &testPersonJson{
+				Given: "Anna", Surname: "Nowak", Gender: gFemale}},
+		}}))
+
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	batch := testBatchRes(t, res)
+
+	require.Len(t, batch.Results, 1)
+	assert.Equal(t, "I0002", batch.Results[0].Pid)
+	assert.Equal(t, "http://example.com/people/I0002", batch.Results[0].Location)
+	assert.Equal(t, "Anna", store.people["I0002"].Given)
+}
@@ -38,6 +38,19 @@ func testMakeRequest(router *gin.Engine, method string, url string, body io.Read
 	return res
 }
 
+func testMakeRequestWithHeaders(router *gin.Engine, method string, url string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest(method, url, body)
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	router.ServeHTTP(res, req)
+
+	return res
+}
+
 func testJsonRes(t *testing.T, res *httptest.ResponseRecorder, payload interface{}) {
 	require.True(t, json.Valid(res.Body.Bytes()))
 	err := json.Unmarshal(res.Body.Bytes(), &payload)
@@ -155,9 +168,7 @@ func TestPersonListToPayload(t *testing.T) {
    2. Check the case of invalid person id format (part of the url)
    3. Check the case of missing person */
 func TestDeletePersonRequest(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"162d2a92": personRecord{
 			Id:      "162d2a92",
 			Given:   "Kazimierz",
@@ -174,11 +185,14 @@ func TestDeletePersonRequest(t *testing.T) {
 			Surname: "Nowak",
 			Gender:  gFemale}}
 
-	relations = map[int64]relationRecord{
+	relations := map[int64]relationRecord{
 		1: relationRecord{Id: 1, Pid1: "4a98ebf4", Pid2: "d910690c", Type: relHusband},
 		2: relationRecord{Id: 2, Pid1: "d910690c", Pid2: "162d2a92", Type: relMother},
 		3: relationRecord{Id: 3, Pid1: "4a98ebf4", Pid2: "162d2a92", Type: relFather}}
 
+	store := newMemoryStore(people, relations)
+	router := setupRouter(store)
+
 	// Case 1: Successful deletion
 
 	res := testMakeRequest(router, "DELETE", "/people/4a98ebf4", nil)
@@ -201,21 +215,21 @@ func TestDeletePersonRequest(t *testing.T) {
 	assert.Equal(t, "Person deleted", resData.Message)
 	assert.Equal(t, int64(2), resData.Count)
 
-	assert.Len(t, people, 2)
-	assert.Equal(t, "162d2a92", people["162d2a92"].Id)
-	assert.Equal(t, "Kazimierz", people["162d2a92"].Given)
-	assert.Equal(t, "Marciniak", people["162d2a92"].Surname)
-	assert.Equal(t, gMale, people["162d2a92"].Gender)
-	assert.Equal(t, "d910690c", people["d910690c"].Id)
-	assert.Equal(t, "Bernadetta", people["d910690c"].Given)
-	assert.Equal(t, "Nowak", people["d910690c"].Surname)
-	assert.Equal(t, gFemale, people["d910690c"].Gender)
-
-	assert.Len(t, relations, 1)
-	assert.Equal(t, int64(2), relations[2].Id)
-	assert.Equal(t, "d910690c", relations[2].Pid1)
-	assert.Equal(t, "162d2a92", relations[2].Pid2)
-	assert.Equal(t, relMother, relations[2].Type)
+	assert.Len(t, store.people, 2)
+	assert.Equal(t, "162d2a92", store.people["162d2a92"].Id)
+	assert.Equal(t, "Kazimierz", store.people["162d2a92"].Given)
+	assert.Equal(t, "Marciniak", store.people["162d2a92"].Surname)
+	assert.Equal(t, gMale, store.people["162d2a92"].Gender)
+	assert.Equal(t, "d910690c", store.people["d910690c"].Id)
+	assert.Equal(t, "Bernadetta", store.people["d910690c"].Given)
+	assert.Equal(t, "Nowak", store.people["d910690c"].Surname)
+	assert.Equal(t, gFemale, store.people["d910690c"].Gender)
+
+	assert.Len(t, store.relations, 1)
+	assert.Equal(t, int64(2), store.relations[2].Id)
+	assert.Equal(t, "d910690c", store.relations[2].Pid1)
+	assert.Equal(t, "162d2a92", store.relations[2].Pid2)
+	assert.Equal(t, relMother, store.relations[2].Type)
 
 	// Case 2: Invalid person id
 
@@ -227,15 +241,15 @@ func TestDeletePersonRequest(t *testing.T) {
 
 	assert.Equal(t, uriErrorMsg, resDataErr.Message)
 
-	assert.Len(t, people, 2)
-	assert.Equal(t, "162d2a92", people["162d2a92"].Id)
-	assert.Equal(t, "Kazimierz", people["162d2a92"].Given)
-	assert.Equal(t, "Marciniak", people["162d2a92"].Surname)
-	assert.Equal(t, gMale, people["162d2a92"].Gender)
-	assert.Equal(t, "d910690c", people["d910690c"].Id)
-	assert.Equal(t, "Bernadetta", people["d910690c"].Given)
-	assert.Equal(t, "Nowak", people["d910690c"].Surname)
-	assert.Equal(t, gFemale, people["d910690c"].Gender)
+	assert.Len(t, store.people, 2)
+	assert.Equal(t, "162d2a92", store.people["162d2a92"].Id)
+	assert.Equal(t, "Kazimierz", store.people["162d2a92"].Given)
+	assert.Equal(t, "Marciniak", store.people["162d2a92"].Surname)
+	assert.Equal(t, gMale, store.people["162d2a92"].Gender)
+	assert.Equal(t, "d910690c", store.people["d910690c"].Id)
+	assert.Equal(t, "Bernadetta", store.people["d910690c"].Given)
+	assert.Equal(t, "Nowak", store.people["d910690c"].Surname)
+	assert.Equal(t, gFemale, store.people["d910690c"].Gender)
 
 	// Case 3: Missing person
 
@@ -249,9 +263,10 @@ func TestDeletePersonRequest(t *testing.T) {
 }
 
 func TestCreatePersonRequestSuccess(t *testing.T) {
-	router := setupRouter()
+	people := map[string]personRecord{}
 
-	people = map[string]personRecord{}
+	store := newMemoryStore(people, nil)
+	router := setupRouter(store)
 
 	person := testPersonJson{
 		Id:      "1",
@@ -268,18 +283,19 @@ func TestCreatePersonRequestSuccess(t *testing.T) {
 	assert.Equal(t, "ok", resData.Message)
 	assert.Equal(t, "http://example.com/people/1", res.Header().Get("Location"))
 
-	assert.Len(t, people, 1)
-	assert.Equal(t, "1", people["1"].Id)
-	assert.Equal(t, "Dorota Justyna", people["1"].Given)
-	assert.Equal(t, "Zawadzka", people["1"].Surname)
-	assert.Equal(t, gFemale, people["1"].Gender)
+	assert.Len(t, store.people, 1)
+	assert.Equal(t, "1", store.people["1"].Id)
+	assert.Equal(t, "Dorota Justyna", store.people["1"].Given)
+	assert.Equal(t, "Zawadzka", store.people["1"].Surname)
+	assert.Equal(t, gFemale, store.people["1"].Gender)
 }
 
 /* Check if payload errors are correctly handled */
 func TestCreatePersonRequestPayload(t *testing.T) {
-	router := setupRouter()
+	people := map[string]personRecord{}
 
-	people = map[string]personRecord{}
+	store := newMemoryStore(people, nil)
+	router := setupRouter(store)
 
 	// Invalid gender field value:
 
@@ -297,9 +313,10 @@ func TestCreatePersonRequestPayload(t *testing.T) {
 
 	assert.Equal(t, payloadErrorMsg, resData.Message)
 
-	// Id field not specified:
+	// Invalid id field value (the missing id is generated by the server):
 
 	person = testPersonJson{
+		Id:      "1$",
 		Given:   "Antoni",
 		Surname: "Wiśniewski",
 		Gender:  gMale}
@@ -316,15 +333,16 @@ func TestCreatePersonRequestPayload(t *testing.T) {
 /* Check if the create person handler correctly handles the case of already existing person.
    Confirm that the returned location string works as expected */
 func TestCreatePersonRequestExists(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"X99": personRecord{
 			Id:      "X99",
 			Given:   "Marian",
 			Surname: "Zakrzewski",
 			Gender:  gMale}}
 
+	store := newMemoryStore(people, nil)
+	router := setupRouter(store)
+
 	person := testPersonJson{
 		Id:      "X99",
 		Given:   "Maria",
@@ -358,15 +376,16 @@ func TestCreatePersonRequestExists(t *testing.T) {
    The person identifier is taken from the request uri. The identifier specified in the payload
    should be ignored if provided */
 func TestReplacePersonRequestSuccess(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"5rjk": personRecord{
 			Id:      "5rjk",
 			Given:   "Honorata",
 			Surname: "Czarnecka",
 			Gender:  gFemale}}
 
+	store := newMemoryStore(people, nil)
+	router := setupRouter(store)
+
 	// Check if the payload person id is ignored:
 
 	person := testPersonJson{
@@ -383,11 +402,11 @@ func TestReplacePersonRequestSuccess(t *testing.T) {
 
 	assert.Equal(t, "Person record replaced", resData.Message)
 
-	assert.Len(t, people, 1)
-	assert.Equal(t, "5rjk", people["5rjk"].Id)
-	assert.Equal(t, "Gniewomir", people["5rjk"].Given)
-	assert.Equal(t, "Baranek", people["5rjk"].Surname)
-	assert.Equal(t, gMale, people["5rjk"].Gender)
+	assert.Len(t, store.people, 1)
+	assert.Equal(t, "5rjk", store.people["5rjk"].Id)
+	assert.Equal(t, "Gniewomir", store.people["5rjk"].Given)
+	assert.Equal(t, "Baranek", store.people["5rjk"].Surname)
+	assert.Equal(t, gMale, store.people["5rjk"].Gender)
 
 	// Check if the payload person id can be omitted
 	person = testPersonJson{
@@ -403,20 +422,18 @@ func TestReplacePersonRequestSuccess(t *testing.T) {
 
 	assert.Equal(t, "Person record replaced", resData.Message)
 
-	assert.Len(t, people, 1)
-	assert.Equal(t, "5rjk", people["5rjk"].Id)
-	assert.Equal(t, "Magdalena", people["5rjk"].Given)
-	assert.Equal(t, "Malinowska", people["5rjk"].Surname)
-	assert.Equal(t, gFemale, people["5rjk"].Gender)
+	assert.Len(t, store.people, 1)
+	assert.Equal(t, "5rjk", store.people["5rjk"].Id)
+	assert.Equal(t, "Magdalena", store.people["5rjk"].Given)
+	assert.Equal(t, "Malinowska", store.people["5rjk"].Surname)
+	assert.Equal(t, gFemale, store.people["5rjk"].Gender)
 }
 
 /* Test if the replace person endpoint handles not existing record correctly
 
    The handler should indicate an error and leave the people map unaltered */
 func TestReplacePersonRequestMissing(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"xejf": personRecord{
 			Id:      "xejf",
 			Given:   "Elżbieta",
@@ -428,6 +445,9 @@ func TestReplacePersonRequestMissing(t *testing.T) {
 			Surname: "Wróblewski",
 			Gender:  gMale}}
 
+	store := newMemoryStore(people, nil)
+	router := setupRouter(store)
+
 	person := testPersonJson{
 		Given:   "Igor",
 		Surname: "Krawczyk",
@@ -441,15 +461,15 @@ func TestReplacePersonRequestMissing(t *testing.T) {
 
 	assert.Equal(t, "Unknown person id", resData.Message)
 
-	assert.Len(t, people, 2)
-	assert.Equal(t, "xejf", people["xejf"].Id)
-	assert.Equal(t, "Elżbieta", people["xejf"].Given)
-	assert.Equal(t, "Głowacka", people["xejf"].Surname)
-	assert.Equal(t, gFemale, people["xejf"].Gender)
-	assert.Equal(t, "xl5l", people["xl5l"].Id)
-	assert.Equal(t, "Karol", people["xl5l"].Given)
-	assert.Equal(t, "Wróblewski", people["xl5l"].Surname)
-	assert.Equal(t, gMale, people["xl5l"].Gender)
+	assert.Len(t, store.people, 2)
+	assert.Equal(t, "xejf", store.people["xejf"].Id)
+	assert.Equal(t, "Elżbieta", store.people["xejf"].Given)
+	assert.Equal(t, "Głowacka", store.people["xejf"].Surname)
+	assert.Equal(t, gFemale, store.people["xejf"].Gender)
+	assert.Equal(t, "xl5l", store.people["xl5l"].Id)
+	assert.Equal(t, "Karol", store.people["xl5l"].Given)
+	assert.Equal(t, "Wróblewski", store.people["xl5l"].Surname)
+	assert.Equal(t, gMale, store.people["xl5l"].Gender)
 }
 
 /* Test if the replace person endpoint handles data format errors correctly
@@ -457,9 +477,7 @@ func TestReplacePersonRequestMissing(t *testing.T) {
    1. The handler should indicate an error when the URI person id is invalid
    2. The handler should indicate an error when the gender value is invalid */
 func TestReplacePersonRequestErrors(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"wjc5": personRecord{
 			Id:      "wjc5",
 			Given:   "Fryderyk",
@@ -471,6 +489,9 @@ func TestReplacePersonRequestErrors(t *testing.T) {
 			Surname: "Krawczyk",
 			Gender:  gUnknown}}
 
+	store := newMemoryStore(people, nil)
+	router := setupRouter(store)
+
 	// Case 1: Invalid URI person id
 
 	person := testPersonJson{
@@ -486,15 +507,15 @@ func TestReplacePersonRequestErrors(t *testing.T) {
 
 	assert.Equal(t, uriErrorMsg, resData.Message)
 
-	assert.Len(t, people, 2)
-	assert.Equal(t, "wjc5", people["wjc5"].Id)
-	assert.Equal(t, "Fryderyk", people["wjc5"].Given)
-	assert.Equal(t, "Lewandowski", people["wjc5"].Surname)
-	assert.Equal(t, gMale, people["wjc5"].Gender)
-	assert.Equal(t, "a1n6", people["a1n6"].Id)
-	assert.Empty(t, people["a1n6"].Given)
-	assert.Equal(t, "Krawczyk", people["a1n6"].Surname)
-	assert.Equal(t, gUnknown, people["a1n6"].Gender)
+	assert.Len(t, store.people, 2)
+	assert.Equal(t, "wjc5", store.people["wjc5"].Id)
+	assert.Equal(t, "Fryderyk", store.people["wjc5"].Given)
+	assert.Equal(t, "Lewandowski", store.people["wjc5"].Surname)
+	assert.Equal(t, gMale, store.people["wjc5"].Gender)
+	assert.Equal(t, "a1n6", store.people["a1n6"].Id)
+	assert.Empty(t, store.people["a1n6"].Given)
+	assert.Equal(t, "Krawczyk", store.people["a1n6"].Surname)
+	assert.Equal(t, gUnknown, store.people["a1n6"].Gender)
 
 	// Case 2: Invalid payload gender value
 
@@ -511,22 +532,23 @@ func TestReplacePersonRequestErrors(t *testing.T) {
 
 	assert.Equal(t, payloadErrorMsg, resData.Message)
 
-	assert.Len(t, people, 2)
-	assert.Equal(t, "wjc5", people["wjc5"].Id)
-	assert.Equal(t, "Fryderyk", people["wjc5"].Given)
-	assert.Equal(t, "Lewandowski", people["wjc5"].Surname)
-	assert.Equal(t, gMale, people["wjc5"].Gender)
-	assert.Equal(t, "a1n6", people["a1n6"].Id)
-	assert.Empty(t, people["a1n6"].Given)
-	assert.Equal(t, "Krawczyk", people["a1n6"].Surname)
-	assert.Equal(t, gUnknown, people["a1n6"].Gender)
+	assert.Len(t, store.people, 2)
+	assert.Equal(t, "wjc5", store.people["wjc5"].Id)
+	assert.Equal(t, "Fryderyk", store.people["wjc5"].Given)
+	assert.Equal(t, "Lewandowski", store.people["wjc5"].Surname)
+	assert.Equal(t, gMale, store.people["wjc5"].Gender)
+	assert.Equal(t, "a1n6", store.people["a1n6"].Id)
+	assert.Empty(t, store.people["a1n6"].Given)
+	assert.Equal(t, "Krawczyk", store.people["a1n6"].Surname)
+	assert.Equal(t, gUnknown, store.people["a1n6"].Gender)
 }
 
 /* Test if the retrieve people endpoint correctly deals with empty database */
 func TestRetrievePeopleRequestEmpty(t *testing.T) {
-	router := setupRouter()
+	people := map[string]personRecord{}
 
-	people = map[string]personRecord{}
+	store := newMemoryStore(people, nil)
+	router := setupRouter(store)
 
 	res := testMakeRequest(router, "GET", "/people", nil)
 
@@ -544,25 +566,26 @@ func TestRetrievePeopleRequestEmpty(t *testing.T) {
  * 1. Retrieval with the default (neutral) person filter
  * 2. Retrieval with active person ids filter  */
 func TestRetrievePeopleRequestPagination(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
-		"P01": personRecord{"P01", "Lidia", "Błaszczyk", gFemale},
-		"P02": personRecord{"P02", "Lara", "Szymańska", gFemale},
-		"P03": personRecord{"P03", "Radosław", "Kołodziej", gMale},
-		"P04": personRecord{"P04", "Antonina", "Kozłowska", gFemale},
-		"P05": personRecord{"P05", "Marcela", "Szymczak", gFemale},
-		"P06": personRecord{"P06", "Bruno", "Maciejewski", gMale},
-		"P07": personRecord{"P07", "Mirosława", "Czarnecka", gFemale},
-		"P08": personRecord{"P08", "Elena", "Szewczyk", gFemale},
-		"P09": personRecord{"P09", "Ariel", "Zalewski", gMale},
-		"P10": personRecord{"P10", "Florian", "Jankowski", gMale},
-		"P11": personRecord{"P11", "Borys", "Kalinowski", gMale},
-		"P12": personRecord{"P12", "Oliwia", "Cieślak", gFemale},
-		"P13": personRecord{"P13", "Natalia", "Ziółkowska", gFemale},
-		"P14": personRecord{"P14", "Eleonora", "Cieślak", gFemale},
+	people := map[string]personRecord{
+		"P01": personRecord{"P01", "Lidia", "Błaszczyk", gFemale, 0},
+		"P02": personRecord{"P02", "Lara", "Szymańska", gFemale, 0},
+		"P03": personRecord{"P03", "Radosław", "Kołodziej", gMale, 0},
+		"P04": personRecord{"P04", "Antonina", "Kozłowska", gFemale, 0},
+		"P05": personRecord{"P05", "Marcela", "Szymczak", gFemale, 0},
+		"P06": personRecord{"P06", "Bruno", "Maciejewski", gMale, 0},
+		"P07": personRecord{"P07", "Mirosława", "Czarnecka", gFemale, 0},
+		"P08": personRecord{"P08", "Elena", "Szewczyk", gFemale, 0},
+		"P09": personRecord{"P09", "Ariel", "Zalewski", gMale, 0},
+		"P10": personRecord{"P10", "Florian", "Jankowski", gMale, 0},
+		"P11": personRecord{"P11", "Borys", "Kalinowski", gMale, 0},
+		"P12": personRecord{"P12", "Oliwia", "Cieślak", gFemale, 0},
+		"P13": personRecord{"P13", "Natalia", "Ziółkowska", gFemale, 0},
+		"P14": personRecord{"P14", "Eleonora", "Cieślak", gFemale, 0},
 	}
 
+	store := newMemoryStore(people, nil)
+	router := setupRouter(store)
+
 	// Case 1: Neutral person filter
 
 	// Request the first page:
@@ -752,7 +775,7 @@ func TestRetrievePeopleRequestPagination(t *testing.T) {
 
 /* Test if the retrieve people endpoint correctly handles invalid pagination parameters */
 func TestRetrievePeopleRequestPaginationParams(t *testing.T) {
-	router := setupRouter()
+	router := setupRouter(newMemoryStore(nil, nil))
 
 	// Request negative page:
 
@@ -787,13 +810,14 @@ func TestRetrievePeopleRequestPaginationParams(t *testing.T) {
 
 /* Test if the retrieve person endpoint correctly returns person data */
 func TestRetrievePersonRequestSuccess(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
-		"P01": personRecord{"P01", "Зоя Юлийовна", "Жданов", gFemale},
-		"P02": personRecord{"P02", "Нина Романовна", "Примаков", gFemale},
+	people := map[string]personRecord{
+		"P01": personRecord{"P01", "Зоя Юлийовна", "Жданов", gFemale, 0},
+		"P02": personRecord{"P02", "Нина Романовна", "Примаков", gFemale, 0},
 	}
 
+	store := newMemoryStore(people, nil)
+	router := setupRouter(store)
+
 	res := testMakeRequest(router, "GET", "/people/P02", nil)
 
 	assert.Equal(t, http.StatusOK, res.Code)
@@ -808,9 +832,7 @@ func TestRetrievePersonRequestSuccess(t *testing.T) {
 
 /* Test if the retrieve person endpoint handles invalid person id format correctly */
 func TestRetrievePersonRequestError(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"3697": personRecord{
 			Id:      "3697",
 			Given:   "Жанна",
@@ -822,6 +844,9 @@ func TestRetrievePersonRequestError(t *testing.T) {
 			Surname: "Носов",
 			Gender:  gMale}}
 
+	store := newMemoryStore(people, nil)
+	router := setupRouter(store)
+
 	res := testMakeRequest(router, "GET", "/people/_xyz_", nil)
 
 	assert.Equal(t, http.StatusBadRequest, res.Code)
@@ -833,15 +858,16 @@ func TestRetrievePersonRequestError(t *testing.T) {
 
 /* Test if the retrieve person endpoint handles missing person correctly */
 func TestRetrievePersonRequestMissing(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"5303": personRecord{
 			Id:      "5303",
 			Given:   "Онисим",
 			Surname: "Абакумов",
 			Gender:  gMale}}
 
+	store := newMemoryStore(people, nil)
+	router := setupRouter(store)
+
 	res := testMakeRequest(router, "GET", "/people/7108", nil)
 
 	assert.Equal(t, http.StatusNotFound, res.Code)
@@ -850,3 +876,63 @@ func TestRetrievePersonRequestMissing(t *testing.T) {
 
 	assert.Equal(t, "Unknown person id", resData.Message)
 }
+
+/* Test the person revision handling (ETag and If-Match headers)
+
+   1. Check if the retrieve person endpoint returns the revision as the ETag header
+   2. Attempt to replace the person with a stale revision
+   3. Replace the person with the current revision
+   4. Attempt to delete the person with a stale revision
+   5. Delete the person with the wildcard If-Match header */
+func TestPersonRequestRevisions(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+
+	// Case 1: Retrieve
+
+	res := testMakeRequest(router, "GET", "/people/P1", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `"1"`, res.Header().Get("ETag"))
+
+	// Case 2: Replace a stale revision
+
+	person := testPersonJson{Given: "Janusz", Surname: "Kowalski", Gender: gMale}
+
+	res = testMakeRequestWithHeaders(
+		router, "PUT", "/people/P1", testJsonBody(t, person), map[string]string{"If-Match": `"7"`})
+
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code)
+	assert.Equal(t, preconditionErrorMsg, testErrorRes(t, res).Message)
+	assert.Equal(t, `"1"`, res.Header().Get("ETag"))
+	assert.Equal(t, "Jan", store.people["P1"].Given)
+
+	// Case 3: Replace the current revision
+
+	res = testMakeRequestWithHeaders(
+		router, "PUT", "/people/P1", testJsonBody(t, person),
+		map[string]string{"If-Match": `W/"1", "1"`})
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `"2"`, res.Header().Get("ETag"))
+	assert.Equal(t, personRecord{"P1", "Janusz", "Kowalski", gMale, 2}, store.people["P1"])
+
+	// Case 4: Delete a stale revision
+
+	res = testMakeRequestWithHeaders(
+		router, "DELETE", "/people/P1", nil, map[string]string{"If-Match": `"1"`})
+
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code)
+	assert.Equal(t, `"2"`, res.Header().Get("ETag"))
+	assert.Len(t, store.people, 1)
+
+	// Case 5: Delete any revision
+
+	res = testMakeRequestWithHeaders(
+		router, "DELETE", "/people/P1", nil, map[string]string{"If-Match": "*"})
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, store.people)
+}
@@ -0,0 +1,336 @@
+package main
+
+/* This file defines the RDF export of the family tree (Turtle, RDF/XML and JSON-LD)
+
+   Every person becomes an individual of the gt:Person class (and of gt:Male or gt:Female if the
+   gender is known) and every relation a single triple using one of the object properties of the
+   gentree ontology (see ontology.go):
+   * father - <child> gt:hasFather <father>
+   * mother - <child> gt:hasMother <mother>
+   * husband - <wife> gt:hasHusband <husband>
+
+   The inverse properties (gt:hasChild, gt:hasWife, etc.) are left to the reasoner. The individual
+   IRIs are the absolute person resource URLs (<base URL>people/<pid>), so the documents can be
+   loaded from anywhere. The base URL is taken from the export request location (or from the
+   command line in the case of the export subcommand). */
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"strings"
+)
+
+// Namespaces of the standard vocabularies used by the exported documents
+const (
+	rdfNamespace  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	rdfsNamespace = "http://www.w3.org/2000/01/rdf-schema#"
+	owlNamespace  = "http://www.w3.org/2002/07/owl#"
+)
+
+// Ontology object properties of the relation types
+var rdfRelationProperties = map[string]string{
+	relFather:  "hasFather",
+	relMother:  "hasMother",
+	relHusband: "hasHusband",
+}
+
+/* Property value of an individual (the property is a term of the gentree ontology) */
+type rdfProperty struct {
+	// Local name of the property (e.g. "surname")
+	Name string
+	// The literal value (data properties) or the IRI (object properties)
+	Value string
+}
+
+/* Individual of the exported document (a person) */
+type rdfIndividual struct {
+	Iri string
+	// Local names of the ontology classes
+	Classes []string
+	Label   string
+	Data    []rdfProperty
+	Links   []rdfProperty
+}
+
+/* Make the IRI of a person individual (the person resource URL) */
+func rdfPersonIri(baseUrl string, pid string) string {
+	return baseUrl + "people/" + pid
+}
+
+/* Convert the snapshot document into the individuals (in the snapshot order)
+
+   Params:
+   * snapshot - the snapshot document
+   * baseUrl - the server base URL (ending with the '/' character) */
+func rdfIndividuals(snapshot snapshotPayload, baseUrl string) []rdfIndividual {
+	individuals := make([]rdfIndividual, 0, len(snapshot.People))
+	index := map[string]int{}
+
+	for _, p := range snapshot.People {
+		individual := rdfIndividual{
+			Iri:     rdfPersonIri(baseUrl, p.Id),
+			Classes: []string{"Person"},
+			Label:   strings.TrimSpace(p.Given + " " + p.Surname),
+			Data:    []rdfProperty{{"personId", p.Id}},
+		}
+
+		switch p.Gender {
+		case gMale:
+			individual.Classes = append(individual.Classes, "Male")
+		case gFemale:
+			individual.Classes = append(individual.Classes, "Female")
+		}
+
+		if p.Given != "" {
+			individual.Data = append(individual.Data, rdfProperty{"givenNames", p.Given})
+		}
+
+		if p.Surname != "" {
+			individual.Data = append(individual.Data, rdfProperty{"surname", p.Surname})
+		}
+
+		index[p.Id] = len(individuals)
+		individuals = append(individuals, individual)
+	}
+
+	for _, r := range snapshot.Relations {
+		property, known := rdfRelationProperties[r.Type]
+		idx, found := index[r.Pid2]
+
+		if !known || !found {
+			log.Warnf("Relation (%d) can't be exported to RDF", r.Id)
+			continue
+		}
+
+		individuals[idx].Links = append(
+			individuals[idx].Links, rdfProperty{property, rdfPersonIri(baseUrl, r.Pid1)})
+	}
+
+	return individuals
+}
+
+/* Escape a string to be written as a Turtle string literal */
+func escapeTurtle(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(value)
+}
+
+/* Write the individuals as a Turtle document importing the ontology of the given IRI */
+func writeTurtle(out io.Writer, ontology string, individuals []rdfIndividual) error {
+	var doc strings.Builder
+
+	fmt.Fprintf(&doc, "@prefix gt: <%s> .\n", ontologyNamespace)
+	fmt.Fprintf(&doc, "@prefix owl: <%s> .\n", owlNamespace)
+	fmt.Fprintf(&doc, "@prefix rdfs: <%s> .\n\n", rdfsNamespace)
+	fmt.Fprintf(&doc, "<> a owl:Ontology ;\n    owl:imports <%s> .\n", ontology)
+
+	for _, individual := range individuals {
+		classes := make([]string, 0, len(individual.Classes))
+
+		for _, class := range individual.Classes {
+			classes = append(classes, "gt:"+class)
+		}
+
+		fmt.Fprintf(&doc, "\n<%s> a %s", individual.Iri, strings.Join(classes, ", "))
+
+		if individual.Label != "" {
+			fmt.Fprintf(&doc, " ;\n    rdfs:label \"%s\"", escapeTurtle(individual.Label))
+		}
+
+		for _, p := range individual.Data {
+			fmt.Fprintf(&doc, " ;\n    gt:%s \"%s\"", p.Name, escapeTurtle(p.Value))
+		}
+
+		for _, p := range individual.Links {
+			fmt.Fprintf(&doc, " ;\n    gt:%s <%s>", p.Name, p.Value)
+		}
+
+		doc.WriteString(" .\n")
+	}
+
+	_, err := io.WriteString(out, doc.String())
+
+	return err
+}
+
+/* Escape a string to be written as XML character data or an attribute value */
+func escapeXml(value string) string {
+	var escaped strings.Builder
+
+	// Writing to a strings.Builder never fails:
+	_ = xml.EscapeText(&escaped, []byte(value))
+
+	return escaped.String()
+}
+
+/* Write the individuals as an RDF/XML document importing the ontology of the given IRI */
+func writeRdfXml(out io.Writer, ontology string, individuals []rdfIndividual) error {
+	var doc strings.Builder
+
+	doc.WriteString(xml.Header)
+	fmt.Fprintf(&doc,
+		"<rdf:RDF xmlns:rdf=\"%s\" xmlns:rdfs=\"%s\" xmlns:owl=\"%s\" xmlns:gt=\"%s\">\n",
+		rdfNamespace, rdfsNamespace, owlNamespace, ontologyNamespace)
+	fmt.Fprintf(&doc, "  <owl:Ontology rdf:about=\"\">\n    <owl:imports rdf:resource=\"%s\"/>\n"+
+		"  </owl:Ontology>\n", escapeXml(ontology))
+
+	for _, individual := range individuals {
+		fmt.Fprintf(&doc, "  <gt:%s rdf:about=\"%s\">\n",
+			individual.Classes[0], escapeXml(individual.Iri))
+
+		for _, class := range individual.Classes[1:] {
+			fmt.Fprintf(&doc, "    <rdf:type rdf:resource=\"%s%s\"/>\n", ontologyNamespace, class)
+		}
+
+		if individual.Label != "" {
+			fmt.Fprintf(&doc, "    <rdfs:label>%s</rdfs:label>\n", escapeXml(individual.Label))
+		}
+
+		for _, p := range individual.Data {
+			fmt.Fprintf(&doc, "    <gt:%s>%s</gt:%s>\n", p.Name, escapeXml(p.Value), p.Name)
+		}
+
+		for _, p := range individual.Links {
+			fmt.Fprintf(&doc, "    <gt:%s rdf:resource=\"%s\"/>\n", p.Name, escapeXml(p.Value))
+		}
+
+		fmt.Fprintf(&doc, "  </gt:%s>\n", individual.Classes[0])
+	}
+
+	doc.WriteString("</rdf:RDF>\n")
+
+	_, err := io.WriteString(out, doc.String())
+
+	return err
+}
+
+/* Write the individuals as a JSON-LD document importing the ontology of the given IRI
+
+   The context maps the property names to the ontology terms, so that the nodes use the plain
+   property names (e.g. "hasFather"). The object properties always have array values. */
+func writeJsonld(out io.Writer, ontology string, individuals []rdfIndividual) error {
+	context := map[string]interface{}{
+		"gt":          ontologyNamespace,
+		"owl":         owlNamespace,
+		"rdfs":        rdfsNamespace,
+		"label":       "rdfs:label",
+		"owl:imports": map[string]string{"@type": "@id"},
+	}
+
+	for _, name := range []string{"personId", "givenNames", "surname"} {
+		context[name] = "gt:" + name
+	}
+
+	for _, name := range rdfRelationProperties {
+		context[name] = map[string]string{"@id": "gt:" + name, "@type": "@id"}
+	}
+
+	graph := []map[string]interface{}{
+		{"@id": "", "@type": "owl:Ontology", "owl:imports": ontology},
+	}
+
+	for _, individual := range individuals {
+		classes := make([]string, 0, len(individual.Classes))
+
+		for _, class := range individual.Classes {
+			classes = append(classes, "gt:"+class)
+		}
+
+		node := map[string]interface{}{"@id": individual.Iri, "@type": classes}
+
+		if individual.Label != "" {
+			node["label"] = individual.Label
+		}
+
+		for _, p := range individual.Data {
+			node[p.Name] = p.Value
+		}
+
+		for _, p := range individual.Links {
+			links, _ := node[p.Name].([]string)
+			node[p.Name] = append(links, p.Value)
+		}
+
+		graph = append(graph, node)
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(map[string]interface{}{"@context": context, "@graph": graph})
+}
+
+/* Write the RDF document of the whole store
+
+   Params:
+   * store - the store to be exported
+   * out - the document destination
+   * baseUrl - the server base URL (ending with the '/' character)
+   * write - function writing the document of the given syntax
+
+   Return:
+   * error (if occurred and nil otherwise) */
+func saveRdf(store Store, out io.Writer, baseUrl string, write func(out io.Writer, ontology string, individuals []rdfIndividual) error) error {
+	var snapshot snapshotPayload
+
+	err := store.view(func(tx Store) error {
+		var err error
+
+		snapshot, err = exportSnapshot(tx)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := write(out, ontologyIri(baseUrl), rdfIndividuals(snapshot, baseUrl)); err != nil {
+		return err
+	}
+
+	log.Infof("Exported %d people and %d relations to RDF",
+		len(snapshot.People), len(snapshot.Relations))
+
+	return nil
+}
+
+/* Write the Turtle document of the whole store (see saveRdf) */
+func saveTurtle(store Store, out io.Writer, baseUrl string) error {
+	return saveRdf(store, out, baseUrl, writeTurtle)
+}
+
+/* Write the RDF/XML document of the whole store (see saveRdf) */
+func saveRdfXml(store Store, out io.Writer, baseUrl string) error {
+	return saveRdf(store, out, baseUrl, writeRdfXml)
+}
+
+/* Write the JSON-LD document of the whole store (see saveRdf) */
+func saveJsonld(store Store, out io.Writer, baseUrl string) error {
+	return saveRdf(store, out, baseUrl, writeJsonld)
+}
+
+/* Handle a Turtle export request */
+func exportTurtle(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doExport(c, formatTurtle)
+}
+
+/* Handle an RDF/XML export request */
+func exportRdfXml(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doExport(c, formatRdfXml)
+}
+
+/* Handle a JSON-LD export request */
+func exportJsonld(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doExport(c, formatJsonld)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type testRdfXmlResourceJson struct {
+	Resource string `xml:"resource,attr"`
+}
+
+type testRdfXmlPersonJson struct {
+	XMLName   xml.Name
+	About     string                   `xml:"about,attr"`
+	Types     []testRdfXmlResourceJson `xml:"type"`
+	Label     string                   `xml:"label"`
+	PersonId  string                   `xml:"personId"`
+	HasFather []testRdfXmlResourceJson `xml:"hasFather"`
+}
+
+type testRdfXmlJson struct {
+	People []testRdfXmlPersonJson `xml:"https://github.com/dariusz-walczak/owl_gentree/ontology# Person"`
+}
+
+func testRdfStore() *memoryStore {
+	return newMemoryStore(
+		map[string]personRecord{
+			"P1": {"P1", "Jan", "Kowalski", gMale, 1},
+			"P2": {"P2", "Anna \"Ania\"", "Nowak", gFemale, 1},
+			"P3": {"P3", "", "", gUnknown, 1},
+		},
+		map[int64]relationRecord{
+			10: {10, "P1", "P2", relHusband, 1},
+			11: {11, "P1", "P3", relFather, 1},
+			12: {12, "P2", "P3", relMother, 1},
+		})
+}
+
+/* Test the Turtle export
+
+   1. Export the people and relations
+   2. Retrieve the ontology */
+func TestRdfExportTurtle(t *testing.T) {
+	router := setupRouter(testRdfStore())
+
+	// Case 1: Export
+
+	res := testMakeRequest(router, "GET", "/export.ttl", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "text/turtle; charset=utf-8", res.Header().Get("Content-Type"))
+
+	doc := res.Body.String()
+
+	assert.True(t, strings.HasPrefix(doc, "@prefix gt: <"+ontologyNamespace+"> .\n"))
+	assert.Contains(t, doc,
+		"<> a owl:Ontology ;\n    owl:imports <http://example.com/ontology.ttl> .\n")
+	assert.Contains(t, doc, "\n<http://example.com/people/P1> a gt:Person, gt:Male ;\n"+
+		"    rdfs:label \"Jan Kowalski\" ;\n"+
+		"    gt:personId \"P1\" ;\n"+
+		"    gt:givenNames \"Jan\" ;\n"+
+		"    gt:surname \"Kowalski\" .\n")
+	assert.Contains(t, doc, "\n<http://example.com/people/P2> a gt:Person, gt:Female ;\n"+
+		"    rdfs:label \"Anna \\\"Ania\\\" Nowak\" ;\n"+
+		"    gt:personId \"P2\" ;\n"+
+		"    gt:givenNames \"Anna \\\"Ania\\\"\" ;\n"+
+		"    gt:surname \"Nowak\" ;\n"+
+		"    gt:hasHusband <http://example.com/people/P1> .\n")
+	assert.Contains(t, doc, "\n<http://example.com/people/P3> a gt:Person ;\n"+
+		"    gt:personId \"P3\" ;\n"+
+		"    gt:hasFather <http://example.com/people/P1> ;\n"+
+		"    gt:hasMother <http://example.com/people/P2> .\n")
+
+	// Case 2: Ontology
+
+	res = testMakeRequest(router, "GET", "/ontology.ttl", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "text/turtle; charset=utf-8", res.Header().Get("Content-Type"))
+
+	ontology := res.Body.String()
+
+	assert.Contains(t, ontology, "\n<http://example.com/ontology.ttl> a owl:Ontology ;\n")
+
+	for _, property := range rdfRelationProperties {
+		assert.Contains(t, ontology, "\ngt:"+property+" a owl:ObjectProperty")
+	}
+
+	assert.Contains(t, ontology, "owl:inverseOf gt:hasParent .")
+	assert.Contains(t, ontology, "owl:inverseOf gt:hasHusband .")
+}
+
+/* Test the RDF/XML and JSON-LD exports
+
+   1. RDF/XML
+   2. JSON-LD */
+func TestRdfExportXmlJsonld(t *testing.T) {
+	router := setupRouter(testRdfStore())
+
+	// Case 1: RDF/XML
+
+	res := testMakeRequest(router, "GET", "/export.rdf", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/rdf+xml; charset=utf-8", res.Header().Get("Content-Type"))
+
+	var doc testRdfXmlJson
+
+	require.Nil(t, xml.Unmarshal(res.Body.Bytes(), &doc))
+	require.Len(t, doc.People, 3)
+	assert.Equal(t, "http://example.com/people/P1", doc.People[0].About)
+	assert.Equal(t, []testRdfXmlResourceJson{{ontologyNamespace + "Male"}}, doc.People[0].Types)
+	assert.Equal(t, "Jan Kowalski", doc.People[0].Label)
+	assert.Equal(t, "Anna \"Ania\" Nowak", doc.People[1].Label)
+	assert.Equal(t, "P3", doc.People[2].PersonId)
+	assert.Empty(t, doc.People[2].Types)
+	assert.Equal(t,
+		[]testRdfXmlResourceJson{{"http://example.com/people/P1"}}, doc.People[2].HasFather)
+
+	// Case 2: JSON-LD
+
+	res = testMakeRequest(router, "GET", "/export.jsonld", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/ld+json; charset=utf-8", res.Header().Get("Content-Type"))
+
+	var ld struct {
+		Context map[string]interface{}   `json:"@context"`
+		Graph   []map[string]interface{} `json:"@graph"`
+	}
+
+	require.Nil(t, json.Unmarshal(res.Body.Bytes(), &ld))
+	assert.Equal(t, ontologyNamespace, ld.Context["gt"])
+	assert.Equal(t, map[string]interface{}{"@id": "gt:hasFather", "@type": "@id"},
+		ld.Context["hasFather"])
+	require.Len(t, ld.Graph, 4)
+	assert.Equal(t, "owl:Ontology", ld.Graph[0]["@type"])
+	assert.Equal(t, map[string]interface{}{
+		"@id":        "http://example.com/people/P2",
+		"@type":      []interface{}{"gt:Person", "gt:Female"},
+		"label":      "Anna \"Ania\" Nowak",
+		"personId":   "P2",
+		"givenNames": "Anna \"Ania\"",
+		"surname":    "Nowak",
+		"hasHusband": []interface{}{"http://example.com/people/P1"},
+	}, ld.Graph[2])
+}
@@ -6,13 +6,17 @@ import (
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"strconv"
 )
 
 type relationPayload struct {
-	Id   int64  `json:"id" binding:"required"`
-	Pid1 string `json:"pid1" binding:"required,alphanum|uuid"`
-	Pid2 string `json:"pid2" binding:"required,alphanum|uuid"`
-	Type string `json:"type" binding:"oneof=father mother husband"`
+	Id int64 `json:"id" binding:"required"`
+	// The id as a decimal string (the ids greater than maxJsonSafeInt lose precision when read as
+	// JSON numbers by some clients; ignored by the import)
+	IdStr string `json:"id_str"`
+	Pid1  string `json:"pid1" binding:"required,alphanum|uuid"`
+	Pid2  string `json:"pid2" binding:"required,alphanum|uuid"`
+	Type  string `json:"type" binding:"oneof=father mother husband"`
 }
 
 /* Convert a relation record to payload data
@@ -23,7 +27,7 @@ type relationPayload struct {
    Returns:
    * relation payload */
 func (r *relationRecord) toPayload() relationPayload {
-	return relationPayload{r.Id, r.Pid1, r.Pid2, r.Type}
+	return relationPayload{r.Id, strconv.FormatInt(r.Id, 10), r.Pid1, r.Pid2, r.Type}
 }
 
 /* Convert a list of relation records to payload data
@@ -59,7 +63,7 @@ type itRelationPayload struct {
    Params:
    * sourcePid - id of the relation source person (not included in the payload) */
 func (p *itRelationPayload) toRecord(sourcePid string) relationRecord {
-	return relationRecord{0, sourcePid, p.Pid, p.Type}
+	return relationRecord{0, sourcePid, p.Pid, p.Type, 0}
 }
 
 /* Relation payload accepted by the createRelation handler
@@ -75,7 +79,7 @@ type iitRelationPayload struct {
 
    This function is used by request handlers when communicating with the storage backend. */
 func (p *iitRelationPayload) toRecord(rid int64) relationRecord {
-	return relationRecord{rid, p.Pid1, p.Pid2, p.Type}
+	return relationRecord{rid, p.Pid1, p.Pid2, p.Type, 0}
 }
 
 /* The structure used to extract relation id from a URI */
@@ -120,7 +124,31 @@ func makeRetrieveRelationUrl(c *gin.Context, rid int64) string {
 func doCreateRelation(c *gin.Context, relation relationRecord) {
 	log.Trace("Entry checkpoint")
 
-	if existing, found, err := queryRelationByData(relation.Pid1, relation.Type, relation.Pid2); found {
+	var existing relationRecord
+	var found, valid bool
+
+	// The duplicate check, the validation and the insertion must be atomic. Otherwise, two
+	// concurrent requests could e.g. create two fathers of the same person:
+	err := getStore(c).update(func(tx Store) error {
+		var err error
+
+		existing, found, err = queryRelationByData(tx, relation.Pid1, relation.Type, relation.Pid2)
+		if found || err != nil {
+			return err
+		}
+
+		if valid, err = validateRelation(tx, relation); !valid || err != nil {
+			return err
+		}
+
+		if relation.Id, err = getRelationIdGenerator(c).nextRelationId(tx); err != nil {
+			return err
+		}
+
+		return tx.insertRelation(relation)
+	})
+
+	if found {
 		log.Infof(
 			"A relation (%d) matching given attributes (%s, %s, %s) already exists",
 			existing.Id, existing.Pid1, existing.Type, existing.Pid2)
@@ -134,15 +162,11 @@ func doCreateRelation(c *gin.Context, relation relationRecord) {
 
 		return
 	} else if err != nil {
-		log.Infof("An error occurred during the relation retrieval attempt (%s)", err)
+		log.Errorf("An error occurred during the relation creation attempt (%s)", err)
 
 		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
 		return
-	}
-
-	valid, err := validateRelation(relation)
-
-	if !valid {
+	} else if !valid {
 		log.Infof(
 			"The relation (%s, %s, %s) is not valid",
 			relation.Pid1, relation.Type, relation.Pid2)
@@ -151,27 +175,10 @@ func doCreateRelation(c *gin.Context, relation relationRecord) {
 			gin.H{"message": fmt.Sprintf("Relation (%s, %s, %s) is invalid",
 				relation.Pid1, relation.Type, relation.Pid2)})
 		return
-	} else if err != nil {
-		log.Errorf("An error occurred during the relation validation (%s)", err)
-
-		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
-		return
 	}
 
-	id, err := getNextRelationId()
-
-	if err != nil {
-		log.Infof("An error occurred during the relation id generation (%s)", err)
-
-		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
-		return
-	}
-
-	relation.Id = id
-	relations[id] = relation
-
-	c.Header("Location", makeRetrieveRelationUrl(c, id))
-	c.JSON(http.StatusCreated, gin.H{"message": "Relation created", "relation_id": id})
+	c.Header("Location", makeRetrieveRelationUrl(c, relation.Id))
+	c.JSON(http.StatusCreated, gin.H{"message": "Relation created", "relation_id": relation.Id})
 
 	log.Infof("Created a new relation (%d) record", relation.Id)
 }
@@ -236,24 +243,47 @@ func deleteRelation(c *gin.Context) {
 		return
 	}
 
-	relation, found, err := queryRelationById(params.Rid)
+	var relation relationRecord
+	var found bool
+	var item trashRecord
+
+	// The revision check and the removal must be atomic:
+	err := getStore(c).update(func(tx Store) error {
+		var err error
+
+		if relation, found, err = tx.queryRelationById(params.Rid); !found || err != nil {
+			return err
+		}
+
+		if err = checkIfMatch(c, relation.Rev); err != nil {
+			return err
+		}
+
+		item, err = trashRelation(tx, relation)
+
+		return err
+	})
 
 	if !found {
 		log.Infof("The relation with given id (%d) doesn't exist", params.Rid)
 		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown relation id"})
 		return
+	} else if isAppError(err, errRevisionMismatch) {
+		log.Infof("The relation (%d) can't be deleted (%s)", params.Rid, err)
+		c.Header("ETag", makeETag(relation.Rev))
+		c.JSON(http.StatusPreconditionFailed, gin.H{"message": preconditionErrorMsg})
+		return
 	} else if err != nil {
-		log.Errorf("An error occurred during the relation retrieval attempt (%s)", err)
+		log.Errorf("An error occurred during the relation removal attempt (%s)", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
 		return
 	}
 
-	delete(relations, params.Rid)
-	c.JSON(http.StatusOK, gin.H{"message": "Relation deleted"})
+	c.JSON(http.StatusOK, gin.H{"message": "Relation deleted", "trash_id": item.Id})
 
 	log.Infof(
-		"Deleted the requested relation (%d) record:  %s, %s, %s",
-		relation.Id, relation.Pid1, relation.Type, relation.Pid2)
+		"Moved the requested relation (%d) record to the trash (%d):  %s, %s, %s",
+		relation.Id, item.Id, relation.Pid1, relation.Type, relation.Pid2)
 }
 
 /* Replace a relation
@@ -272,7 +302,7 @@ func replaceRelation(c *gin.Context) {
 		return
 	}
 
-	_, found, err := queryRelationById(params.Rid)
+	_, found, err := getStore(c).queryRelationById(params.Rid)
 
 	if !found {
 		log.Infof("The relation with given id (%d) doesn't exist", params.Rid)
@@ -292,11 +322,74 @@ func replaceRelation(c *gin.Context) {
 		return
 	}
 
-	relations[params.Rid] = relation.toRecord(params.Rid)
+	doReplaceRelation(c, params.Rid, relation, false)
+}
+
+/* Lower level, shared implementation of the replace relation handlers
+
+   The upper-level handlers (replaceRelation and restoreRelationRevision) are adapters taking the
+   new relation data from different sources and passing them to this function
+
+   Params:
+   * c - gin context
+   * rid - the relation identifier
+   * relation - the new relation data (already validated)
+   * check - check the new relation data against the current data the same way as the data of a
+     new relation (see checkRelationReplacement), so that e.g. a restored revision can't refer to
+     a person deleted in the meantime or add another father of the same person */
+func doReplaceRelation(c *gin.Context, rid int64, relation iitRelationPayload, check bool) {
+	log.Trace("Entry checkpoint")
+
+	var current relationRecord
+
+	// The revision check and the update must be atomic:
+	err := getStore(c).update(func(tx Store) error {
+		var found bool
+		var err error
+
+		// The relation might have been deleted in the meantime:
+		if current, found, err = tx.queryRelationById(rid); err != nil {
+			return err
+		} else if !found {
+			return AppError{errRecordNotFound, fmt.Sprintf("Relation record (%d) not found", rid)}
+		}
+
+		if err := checkIfMatch(c, current.Rev); err != nil {
+			return err
+		}
 
+		if check {
+			if err := checkRelationReplacement(tx, relation.toRecord(rid)); err != nil {
+				return err
+			}
+		}
+
+		return tx.updateRelation(relation.toRecord(rid))
+	})
+
+	if isAppError(err, errRecordNotFound) {
+		log.Infof("The relation with given id (%d) doesn't exist", rid)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown relation id"})
+		return
+	} else if isAppError(err, errRevisionMismatch) {
+		log.Infof("The relation (%d) can't be replaced (%s)", rid, err)
+		c.Header("ETag", makeETag(current.Rev))
+		c.JSON(http.StatusPreconditionFailed, gin.H{"message": preconditionErrorMsg})
+		return
+	} else if isAppError(err, errConflict) {
+		log.Infof("The relation (%d) can't be replaced (%s)", rid, err)
+		c.JSON(http.StatusConflict, gin.H{"message": err.(AppError).msg})
+		return
+	} else if err != nil {
+		log.Errorf("An error occurred during the relation update attempt (%s)", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	}
+
+	c.Header("ETag", makeETag(current.Rev+1))
 	c.JSON(http.StatusOK, gin.H{"message": "Relation record replaced"})
 
-	log.Infof("Replaced the relation (%d) record", params.Rid)
+	log.Infof("Replaced the relation (%d) record", rid)
 }
 
 /* Retrieve a relation
@@ -313,7 +406,7 @@ func retrieveRelation(c *gin.Context) {
 		return
 	}
 
-	relation, found, err := queryRelationById(params.Rid)
+	relation, found, err := getStore(c).queryRelationById(params.Rid)
 
 	if !found {
 		log.Infof("The relation with given id (%d) doesn't exist", params.Rid)
@@ -325,6 +418,9 @@ func retrieveRelation(c *gin.Context) {
 		return
 	}
 
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Access-Control-Expose-Headers", "ETag")
+	c.Header("ETag", makeETag(relation.Rev))
 	c.JSON(http.StatusOK, relation.toPayload())
 
 	log.Infof("Found the requested relation record (%d)", params.Rid)
@@ -342,7 +438,7 @@ func retrieveRelations(c *gin.Context) {
 		return
 	}
 
-	relations, pagData, err := queryRelationsByPerson("", pagQuery.toPaginationData())
+	relations, pagData, err := getStore(c).queryRelationsByPerson("", pagQuery.toPaginationData())
 
 	if err != nil {
 		log.Errorf("An error occurred during relations retrieval attempt (%s)", err)
@@ -384,7 +480,9 @@ func retrievePersonRelations(c *gin.Context) {
 		return
 	}
 
-	if _, found, err := getPerson(params.Pid); !found {
+	store := getStore(c)
+
+	if _, found, err := store.getPerson(params.Pid); !found {
 		log.Infof("The person with given id (%s) doesn't exist", params.Pid)
 		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown person id"})
 		return
@@ -394,7 +492,7 @@ func retrievePersonRelations(c *gin.Context) {
 		return
 	}
 
-	relations, pagData, err := queryRelationsByPerson(params.Pid, pagQuery.toPaginationData())
+	relations, pagData, err := store.queryRelationsByPerson(params.Pid, pagQuery.toPaginationData())
 
 	if err != nil {
 		log.Errorf("An error occurred during relations retrieval attempt (%s)", err)
@@ -4,12 +4,8 @@ package main
    backend */
 
 import (
-	rand "crypto/rand"
 	"fmt"
 	log "github.com/sirupsen/logrus"
-	"math"
-	"math/big"
-	"sort"
 )
 
 const (
@@ -18,16 +14,51 @@ const (
 	relHusband = "husband"
 )
 
+/* Storage representation of a relation
+
+   The JSON encoding of the record is used by the journal files (see journal_store.go) */
 type relationRecord struct {
-	Id   int64
-	Pid1 string
-	Pid2 string
-	Type string
+	Id   int64  `json:"id"`
+	Pid1 string `json:"pid1"`
+	Pid2 string `json:"pid2"`
+	Type string `json:"type"`
+	// Revision number assigned by the store (1 on insertion, incremented on every update)
+	Rev int64 `json:"rev"`
 }
 
 type relationList []relationRecord
 
-var relations = map[int64]relationRecord{}
+/* Store the relation record in the relations map and the indexes
+
+   The function replaces the existing record with the same id (if any). It doesn't record the
+   modification in the undo log or in the history. */
+func (s *memoryStore) putRelation(relation relationRecord) {
+	if old, found := s.relations[relation.Id]; found {
+		s.relationIdx.remove(old)
+	}
+
+	s.relations[relation.Id] = relation
+	s.relationIdx.add(relation)
+}
+
+/* Remove the relation record from the relations map and the indexes (see putRelation) */
+func (s *memoryStore) dropRelation(id int64) {
+	if old, found := s.relations[id]; found {
+		s.relationIdx.remove(old)
+		delete(s.relations, id)
+	}
+}
+
+/* Retrieve the relation records with the given identifiers (in the order of the identifiers) */
+func (s *memoryStore) relationsById(ids []int64) relationList {
+	result := make(relationList, 0, len(ids))
+
+	for _, id := range ids {
+		result = append(result, s.relations[id])
+	}
+
+	return result
+}
 
 /* Delete all the relation records associated with the given person
 
@@ -37,50 +68,23 @@ var relations = map[int64]relationRecord{}
    Return:
    * number of deleted records
    * error (if occurred and nil otherwise) */
-func deleteRelationsByPerson(pid string) (int64, error) {
+func (s *memoryStore) deleteRelationsByPerson(pid string) (int64, error) {
 	log.Debugf("Deleting all the relations of the given person (%s)", pid)
 
 	var num int64 = 0
 
-	for k, r := range relations {
-		if (r.Pid1 == pid) || (r.Pid2 == pid) {
-			delete(relations, k)
-			num++
-		}
-	}
-
-	return num, nil
-}
-
-/* Generate a new, unique relation id
-
-   The function generates a random, unique identifier using a cryptographic function. It always
-   uses the entire identifier pool, so the chance for a conflict increases with the increasing
-   number of existing records. If multiple attempts of unique identifier generation fail, the
-   function will fail, too.
-
-   Returns:
-   * new relation record identifier (unique in the scope of the relations table)
-   * error (if occurred or when the generation failed and nil otherwise) */
-func getNextRelationId() (int64, error) {
-	const maxAttempts = 5
+	for _, r := range s.relationsById(s.relationIdx.personRelationIds(pid)) {
+		s.dropRelation(r.Id)
+		num++
 
-	for i := 0; i < maxAttempts; i++ {
-		num, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
-		if err != nil {
-			return 0, err
-		}
+		old := r
+		s.onUndo(func() { s.putRelation(old) })
 
-		if _, found := relations[num.Int64()]; !found {
-			return num.Int64(), nil
-		}
+		r.Rev++
+		s.recordRelationRevision(revDelete, r)
 	}
 
-	msg := fmt.Sprintf("Failed to generate relation id %d attempts", maxAttempts)
-
-	log.Warn(msg)
-
-	return 0, AppError{errIdGenerationFailed, msg}
+	return num, nil
 }
 
 /* Query a relation record by relation id
@@ -89,10 +93,10 @@ func getNextRelationId() (int64, error) {
    * relation record (uninitialized if not found or when an error occurred)
    * success flag (true if the relation was found and false otherwise)
    * error (if occurred and nil otherwise) */
-func queryRelationById(id int64) (relationRecord, bool, error) {
+func (s *memoryStore) queryRelationById(id int64) (relationRecord, bool, error) {
 	log.Debugf("Retrieving relation record by id (%d)", id)
 
-	relation, found := relations[id]
+	relation, found := s.relations[id]
 
 	if !found {
 		log.Debugf("Relation record (%d) not found", id)
@@ -118,44 +122,54 @@ func queryRelationById(id int64) (relationRecord, bool, error) {
    * updated pagination data (empty if an error occurred; copy of the pag parameter with the total
      record count field updated otherwise)
    * error (if occurred and nil otherwise) */
-func queryRelationsByPerson(pid string, pag paginationData) (relationList, paginationData, error) {
+func (s *memoryStore) queryRelationsByPerson(pid string, pag paginationData) (relationList, paginationData, error) {
 	log.Debugf("Retrieving all the relations of the given person (%s)", pid)
 
 	if err := pag.validate(); err != nil {
 		return []relationRecord{}, paginationData{}, err
 	}
 
-	// Extract slice of all the values (relation records) of the relations map
-	sorted := make(relationList, 0, len(relations))
+	if pid == "" {
+		// The ordered index allows retrieving the page without visiting the preceding records:
+		pag.TotalCnt = s.relationIdx.ids.len()
 
-	for _, r := range relations {
-		if (r.Pid1 == pid) || (r.Pid2 == pid) || (pid == "") {
-			sorted = append(sorted, r)
-		}
+		return s.relationsById(
+			s.relationIdx.ids.slice(pag.PageIdx*pag.PageSize, pag.PageSize)), pag, nil
 	}
 
-	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Id < sorted[j].Id })
+	ids := s.relationIdx.personRelationIds(pid)
 
-	first := minInt(pag.PageIdx*pag.PageSize, len(sorted))
-	last := minInt((pag.PageIdx+1)*pag.PageSize, len(sorted))
+	first := minInt(pag.PageIdx*pag.PageSize, len(ids))
+	last := minInt((pag.PageIdx+1)*pag.PageSize, len(ids))
 
-	pag.TotalCnt = len(sorted)
+	pag.TotalCnt = len(ids)
 
-	return sorted[first:last], pag, nil
+	return s.relationsById(ids[first:last]), pag, nil
 }
 
-func queryRelationsByData(pid1 string, typ string, pid2 string) ([]relationRecord, error) {
+func (s *memoryStore) queryRelationsByData(pid1 string, typ string, pid2 string) ([]relationRecord, error) {
 	log.Debugf("Looking for matching relations (%s, %s, %s)", pid1, typ, pid2)
 
 	var result []relationRecord
 
-	for _, r := range relations {
+	match := func(r relationRecord) {
 		if (pid1 == "" || pid1 == r.Pid1) && (typ == "" || typ == r.Type) &&
 			(pid2 == "" || pid2 == r.Pid2) {
 			result = append(result, r)
 		}
 	}
 
+	// Only the type filter (or no filter at all) requires the full scan:
+	if ids, indexed := s.relationIdx.candidates(pid1, typ, pid2); indexed {
+		for id := range ids {
+			match(s.relations[id])
+		}
+	} else {
+		for _, r := range s.relations {
+			match(r)
+		}
+	}
+
 	log.Debugf("Found %d matching relations", len(result))
 
 	return result, nil
@@ -167,8 +181,8 @@ func queryRelationsByData(pid1 string, typ string, pid2 string) ([]relationRecor
    * relation record structure (uninitialized if not found or when an error occurred)
    * success flag (true if one and only one record was found, and false otherwise)
    * error (if occurred and nil otherwise) */
-func queryRelationByData(pid1 string, typ string, pid2 string) (relationRecord, bool, error) {
-	relations, err := queryRelationsByData(pid1, typ, pid2)
+func queryRelationByData(store Store, pid1 string, typ string, pid2 string) (relationRecord, bool, error) {
+	relations, err := store.queryRelationsByData(pid1, typ, pid2)
 
 	if err != nil {
 		return relationRecord{}, false, err
@@ -209,8 +223,22 @@ func queryRelationByData(pid1 string, typ string, pid2 string) (relationRecord,
       a simple model
    ** The need to add less common relations (same-sex partnerships, child adoption, etc.) is
       recognized but planned as an extension when the basic functionality works. */
-func validateRelation(r relationRecord) (bool, error) {
-	p1, found, err := getPerson(r.Pid1)
+func validateRelation(store Store, r relationRecord) (bool, error) {
+	return validateRelationExcluding(store, r, 0)
+}
+
+/* Check if the relation record is valid (see validateRelation) ignoring one of the existing
+   relation records
+
+   The function validates the replacement of an existing relation: the relation being replaced
+   mustn't make its replacement invalid (e.g. as another father of the same person).
+
+   Params:
+   * store - the store
+   * r - the relation record to be validated
+   * excluded - identifier of the ignored relation record (0 if none is ignored) */
+func validateRelationExcluding(store Store, r relationRecord, excluded int64) (bool, error) {
+	p1, found, err := store.getPerson(r.Pid1)
 
 	if !found {
 		log.Infof(
@@ -238,7 +266,7 @@ func validateRelation(r relationRecord) (bool, error) {
 		return false, nil
 	}
 
-	p2, found, err := getPerson(r.Pid2)
+	p2, found, err := store.getPerson(r.Pid2)
 
 	if !found {
 		log.Debugf(
@@ -263,20 +291,127 @@ func validateRelation(r relationRecord) (bool, error) {
 	// Check the multiple fathers/mothers case:
 
 	if (r.Type == relFather) || (r.Type == relMother) {
-		other, found, err := queryRelationByData("", r.Type, r.Pid2)
-
-		if found {
-			log.Infof(
-				"Found another (%d) %s relation for the target person (%s)",
-				other.Id, r.Type, r.Pid2)
+		others, err := store.queryRelationsByData("", r.Type, r.Pid2)
 
-			return false, nil
-		} else if err != nil {
+		if err != nil {
 			log.Tracef("An error occurred during the relation retrieval attempt (%s)", err)
 
 			return false, err
 		}
+
+		for _, other := range others {
+			if other.Id != excluded {
+				log.Infof(
+					"Found another (%d) %s relation for the target person (%s)",
+					other.Id, r.Type, r.Pid2)
+
+				return false, nil
+			}
+		}
 	}
 
 	return true, nil
 }
+
+/* Check if the relation record may replace the existing relation record of the same id
+
+   The replacement mustn't duplicate any other relation and must be valid (see validateRelation;
+   the replaced relation is ignored).
+
+   Params:
+   * store - the store
+   * r - the replacement relation record
+
+   Return:
+   * error (AppError with the errConflict code if the replacement is rejected, other error if
+     occurred, and nil otherwise) */
+func checkRelationReplacement(store Store, r relationRecord) error {
+	if existing, found, err := queryRelationByData(store, r.Pid1, r.Type, r.Pid2); err != nil {
+		return err
+	} else if found && existing.Id != r.Id {
+		return AppError{
+			errConflict,
+			fmt.Sprintf("Relation (%s, %s, %s) already exists", r.Pid1, r.Type, r.Pid2)}
+	}
+
+	if valid, err := validateRelationExcluding(store, r, r.Id); err != nil {
+		return err
+	} else if !valid {
+		return AppError{
+			errConflict, fmt.Sprintf("Relation (%s, %s, %s) is invalid", r.Pid1, r.Type, r.Pid2)}
+	}
+
+	return nil
+}
+
+/* Store a new relation record
+
+   The record revision is set to 1 or, if the record existed before, to the revision following the
+   last one in the history (the Rev field of the parameter is ignored)
+
+   Return:
+   * error (if the relation id is already used and nil otherwise) */
+func (s *memoryStore) insertRelation(relation relationRecord) error {
+	log.Debugf("Inserting relation record (%d)", relation.Id)
+
+	if _, found := s.relations[relation.Id]; found {
+		return AppError{
+			errDuplicateFound, fmt.Sprintf("Relation record (%d) already exists", relation.Id)}
+	}
+
+	relation.Rev = s.nextRelationRev(relation.Id)
+
+	s.putRelation(relation)
+	s.onUndo(func() { s.dropRelation(relation.Id) })
+	s.recordRelationRevision(revCreate, relation)
+
+	return nil
+}
+
+/* Overwrite an existing relation record
+
+   The record revision is incremented (the Rev field of the parameter is ignored)
+
+   Return:
+   * error (if the relation record doesn't exist and nil otherwise) */
+func (s *memoryStore) updateRelation(relation relationRecord) error {
+	log.Debugf("Updating relation record (%d)", relation.Id)
+
+	old, found := s.relations[relation.Id]
+
+	if !found {
+		return AppError{
+			errRecordNotFound, fmt.Sprintf("Relation record (%d) not found", relation.Id)}
+	}
+
+	relation.Rev = old.Rev + 1
+
+	s.putRelation(relation)
+	s.onUndo(func() { s.putRelation(old) })
+	s.recordRelationRevision(revUpdate, relation)
+
+	return nil
+}
+
+/* Remove a relation record
+
+   Return:
+   * error (if the relation record doesn't exist and nil otherwise) */
+func (s *memoryStore) removeRelation(id int64) error {
+	log.Debugf("Removing relation record (%d)", id)
+
+	old, found := s.relations[id]
+
+	if !found {
+		return AppError{errRecordNotFound, fmt.Sprintf("Relation record (%d) not found", id)}
+	}
+
+	s.dropRelation(id)
+	s.onUndo(func() { s.putRelation(old) })
+
+	deleted := old
+	deleted.Rev++
+	s.recordRelationRevision(revDelete, deleted)
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+/* This file defines the generators of the relation identifiers */
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// Relation id schemes (see newRelationIdGenerator)
+const (
+	ridTime   = "time"
+	ridRandom = "random"
+)
+
+/* The largest integer represented exactly by the JSON numbers in JavaScript (2^53 - 1)
+
+   The generated relation ids never exceed it. The ids generated before (by the full range random
+   generator) may, so the relation payloads carry the ids as strings as well (see relationPayload)
+   and the clients are advised to treat the relation ids as opaque. */
+const maxJsonSafeInt = 1<<53 - 1
+
+const (
+	// Start of the time-ordered relation ids epoch (2024-01-01T00:00:00Z) in milliseconds
+	relationIdEpoch = 1704067200000
+	// Number of the low-order bits of the time-ordered ids holding the per-millisecond sequence
+	relationIdSeqBits = 12
+)
+
+/* Generator of the relation identifiers */
+type relationIdGenerator interface {
+	/* Generate a new relation id
+
+	   The id is not used by any existing relation record nor by a deleted one. The function must
+	   be called from the function passed to the store update method, so that the id can't be
+	   taken in between.
+
+	   Params:
+	   * tx - the store (as passed to the function run by the store update method)
+
+	   Return:
+	   * new relation record identifier (positive and not greater than maxJsonSafeInt)
+	   * error (if occurred or when the generation failed and nil otherwise) */
+	nextRelationId(tx Store) (int64, error)
+}
+
+/* Check if the relation id is used by an existing or deleted relation record */
+func isRelationIdUsed(tx Store, id int64) (bool, error) {
+	if _, found, err := tx.queryRelationById(id); found || err != nil {
+		return found, err
+	}
+
+	history, err := tx.queryRelationHistory(id)
+
+	return len(history) > 0, err
+}
+
+/* Generator of the time-ordered relation ids
+
+   The id consists of the number of milliseconds since the relationIdEpoch (41 bits, enough for
+   about 69 years) followed by a sequence number (12 bits). Every id is greater than the previous
+   one, so the ids are unique by construction. The ids used already (e.g. after the clock was set
+   back and the server restarted) are skipped. */
+type timeRelationIdGenerator struct {
+	mutex sync.Mutex
+	last  int64
+	// Current time source (replaceable in tests)
+	now func() time.Time
+}
+
+func (g *timeRelationIdGenerator) nextRelationId(tx Store) (int64, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	id := max(g.last+1, (g.now().UnixMilli()-relationIdEpoch)<<relationIdSeqBits)
+
+	for ; id <= maxJsonSafeInt; id++ {
+		if used, err := isRelationIdUsed(tx, id); err != nil {
+			return 0, err
+		} else if !used {
+			g.last = id
+			return id, nil
+		}
+	}
+
+	return 0, AppError{errIdGenerationFailed, "The time-ordered relation id pool is exhausted"}
+}
+
+/* Generator of the random relation ids
+
+   The ids are drawn from the whole JSON-safe range using a cryptographic function, so the chance
+   for a conflict increases with the increasing number of existing records. If multiple attempts
+   of unique identifier generation fail, the generation fails, too. */
+type randomRelationIdGenerator struct{}
+
+func (g *randomRelationIdGenerator) nextRelationId(tx Store) (int64, error) {
+	const maxAttempts = 5
+
+	for i := 0; i < maxAttempts; i++ {
+		num, err := rand.Int(rand.Reader, big.NewInt(maxJsonSafeInt))
+		if err != nil {
+			return 0, err
+		}
+
+		// Zero is not a valid id:
+		id := num.Int64() + 1
+
+		if used, err := isRelationIdUsed(tx, id); err != nil {
+			return 0, err
+		} else if !used {
+			return id, nil
+		}
+	}
+
+	msg := fmt.Sprintf("Failed to generate relation id in %d attempts", maxAttempts)
+
+	log.Warn(msg)
+
+	return 0, AppError{errIdGenerationFailed, msg}
+}
+
+/* Create the relation id generator of the given scheme
+
+   Params:
+   * scheme - one of the ridXxx constants
+
+   Return:
+   * the generator (nil if an error occurred)
+   * error (if the scheme is unknown and nil otherwise) */
+func newRelationIdGenerator(scheme string) (relationIdGenerator, error) {
+	switch scheme {
+	case ridTime:
+		return &timeRelationIdGenerator{now: time.Now}, nil
+	case ridRandom:
+		return &randomRelationIdGenerator{}, nil
+	}
+
+	return nil, AppError{
+		errInvalidArgument, fmt.Sprintf("Unknown relation id scheme (%s)", scheme)}
+}
+
+// The gin context key under which the relation id generator is available to the request handlers
+const relationIdGeneratorCtxKey = "gentree.relationIdGenerator"
+
+/* Create a middleware making the given relation id generator available to the request handlers
+
+   The handlers retrieve the generator using the getRelationIdGenerator function */
+func relationIdGeneratorMiddleware(gen relationIdGenerator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(relationIdGeneratorCtxKey, gen)
+		c.Next()
+	}
+}
+
+/* Retrieve the relation id generator assigned to the request context by the middleware */
+func getRelationIdGenerator(c *gin.Context) relationIdGenerator {
+	return c.MustGet(relationIdGeneratorCtxKey).(relationIdGenerator)
+}
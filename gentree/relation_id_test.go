@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+/* Test the time-ordered relation id generator
+
+   1. Generate ids within a single millisecond and in the following one
+   2. Check if the used ids are skipped
+   3. Check if the ids keep growing after the clock is set back */
+func TestTimeRelationIdGenerator(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	gen := &timeRelationIdGenerator{now: func() time.Time { return now }}
+	store := newMemoryStore(nil, nil)
+	base := (now.UnixMilli() - relationIdEpoch) << relationIdSeqBits
+
+	// Case 1: Sequence
+
+	for i := int64(0); i < 3; i++ {
+		id, err := gen.nextRelationId(store)
+
+		assert.Nil(t, err)
+		assert.Equal(t, base+i, id)
+		assert.LessOrEqual(t, id, int64(maxJsonSafeInt))
+	}
+
+	now = now.Add(time.Millisecond)
+
+	id, err := gen.nextRelationId(store)
+
+	assert.Nil(t, err)
+	assert.Equal(t, base+1<<relationIdSeqBits, id)
+
+	// Case 2: Used ids
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{id, "P1", "P2", relHusband, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{id + 1, "P1", "P2", relHusband, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{id + 2, "P1", "P2", relHusband, 0}))
+	require.Nil(t, store.removeRelation(id+2))
+
+	next, err := gen.nextRelationId(store)
+
+	assert.Nil(t, err)
+	assert.Equal(t, id+3, next)
+
+	// Case 3: Clock set back
+
+	now = now.Add(-time.Hour)
+
+	id, err = gen.nextRelationId(store)
+
+	assert.Nil(t, err)
+	assert.Equal(t, next+1, id)
+
+	// A new generator (e.g. after a restart) skips the used ids as well:
+	gen = &timeRelationIdGenerator{now: func() time.Time { return now.Add(time.Hour) }}
+
+	id, err = gen.nextRelationId(store)
+
+	assert.Nil(t, err)
+	assert.Equal(t, next, id)
+}
+
+/* Test if the random relation id generator keeps the ids in the JSON-safe range */
+func TestRandomRelationIdGenerator(t *testing.T) {
+	gen, err := newRelationIdGenerator(ridRandom)
+	require.Nil(t, err)
+
+	store := newMemoryStore(nil, nil)
+
+	for i := 0; i < 100; i++ {
+		id, err := gen.nextRelationId(store)
+
+		assert.Nil(t, err)
+		assert.Greater(t, id, int64(0))
+		assert.LessOrEqual(t, id, int64(maxJsonSafeInt))
+	}
+
+	_, err = newRelationIdGenerator("snowflake")
+
+	assert.True(t, isAppError(err, errInvalidArgument))
+}
+
+/* Test if the relations created with the ids of the former (full int64 range) generator are still
+   accessible, and if the new relations get time-ordered ids */
+func TestRelationIdRequests(t *testing.T) {
+	const legacyId = int64(8646911284551352320)
+
+	people := map[string]personRecord{
+		"P1": {"P1", "Jan", "Kowalski", gMale, 0},
+		"P2": {"P2", "Anna", "Nowak", gFemale, 0},
+		"P3": {"P3", "Ewa", "Kowalska", gFemale, 0},
+	}
+	relations := map[int64]relationRecord{
+		legacyId: {legacyId, "P1", "P2", relHusband, 1},
+	}
+
+	router := setupRouter(newMemoryStore(people, relations))
+
+	res := testMakeRequest(router, "GET", fmt.Sprintf("/relations/%d", legacyId), nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, legacyId, testFullRelationRes(t, res).Id)
+
+	res = testMakeRequest(router, "POST", "/relations", testJsonBody(t, testIitRelationJson{
+		"P1", "P3", relFather}))
+
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	first := testRelationIdRes(t, res).RelationId
+
+	res = testMakeRequest(router, "POST", "/relations", testJsonBody(t, testIitRelationJson{
+		"P2", "P3", relMother}))
+
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	second := testRelationIdRes(t, res).RelationId
+
+	assert.Less(t, first, second)
+	assert.LessOrEqual(t, second, int64(maxJsonSafeInt))
+}
@@ -0,0 +1,145 @@
+package main
+
+/* This file defines the secondary indexes of the in-memory relation records */
+
+import (
+	"sort"
+)
+
+// Set of relation identifiers
+type relationIdSet map[int64]struct{}
+
+// Relation identifier sets keyed by the attribute value(s)
+type relationIdIndex map[string]relationIdSet
+
+/* Compose the key of the (type, pid2) index (the relation types never contain the separator) */
+func typePid2Key(typ string, pid2 string) string {
+	return typ + "/" + pid2
+}
+
+/* Secondary indexes of the relation records
+
+   The indexes map the attribute values to the identifiers of the relations having them, so that
+   the relation queries touch only the matching records instead of scanning all of them. The
+   indexes must be updated on every modification of the relation records (see putRelation and
+   dropRelation). */
+type relationIndex struct {
+	// All the relation ids in the increasing order
+	ids        *orderedIndex[int64]
+	byPid1     relationIdIndex
+	byPid2     relationIdIndex
+	byTypePid2 relationIdIndex
+}
+
+/* Create a relation index containing the given relations */
+func newRelationIndex(relations map[int64]relationRecord) *relationIndex {
+	idx := &relationIndex{
+		ids:        &orderedIndex[int64]{},
+		byPid1:     relationIdIndex{},
+		byPid2:     relationIdIndex{},
+		byTypePid2: relationIdIndex{},
+	}
+
+	for _, r := range relations {
+		idx.add(r)
+	}
+
+	return idx
+}
+
+/* Add the relation to the indexes */
+func (idx *relationIndex) add(r relationRecord) {
+	idx.ids.insert(r.Id)
+	idx.byPid1.add(r.Pid1, r.Id)
+	idx.byPid2.add(r.Pid2, r.Id)
+	idx.byTypePid2.add(typePid2Key(r.Type, r.Pid2), r.Id)
+}
+
+/* Remove the relation from the indexes (the relation attributes must be the indexed ones) */
+func (idx *relationIndex) remove(r relationRecord) {
+	idx.ids.remove(r.Id)
+	idx.byPid1.remove(r.Pid1, r.Id)
+	idx.byPid2.remove(r.Pid2, r.Id)
+	idx.byTypePid2.remove(typePid2Key(r.Type, r.Pid2), r.Id)
+}
+
+/* Add the identifier to the set stored under the given key (creating the set if necessary) */
+func (index relationIdIndex) add(key string, id int64) {
+	set, found := index[key]
+
+	if !found {
+		set = relationIdSet{}
+		index[key] = set
+	}
+
+	set[id] = struct{}{}
+}
+
+/* Remove the identifier from the set stored under the given key (dropping the set if it becomes
+   empty, so that the index doesn't grow with the keys no longer used) */
+func (index relationIdIndex) remove(key string, id int64) {
+	set := index[key]
+
+	delete(set, id)
+
+	if len(set) == 0 {
+		delete(index, key)
+	}
+}
+
+/* Retrieve the identifiers of all the relations of the given person (either the first or the
+   second one) in the increasing order */
+func (idx *relationIndex) personRelationIds(pid string) []int64 {
+	ids := make([]int64, 0, len(idx.byPid1[pid])+len(idx.byPid2[pid]))
+
+	for id := range idx.byPid1[pid] {
+		ids = append(ids, id)
+	}
+
+	for id := range idx.byPid2[pid] {
+		// A relation of a person with themselves is in both sets:
+		if _, found := idx.byPid1[pid][id]; !found {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
+
+/* Retrieve the set of candidate relations matching the given attributes (see
+   queryRelationsByData)
+
+   The candidates have to be filtered, since not all the attributes are indexed together
+
+   Return:
+   * the smallest indexed set containing all the matching relations
+   * success flag (false if no index applies and all the relations have to be scanned) */
+func (idx *relationIndex) candidates(pid1 string, typ string, pid2 string) (relationIdSet, bool) {
+	var sets []relationIdSet
+
+	if pid1 != "" {
+		sets = append(sets, idx.byPid1[pid1])
+	}
+
+	if typ != "" && pid2 != "" {
+		sets = append(sets, idx.byTypePid2[typePid2Key(typ, pid2)])
+	} else if pid2 != "" {
+		sets = append(sets, idx.byPid2[pid2])
+	}
+
+	if len(sets) == 0 {
+		return nil, false
+	}
+
+	smallest := sets[0]
+
+	for _, set := range sets[1:] {
+		if len(set) < len(smallest) {
+			smallest = set
+		}
+	}
+
+	return smallest, true
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+)
+
+/* Create an in-memory store with a synthetic tree of the given number of people
+
+   Every person except the first four has a father and a mother (two relations per person) */
+func testMakeTreeStore(peopleCnt int) *memoryStore {
+	people := make(map[string]personRecord, peopleCnt)
+	relations := make(map[int64]relationRecord, 2*peopleCnt)
+
+	for i := 0; i < peopleCnt; i++ {
+		gender := gMale
+
+		if i%2 == 1 {
+			gender = gFemale
+		}
+
+		pid := fmt.Sprintf("P%d", i)
+		people[pid] = personRecord{pid, "Given", "Surname", gender, 1}
+
+		if i < 4 {
+			continue
+		}
+
+		father := fmt.Sprintf("P%d", 2*(i/4))
+		mother := fmt.Sprintf("P%d", 2*(i/4)+1)
+
+		relations[int64(2*i)] = relationRecord{int64(2 * i), father, pid, relFather, 1}
+		relations[int64(2*i+1)] = relationRecord{int64(2*i + 1), mother, pid, relMother, 1}
+	}
+
+	return newMemoryStore(people, relations)
+}
+
+/* Query the relations matching the given attributes by scanning all of them (the reference
+   implementation the indexed queries are compared with) */
+func testScanRelationsByData(s *memoryStore, pid1 string, typ string, pid2 string) []relationRecord {
+	var result []relationRecord
+
+	for _, r := range s.relations {
+		if (pid1 == "" || pid1 == r.Pid1) && (typ == "" || typ == r.Type) &&
+			(pid2 == "" || pid2 == r.Pid2) {
+			result = append(result, r)
+		}
+	}
+
+	return result
+}
+
+func testSortRelations(relations []relationRecord) []relationRecord {
+	sort.Slice(relations, func(i, j int) bool { return relations[i].Id < relations[j].Id })
+	return relations
+}
+
+/* Test if the relation indexes follow the relation modifications
+
+   1. Check the index based queries against the full scan after the store creation
+   2. Modify the relations and check the queries again
+   3. Roll back a deletion and check the queries again */
+func TestRelationIndex(t *testing.T) {
+	store := testMakeTreeStore(64)
+
+	queries := [][3]string{
+		{"P8", "", ""},
+		{"", "", "P17"},
+		{"", relMother, "P17"},
+		{"P9", relMother, ""},
+		{"P8", relMother, "P17"},
+		{"", relFather, ""},
+		{"P4", relHusband, ""},
+		{"", "", ""},
+	}
+
+	check := func() {
+		for _, q := range queries {
+			expected := testSortRelations(testScanRelationsByData(store, q[0], q[1], q[2]))
+			actual, err := store.queryRelationsByData(q[0], q[1], q[2])
+
+			assert.Nil(t, err)
+			assert.Equal(t, expected, testSortRelations(actual), "query: %v", q)
+		}
+
+		for _, pid := range []string{"P0", "P8", "P17", "P63", "P99"} {
+			expected := testSortRelations(append(append(relationList{},
+				testScanRelationsByData(store, pid, "", "")...),
+				testScanRelationsByData(store, "", "", pid)...))
+			actual, _, err := store.queryRelationsByPerson(pid, paginationData{0, 100, 0, 10, 100})
+
+			assert.Nil(t, err)
+			assert.Equal(t, relationList(expected), actual, "person: %s", pid)
+		}
+	}
+
+	// Case 1: Creation
+
+	check()
+
+	// Case 2: Modifications
+
+	require.Nil(t, store.updateRelation(relationRecord{34, "P4", "P17", relFather, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{1, "P4", "P9", relHusband, 0}))
+	require.Nil(t, store.removeRelation(35))
+
+	check()
+
+	deleted, err := store.deleteRelationsByPerson("P8")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), deleted)
+
+	check()
+
+	// Case 3: Rollback
+
+	assert.NotNil(t, store.update(func(tx Store) error {
+		if _, err := tx.deleteRelationsByPerson("P9"); err != nil {
+			return err
+		}
+
+		return errors.New("rollback")
+	}))
+
+	check()
+}
+
+var testBenchmarkSizes = []int{1000, 10000, 100000, 200000}
+
+/* Benchmark the relation query used by the relation validation (the other father check) with the
+   indexes and with the full scan; the largest tree has 400k relations */
+func BenchmarkQueryRelationsByData(b *testing.B) {
+	for _, size := range testBenchmarkSizes {
+		store := testMakeTreeStore(size)
+		pid2 := fmt.Sprintf("P%d", size/2)
+
+		b.Run(fmt.Sprintf("indexed/people=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := store.queryRelationsByData("", relFather, pid2); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("scan/people=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				testScanRelationsByData(store, "", relFather, pid2)
+			}
+		})
+	}
+}
+
+/* Benchmark the retrieval of the first page of the relations of a person */
+func BenchmarkQueryRelationsByPerson(b *testing.B) {
+	for _, size := range testBenchmarkSizes {
+		store := testMakeTreeStore(size)
+		pid := fmt.Sprintf("P%d", size/2)
+
+		b.Run(fmt.Sprintf("people=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _, err := store.queryRelationsByPerson(pid, paginationData{0, 10, 0, 10, 100})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+/* Benchmark the validation of a new relation (performed on every relation creation) */
+func BenchmarkValidateRelation(b *testing.B) {
+	for _, size := range testBenchmarkSizes {
+		store := testMakeTreeStore(size)
+		relation := relationRecord{1, fmt.Sprintf("P%d", size/2), "P2", relFather, 0}
+
+		b.Run(fmt.Sprintf("people=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := validateRelation(store, relation); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+/* Benchmark the deletion of the relations of a person (rolled back after every iteration) */
+func BenchmarkDeleteRelationsByPerson(b *testing.B) {
+	errRollback := errors.New("rollback")
+
+	for _, size := range testBenchmarkSizes {
+		store := testMakeTreeStore(size)
+		pid := fmt.Sprintf("P%d", size/2)
+
+		b.Run(fmt.Sprintf("people=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				err := store.update(func(tx Store) error {
+					if _, err := tx.deleteRelationsByPerson(pid); err != nil {
+						return err
+					}
+
+					return errRollback
+				})
+
+				if err != errRollback {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
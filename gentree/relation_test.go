@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -66,9 +67,7 @@ func testRelationListRes(t *testing.T, res *httptest.ResponseRecorder) testRelat
    5. Test the person specific relation endpoint with the mother relation
    6. Test the person specific relation endpoint with the husband relation */
 func TestCreateRelationRequestSuccess(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"F1P1": personRecord{
 			Id:      "F1P1",
 			Given:   "Ignacy",
@@ -100,7 +99,10 @@ func TestCreateRelationRequestSuccess(t *testing.T) {
 			Surname: "Cieślak",
 			Gender:  gMale}}
 
-	relations = map[int64]relationRecord{}
+	relations := map[int64]relationRecord{}
+
+	store := newMemoryStore(people, relations)
+	router := setupRouter(store)
 
 	// Case 1: General father relation
 
@@ -191,37 +193,37 @@ func TestCreateRelationRequestSuccess(t *testing.T) {
 
 	// Check the final state of the relation table:
 
-	assert.Len(t, relations, 6)
-
-	assert.Equal(t, resData1.RelationId, relations[resData1.RelationId].Id)
-	assert.Equal(t, "F1P1", relations[resData1.RelationId].Pid1)
-	assert.Equal(t, "F1P3", relations[resData1.RelationId].Pid2)
-	assert.Equal(t, relFather, relations[resData1.RelationId].Type)
-
-	assert.Equal(t, resData2.RelationId, relations[resData2.RelationId].Id)
-	assert.Equal(t, "F1P2", relations[resData2.RelationId].Pid1)
-	assert.Equal(t, "F1P3", relations[resData2.RelationId].Pid2)
-	assert.Equal(t, relMother, relations[resData2.RelationId].Type)
-
-	assert.Equal(t, resData3.RelationId, relations[resData3.RelationId].Id)
-	assert.Equal(t, "F1P1", relations[resData3.RelationId].Pid1)
-	assert.Equal(t, "F1P2", relations[resData3.RelationId].Pid2)
-	assert.Equal(t, relHusband, relations[resData3.RelationId].Type)
-
-	assert.Equal(t, resData4.RelationId, relations[resData4.RelationId].Id)
-	assert.Equal(t, "F2P1", relations[resData4.RelationId].Pid1)
-	assert.Equal(t, "F2P3", relations[resData4.RelationId].Pid2)
-	assert.Equal(t, relFather, relations[resData4.RelationId].Type)
-
-	assert.Equal(t, resData5.RelationId, relations[resData5.RelationId].Id)
-	assert.Equal(t, "F2P2", relations[resData5.RelationId].Pid1)
-	assert.Equal(t, "F2P3", relations[resData5.RelationId].Pid2)
-	assert.Equal(t, relMother, relations[resData5.RelationId].Type)
-
-	assert.Equal(t, resData6.RelationId, relations[resData6.RelationId].Id)
-	assert.Equal(t, "F2P1", relations[resData6.RelationId].Pid1)
-	assert.Equal(t, "F2P2", relations[resData6.RelationId].Pid2)
-	assert.Equal(t, relHusband, relations[resData6.RelationId].Type)
+	assert.Len(t, store.relations, 6)
+
+	assert.Equal(t, resData1.RelationId, store.relations[resData1.RelationId].Id)
+	assert.Equal(t, "F1P1", store.relations[resData1.RelationId].Pid1)
+	assert.Equal(t, "F1P3", store.relations[resData1.RelationId].Pid2)
+	assert.Equal(t, relFather, store.relations[resData1.RelationId].Type)
+
+	assert.Equal(t, resData2.RelationId, store.relations[resData2.RelationId].Id)
+	assert.Equal(t, "F1P2", store.relations[resData2.RelationId].Pid1)
+	assert.Equal(t, "F1P3", store.relations[resData2.RelationId].Pid2)
+	assert.Equal(t, relMother, store.relations[resData2.RelationId].Type)
+
+	assert.Equal(t, resData3.RelationId, store.relations[resData3.RelationId].Id)
+	assert.Equal(t, "F1P1", store.relations[resData3.RelationId].Pid1)
+	assert.Equal(t, "F1P2", store.relations[resData3.RelationId].Pid2)
+	assert.Equal(t, relHusband, store.relations[resData3.RelationId].Type)
+
+	assert.Equal(t, resData4.RelationId, store.relations[resData4.RelationId].Id)
+	assert.Equal(t, "F2P1", store.relations[resData4.RelationId].Pid1)
+	assert.Equal(t, "F2P3", store.relations[resData4.RelationId].Pid2)
+	assert.Equal(t, relFather, store.relations[resData4.RelationId].Type)
+
+	assert.Equal(t, resData5.RelationId, store.relations[resData5.RelationId].Id)
+	assert.Equal(t, "F2P2", store.relations[resData5.RelationId].Pid1)
+	assert.Equal(t, "F2P3", store.relations[resData5.RelationId].Pid2)
+	assert.Equal(t, relMother, store.relations[resData5.RelationId].Type)
+
+	assert.Equal(t, resData6.RelationId, store.relations[resData6.RelationId].Id)
+	assert.Equal(t, "F2P1", store.relations[resData6.RelationId].Pid1)
+	assert.Equal(t, "F2P2", store.relations[resData6.RelationId].Pid2)
+	assert.Equal(t, relHusband, store.relations[resData6.RelationId].Type)
 }
 
 /* Test if both the create relation endpoints correctly handle an attempt to create an already
@@ -231,9 +233,7 @@ func TestCreateRelationRequestSuccess(t *testing.T) {
    1. general (/relations)
    2. person specific (/people/:pid/relations) */
 func TestCreateRelationRequestExists(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"A": personRecord{
 			Id:      "A",
 			Given:   "Mirosław",
@@ -250,11 +250,14 @@ func TestCreateRelationRequestExists(t *testing.T) {
 			Surname: "Woźniak",
 			Gender:  gFemale}}
 
-	relations = map[int64]relationRecord{
+	relations := map[int64]relationRecord{
 		1: relationRecord{Id: 1, Pid1: "A", Pid2: "B", Type: relHusband},
 		2: relationRecord{Id: 2, Pid1: "B", Pid2: "C", Type: relMother},
 		3: relationRecord{Id: 3, Pid1: "A", Pid2: "C", Type: relFather}}
 
+	store := newMemoryStore(people, relations)
+	router := setupRouter(store)
+
 	// Case 1: General relation
 
 	iitRelation := testIitRelationJson{
@@ -290,9 +293,7 @@ func TestCreateRelationRequestExists(t *testing.T) {
 /* Test if the create person specific relation endpoint handles invalid person id format
    correctly */
 func TestCreateRelationRequestPidError(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"A": personRecord{
 			Id:      "A",
 			Given:   "Patrycja",
@@ -304,7 +305,10 @@ func TestCreateRelationRequestPidError(t *testing.T) {
 			Surname: "Szymczak",
 			Gender:  gMale}}
 
-	relations = map[int64]relationRecord{}
+	relations := map[int64]relationRecord{}
+
+	store := newMemoryStore(people, relations)
+	router := setupRouter(store)
 
 	relation := testItRelationJson{
 		Pid:  "A",
@@ -325,9 +329,7 @@ func TestCreateRelationRequestPidError(t *testing.T) {
    2. The person specific handler should indicate an error when the relation type is
       invalid */
 func TestCreateRelationRequestPayloadError(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"526839f0": personRecord{
 			Id:      "526839f0",
 			Given:   "Dominik",
@@ -339,7 +341,10 @@ func TestCreateRelationRequestPayloadError(t *testing.T) {
 			Surname: "Baran",
 			Gender:  gMale}}
 
-	relations = map[int64]relationRecord{}
+	relations := map[int64]relationRecord{}
+
+	store := newMemoryStore(people, relations)
+	router := setupRouter(store)
 
 	// Case 1: General handler
 
@@ -376,16 +381,17 @@ func TestCreateRelationRequestPayloadError(t *testing.T) {
    1. The general handler should indicate an error when the relation is invalid
    2. The person specific handler should indicate an error when the relation is invalid */
 func TestCreateRelationRequestValidationError(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"9596": personRecord{
 			Id:      "9596",
 			Given:   "Dorian",
 			Surname: "Piotrowski",
 			Gender:  gMale}}
 
-	relations = map[int64]relationRecord{}
+	relations := map[int64]relationRecord{}
+
+	store := newMemoryStore(people, relations)
+	router := setupRouter(store)
 
 	// Case 1: General handler
 
@@ -423,9 +429,7 @@ func TestCreateRelationRequestValidationError(t *testing.T) {
    2. Check the case of invalid relation id format (part of the url)
    3. Check the case of missing relation */
 func TestDeleteRelationRequest(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"cf": personRecord{
 			Id:      "cf",
 			Given:   "Bartłomiej",
@@ -442,11 +446,14 @@ func TestDeleteRelationRequest(t *testing.T) {
 			Surname: "Sokołowska",
 			Gender:  gFemale}}
 
-	relations = map[int64]relationRecord{
+	relations := map[int64]relationRecord{
 		88128: relationRecord{Id: 88128, Pid1: "9c", Pid2: "b4", Type: relMother},
 		86917: relationRecord{Id: 86917, Pid1: "cf", Pid2: "b4", Type: relFather},
 		51235: relationRecord{Id: 51235, Pid1: "cf", Pid2: "9c", Type: relHusband}}
 
+	store := newMemoryStore(people, relations)
+	router := setupRouter(store)
+
 	// Case 1: Successful deletion
 
 	res := testMakeRequest(router, "DELETE", "/relations/51235", nil)
@@ -457,17 +464,17 @@ func TestDeleteRelationRequest(t *testing.T) {
 
 	assert.Equal(t, "Relation deleted", resData.Message)
 
-	assert.Len(t, relations, 2)
+	assert.Len(t, store.relations, 2)
 
-	assert.Equal(t, int64(88128), relations[88128].Id)
-	assert.Equal(t, "9c", relations[88128].Pid1)
-	assert.Equal(t, "b4", relations[88128].Pid2)
-	assert.Equal(t, relMother, relations[88128].Type)
+	assert.Equal(t, int64(88128), store.relations[88128].Id)
+	assert.Equal(t, "9c", store.relations[88128].Pid1)
+	assert.Equal(t, "b4", store.relations[88128].Pid2)
+	assert.Equal(t, relMother, store.relations[88128].Type)
 
-	assert.Equal(t, int64(86917), relations[86917].Id)
-	assert.Equal(t, "cf", relations[86917].Pid1)
-	assert.Equal(t, "b4", relations[86917].Pid2)
-	assert.Equal(t, relFather, relations[86917].Type)
+	assert.Equal(t, int64(86917), store.relations[86917].Id)
+	assert.Equal(t, "cf", store.relations[86917].Pid1)
+	assert.Equal(t, "b4", store.relations[86917].Pid2)
+	assert.Equal(t, relFather, store.relations[86917].Type)
 
 	// Case 2: Invalid relation id
 
@@ -497,9 +504,7 @@ func TestDeleteRelationRequest(t *testing.T) {
    3. Test the case of missing relation
    4. Test the case of invalid person id (payload) */
 func TestReplaceRelationRequest(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"A": personRecord{
 			Id:      "A",
 			Given:   "Magda",
@@ -522,10 +527,13 @@ func TestReplaceRelationRequest(t *testing.T) {
 			Gender:  gMale},
 	}
 
-	relations = map[int64]relationRecord{
+	relations := map[int64]relationRecord{
 		1: relationRecord{Id: 1, Pid1: "A", Pid2: "B", Type: relMother},
 		2: relationRecord{Id: 2, Pid1: "C", Pid2: "B", Type: relFather}}
 
+	store := newMemoryStore(people, relations)
+	router := setupRouter(store)
+
 	// Case 1: Replacement success
 
 	iitRelation := testIitRelationJson{
@@ -541,17 +549,17 @@ func TestReplaceRelationRequest(t *testing.T) {
 
 	assert.Equal(t, "Relation record replaced", resData.Message)
 
-	assert.Len(t, relations, 2)
+	assert.Len(t, store.relations, 2)
 
-	assert.Equal(t, int64(1), relations[1].Id)
-	assert.Equal(t, "A", relations[1].Pid1)
-	assert.Equal(t, "B", relations[1].Pid2)
-	assert.Equal(t, relMother, relations[1].Type)
+	assert.Equal(t, int64(1), store.relations[1].Id)
+	assert.Equal(t, "A", store.relations[1].Pid1)
+	assert.Equal(t, "B", store.relations[1].Pid2)
+	assert.Equal(t, relMother, store.relations[1].Type)
 
-	assert.Equal(t, int64(2), relations[2].Id)
-	assert.Equal(t, "D", relations[2].Pid1)
-	assert.Equal(t, "B", relations[2].Pid2)
-	assert.Equal(t, relFather, relations[2].Type)
+	assert.Equal(t, int64(2), store.relations[2].Id)
+	assert.Equal(t, "D", store.relations[2].Pid1)
+	assert.Equal(t, "B", store.relations[2].Pid2)
+	assert.Equal(t, relFather, store.relations[2].Type)
 
 	// Case 2: Invalid relation id
 
@@ -568,17 +576,17 @@ func TestReplaceRelationRequest(t *testing.T) {
 
 	assert.Equal(t, uriErrorMsg, resData.Message)
 
-	assert.Len(t, relations, 2)
+	assert.Len(t, store.relations, 2)
 
-	assert.Equal(t, int64(1), relations[1].Id)
-	assert.Equal(t, "A", relations[1].Pid1)
-	assert.Equal(t, "B", relations[1].Pid2)
-	assert.Equal(t, relMother, relations[1].Type)
+	assert.Equal(t, int64(1), store.relations[1].Id)
+	assert.Equal(t, "A", store.relations[1].Pid1)
+	assert.Equal(t, "B", store.relations[1].Pid2)
+	assert.Equal(t, relMother, store.relations[1].Type)
 
-	assert.Equal(t, int64(2), relations[2].Id)
-	assert.Equal(t, "D", relations[2].Pid1)
-	assert.Equal(t, "B", relations[2].Pid2)
-	assert.Equal(t, relFather, relations[2].Type)
+	assert.Equal(t, int64(2), store.relations[2].Id)
+	assert.Equal(t, "D", store.relations[2].Pid1)
+	assert.Equal(t, "B", store.relations[2].Pid2)
+	assert.Equal(t, relFather, store.relations[2].Type)
 
 	// Case 3: Missing relation
 
@@ -592,17 +600,17 @@ func TestReplaceRelationRequest(t *testing.T) {
 
 	assert.Equal(t, "Unknown relation id", resData.Message)
 
-	assert.Len(t, relations, 2)
+	assert.Len(t, store.relations, 2)
 
-	assert.Equal(t, int64(1), relations[1].Id)
-	assert.Equal(t, "A", relations[1].Pid1)
-	assert.Equal(t, "B", relations[1].Pid2)
-	assert.Equal(t, relMother, relations[1].Type)
+	assert.Equal(t, int64(1), store.relations[1].Id)
+	assert.Equal(t, "A", store.relations[1].Pid1)
+	assert.Equal(t, "B", store.relations[1].Pid2)
+	assert.Equal(t, relMother, store.relations[1].Type)
 
-	assert.Equal(t, int64(2), relations[2].Id)
-	assert.Equal(t, "D", relations[2].Pid1)
-	assert.Equal(t, "B", relations[2].Pid2)
-	assert.Equal(t, relFather, relations[2].Type)
+	assert.Equal(t, int64(2), store.relations[2].Id)
+	assert.Equal(t, "D", store.relations[2].Pid1)
+	assert.Equal(t, "B", store.relations[2].Pid2)
+	assert.Equal(t, relFather, store.relations[2].Type)
 
 	// Case 4: Invalid person id
 
@@ -619,28 +627,28 @@ func TestReplaceRelationRequest(t *testing.T) {
 
 	assert.Equal(t, payloadErrorMsg, resData.Message)
 
-	assert.Len(t, relations, 2)
+	assert.Len(t, store.relations, 2)
 
-	assert.Equal(t, int64(1), relations[1].Id)
-	assert.Equal(t, "A", relations[1].Pid1)
-	assert.Equal(t, "B", relations[1].Pid2)
-	assert.Equal(t, relMother, relations[1].Type)
+	assert.Equal(t, int64(1), store.relations[1].Id)
+	assert.Equal(t, "A", store.relations[1].Pid1)
+	assert.Equal(t, "B", store.relations[1].Pid2)
+	assert.Equal(t, relMother, store.relations[1].Type)
 
-	assert.Equal(t, int64(2), relations[2].Id)
-	assert.Equal(t, "D", relations[2].Pid1)
-	assert.Equal(t, "B", relations[2].Pid2)
-	assert.Equal(t, relFather, relations[2].Type)
+	assert.Equal(t, int64(2), store.relations[2].Id)
+	assert.Equal(t, "D", store.relations[2].Pid1)
+	assert.Equal(t, "B", store.relations[2].Pid2)
+	assert.Equal(t, relFather, store.relations[2].Type)
 }
 
 /* Test the retrieve relation endpoint
 
    1. Test the success scenario (existing record correctly returned)
    2. Test the case of invalid relation id format (part of url)
-   3. Test the case of missing relation */
+   3. Test the case of missing relation
+   4. Test the case of a legacy relation id greater than maxJsonSafeInt (returned as a string as
+      well) */
 func TestRetrieveRelationRequest(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"f6b6": personRecord{
 			Id:      "f6b6",
 			Given:   "Florian",
@@ -657,9 +665,14 @@ func TestRetrieveRelationRequest(t *testing.T) {
 			Surname: "Krajewski",
 			Gender:  gMale}}
 
-	relations = map[int64]relationRecord{
+	relations := map[int64]relationRecord{
 		20547: relationRecord{Id: 20547, Pid1: "b0dc", Pid2: "f870", Type: relMother},
-		11646: relationRecord{Id: 11646, Pid1: "f6b6", Pid2: "f870", Type: relFather}}
+		11646: relationRecord{Id: 11646, Pid1: "f6b6", Pid2: "f870", Type: relFather},
+		maxJsonSafeInt + 2: relationRecord{
+			Id: maxJsonSafeInt + 2, Pid1: "f6b6", Pid2: "b0dc", Type: relHusband}}
+
+	store := newMemoryStore(people, relations)
+	router := setupRouter(store)
 
 	// Case 1: Successful retrieval
 
@@ -693,6 +706,14 @@ func TestRetrieveRelationRequest(t *testing.T) {
 	resData3 := testErrorRes(t, res)
 
 	assert.Equal(t, "Unknown relation id", resData3.Message)
+
+	// Case 4: Legacy relation id
+
+	res = testMakeRequest(router, "GET", "/relations/9007199254740993", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, int64(9007199254740993), testFullRelationRes(t, res).Id)
+	assert.Contains(t, res.Body.String(), `"id_str":"9007199254740993"`)
 }
 
 /* Test if the retrieve relations endpoint works as expected
@@ -702,9 +723,7 @@ func TestRetrieveRelationRequest(t *testing.T) {
    2. Test the successful retrieval of the second page
    3. Test the handling of the negative pagination page index (to test pagination binding error) */
 func TestRetrieveRelationsRequest(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"P01": personRecord{Id: "P01", Given: "Marian", Surname: "Zawadzki", Gender: gMale},
 		"P02": personRecord{Id: "P02", Given: "Marlena", Surname: "Pawlak", Gender: gFemale},
 		"P03": personRecord{Id: "P03", Given: "Urszula", Surname: "Zawadzka", Gender: gFemale},
@@ -716,7 +735,7 @@ func TestRetrieveRelationsRequest(t *testing.T) {
 		"P09": personRecord{Id: "P09", Given: "Anna", Surname: "Malinowska", Gender: gFemale},
 		"P10": personRecord{Id: "P10", Given: "Emanuel", Surname: "Witkowski", Gender: gMale}}
 
-	relations = map[int64]relationRecord{
+	relations := map[int64]relationRecord{
 		10: relationRecord{Id: 10, Pid1: "P01", Pid2: "P02", Type: relHusband},
 		11: relationRecord{Id: 11, Pid1: "P01", Pid2: "P03", Type: relFather},
 		12: relationRecord{Id: 12, Pid1: "P02", Pid2: "P03", Type: relMother},
@@ -732,6 +751,9 @@ func TestRetrieveRelationsRequest(t *testing.T) {
 		22: relationRecord{Id: 22, Pid1: "P04", Pid2: "P07", Type: relHusband},
 		23: relationRecord{Id: 23, Pid1: "P10", Pid2: "P09", Type: relHusband}}
 
+	store := newMemoryStore(people, relations)
+	router := setupRouter(store)
+
 	// Case 1: Successful retrieval of the first page
 
 	res := testMakeRequest(router, "GET", "/relations?limit=10&page=0", nil)
@@ -847,9 +869,7 @@ func TestRetrieveRelationsRequest(t *testing.T) {
    4. Test the handling of the invalid pagination query variables (too small page size)
    5. Test the handling of not existing person */
 func TestRetrievePersonRelationsRequest(t *testing.T) {
-	router := setupRouter()
-
-	people = map[string]personRecord{
+	people := map[string]personRecord{
 		"P01": personRecord{Id: "P01", Given: "Albert", Surname: "Michalski", Gender: gMale},
 		"P02": personRecord{Id: "P02", Given: "Wioletta", Surname: "Piotrowska", Gender: gFemale},
 		"P03": personRecord{Id: "P03", Given: "Adela", Surname: "Michalska", Gender: gFemale},
@@ -868,7 +888,7 @@ func TestRetrievePersonRelationsRequest(t *testing.T) {
 		"P16": personRecord{Id: "P16", Given: "Edyta", Surname: "Michalska", Gender: gFemale},
 		"P17": personRecord{Id: "P17", Given: "Barbara", Surname: "Michalska", Gender: gFemale}}
 
-	relations = map[int64]relationRecord{
+	relations := map[int64]relationRecord{
 		10: relationRecord{Id: 10, Pid1: "P01", Pid2: "P02", Type: relHusband},
 		11: relationRecord{Id: 11, Pid1: "P01", Pid2: "P03", Type: relFather},
 		12: relationRecord{Id: 12, Pid1: "P02", Pid2: "P03", Type: relMother},
@@ -899,6 +919,9 @@ func TestRetrievePersonRelationsRequest(t *testing.T) {
 		37: relationRecord{Id: 37, Pid1: "P05", Pid2: "P17", Type: relFather},
 		38: relationRecord{Id: 38, Pid1: "P06", Pid2: "P17", Type: relMother}}
 
+	store := newMemoryStore(people, relations)
+	router := setupRouter(store)
+
 	// Case 1: Successful retrieval of the first page
 
 	res := testMakeRequest(router, "GET", "/people/P05/relations?limit=10&page=0", nil)
@@ -1017,3 +1040,68 @@ func TestRetrievePersonRelationsRequest(t *testing.T) {
 
 	assert.Equal(t, "Unknown person id", resData5.Message)
 }
+
+/* Test the relation revision handling (ETag and If-Match headers)
+
+   1. Check if the retrieve relation endpoint returns the revision as the ETag header
+   2. Attempt to replace the relation with a stale revision
+   3. Replace the relation with the current revision
+   4. Attempt to delete the relation with a stale revision
+   5. Delete the relation with the current revision */
+func TestRelationRequestRevisions(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Kowalska", gFemale, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{1, "P1", "P2", relHusband, 0}))
+
+	// Case 1: Retrieve
+
+	res := testMakeRequest(router, "GET", "/relations/1", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `"1"`, res.Header().Get("ETag"))
+	// The browser clients can read the header:
+	assert.Equal(t, "ETag", res.Header().Get("Access-Control-Expose-Headers"))
+
+	// Case 2: Replace a stale revision
+
+	relation := testIitRelationJson{Pid1: "P2", Pid2: "P1", Type: relMother}
+
+	res = testMakeRequestWithHeaders(
+		router, "PUT", "/relations/1", testJsonBody(t, relation),
+		map[string]string{"If-Match": `"2"`})
+
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code)
+	assert.Equal(t, preconditionErrorMsg, testErrorRes(t, res).Message)
+	assert.Equal(t, `"1"`, res.Header().Get("ETag"))
+	assert.Equal(t, relHusband, store.relations[1].Type)
+
+	// Case 3: Replace the current revision
+
+	res = testMakeRequestWithHeaders(
+		router, "PUT", "/relations/1", testJsonBody(t, relation),
+		map[string]string{"If-Match": `"1"`})
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `"2"`, res.Header().Get("ETag"))
+	assert.Equal(t, relationRecord{1, "P2", "P1", relMother, 2}, store.relations[1])
+
+	// Case 4: Delete a stale revision
+
+	res = testMakeRequestWithHeaders(
+		router, "DELETE", "/relations/1", nil, map[string]string{"If-Match": `"1"`})
+
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code)
+	assert.Equal(t, `"2"`, res.Header().Get("ETag"))
+	assert.Len(t, store.relations, 1)
+
+	// Case 5: Delete the current revision
+
+	res = testMakeRequestWithHeaders(
+		router, "DELETE", "/relations/1", nil, map[string]string{"If-Match": `"2"`})
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, store.relations)
+}
@@ -0,0 +1,385 @@
+package main
+
+/* This file defines the export and import of the whole database as a single JSON document (the
+   snapshot) */
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"time"
+)
+
+// Format name and version written to the snapshot header
+const (
+	snapshotFormat  = "gentree-snapshot"
+	snapshotVersion = 1
+)
+
+// Number of records retrieved from the store at once during the export
+const snapshotPageSize = 1000
+
+/* The snapshot document
+
+   The records are ordered by id. The record revisions are not exported (the imported records
+   start new histories). */
+type snapshotPayload struct {
+	Format     string              `json:"format"`
+	Version    int                 `json:"version"`
+	ExportedAt time.Time           `json:"exported_at"`
+	People     []fullPersonPayload `json:"people"`
+	Relations  []relationPayload   `json:"relations"`
+	// GEDCOM extension structures keyed by the person ids (see gedcomExtension)
+	GedcomExtensions map[string][]gedcomExtension `json:"gedcom_extensions,omitempty"`
+	// Gramps handles keyed by the person ids (see gramps.go)
+	GrampsHandles map[string]string `json:"gramps_handles,omitempty"`
+}
+
+/* Check if the snapshot header specifies the supported format and version */
+func (p *snapshotPayload) validate() error {
+	if p.Format != snapshotFormat {
+		return AppError{errInvalidArgument, fmt.Sprintf("Unknown snapshot format (%s)", p.Format)}
+	}
+
+	if p.Version != snapshotVersion {
+		return AppError{
+			errInvalidArgument, fmt.Sprintf("Unsupported snapshot version (%d)", p.Version)}
+	}
+
+	return nil
+}
+
+/* Record rejected by the snapshot import (exactly one of the record fields is set) */
+type importRejectionPayload struct {
+	Person   *fullPersonPayload `json:"person,omitempty"`
+	Relation *relationPayload   `json:"relation,omitempty"`
+	Reason   string             `json:"reason"`
+}
+
+/* Summary of the snapshot import */
+type importReportPayload struct {
+	ImportedPeople    int `json:"imported_people"`
+	ImportedRelations int `json:"imported_relations"`
+	// Records identical to the existing ones (merge mode only)
+	SkippedPeople    int                      `json:"skipped_people"`
+	SkippedRelations int                      `json:"skipped_relations"`
+	Rejected         []importRejectionPayload `json:"rejected"`
+}
+
+/* Collect all the people and relations of the store
+
+   The function must be called from the function passed to the store view (or update) method, so
+   that the relations are consistent with the people.
+
+   Return:
+   * the snapshot document (valid only if no error occurred)
+   * error (if occurred and nil otherwise) */
+func exportSnapshot(tx Store) (snapshotPayload, error) {
+	snapshot := snapshotPayload{
+		Format:     snapshotFormat,
+		Version:    snapshotVersion,
+		ExportedAt: time.Now().UTC(),
+		People:     []fullPersonPayload{},
+		Relations:  []relationPayload{},
+	}
+
+	for idx := 0; ; idx++ {
+		pag := paginationData{idx, snapshotPageSize, 0, snapshotPageSize, snapshotPageSize}
+
+		people, pag, err := tx.queryPeople(pag, personFilter{})
+		if err != nil {
+			return snapshotPayload{}, err
+		}
+
+		snapshot.People = append(snapshot.People, people.toPayload()...)
+
+		if len(snapshot.People) >= pag.TotalCnt || len(people) == 0 {
+			break
+		}
+	}
+
+	for _, person := range snapshot.People {
+		extensions, err := tx.getGedcomExtensions(person.Id)
+		if err != nil {
+			return snapshotPayload{}, err
+		}
+
+		if len(extensions) > 0 {
+			if snapshot.GedcomExtensions == nil {
+				snapshot.GedcomExtensions = map[string][]gedcomExtension{}
+			}
+
+			snapshot.GedcomExtensions[person.Id] = extensions
+		}
+	}
+
+	handles, err := tx.queryGrampsHandles()
+	if err != nil {
+		return snapshotPayload{}, err
+	}
+
+	if len(handles) > 0 {
+		snapshot.GrampsHandles = handles
+	}
+
+	for idx := 0; ; idx++ {
+		pag := paginationData{idx, snapshotPageSize, 0, snapshotPageSize, snapshotPageSize}
+
+		relations, pag, err := tx.queryRelationsByPerson("", pag)
+		if err != nil {
+			return snapshotPayload{}, err
+		}
+
+		snapshot.Relations = append(snapshot.Relations, relations.toPayload()...)
+
+		if len(snapshot.Relations) >= pag.TotalCnt || len(relations) == 0 {
+			break
+		}
+	}
+
+	return snapshot, nil
+}
+
+/* Check if the store contains neither people nor relations */
+func isStoreEmpty(tx Store) (bool, error) {
+	pag := paginationData{0, minPageSize, 0, minPageSize, maxPageSize}
+
+	if _, pag, err := tx.queryPeople(pag, personFilter{}); err != nil || pag.TotalCnt > 0 {
+		return false, err
+	}
+
+	_, pag, err := tx.queryRelationsByPerson("", pag)
+
+	return err == nil && pag.TotalCnt == 0, err
+}
+
+/* Load the snapshot records into the store
+
+   The people are imported first, then the relations. Every relation is checked using the
+   validateRelation function. Invalid records don't abort the import; they are rejected and listed
+   in the report instead. In the merge mode, the records identical to the existing ones (people
+   with the same id and data, relations with the same people and type) are skipped. The GEDCOM
+   extensions and the Gramps handles are stored only for the imported (not skipped) people. The
+   snapshot relation ids are preserved unless already used or not positive; the relations get new
+   ids otherwise.
+
+   The function must be called from the function passed to the store update method.
+
+   Params:
+   * tx - the store (as passed to the function run by the store update method)
+   * gen - the generator of the ids of the relations whose snapshot ids can't be preserved
+   * snapshot - the snapshot document (with the header validated)
+   * mode - one of the importXxx constants
+
+   Return:
+   * the import report (valid only if no error occurred)
+   * error (AppError with the errConflict code if the store isn't empty in the empty mode, other
+     error if occurred, and nil otherwise) */
+func importSnapshot(tx Store, gen relationIdGenerator, snapshot snapshotPayload, mode string) (importReportPayload, error) {
+	report := importReportPayload{Rejected: []importRejectionPayload{}}
+
+	if mode != importMerge {
+		if empty, err := isStoreEmpty(tx); err != nil {
+			return report, err
+		} else if !empty {
+			return report, AppError{errConflict, "The store is not empty"}
+		}
+	}
+
+	for _, payload := range snapshot.People {
+		reject := func(reason string) {
+			person := payload
+			report.Rejected = append(
+				report.Rejected, importRejectionPayload{Person: &person, Reason: reason})
+		}
+
+		if err := binding.Validator.ValidateStruct(&payload); err != nil {
+			reject("Invalid person data")
+			continue
+		}
+
+		person := payload.toRecord()
+
+		if existing, found, err := tx.getPerson(person.Id); found {
+			existing.Rev = 0
+
+			if existing != person {
+				reject(fmt.Sprintf("Person (%s) already exists", person.Id))
+			} else {
+				report.SkippedPeople++
+			}
+
+			continue
+		} else if err != nil {
+			return report, err
+		}
+
+		if err := tx.insertPerson(person); err != nil {
+			return report, err
+		}
+
+		if extensions := snapshot.GedcomExtensions[person.Id]; len(extensions) > 0 {
+			if err := tx.setGedcomExtensions(person.Id, extensions); err != nil {
+				return report, err
+			}
+		}
+
+		// A handle already assigned to another person is dropped (the person is still imported):
+		if handle := snapshot.GrampsHandles[person.Id]; handle != "" {
+			if err := tx.setGrampsHandle(person.Id, handle); isAppError(err, errDuplicateFound) {
+				log.Infof("Dropped the Gramps handle of person (%s) (%s)", person.Id, err)
+			} else if err != nil {
+				return report, err
+			}
+		}
+
+		report.ImportedPeople++
+	}
+
+	for _, payload := range snapshot.Relations {
+		reject := func(reason string) {
+			relation := payload
+			report.Rejected = append(
+				report.Rejected, importRejectionPayload{Relation: &relation, Reason: reason})
+		}
+
+		// The id is not validated (the relations without a positive id get a new one):
+		data := iitRelationPayload{payload.Pid1, payload.Pid2, payload.Type}
+
+		if err := binding.Validator.ValidateStruct(&data); err != nil {
+			reject("Invalid relation data")
+			continue
+		}
+
+		relation := data.toRecord(payload.Id)
+
+		if _, found, err := queryRelationByData(
+			tx, relation.Pid1, relation.Type, relation.Pid2); found {
+			report.SkippedRelations++
+			continue
+		} else if err != nil {
+			return report, err
+		}
+
+		if valid, err := validateRelation(tx, relation); err != nil {
+			return report, err
+		} else if !valid {
+			reject(fmt.Sprintf("Relation (%s, %s, %s) is invalid",
+				relation.Pid1, relation.Type, relation.Pid2))
+			continue
+		}
+
+		if used, err := isRelationIdUsed(tx, relation.Id); err != nil {
+			return report, err
+		} else if used || relation.Id <= 0 {
+			if relation.Id, err = gen.nextRelationId(tx); err != nil {
+				return report, err
+			}
+		}
+
+		if err := tx.insertRelation(relation); err != nil {
+			return report, err
+		}
+
+		report.ImportedRelations++
+	}
+
+	return report, nil
+}
+
+/* Handle an export request
+
+   The response contains all the people and relations (see snapshotPayload) */
+func exportDatabase(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doExport(c, formatSnapshot)
+}
+
+/* Load a snapshot document into the store (see importSnapshot)
+
+   Params:
+   * store - the store to import the snapshot into
+   * gen - the relation id generator (see importSnapshot)
+   * in - the snapshot document source
+   * mode - one of the importXxx constants
+
+   Return:
+   * the import report (valid only if no error occurred)
+   * error (AppError with the errInvalidArgument code if the document is malformed, see
+     importSnapshot for the other errors) */
+func loadSnapshot(store Store, gen relationIdGenerator, in io.Reader, mode string) (importReportPayload, error) {
+	var snapshot snapshotPayload
+
+	if err := json.NewDecoder(in).Decode(&snapshot); err != nil {
+		log.Infof("Snapshot data unmarshalling error: %s", err)
+
+		return importReportPayload{}, AppError{errInvalidArgument, "Malformed snapshot document"}
+	}
+
+	if err := snapshot.validate(); err != nil {
+		return importReportPayload{}, err
+	}
+
+	var report importReportPayload
+
+	err := store.update(func(tx Store) error {
+		var err error
+
+		report, err = importSnapshot(tx, gen, snapshot, mode)
+
+		return err
+	})
+
+	return report, err
+}
+
+/* Handle a snapshot import request
+
+   The function will retrieve the snapshot from the request payload (snapshotPayload) and the
+   import mode from the request query (importQuery; the empty mode is the default one). Either all
+   the valid records are imported or none of them (when an error occurs). */
+func importDatabase(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	doImport(c, formatSnapshot)
+}
+
+/* Write the snapshot of the whole store
+
+   Params:
+   * store - the store to be exported
+   * out - the snapshot document destination
+
+   Return:
+   * error (if occurred and nil otherwise) */
+func saveSnapshot(store Store, out io.Writer) error {
+	var snapshot snapshotPayload
+
+	err := store.view(func(tx Store) error {
+		var err error
+
+		snapshot, err = exportSnapshot(tx)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(snapshot); err != nil {
+		return err
+	}
+
+	log.Infof("Exported %d people and %d relations",
+		len(snapshot.People), len(snapshot.Relations))
+
+	return nil
+}
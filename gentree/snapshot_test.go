@@ -0,0 +1,194 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+type testSnapshotJson struct {
+	Format    string                 `json:"format"`
+	Version   int                    `json:"version"`
+	People    []testPersonJson       `json:"people"`
+	Relations []testFullRelationJson `json:"relations"`
+}
+
+func testSnapshotRes(t *testing.T, res *httptest.ResponseRecorder) testSnapshotJson {
+	payload := testSnapshotJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+type testImportRejectionJson struct {
+	Person   *testPersonJson       `json:"person"`
+	Relation *testFullRelationJson `json:"relation"`
+	Reason   string                `json:"reason"`
+}
+
+type testImportReportJson struct {
+	Message string `json:"message"`
+	Report  struct {
+		ImportedPeople    int                       `json:"imported_people"`
+		ImportedRelations int                       `json:"imported_relations"`
+		SkippedPeople     int                       `json:"skipped_people"`
+		SkippedRelations  int                       `json:"skipped_relations"`
+		Rejected          []testImportRejectionJson `json:"rejected"`
+	} `json:"report"`
+}
+
+func testImportReportRes(t *testing.T, res *httptest.ResponseRecorder) testImportReportJson {
+	payload := testImportReportJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+/* Test the snapshot export and import requests
+
+   1. Export a store
+   2. Import the snapshot into an empty store
+   3. Attempt to import the snapshot into a non-empty store
+   4. Merge a snapshot containing identical, conflicting and invalid records
+   5. Attempt to import a snapshot of an unsupported version */
+func TestSnapshotRequests(t *testing.T) {
+	source := newMemoryStore(nil, nil)
+
+	require.Nil(t, source.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, source.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+	require.Nil(t, source.insertPerson(personRecord{"P3", "Ewa", "Kowalska", gFemale, 0}))
+	require.Nil(t, source.updatePerson(personRecord{"P3", "Ewa", "Kowalska", gFemale, 0}))
+	require.Nil(t, source.insertRelation(relationRecord{10, "P1", "P2", relHusband, 0}))
+	require.Nil(t, source.insertRelation(relationRecord{20, "P1", "P3", relFather, 0}))
+	require.Nil(t, source.insertRelation(relationRecord{30, "P2", "P3", relMother, 0}))
+
+	// Case 1: Export
+
+	res := testMakeRequest(setupRouter(source), "GET", "/export", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	snapshot := testSnapshotRes(t, res)
+
+	assert.Equal(t, snapshotFormat, snapshot.Format)
+	assert.Equal(t, snapshotVersion, snapshot.Version)
+	assert.Equal(t, []testPersonJson{
+		{"P1", "Jan", "Kowalski", gMale},
+		{"P2", "Anna", "Nowak", gFemale},
+		{"P3", "Ewa", "Kowalska", gFemale}}, snapshot.People)
+	assert.Equal(t, []testFullRelationJson{
+		{10, "P1", "P2", relHusband},
+		{20, "P1", "P3", relFather},
+		{30, "P2", "P3", relMother}}, snapshot.Relations)
+
+	// Case 2: Import
+
+	target := newMemoryStore(nil, nil)
+	router := setupRouter(target)
+
+	res = testMakeRequest(router, "POST", "/import", testJsonBody(t, snapshot))
+
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	report := testImportReportRes(t, res)
+
+	assert.Equal(t, 3, report.Report.ImportedPeople)
+	assert.Equal(t, 3, report.Report.ImportedRelations)
+	assert.Empty(t, report.Report.Rejected)
+	assert.Equal(t, personRecord{"P3", "Ewa", "Kowalska", gFemale, 1}, target.people["P3"])
+	assert.Equal(t, relationRecord{30, "P2", "P3", relMother, 1}, target.relations[30])
+
+	// Case 3: Non-empty store
+
+	res = testMakeRequest(router, "POST", "/import", testJsonBody(t, snapshot))
+
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.Equal(t, "The store is not empty", testErrorRes(t, res).Message)
+
+	// Case 4: Merge
+
+	snapshot.People = []testPersonJson{
+		{"P1", "Jan", "Kowalski", gMale},
+		{"P2", "Anna", "Wiśniewska", gFemale},
+		{"P4", "Adam", "Kowalski", gMale},
+		{"P$", "Piotr", "Nowak", gMale}}
+	snapshot.Relations = []testFullRelationJson{
+		{10, "P1", "P2", relHusband},
+		{20, "P4", "P3", relFather},
+		{30, "P4", "P1", relFather},
+		{40, "P1", "P4", relMother}}
+
+	res = testMakeRequest(router, "POST", "/import?mode=merge", testJsonBody(t, snapshot))
+
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	report = testImportReportRes(t, res)
+
+	assert.Equal(t, 1, report.Report.ImportedPeople)
+	assert.Equal(t, 1, report.Report.SkippedPeople)
+	assert.Equal(t, 1, report.Report.ImportedRelations)
+	assert.Equal(t, 1, report.Report.SkippedRelations)
+	assert.Equal(t, []testImportRejectionJson{
+		{Person: &testPersonJson{"P2", "Anna", "Wiśniewska", gFemale},
+			Reason: "Person (P2) already exists"},
+		{Person: &testPersonJson{"P$", "Piotr", "Nowak", gMale},
+			Reason: "Invalid person data"},
+		{Relation: &testFullRelationJson{20, "P4", "P3", relFather},
+			Reason: "Relation (P4, father, P3) is invalid"},
+		{Relation: &testFullRelationJson{40, "P1", "P4", relMother},
+			Reason: "Relation (P1, mother, P4) is invalid"}}, report.Report.Rejected)
+	assert.Equal(t, "Nowak", target.people["P2"].Surname)
+	assert.Contains(t, target.people, "P4")
+
+	// The snapshot id of the imported relation was taken, so it got a new one:
+	relations, err := target.queryRelationsByData("P4", relFather, "P1")
+
+	require.Nil(t, err)
+	require.Len(t, relations, 1)
+	assert.NotEqual(t, int64(30), relations[0].Id)
+
+	// Case 5: Unsupported version
+
+	snapshot.Version = snapshotVersion + 1
+
+	res = testMakeRequest(router, "POST", "/import?mode=merge", testJsonBody(t, snapshot))
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, "Unsupported snapshot version (2)", testErrorRes(t, res).Message)
+}
+
+/* Test if the export and import subcommands move the records between two SQLite databases */
+func TestSnapshotCommands(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snapshot.json")
+
+	source := testOpenSqliteStore(t, filepath.Join(dir, "source.db"))
+
+	require.Nil(t, source.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, source.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+	require.Nil(t, source.insertRelation(relationRecord{7, "P1", "P2", relHusband, 0}))
+
+	require.Nil(t, runExportCommand(source, path, formatSnapshot, ""))
+
+	target := testOpenSqliteStore(t, filepath.Join(dir, "target.db"))
+	gen, err := newRelationIdGenerator(ridTime)
+	require.Nil(t, err)
+
+	require.Nil(t, runImportCommand(target, gen, path, formatSnapshot, importEmpty))
+
+	person, found, err := target.getPerson("P2")
+
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, personRecord{"P2", "Anna", "Nowak", gFemale, 1}, person)
+
+	relation, found, err := target.queryRelationById(7)
+
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, relationRecord{7, "P1", "P2", relHusband, 1}, relation)
+
+	assert.True(t, isAppError(
+		runImportCommand(target, gen, path, formatSnapshot, importEmpty), errConflict))
+}
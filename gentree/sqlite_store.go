@@ -0,0 +1,966 @@
+package main
+
+/* This file defines the SQLite implementation of the Store interface */
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/* Schema migrations of the SQLite database
+
+   The migrations are applied in order at startup. The index of the last applied migration (plus
+   one) is stored in the database as the user_version pragma value. New migrations must always be
+   appended to the end of the list; the already released ones must never be modified. */
+var sqliteMigrations = []string{
+	// 1: Initial schema
+	`CREATE TABLE people (
+		id      TEXT PRIMARY KEY NOT NULL,
+		given   TEXT NOT NULL,
+		surname TEXT NOT NULL,
+		gender  TEXT NOT NULL CHECK (gender IN ('male', 'female', 'unknown'))
+	);
+	CREATE TABLE relations (
+		id   INTEGER PRIMARY KEY NOT NULL,
+		pid1 TEXT NOT NULL REFERENCES people (id),
+		pid2 TEXT NOT NULL REFERENCES people (id),
+		type TEXT NOT NULL CHECK (type IN ('father', 'mother', 'husband'))
+	);
+	CREATE INDEX relations_pid1_idx ON relations (pid1);
+	CREATE INDEX relations_pid2_idx ON relations (pid2);
+	CREATE INDEX relations_type_pid2_idx ON relations (type, pid2);`,
+	// 2: Record revisions
+	`ALTER TABLE people ADD COLUMN rev INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE relations ADD COLUMN rev INTEGER NOT NULL DEFAULT 1;`,
+	// 3: Record revision histories (maintained by the triggers)
+	`CREATE TABLE person_history (
+		pid     TEXT NOT NULL,
+		rev     INTEGER NOT NULL,
+		time    TEXT NOT NULL,
+		op      TEXT NOT NULL CHECK (op IN ('create', 'update', 'delete')),
+		given   TEXT NOT NULL,
+		surname TEXT NOT NULL,
+		gender  TEXT NOT NULL,
+		PRIMARY KEY (pid, rev)
+	);
+	CREATE TABLE relation_history (
+		rid  INTEGER NOT NULL,
+		rev  INTEGER NOT NULL,
+		time TEXT NOT NULL,
+		op   TEXT NOT NULL CHECK (op IN ('create', 'update', 'delete')),
+		pid1 TEXT NOT NULL,
+		pid2 TEXT NOT NULL,
+		type TEXT NOT NULL,
+		PRIMARY KEY (rid, rev)
+	);
+	CREATE TRIGGER people_insert_history AFTER INSERT ON people BEGIN
+		INSERT INTO person_history VALUES (
+			NEW.id, NEW.rev, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), 'create',
+			NEW.given, NEW.surname, NEW.gender);
+	END;
+	CREATE TRIGGER people_update_history AFTER UPDATE ON people BEGIN
+		INSERT INTO person_history VALUES (
+			NEW.id, NEW.rev, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), 'update',
+			NEW.given, NEW.surname, NEW.gender);
+	END;
+	CREATE TRIGGER people_delete_history AFTER DELETE ON people BEGIN
+		INSERT INTO person_history VALUES (
+			OLD.id, OLD.rev + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), 'delete',
+			OLD.given, OLD.surname, OLD.gender);
+	END;
+	CREATE TRIGGER relations_insert_history AFTER INSERT ON relations BEGIN
+		INSERT INTO relation_history VALUES (
+			NEW.id, NEW.rev, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), 'create',
+			NEW.pid1, NEW.pid2, NEW.type);
+	END;
+	CREATE TRIGGER relations_update_history AFTER UPDATE ON relations BEGIN
+		INSERT INTO relation_history VALUES (
+			NEW.id, NEW.rev, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), 'update',
+			NEW.pid1, NEW.pid2, NEW.type);
+	END;
+	CREATE TRIGGER relations_delete_history AFTER DELETE ON relations BEGIN
+		INSERT INTO relation_history VALUES (
+			OLD.id, OLD.rev + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), 'delete',
+			OLD.pid1, OLD.pid2, OLD.type);
+	END;`,
+	// 4: Trash (the records are stored as JSON, see trashRecord)
+	`CREATE TABLE trash (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		time      TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+		person    TEXT NULL,
+		relations TEXT NOT NULL
+	);
+	CREATE INDEX trash_time_idx ON trash (time);`,
+	// 5: GEDCOM extensions (stored as JSON, see gedcomExtension)
+	`CREATE TABLE gedcom_extensions (
+		pid  TEXT PRIMARY KEY NOT NULL REFERENCES people (id) ON DELETE CASCADE,
+		data TEXT NOT NULL
+	);`,
+	// 6: Gramps handles
+	`CREATE TABLE gramps_handles (
+		pid    TEXT PRIMARY KEY NOT NULL REFERENCES people (id) ON DELETE CASCADE,
+		handle TEXT NOT NULL UNIQUE
+	);`,
+	// 7: GEDCOM extensions of the people in the trash (stored as JSON, see gedcomExtension)
+	`ALTER TABLE trash ADD COLUMN gedcom_extensions TEXT NULL;`,
+	// 8: Gramps handles of the people in the trash
+	`ALTER TABLE trash ADD COLUMN gramps_handle TEXT NULL;`,
+	// 9: Store instance identifier (generated like newStoreInstanceId does)
+	`CREATE TABLE instance (
+		id TEXT NOT NULL
+	);
+	INSERT INTO instance (id) VALUES (lower(hex(randomblob(16))));`,
+}
+
+/* SQLite implementation of the Store interface
+
+   The data is kept in the database file specified at the store creation */
+type sqliteStore struct {
+	db *sql.DB
+	// The database itself or the transaction of the update or view method
+	q sqlQuerier
+}
+
+/* Query interface common to the database and transaction objects */
+type sqlQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+/* Open (and create if necessary) the SQLite database and bring its schema up to date
+
+   Params:
+   * path - the database file path
+
+   Return:
+   * the store (nil if an error occurred)
+   * error (if occurred and nil otherwise) */
+func openSqliteStore(path string) (*sqliteStore, error) {
+	log.Debugf("Opening the SQLite database (%s)", path)
+
+	// The foreign keys enforcement is a per connection setting in SQLite. The WAL mode lets the
+	// readers (see the view method) run alongside the writer, and the immediate transactions make
+	// the competing writers wait (busy_timeout) instead of failing when upgrading their locks.
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"+
+		"&_pragma=journal_mode(wal)&_txlock=immediate", path)
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateSqliteDb(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteStore{db, db}, nil
+}
+
+/* Close the underlying database */
+func (s *sqliteStore) close() error {
+	return s.db.Close()
+}
+
+/* Run the given function in a database transaction
+
+   The transaction is committed if the function succeeds and rolled back otherwise. Nested calls
+   reuse the outer transaction. */
+func (s *sqliteStore) update(fn func(tx Store) error) error {
+	if _, nested := s.q.(*sql.Tx); nested {
+		return fn(s)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&sqliteStore{s.db, tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/* Run the given function in a read-only database transaction
+
+   The transaction sees a consistent state of the database without blocking the other readers.
+   Nested calls reuse the outer transaction. */
+func (s *sqliteStore) view(fn func(tx Store) error) error {
+	if _, nested := s.q.(*sql.Tx); nested {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+
+	// Nothing is modified, so there is nothing to commit:
+	defer tx.Rollback()
+
+	return fn(&sqliteStore{s.db, tx})
+}
+
+/* Apply all the schema migrations not applied yet
+
+   Each migration is applied in a separate transaction together with the schema version update */
+func migrateSqliteDb(db *sql.DB) error {
+	var version int
+
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	if version > len(sqliteMigrations) {
+		return AppError{
+			errInvalidArgument,
+			fmt.Sprintf("The database schema version (%d) is newer than the supported one (%d)",
+				version, len(sqliteMigrations))}
+	}
+
+	for ; version < len(sqliteMigrations); version++ {
+		log.Infof("Applying the database schema migration #%d", version+1)
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(sqliteMigrations[version]); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/* Create an SQL placeholder list for the given number of values (e.g. "?, ?, ?") */
+func sqlPlaceholders(cnt int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", cnt), ", ")
+}
+
+func (s *sqliteStore) getPerson(pid string) (personRecord, bool, error) {
+	log.Debugf("Retrieving person record by id (%s)", pid)
+
+	var p personRecord
+
+	err := s.q.QueryRow(
+		"SELECT id, given, surname, gender, rev FROM people WHERE id = ?", pid).Scan(
+		&p.Id, &p.Given, &p.Surname, &p.Gender, &p.Rev)
+
+	if err == sql.ErrNoRows {
+		log.Debugf("Person record (%s) not found", pid)
+
+		return personRecord{}, false, nil
+	} else if err != nil {
+		return personRecord{}, false, err
+	}
+
+	return p, true, nil
+}
+
+func (s *sqliteStore) maxPersonSequence(prefix string) (int64, error) {
+	log.Debugf("Retrieving the greatest person id sequence number (%s)", prefix)
+
+	// The histories cover the deleted records (and the records of the older schema versions don't
+	// need to have one, so the current records are visited as well):
+	start := utf8.RuneCountInString(prefix) + 1
+
+	var result int64
+
+	err := s.q.QueryRow(
+		`SELECT COALESCE(MAX(CAST(substr(pid, ?) AS INTEGER)), 0)
+		 FROM (SELECT id AS pid FROM people UNION SELECT pid FROM person_history)
+		 WHERE substr(pid, 1, ?) = ? AND length(pid) BETWEEN ? AND ?
+		   AND substr(pid, ?) NOT GLOB '*[^0-9]*'`,
+		start, start-1, prefix, start, start-1+maxPersonSequenceDigits, start).Scan(&result)
+
+	return result, err
+}
+
+func (s *sqliteStore) queryPeople(pag paginationData, filter personFilter) (personList, paginationData, error) {
+	log.Debugf("Retrieving all the people")
+
+	if err := pag.validate(); err != nil {
+		return []personRecord{}, paginationData{}, err
+	}
+
+	where := ""
+	args := []interface{}{}
+
+	if filter.Ids.Enabled {
+		where = fmt.Sprintf("WHERE id IN (%s)", sqlPlaceholders(len(filter.Ids.Value)))
+
+		for _, pid := range filter.Ids.Value {
+			args = append(args, pid)
+		}
+	}
+
+	if err := s.q.QueryRow(
+		"SELECT COUNT(*) FROM people "+where, args...).Scan(&pag.TotalCnt); err != nil {
+		return []personRecord{}, paginationData{}, err
+	}
+
+	rows, err := s.q.Query(
+		"SELECT id, given, surname, gender, rev FROM people "+where+" ORDER BY id LIMIT ? OFFSET ?",
+		append(args, pag.PageSize, pag.PageIdx*pag.PageSize)...)
+	if err != nil {
+		return []personRecord{}, paginationData{}, err
+	}
+	defer rows.Close()
+
+	result := personList{}
+
+	for rows.Next() {
+		var p personRecord
+
+		if err := rows.Scan(&p.Id, &p.Given, &p.Surname, &p.Gender, &p.Rev); err != nil {
+			return []personRecord{}, paginationData{}, err
+		}
+
+		result = append(result, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return []personRecord{}, paginationData{}, err
+	}
+
+	return result, pag, nil
+}
+
+func (s *sqliteStore) insertPerson(person personRecord) error {
+	log.Debugf("Inserting person record (%s)", person.Id)
+
+	res, err := s.q.Exec(
+		`INSERT INTO people (id, given, surname, gender, rev) VALUES (?, ?, ?, ?,
+		 (SELECT COALESCE(MAX(rev), 0) + 1 FROM person_history WHERE pid = ?))
+		 ON CONFLICT (id) DO NOTHING`,
+		person.Id, person.Given, person.Surname, person.Gender, person.Id)
+	if err != nil {
+		return err
+	}
+
+	if cnt, err := res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return AppError{
+			errDuplicateFound, fmt.Sprintf("Person record (%s) already exists", person.Id)}
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) updatePerson(person personRecord) error {
+	log.Debugf("Updating person record (%s)", person.Id)
+
+	res, err := s.q.Exec(
+		"UPDATE people SET given = ?, surname = ?, gender = ?, rev = rev + 1 WHERE id = ?",
+		person.Given, person.Surname, person.Gender, person.Id)
+	if err != nil {
+		return err
+	}
+
+	if cnt, err := res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return AppError{
+			errRecordNotFound, fmt.Sprintf("Person record (%s) not found", person.Id)}
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) removePerson(pid string) error {
+	log.Debugf("Removing person record (%s)", pid)
+
+	res, err := s.q.Exec("DELETE FROM people WHERE id = ?", pid)
+	if err != nil {
+		return err
+	}
+
+	if cnt, err := res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return AppError{errRecordNotFound, fmt.Sprintf("Person record (%s) not found", pid)}
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) getGedcomExtensions(pid string) ([]gedcomExtension, error) {
+	log.Debugf("Retrieving the GEDCOM extensions of person (%s)", pid)
+
+	var data string
+
+	err := s.q.QueryRow("SELECT data FROM gedcom_extensions WHERE pid = ?", pid).Scan(&data)
+
+	if err == sql.ErrNoRows {
+		return []gedcomExtension{}, nil
+	} else if err != nil {
+		return []gedcomExtension{}, err
+	}
+
+	extensions := []gedcomExtension{}
+
+	if err := json.Unmarshal([]byte(data), &extensions); err != nil {
+		return []gedcomExtension{}, err
+	}
+
+	return extensions, nil
+}
+
+func (s *sqliteStore) setGedcomExtensions(pid string, extensions []gedcomExtension) error {
+	log.Debugf("Setting %d GEDCOM extension(s) of person (%s)", len(extensions), pid)
+
+	var cnt int
+
+	if err := s.q.QueryRow("SELECT COUNT(*) FROM people WHERE id = ?", pid).Scan(&cnt); err != nil {
+		return err
+	} else if cnt == 0 {
+		return AppError{errRecordNotFound, fmt.Sprintf("Person record (%s) not found", pid)}
+	}
+
+	if len(extensions) == 0 {
+		_, err := s.q.Exec("DELETE FROM gedcom_extensions WHERE pid = ?", pid)
+		return err
+	}
+
+	data, err := json.Marshal(extensions)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.q.Exec(
+		"INSERT OR REPLACE INTO gedcom_extensions (pid, data) VALUES (?, ?)", pid, string(data))
+
+	return err
+}
+
+func (s *sqliteStore) queryGrampsHandles() (map[string]string, error) {
+	log.Debugf("Retrieving the Gramps handles")
+
+	rows, err := s.q.Query("SELECT pid, handle FROM gramps_handles")
+	if err != nil {
+		return map[string]string{}, err
+	}
+	defer rows.Close()
+
+	handles := map[string]string{}
+
+	for rows.Next() {
+		var pid, handle string
+
+		if err := rows.Scan(&pid, &handle); err != nil {
+			return map[string]string{}, err
+		}
+
+		handles[pid] = handle
+	}
+
+	if err := rows.Err(); err != nil {
+		return map[string]string{}, err
+	}
+
+	return handles, nil
+}
+
+func (s *sqliteStore) getGrampsHandle(pid string) (string, error) {
+	log.Debugf("Retrieving the Gramps handle of person (%s)", pid)
+
+	var handle string
+
+	err := s.q.QueryRow("SELECT handle FROM gramps_handles WHERE pid = ?", pid).Scan(&handle)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return handle, err
+}
+
+func (s *sqliteStore) setGrampsHandle(pid string, handle string) error {
+	log.Debugf("Setting the Gramps handle (%s) of person (%s)", handle, pid)
+
+	var cnt int
+
+	if err := s.q.QueryRow("SELECT COUNT(*) FROM people WHERE id = ?", pid).Scan(&cnt); err != nil {
+		return err
+	} else if cnt == 0 {
+		return AppError{errRecordNotFound, fmt.Sprintf("Person record (%s) not found", pid)}
+	}
+
+	if handle == "" {
+		_, err := s.q.Exec("DELETE FROM gramps_handles WHERE pid = ?", pid)
+		return err
+	}
+
+	err := s.q.QueryRow(
+		"SELECT COUNT(*) FROM gramps_handles WHERE handle = ? AND pid != ?", handle, pid).Scan(&cnt)
+	if err != nil {
+		return err
+	} else if cnt > 0 {
+		return AppError{
+			errDuplicateFound, fmt.Sprintf("Gramps handle (%s) is already assigned", handle)}
+	}
+
+	_, err = s.q.Exec(
+		"INSERT OR REPLACE INTO gramps_handles (pid, handle) VALUES (?, ?)", pid, handle)
+
+	return err
+}
+
+func (s *sqliteStore) getInstanceId() (string, error) {
+	log.Debugf("Retrieving the store instance identifier")
+
+	var id string
+
+	err := s.q.QueryRow("SELECT id FROM instance").Scan(&id)
+
+	return id, err
+}
+
+func (s *sqliteStore) queryRelationById(id int64) (relationRecord, bool, error) {
+	log.Debugf("Retrieving relation record by id (%d)", id)
+
+	var r relationRecord
+
+	err := s.q.QueryRow(
+		"SELECT id, pid1, pid2, type, rev FROM relations WHERE id = ?", id).Scan(
+		&r.Id, &r.Pid1, &r.Pid2, &r.Type, &r.Rev)
+
+	if err == sql.ErrNoRows {
+		log.Debugf("Relation record (%d) not found", id)
+
+		return relationRecord{}, false, nil
+	} else if err != nil {
+		return relationRecord{}, false, err
+	}
+
+	return r, true, nil
+}
+
+/* Query relation records using the given SQL query and arguments
+
+   The query must select the id, pid1, pid2, type, and rev columns (in this order) */
+func (s *sqliteStore) queryRelations(query string, args ...interface{}) (relationList, error) {
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := relationList{}
+
+	for rows.Next() {
+		var r relationRecord
+
+		if err := rows.Scan(&r.Id, &r.Pid1, &r.Pid2, &r.Type, &r.Rev); err != nil {
+			return nil, err
+		}
+
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
+
+func (s *sqliteStore) queryRelationsByPerson(pid string, pag paginationData) (relationList, paginationData, error) {
+	log.Debugf("Retrieving all the relations of the given person (%s)", pid)
+
+	if err := pag.validate(); err != nil {
+		return []relationRecord{}, paginationData{}, err
+	}
+
+	// The conditions are added only when needed, so that the query planner can use the indexes:
+	where := ""
+	args := []interface{}{}
+
+	if pid != "" {
+		where = "WHERE pid1 = ? OR pid2 = ?"
+		args = append(args, pid, pid)
+	}
+
+	if err := s.q.QueryRow(
+		"SELECT COUNT(*) FROM relations "+where, args...).Scan(&pag.TotalCnt); err != nil {
+		return []relationRecord{}, paginationData{}, err
+	}
+
+	result, err := s.queryRelations(
+		"SELECT id, pid1, pid2, type, rev FROM relations "+where+" ORDER BY id LIMIT ? OFFSET ?",
+		append(args, pag.PageSize, pag.PageIdx*pag.PageSize)...)
+	if err != nil {
+		return []relationRecord{}, paginationData{}, err
+	}
+
+	return result, pag, nil
+}
+
+func (s *sqliteStore) queryRelationsByData(pid1 string, typ string, pid2 string) ([]relationRecord, error) {
+	log.Debugf("Looking for matching relations (%s, %s, %s)", pid1, typ, pid2)
+
+	// The conditions are added only when needed, so that the query planner can use the indexes:
+	conds := []string{}
+	args := []interface{}{}
+
+	for _, attr := range []struct{ column, value string }{
+		{"pid1", pid1}, {"type", typ}, {"pid2", pid2}} {
+		if attr.value != "" {
+			conds = append(conds, attr.column+" = ?")
+			args = append(args, attr.value)
+		}
+	}
+
+	where := ""
+
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	result, err := s.queryRelations(
+		"SELECT id, pid1, pid2, type, rev FROM relations "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Found %d matching relations", len(result))
+
+	return result, nil
+}
+
+func (s *sqliteStore) insertRelation(relation relationRecord) error {
+	log.Debugf("Inserting relation record (%d)", relation.Id)
+
+	res, err := s.q.Exec(
+		`INSERT INTO relations (id, pid1, pid2, type, rev) VALUES (?, ?, ?, ?,
+		 (SELECT COALESCE(MAX(rev), 0) + 1 FROM relation_history WHERE rid = ?))
+		 ON CONFLICT (id) DO NOTHING`,
+		relation.Id, relation.Pid1, relation.Pid2, relation.Type, relation.Id)
+	if err != nil {
+		return err
+	}
+
+	if cnt, err := res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return AppError{
+			errDuplicateFound, fmt.Sprintf("Relation record (%d) already exists", relation.Id)}
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) updateRelation(relation relationRecord) error {
+	log.Debugf("Updating relation record (%d)", relation.Id)
+
+	res, err := s.q.Exec(
+		"UPDATE relations SET pid1 = ?, pid2 = ?, type = ?, rev = rev + 1 WHERE id = ?",
+		relation.Pid1, relation.Pid2, relation.Type, relation.Id)
+	if err != nil {
+		return err
+	}
+
+	if cnt, err := res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return AppError{
+			errRecordNotFound, fmt.Sprintf("Relation record (%d) not found", relation.Id)}
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) removeRelation(id int64) error {
+	log.Debugf("Removing relation record (%d)", id)
+
+	res, err := s.q.Exec("DELETE FROM relations WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if cnt, err := res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return AppError{errRecordNotFound, fmt.Sprintf("Relation record (%d) not found", id)}
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) deleteRelationsByPerson(pid string) (int64, error) {
+	log.Debugf("Deleting all the relations of the given person (%s)", pid)
+
+	res, err := s.q.Exec("DELETE FROM relations WHERE pid1 = ? OR pid2 = ?", pid, pid)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+/* Parse the revision time stored by the history triggers */
+func parseSqliteTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func (s *sqliteStore) queryPersonHistory(pid string) ([]personRevision, error) {
+	log.Debugf("Retrieving the person record (%s) history", pid)
+
+	rows, err := s.q.Query(
+		`SELECT pid, rev, time, op, given, surname, gender FROM person_history
+		 WHERE pid = ? ORDER BY rev`, pid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []personRevision{}
+
+	for rows.Next() {
+		var rev personRevision
+		var tm string
+
+		if err := rows.Scan(
+			&rev.Person.Id, &rev.Person.Rev, &tm, &rev.Op,
+			&rev.Person.Given, &rev.Person.Surname, &rev.Person.Gender); err != nil {
+			return nil, err
+		}
+
+		if rev.Time, err = parseSqliteTime(tm); err != nil {
+			return nil, err
+		}
+
+		result = append(result, rev)
+	}
+
+	return result, rows.Err()
+}
+
+func (s *sqliteStore) queryRelationHistory(id int64) ([]relationRevision, error) {
+	log.Debugf("Retrieving the relation record (%d) history", id)
+
+	rows, err := s.q.Query(
+		`SELECT rid, rev, time, op, pid1, pid2, type FROM relation_history
+		 WHERE rid = ? ORDER BY rev`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []relationRevision{}
+
+	for rows.Next() {
+		var rev relationRevision
+		var tm string
+
+		if err := rows.Scan(
+			&rev.Relation.Id, &rev.Relation.Rev, &tm, &rev.Op,
+			&rev.Relation.Pid1, &rev.Relation.Pid2, &rev.Relation.Type); err != nil {
+			return nil, err
+		}
+
+		if rev.Time, err = parseSqliteTime(tm); err != nil {
+			return nil, err
+		}
+
+		result = append(result, rev)
+	}
+
+	return result, rows.Err()
+}
+
+/* Format a time the same way the database formats the timestamps (so that they can be compared) */
+func formatSqliteTime(value time.Time) string {
+	return value.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func (s *sqliteStore) insertTrash(item trashRecord) (int64, error) {
+	log.Debugf("Inserting trash item")
+
+	var person []byte
+
+	if item.Person != nil {
+		var err error
+
+		if person, err = json.Marshal(item.Person); err != nil {
+			return 0, err
+		}
+	}
+
+	relations, err := json.Marshal(item.Relations)
+	if err != nil {
+		return 0, err
+	}
+
+	var extensions []byte
+
+	if len(item.GedcomExtensions) > 0 {
+		if extensions, err = json.Marshal(item.GedcomExtensions); err != nil {
+			return 0, err
+		}
+	}
+
+	var handle *string
+
+	if item.GrampsHandle != "" {
+		handle = &item.GrampsHandle
+	}
+
+	// A nil byte slice (or pointer) is stored as NULL:
+	res, err := s.q.Exec(
+		"INSERT INTO trash (person, relations, gedcom_extensions, gramps_handle) "+
+			"VALUES (?, ?, ?, ?)",
+		person, string(relations), extensions, handle)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+/* Scan a trash row (the id, time, person, relations, gedcom_extensions, and gramps_handle
+   columns) */
+func scanTrash(scan func(dest ...interface{}) error) (trashRecord, error) {
+	var item trashRecord
+	var tm string
+	var person sql.NullString
+	var relations string
+	var extensions sql.NullString
+	var handle sql.NullString
+
+	if err := scan(&item.Id, &tm, &person, &relations, &extensions, &handle); err != nil {
+		return trashRecord{}, err
+	}
+
+	var err error
+
+	if item.Time, err = parseSqliteTime(tm); err != nil {
+		return trashRecord{}, err
+	}
+
+	if person.Valid {
+		item.Person = &personRecord{}
+
+		if err := json.Unmarshal([]byte(person.String), item.Person); err != nil {
+			return trashRecord{}, err
+		}
+	}
+
+	if err := json.Unmarshal([]byte(relations), &item.Relations); err != nil {
+		return trashRecord{}, err
+	}
+
+	if extensions.Valid {
+		if err := json.Unmarshal([]byte(extensions.String), &item.GedcomExtensions); err != nil {
+			return trashRecord{}, err
+		}
+	}
+
+	item.GrampsHandle = handle.String
+
+	return item, nil
+}
+
+func (s *sqliteStore) getTrash(id int64) (trashRecord, bool, error) {
+	log.Debugf("Retrieving trash item by id (%d)", id)
+
+	item, err := scanTrash(s.q.QueryRow(
+		"SELECT id, time, person, relations, gedcom_extensions, gramps_handle FROM trash "+
+			"WHERE id = ?", id).Scan)
+
+	if err == sql.ErrNoRows {
+		log.Debugf("Trash item (%d) not found", id)
+
+		return trashRecord{}, false, nil
+	} else if err != nil {
+		return trashRecord{}, false, err
+	}
+
+	return item, true, nil
+}
+
+func (s *sqliteStore) queryTrash(pag paginationData) (trashList, paginationData, error) {
+	log.Debugf("Retrieving the trash items")
+
+	if err := pag.validate(); err != nil {
+		return trashList{}, paginationData{}, err
+	}
+
+	if err := s.q.QueryRow("SELECT COUNT(*) FROM trash").Scan(&pag.TotalCnt); err != nil {
+		return trashList{}, paginationData{}, err
+	}
+
+	rows, err := s.q.Query(
+		"SELECT id, time, person, relations, gedcom_extensions, gramps_handle FROM trash "+
+			"ORDER BY id LIMIT ? OFFSET ?",
+		pag.PageSize, pag.PageIdx*pag.PageSize)
+	if err != nil {
+		return trashList{}, paginationData{}, err
+	}
+	defer rows.Close()
+
+	result := trashList{}
+
+	for rows.Next() {
+		item, err := scanTrash(rows.Scan)
+		if err != nil {
+			return trashList{}, paginationData{}, err
+		}
+
+		result = append(result, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return trashList{}, paginationData{}, err
+	}
+
+	return result, pag, nil
+}
+
+func (s *sqliteStore) removeTrash(id int64) error {
+	log.Debugf("Removing trash item (%d)", id)
+
+	res, err := s.q.Exec("DELETE FROM trash WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if cnt, err := res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return AppError{errRecordNotFound, fmt.Sprintf("Trash item (%d) not found", id)}
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) purgeTrash(before time.Time) (int64, error) {
+	log.Debugf("Purging the trash items deleted before %s", before)
+
+	res, err := s.q.Exec("DELETE FROM trash WHERE time < ?", formatSqliteTime(before))
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
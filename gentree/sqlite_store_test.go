@@ -0,0 +1,399 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+/* Open an SQLite store backed by a database file placed in a temporary directory
+
+   The store is closed automatically at the end of the test */
+func testOpenSqliteStore(t *testing.T, path string) *sqliteStore {
+	store, err := openSqliteStore(path)
+	require.Nil(t, err)
+
+	t.Cleanup(func() { store.close() })
+
+	return store
+}
+
+/* Test the database schema migration
+
+   1. All the migrations are applied to a new database
+   2. Re-opening an up to date database doesn't fail
+   3. A database with a schema newer than the supported one is rejected */
+func TestSqliteStoreMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gentree.db")
+
+	// Case 1: New database
+
+	store := testOpenSqliteStore(t, path)
+
+	var version int
+	require.Nil(t, store.db.QueryRow("PRAGMA user_version").Scan(&version))
+	assert.Equal(t, len(sqliteMigrations), version)
+
+	store.close()
+
+	// Case 2: Up to date database
+
+	store = testOpenSqliteStore(t, path)
+
+	require.Nil(t, store.db.QueryRow("PRAGMA user_version").Scan(&version))
+	assert.Equal(t, len(sqliteMigrations), version)
+
+	_, err := store.db.Exec("PRAGMA user_version = 1000")
+	require.Nil(t, err)
+
+	store.close()
+
+	// Case 3: Database newer than supported
+
+	_, err = openSqliteStore(path)
+
+	assert.Equal(t, errInvalidArgument, err.(AppError).Code)
+}
+
+/* Test the person and relation records handling of the SQLite store
+
+   1. Records are stored and retrieved
+   2. Duplicated records are rejected
+   3. Relations referring to missing people and records violating the column constraints are
+      rejected (the errors aren't reported as duplicates)
+   4. Records are updated and the missing ones reported
+   5. Records are queried with pagination
+   6. Records survive closing and re-opening the database
+   7. Records are removed */
+func TestSqliteStoreRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gentree.db")
+
+	store := testOpenSqliteStore(t, path)
+
+	// Case 1: Store and retrieve
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P3", "Adam", "Kowalski", gMale, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{5, "P1", "P3", relFather, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{3, "P2", "P3", relMother, 0}))
+
+	person, found, err := store.getPerson("P2")
+
+	assert.True(t, found)
+	assert.Nil(t, err)
+	assert.Equal(t, personRecord{"P2", "Anna", "Nowak", gFemale, 1}, person)
+
+	_, found, err = store.getPerson("P4")
+
+	assert.False(t, found)
+	assert.Nil(t, err)
+
+	relation, found, err := store.queryRelationById(5)
+
+	assert.True(t, found)
+	assert.Nil(t, err)
+	assert.Equal(t, relationRecord{5, "P1", "P3", relFather, 1}, relation)
+
+	list, err := store.queryRelationsByData("", relMother, "P3")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []relationRecord{{3, "P2", "P3", relMother, 1}}, list)
+
+	// Case 2: Duplicates
+
+	err = store.insertPerson(personRecord{"P1", "Janina", "Kowalska", gFemale, 0})
+
+	assert.Equal(t, errDuplicateFound, err.(AppError).Code)
+
+	err = store.insertRelation(relationRecord{5, "P2", "P3", relMother, 0})
+
+	assert.Equal(t, errDuplicateFound, err.(AppError).Code)
+
+	// Case 3: Foreign keys and column constraints
+
+	assert.NotNil(t, store.insertRelation(relationRecord{6, "P1", "P9", relFather, 0}))
+	assert.NotNil(t, store.removePerson("P1"))
+
+	err = store.insertPerson(personRecord{"P4", "Ewa", "Kowalska", "other", 0})
+
+	assert.NotNil(t, err)
+	assert.False(t, isAppError(err, errDuplicateFound))
+
+	err = store.insertRelation(relationRecord{6, "P1", "P3", "uncle", 0})
+
+	assert.NotNil(t, err)
+	assert.False(t, isAppError(err, errDuplicateFound))
+
+	// Case 4: Update
+
+	require.Nil(t, store.updatePerson(personRecord{"P2", "Anna Maria", "Nowak", gFemale, 0}))
+
+	err = store.updatePerson(personRecord{"P9", "", "", gUnknown, 0})
+
+	assert.Equal(t, errRecordNotFound, err.(AppError).Code)
+
+	require.Nil(t, store.updateRelation(relationRecord{5, "P1", "P2", relHusband, 0}))
+
+	err = store.updateRelation(relationRecord{9, "P1", "P2", relHusband, 0})
+
+	assert.Equal(t, errRecordNotFound, err.(AppError).Code)
+
+	// Case 5: Pagination
+
+	people, pagResult, err := store.queryPeople(
+		paginationData{PageIdx: 1, PageSize: 2, minPageSize: 1, maxPageSize: 10}, personFilter{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, pagResult.TotalCnt)
+	assert.Equal(t, personList{{"P3", "Adam", "Kowalski", gMale, 1}}, people)
+
+	people, pagResult, err = store.queryPeople(
+		paginationData{PageIdx: 0, PageSize: 2, minPageSize: 1, maxPageSize: 10},
+		personFilter{personIdsFilter{[]string{"P3", "P2", "P7"}, true}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, pagResult.TotalCnt)
+	assert.Len(t, people, 2)
+	assert.Equal(t, "P2", people[0].Id)
+	assert.Equal(t, "P3", people[1].Id)
+
+	relations, pagResult, err := store.queryRelationsByPerson(
+		"P3", paginationData{PageIdx: 0, PageSize: 10, minPageSize: 1, maxPageSize: 10})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, pagResult.TotalCnt)
+	assert.Equal(t, relationList{{3, "P2", "P3", relMother, 1}}, relations)
+
+	relations, pagResult, err = store.queryRelationsByPerson(
+		"", paginationData{PageIdx: 0, PageSize: 10, minPageSize: 1, maxPageSize: 10})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, pagResult.TotalCnt)
+	assert.Equal(t, relationList{{3, "P2", "P3", relMother, 1}, {5, "P1", "P2", relHusband, 2}}, relations)
+
+	// Case 6: Persistence
+
+	store.close()
+	store = testOpenSqliteStore(t, path)
+
+	person, found, err = store.getPerson("P2")
+
+	assert.True(t, found)
+	assert.Nil(t, err)
+	assert.Equal(t, personRecord{"P2", "Anna Maria", "Nowak", gFemale, 2}, person)
+
+	// Case 7: Removal
+
+	cnt, err := store.deleteRelationsByPerson("P2")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), cnt)
+
+	require.Nil(t, store.removePerson("P2"))
+
+	err = store.removePerson("P2")
+
+	assert.Equal(t, errRecordNotFound, err.(AppError).Code)
+
+	err = store.removeRelation(5)
+
+	assert.Equal(t, errRecordNotFound, err.(AppError).Code)
+
+	var rowCnt int
+	require.Nil(t, store.db.QueryRow("SELECT COUNT(*) FROM relations").Scan(&rowCnt))
+	assert.Equal(t, 0, rowCnt)
+}
+
+/* Test if the request handlers work with the SQLite store
+
+   1. Create two people and a relation between them
+   2. Delete one of the people together with the relation */
+func TestSqliteStoreRequests(t *testing.T) {
+	store := testOpenSqliteStore(t, filepath.Join(t.TempDir(), "gentree.db"))
+	router := setupRouter(store)
+
+	// Case 1: Create
+
+	res := testMakeRequest(router, "POST", "/people", testJsonBody(t, testPersonJson{
+		Id: "A", Given: "Jerzy", Surname: "Zieliński", Gender: gMale}))
+
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	res = testMakeRequest(router, "POST", "/people", testJsonBody(t, testPersonJson{
+		Id: "B", Given: "Wanda", Surname: "Zielińska", Gender: gFemale}))
+
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	res = testMakeRequest(router, "POST", "/people/A/relations", testJsonBody(t, testItRelationJson{
+		Pid: "B", Type: relFather}))
+
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	rid := testRelationIdRes(t, res).RelationId
+
+	res = testMakeRequest(router, "GET", "/people/A/relations", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	resData := testRelationListRes(t, res)
+
+	assert.Len(t, resData.Records, 1)
+	assert.Equal(t, rid, resData.Records[0].Id)
+
+	// Case 2: Delete
+
+	res = testMakeRequest(router, "DELETE", "/people/A", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	_, found, err := store.queryRelationById(rid)
+
+	assert.False(t, found)
+	assert.Nil(t, err)
+
+	var cnt int
+	require.Nil(t, store.db.QueryRow("SELECT COUNT(*) FROM people").Scan(&cnt))
+	assert.Equal(t, 1, cnt)
+}
+
+/* Test the GEDCOM extensions handling of the SQLite store
+
+   1. Extensions are stored, replaced and retrieved
+   2. Extensions of a missing person are rejected
+   3. An update failure reverts the extension modification
+   4. Extensions are removed together with the person */
+func TestSqliteStoreGedcomExtensions(t *testing.T) {
+	store := testOpenSqliteStore(t, filepath.Join(t.TempDir(), "gentree.db"))
+
+	extensions := []gedcomExtension{
+		{"", gedcomLine{Level: 1, Tag: "_UID", Value: "ABC"}},
+		{"https://example.com/note", gedcomLine{Level: 1, Tag: "_NOTE", Value: "Line 1\nLine 2"}},
+	}
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+
+	// Case 1: Store and retrieve
+
+	stored, err := store.getGedcomExtensions("P1")
+
+	assert.Nil(t, err)
+	assert.Empty(t, stored)
+
+	require.Nil(t, store.setGedcomExtensions("P1", extensions[:1]))
+	require.Nil(t, store.setGedcomExtensions("P1", extensions))
+
+	stored, err = store.getGedcomExtensions("P1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, extensions, stored)
+
+	// Case 2: Missing person
+
+	err = store.setGedcomExtensions("P2", extensions)
+
+	assert.True(t, isAppError(err, errRecordNotFound))
+
+	// Case 3: Update failure
+
+	err = store.update(func(tx Store) error {
+		require.Nil(t, tx.setGedcomExtensions("P1", []gedcomExtension{}))
+
+		return AppError{errConflict, "Test failure"}
+	})
+
+	assert.True(t, isAppError(err, errConflict))
+
+	stored, err = store.getGedcomExtensions("P1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, extensions, stored)
+
+	// Case 4: Person removal
+
+	require.Nil(t, store.removePerson("P1"))
+
+	var cnt int
+	require.Nil(t, store.db.QueryRow("SELECT COUNT(*) FROM gedcom_extensions").Scan(&cnt))
+	assert.Equal(t, 0, cnt)
+}
+
+/* Test the Gramps handles handling of the SQLite store
+
+   1. Handles are assigned and retrieved
+   2. A handle assigned to another person is rejected
+   3. Handles are removed together with the people */
+func TestSqliteStoreGrampsHandles(t *testing.T) {
+	store := testOpenSqliteStore(t, filepath.Join(t.TempDir(), "gentree.db"))
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+
+	// Case 1: Assign and retrieve
+
+	require.Nil(t, store.setGrampsHandle("P1", "_a1"))
+	require.Nil(t, store.setGrampsHandle("P2", "_b1"))
+	require.Nil(t, store.setGrampsHandle("P2", "_b2"))
+
+	handles, err := store.queryGrampsHandles()
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"P1": "_a1", "P2": "_b2"}, handles)
+
+	// Case 2: Duplicate handle
+
+	err = store.setGrampsHandle("P2", "_a1")
+
+	assert.True(t, isAppError(err, errDuplicateFound))
+
+	err = store.setGrampsHandle("P3", "_c1")
+
+	assert.True(t, isAppError(err, errRecordNotFound))
+
+	// Case 3: Person removal
+
+	require.Nil(t, store.removePerson("P1"))
+
+	handles, err = store.queryGrampsHandles()
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"P2": "_b2"}, handles)
+}
+
+/* Test if the store instance identifier survives re-opening the database
+
+   1. A new database gets an instance identifier
+   2. The identifier doesn't change when the database is re-opened
+   3. Another database gets another identifier */
+func TestSqliteStoreInstanceId(t *testing.T) {
+	dir := t.TempDir()
+
+	// Case 1: New database
+
+	store := testOpenSqliteStore(t, filepath.Join(dir, "gentree.db"))
+
+	id, err := store.getInstanceId()
+
+	require.Nil(t, err)
+	assert.Len(t, id, 32)
+
+	// Case 2: Re-opened database
+
+	store.close()
+
+	store = testOpenSqliteStore(t, filepath.Join(dir, "gentree.db"))
+
+	reopened, err := store.getInstanceId()
+
+	assert.Nil(t, err)
+	assert.Equal(t, id, reopened)
+
+	// Case 3: Another database
+
+	other, err := testOpenSqliteStore(t, filepath.Join(dir, "other.db")).getInstanceId()
+
+	assert.Nil(t, err)
+	assert.NotEqual(t, id, other)
+}
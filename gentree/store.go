@@ -0,0 +1,424 @@
+package main
+
+/* This file defines the storage backend interface used by the request handlers and the in-memory
+   implementation of the interface */
+
+import (
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+/* Storage backend interface
+
+   The request handlers never access the data directly. Instead, they retrieve the store assigned
+   to the router (see the getStore function) and communicate with it using the methods below.
+
+   Design Assumptions:
+   * The store methods don't validate the records (e.g. the relation consistency); it is the
+     responsibility of the caller (see the validateRelation function)
+   * The "not found" case is not an error; the query methods return a success flag instead
+   * A single method call is atomic, but a sequence of calls isn't (another request may modify the
+     data in between); sequences of the check-then-act kind must be run using the update method,
+     and sequences of queries needing a consistent state using the view method */
+type Store interface {
+	/* Run the given function with exclusive access to the store
+
+	   The function must access the data only using the store passed as its parameter. No other
+	   modification can interleave with the ones performed by the function.
+
+	   Return:
+	   * error returned by the function or an error of the store itself (nil otherwise) */
+	update(fn func(tx Store) error) error
+
+	/* Run the given function with a consistent read-only view of the store
+
+	   The function must access the data only using the store passed as its parameter and must
+	   not modify it. No modification can interleave with the queries performed by the function,
+	   but other views may run concurrently.
+
+	   Return:
+	   * error returned by the function or an error of the store itself (nil otherwise) */
+	view(fn func(tx Store) error) error
+
+	/* Retrieve a person record by id
+
+	   Returns:
+	   * person record structure (uninitialized if not found)
+	   * success flag (true if the record was found and false otherwise)
+	   * error (if occurred) */
+	getPerson(pid string) (personRecord, bool, error)
+
+	/* Query person records
+
+	   Params:
+	   * pag - pagination data specifying the range of records to be returned
+	   * filter - record filter specification
+
+	   Return:
+	   * slice of person records (empty if an error occurred)
+	   * updated pagination data (empty if an error occurred; copy of the pag parameter with the
+	     total record count field updated otherwise)
+	   * error (if occurred and nil otherwise) */
+	queryPeople(pag paginationData, filter personFilter) (personList, paginationData, error)
+
+	/* Find the greatest sequence number used by the person ids of the given prefix
+
+	   Only the ids consisting of the prefix followed by digits (at most maxPersonSequenceDigits)
+	   are considered. The deleted people are included (see personIdGenerator).
+
+	   Return:
+	   * the greatest sequence number (0 if no id matches)
+	   * error (if occurred and nil otherwise) */
+	maxPersonSequence(prefix string) (int64, error)
+
+	/* Store a new person record (the record identifier must not be used yet)
+
+	   The store sets the record revision to the one following the last revision in the record
+	   history (1 for a record that never existed before) */
+	insertPerson(person personRecord) error
+
+	/* Overwrite an existing person record (identified by the record Id field)
+
+	   The store increments the record revision */
+	updatePerson(person personRecord) error
+
+	/* Remove a person record
+
+	   The relations of the person are not touched (see deleteRelationsByPerson). The GEDCOM
+	   extensions and the Gramps handle of the person are removed together with the record. */
+	removePerson(pid string) error
+
+	/* Retrieve the GEDCOM extension structures preserved for a person by the GEDCOM import
+
+	   Return:
+	   * slice of the extension structures in the original order (empty if there are none)
+	   * error (if occurred and nil otherwise) */
+	getGedcomExtensions(pid string) ([]gedcomExtension, error)
+
+	/* Replace the GEDCOM extension structures of a person (an empty slice removes them)
+
+	   Return:
+	   * error (AppError with the errRecordNotFound code if the person doesn't exist, other error
+	     if occurred, and nil otherwise) */
+	setGedcomExtensions(pid string, extensions []gedcomExtension) error
+
+	/* Query the Gramps handles assigned to the people by the Gramps import
+
+	   Return:
+	   * the handles keyed by the person ids (empty if there are none)
+	   * error (if occurred and nil otherwise) */
+	queryGrampsHandles() (map[string]string, error)
+
+	/* Retrieve the Gramps handle assigned to a person
+
+	   Return:
+	   * the handle (empty if the person has none)
+	   * error (if occurred and nil otherwise) */
+	getGrampsHandle(pid string) (string, error)
+
+	/* Assign a Gramps handle to a person (an empty handle removes the assignment)
+
+	   Return:
+	   * error (AppError with the errRecordNotFound code if the person doesn't exist, AppError with
+	     the errDuplicateFound code if the handle is assigned to another person, other error if
+	     occurred, and nil otherwise) */
+	setGrampsHandle(pid string, handle string) error
+
+	/* Retrieve the identifier of the store instance
+
+	   The identifier is random and assigned when the store is created. The persistent stores keep
+	   it, so it doesn't change when the server restarts. It tells apart the data exported by
+	   different stores (see grampsExportHandlePrefix).
+
+	   Return:
+	   * the instance identifier
+	   * error (if occurred and nil otherwise) */
+	getInstanceId() (string, error)
+
+	/* Query a relation record by relation id
+
+	   Returns:
+	   * relation record (uninitialized if not found or when an error occurred)
+	   * success flag (true if the relation was found and false otherwise)
+	   * error (if occurred and nil otherwise) */
+	queryRelationById(id int64) (relationRecord, bool, error)
+
+	/* Query all the relation records associated with the given person
+
+	   All the existing records are returned if the person identifier is an empty string
+
+	   Params:
+	   * pid - the person identifier (ignored if it is an empty string)
+	   * pag - pagination data specifying the range of records to be returned
+
+	   Return:
+	   * slice of relation records (empty if an error occurred)
+	   * updated pagination data (empty if an error occurred; copy of the pag parameter with the
+	     total record count field updated otherwise)
+	   * error (if occurred and nil otherwise) */
+	queryRelationsByPerson(pid string, pag paginationData) (relationList, paginationData, error)
+
+	/* Query all the relation records matching the given attributes
+
+	   Empty attribute values match any value */
+	queryRelationsByData(pid1 string, typ string, pid2 string) ([]relationRecord, error)
+
+	/* Store a new relation record (the record identifier must be obtained from a
+	   relationIdGenerator)
+
+	   The store sets the record revision to the one following the last revision in the record
+	   history (1 for a record that never existed before) */
+	insertRelation(relation relationRecord) error
+
+	/* Overwrite an existing relation record (identified by the record Id field)
+
+	   The store increments the record revision */
+	updateRelation(relation relationRecord) error
+
+	// Remove a relation record
+	removeRelation(id int64) error
+
+	/* Delete all the relation records associated with the given person
+
+	   Return:
+	   * number of deleted records
+	   * error (if occurred and nil otherwise) */
+	deleteRelationsByPerson(pid string) (int64, error)
+
+	/* Query the revision history of a person record
+
+	   Every modification of the record (including its deletion) is recorded as a new revision.
+	   The history of a deleted record is kept.
+
+	   Return:
+	   * slice of revisions, oldest first (empty if the record never existed)
+	   * error (if occurred and nil otherwise) */
+	queryPersonHistory(pid string) ([]personRevision, error)
+
+	// Query the revision history of a relation record (see queryPersonHistory)
+	queryRelationHistory(id int64) ([]relationRevision, error)
+
+	/* Store a new trash item (see trashPerson and trashRelation)
+
+	   The store assigns the item identifier (greater than the identifiers of all the items
+	   inserted before) and the deletion time
+
+	   Return:
+	   * identifier of the new item
+	   * error (if occurred and nil otherwise) */
+	insertTrash(item trashRecord) (int64, error)
+
+	/* Retrieve a trash item by id
+
+	   Returns:
+	   * trash item (uninitialized if not found)
+	   * success flag (true if the item was found and false otherwise)
+	   * error (if occurred and nil otherwise) */
+	getTrash(id int64) (trashRecord, bool, error)
+
+	/* Query trash items ordered by id
+
+	   Params:
+	   * pag - pagination data specifying the range of items to be returned
+
+	   Return:
+	   * slice of trash items (empty if an error occurred)
+	   * updated pagination data (empty if an error occurred; copy of the pag parameter with the
+	     total item count field updated otherwise)
+	   * error (if occurred and nil otherwise) */
+	queryTrash(pag paginationData) (trashList, paginationData, error)
+
+	// Remove a trash item (the records of the item are not restored)
+	removeTrash(id int64) error
+
+	/* Remove all the trash items deleted before the given time
+
+	   Return:
+	   * number of removed items
+	   * error (if occurred and nil otherwise) */
+	purgeTrash(before time.Time) (int64, error)
+}
+
+// The gin context key under which the store is available to the request handlers
+const storeCtxKey = "gentree.store"
+
+/* Create a middleware making the given store available to the request handlers
+
+   The handlers retrieve the store using the getStore function */
+func storeMiddleware(store Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(storeCtxKey, store)
+		c.Next()
+	}
+}
+
+/* Retrieve the store assigned to the request context by the store middleware
+
+   The function panics if the middleware is not installed (it is a programming error) */
+func getStore(c *gin.Context) Store {
+	return c.MustGet(storeCtxKey).(Store)
+}
+
+/* In-memory implementation of the Store interface
+
+   The data is lost when the server process exits. The store isn't safe for concurrent use; it
+   must be wrapped with the lockingStore decorator when used by the router. */
+type memoryStore struct {
+	people    map[string]personRecord
+	relations map[int64]relationRecord
+	// Person ids in the increasing order (see putPerson and dropPerson)
+	personIds *orderedIndex[string]
+	// Secondary indexes of the relations (see putRelation and dropRelation)
+	relationIdx *relationIndex
+
+	// Revision histories of the records (including the deleted ones)
+	personHistory   map[string][]personRevision
+	relationHistory map[int64][]relationRevision
+	// Time of the modifications recorded in the histories (the current time is used if zero)
+	timestamp time.Time
+
+	trash map[int64]trashRecord
+	// Identifier of the last inserted trash item (the removed items included)
+	lastTrashId int64
+
+	// GEDCOM extension structures keyed by the person ids
+	gedcomExtensions map[string][]gedcomExtension
+	// Gramps handles keyed by the person ids
+	grampsHandles map[string]string
+	// Person ids keyed by the Gramps handles (the reverse of grampsHandles)
+	grampsPids map[string]string
+	// Identifier of the store instance (see newStoreInstanceId)
+	instanceId string
+
+	// Set while the update method runs
+	updating bool
+	// Actions reverting the modifications made by the running update method (in order)
+	undoLog []func()
+}
+
+/* Run the given function with the store itself
+
+   The in-memory store isn't safe for concurrent use (see lockingStore), so there is nothing to
+   synchronize here. If the function fails, all the modifications it made are reverted. Nested
+   calls are a part of the outermost call. */
+func (s *memoryStore) update(fn func(tx Store) error) error {
+	if s.updating {
+		return fn(s)
+	}
+
+	s.updating = true
+
+	err := fn(s)
+
+	s.updating = false
+
+	if err != nil {
+		log.Debugf("Reverting %d modification(s) of the failed update", len(s.undoLog))
+
+		for i := len(s.undoLog) - 1; i >= 0; i-- {
+			s.undoLog[i]()
+		}
+	}
+
+	s.undoLog = nil
+
+	return err
+}
+
+/* Run the given function with the store itself
+
+   The in-memory store isn't safe for concurrent use (see lockingStore), so there is nothing to
+   synchronize here */
+func (s *memoryStore) view(fn func(tx Store) error) error {
+	return fn(s)
+}
+
+/* Record an action reverting a modification (only if the update method runs)
+
+   The undo actions restore the records directly (bypassing the store methods), so that the record
+   revisions are restored as well */
+func (s *memoryStore) onUndo(action func()) {
+	if s.updating {
+		s.undoLog = append(s.undoLog, action)
+	}
+}
+
+/* Create an in-memory store
+
+   Params:
+   * people - initial person records keyed by the person id (nil stands for an empty map)
+   * relations - initial relation records keyed by the relation id (nil stands for an empty map)
+
+   The store takes ownership of the maps passed as the parameters. The initial records have no
+   revision history. */
+func newMemoryStore(people map[string]personRecord, relations map[int64]relationRecord) *memoryStore {
+	if people == nil {
+		people = map[string]personRecord{}
+	}
+
+	if relations == nil {
+		relations = map[int64]relationRecord{}
+	}
+
+	pids := make([]string, 0, len(people))
+
+	for pid := range people {
+		pids = append(pids, pid)
+	}
+
+	return &memoryStore{
+		people:           people,
+		relations:        relations,
+		personIds:        newOrderedIndex(pids),
+		relationIdx:      newRelationIndex(relations),
+		personHistory:    map[string][]personRevision{},
+		relationHistory:  map[int64][]relationRevision{},
+		trash:            map[int64]trashRecord{},
+		gedcomExtensions: map[string][]gedcomExtension{},
+		grampsHandles:    map[string]string{},
+		grampsPids:       map[string]string{},
+		instanceId:       newStoreInstanceId(),
+	}
+}
+
+/* Generate a store instance identifier (32 random hexadecimal digits) */
+func newStoreInstanceId() string {
+	id := uuid.New()
+
+	return hex.EncodeToString(id[:])
+}
+
+func (s *memoryStore) getInstanceId() (string, error) {
+	return s.instanceId, nil
+}
+
+/* Create the store selected by the command line arguments
+
+   Return:
+   * the store (nil if an error occurred)
+   * error (if occurred and nil otherwise) */
+func openStore(args AppArgs) (Store, error) {
+	if args.DbPath != "" {
+		log.Infof("Using the SQLite store (%s)", args.DbPath)
+
+		return openSqliteStore(args.DbPath)
+	}
+
+	if args.JournalPath != "" {
+		log.Infof("Using the journal store (%s)", args.JournalPath)
+
+		store, err := openJournalStore(args.JournalPath, args.JournalCompactInterval)
+		if err != nil {
+			return nil, err
+		}
+
+		return newLockingStore(store), nil
+	}
+
+	log.Info("Using the in-memory store")
+
+	return newLockingStore(newMemoryStore(nil, nil)), nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+/* Test the person record modification methods of the in-memory store
+
+   1. Insert a new person record
+   2. Attempt to insert an already existing person record
+   3. Update an existing person record
+   4. Attempt to update a missing person record
+   5. Remove an existing person record
+   6. Attempt to remove a missing person record */
+func TestMemoryStorePersonModification(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+
+	// Case 1: Insert a new record
+
+	err := store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0})
+
+	assert.Nil(t, err)
+	assert.Len(t, store.people, 1)
+	assert.Equal(t, "Jan", store.people["P1"].Given)
+
+	// Case 2: Insert an existing record
+
+	err = store.insertPerson(personRecord{"P1", "Janina", "Kowalska", gFemale, 0})
+
+	assert.Equal(t, errDuplicateFound, err.(AppError).Code)
+	assert.Equal(t, "Jan", store.people["P1"].Given)
+
+	// Case 3: Update an existing record
+
+	err = store.updatePerson(personRecord{"P1", "Janina", "Kowalska", gFemale, 0})
+
+	assert.Nil(t, err)
+	assert.Len(t, store.people, 1)
+	assert.Equal(t, "Janina", store.people["P1"].Given)
+	assert.Equal(t, gFemale, store.people["P1"].Gender)
+
+	// Case 4: Update a missing record
+
+	err = store.updatePerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0})
+
+	assert.Equal(t, errRecordNotFound, err.(AppError).Code)
+	assert.Len(t, store.people, 1)
+
+	// Case 5: Remove an existing record
+
+	err = store.removePerson("P1")
+
+	assert.Nil(t, err)
+	assert.Empty(t, store.people)
+
+	// Case 6: Remove a missing record
+
+	err = store.removePerson("P1")
+
+	assert.Equal(t, errRecordNotFound, err.(AppError).Code)
+}
+
+/* Test the relation record modification methods of the in-memory store
+
+   1. Insert a new relation record
+   2. Attempt to insert an already existing relation record
+   3. Update an existing relation record
+   4. Attempt to update a missing relation record
+   5. Remove an existing relation record
+   6. Attempt to remove a missing relation record */
+func TestMemoryStoreRelationModification(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+
+	// Case 1: Insert a new record
+
+	err := store.insertRelation(relationRecord{7, "P1", "P2", relFather, 0})
+
+	assert.Nil(t, err)
+	assert.Len(t, store.relations, 1)
+	assert.Equal(t, relFather, store.relations[7].Type)
+
+	// Case 2: Insert an existing record
+
+	err = store.insertRelation(relationRecord{7, "P3", "P2", relMother, 0})
+
+	assert.Equal(t, errDuplicateFound, err.(AppError).Code)
+	assert.Equal(t, "P1", store.relations[7].Pid1)
+
+	// Case 3: Update an existing record
+
+	err = store.updateRelation(relationRecord{7, "P3", "P2", relMother, 0})
+
+	assert.Nil(t, err)
+	assert.Len(t, store.relations, 1)
+	assert.Equal(t, "P3", store.relations[7].Pid1)
+	assert.Equal(t, relMother, store.relations[7].Type)
+
+	// Case 4: Update a missing record
+
+	err = store.updateRelation(relationRecord{8, "P1", "P2", relFather, 0})
+
+	assert.Equal(t, errRecordNotFound, err.(AppError).Code)
+	assert.Len(t, store.relations, 1)
+
+	// Case 5: Remove an existing record
+
+	err = store.removeRelation(7)
+
+	assert.Nil(t, err)
+	assert.Empty(t, store.relations)
+
+	// Case 6: Remove a missing record
+
+	err = store.removeRelation(7)
+
+	assert.Equal(t, errRecordNotFound, err.(AppError).Code)
+}
+
+/* Test if a failed update reverts all the modifications, including the record revisions */
+func TestMemoryStoreUpdateRollback(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+
+	assert.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	assert.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+	assert.Nil(t, store.insertRelation(relationRecord{1, "P1", "P2", relHusband, 0}))
+	assert.Nil(t, store.updatePerson(personRecord{"P1", "Janusz", "Kowalski", gMale, 0}))
+
+	people := map[string]personRecord{
+		"P1": {"P1", "Janusz", "Kowalski", gMale, 2},
+		"P2": {"P2", "Anna", "Nowak", gFemale, 1}}
+	relations := map[int64]relationRecord{1: {1, "P1", "P2", relHusband, 1}}
+
+	assert.Equal(t, people, store.people)
+
+	err := store.update(func(tx Store) error {
+		assert.Nil(t, tx.updatePerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+		assert.Nil(t, tx.insertPerson(personRecord{"P3", "Adam", "Kowalski", gMale, 0}))
+		assert.Nil(t, tx.removeRelation(1))
+		assert.Nil(t, tx.removePerson("P2"))
+
+		return tx.updatePerson(personRecord{"P9", "", "", gUnknown, 0})
+	})
+
+	assert.Equal(t, errRecordNotFound, err.(AppError).Code)
+	assert.Equal(t, people, store.people)
+	assert.Equal(t, relations, store.relations)
+}
+
+/* Test the Gramps handles handling of the in-memory store
+
+   1. Handles are assigned and reassigned
+   2. A handle assigned to another person is rejected
+   3. A failed update reverts the handle modifications
+   4. Handles are removed together with the people (and become free to be assigned again) */
+func TestMemoryStoreGrampsHandles(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+
+	assert.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	assert.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+
+	// Case 1: Assign and reassign
+
+	assert.Nil(t, store.setGrampsHandle("P1", "_a1"))
+	assert.Nil(t, store.setGrampsHandle("P2", "_b1"))
+	assert.Nil(t, store.setGrampsHandle("P2", "_b2"))
+	assert.Nil(t, store.setGrampsHandle("P1", "_b1"))
+
+	handles := map[string]string{"P1": "_b1", "P2": "_b2"}
+
+	assert.Equal(t, handles, store.grampsHandles)
+	assert.Equal(t, map[string]string{"_b1": "P1", "_b2": "P2"}, store.grampsPids)
+
+	// Case 2: Duplicate handle
+
+	err := store.setGrampsHandle("P2", "_b1")
+
+	assert.True(t, isAppError(err, errDuplicateFound))
+
+	// Case 3: Rollback
+
+	err = store.update(func(tx Store) error {
+		assert.Nil(t, tx.setGrampsHandle("P1", ""))
+		assert.Nil(t, tx.setGrampsHandle("P2", "_b1"))
+		assert.Nil(t, tx.removePerson("P2"))
+
+		return tx.setGrampsHandle("P9", "_c1")
+	})
+
+	assert.True(t, isAppError(err, errRecordNotFound))
+	assert.Equal(t, handles, store.grampsHandles)
+	assert.Equal(t, map[string]string{"_b1": "P1", "_b2": "P2"}, store.grampsPids)
+
+	// Case 4: Person removal
+
+	assert.Nil(t, store.removePerson("P2"))
+	assert.Nil(t, store.setGrampsHandle("P1", "_b2"))
+
+	assert.Equal(t, map[string]string{"P1": "_b2"}, store.grampsHandles)
+	assert.Equal(t, map[string]string{"_b2": "P1"}, store.grampsPids)
+}
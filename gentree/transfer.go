@@ -0,0 +1,287 @@
+package main
+
+/* This file defines the import and export plumbing shared by the supported data formats (the
+   request handler helpers and the command line subcommands) */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Supported import and export data formats
+const (
+	formatSnapshot = "snapshot"
+	// GEDCOM 5.5.1 (the import accepts GEDCOM 7 as well)
+	formatGedcom  = "gedcom"
+	formatGedcom7 = "gedcom7"
+	// GEDCOM 7 file packed in a zip archive together with the media files
+	formatGedzip = "gedzip"
+	// GEDCOM X JSON document
+	formatGedcomx = "gedcomx"
+	// Gramps XML document (gzip compressed)
+	formatGramps = "gramps"
+	// CSV documents of the people and the relations (see csv.go)
+	formatPeopleCsv    = "people-csv"
+	formatRelationsCsv = "relations-csv"
+	// RDF documents using the gentree ontology (export only, see rdf.go)
+	formatTurtle = "turtle"
+	formatRdfXml = "rdfxml"
+	formatJsonld = "jsonld"
+)
+
+// Import modes
+const (
+	// The store must be empty (the relation ids are preserved)
+	importEmpty = "empty"
+	// The records are added to the existing ones (the identical records are skipped)
+	importMerge = "merge"
+)
+
+/* The structure used to extract the import parameters from a request query */
+type importQuery struct {
+	Mode string `form:"mode" binding:"isdefault|oneof=empty merge"`
+}
+
+/* Function loading the data of a single format into the store
+
+   Params:
+   * store - the store to load the data into
+   * gen - the generator of the ids of the new relations
+   * in - the data source
+   * mode - one of the importXxx constants
+
+   Return:
+   * the import report (to be encoded as JSON; valid only if no error occurred)
+   * error (AppError with the errInvalidArgument code if the data is malformed, AppError with the
+     errConflict code if the data can't be imported in the given mode, other error if occurred, and
+     nil otherwise) */
+type importLoader func(store Store, gen relationIdGenerator, in io.Reader, mode string) (interface{}, error)
+
+// Loaders of the supported import formats
+var importLoaders = map[string]importLoader{
+	formatSnapshot: func(store Store, gen relationIdGenerator, in io.Reader, mode string) (interface{}, error) {
+		return loadSnapshot(store, gen, in, mode)
+	},
+	formatGedcom: func(store Store, gen relationIdGenerator, in io.Reader, mode string) (interface{}, error) {
+		return loadGedcom(store, gen, in, mode)
+	},
+	formatGedzip: func(store Store, gen relationIdGenerator, in io.Reader, mode string) (interface{}, error) {
+		return loadGedzip(store, gen, in, mode)
+	},
+	formatGedcomx: func(store Store, gen relationIdGenerator, in io.Reader, mode string) (interface{}, error) {
+		return loadGedcomx(store, gen, in, mode)
+	},
+	formatGramps: func(store Store, gen relationIdGenerator, in io.Reader, mode string) (interface{}, error) {
+		return loadGramps(store, gen, in, mode)
+	},
+	formatPeopleCsv: func(store Store, gen relationIdGenerator, in io.Reader, mode string) (interface{}, error) {
+		return loadPeopleCsv(store, gen, in, mode)
+	},
+	formatRelationsCsv: func(store Store, gen relationIdGenerator, in io.Reader, mode string) (interface{}, error) {
+		return loadRelationsCsv(store, gen, in, mode)
+	},
+}
+
+/* Exporter of a single data format */
+type exporter struct {
+	// Function writing the data of the whole store (the server base URL, ending with the '/'
+	// character, is used by the formats referring to the server resources)
+	save func(store Store, out io.Writer, baseUrl string) error
+	// Content type of the export response
+	contentType string
+	// Default file name suggested by the export response
+	fileName string
+}
+
+/* Adapt a function writing the data of the whole store to the exporter save field (the base URL
+   is ignored) */
+func withoutBaseUrl(save func(store Store, out io.Writer) error) func(Store, io.Writer, string) error {
+	return func(store Store, out io.Writer, _ string) error {
+		return save(store, out)
+	}
+}
+
+// Exporters of the supported formats
+var exporters = map[string]exporter{
+	formatSnapshot:     {withoutBaseUrl(saveSnapshot), "application/json; charset=utf-8", "gentree.json"},
+	formatGedcom:       {withoutBaseUrl(saveGedcom), "application/x-gedcom; charset=utf-8", "gentree.ged"},
+	formatGedcom7:      {withoutBaseUrl(saveGedcom7), "application/x-gedcom; charset=utf-8", "gentree.ged"},
+	formatGedzip:       {withoutBaseUrl(saveGedzip), "application/zip", "gentree.gdz"},
+	formatGedcomx:      {withoutBaseUrl(saveGedcomx), gedcomxMediaType, "gentree.gedcomx.json"},
+	formatGramps:       {withoutBaseUrl(saveGramps), "application/x-gramps", "gentree.gramps"},
+	formatPeopleCsv:    {withoutBaseUrl(savePeopleCsv), "text/csv; charset=utf-8", "people.csv"},
+	formatRelationsCsv: {withoutBaseUrl(saveRelationsCsv), "text/csv; charset=utf-8", "relations.csv"},
+	formatTurtle:       {saveTurtle, "text/turtle; charset=utf-8", "gentree.ttl"},
+	formatRdfXml:       {saveRdfXml, "application/rdf+xml; charset=utf-8", "gentree.rdf"},
+	formatJsonld:       {saveJsonld, "application/ld+json; charset=utf-8", "gentree.jsonld"},
+}
+
+/* Lower level, shared implementation of the export handlers
+
+   The data is written to a buffer first, so that an error can still be reported with the
+   appropriate status.
+
+   Params:
+   * c - gin context
+   * format - one of the formatXxx constants */
+func doExport(c *gin.Context, format string) {
+	log.Trace("Entry checkpoint")
+
+	exp := exporters[format]
+	data := &bytes.Buffer{}
+
+	if err := exp.save(getStore(c), data, requestBaseUrl(c)); err != nil {
+		log.Errorf("An error occurred during the %s export attempt (%s)", format, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exp.fileName))
+	c.Data(http.StatusOK, exp.contentType, data.Bytes())
+}
+
+/* Lower level, shared implementation of the import handlers
+
+   The data is taken from the "file" field of a multipart form or, if the request is not a
+   multipart one, from the whole request payload. The import mode is taken from the request query
+   (importQuery; the empty mode is the default one).
+
+   Params:
+   * c - gin context
+   * format - one of the formatXxx constants */
+func doImport(c *gin.Context, format string) {
+	log.Trace("Entry checkpoint")
+
+	var query importQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Infof("Query parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": queryErrorMsg})
+		return
+	}
+
+	if query.Mode == "" {
+		query.Mode = importEmpty
+	}
+
+	var in io.Reader = c.Request.Body
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			log.Infof("Uploaded file retrieval error: %s", err)
+			c.JSON(http.StatusBadRequest, gin.H{"message": payloadErrorMsg})
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			log.Errorf("An error occurred during the uploaded file opening attempt (%s)", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+			return
+		}
+
+		defer file.Close()
+
+		in = file
+	}
+
+	report, err := importLoaders[format](getStore(c), getRelationIdGenerator(c), in, query.Mode)
+
+	if isAppError(err, errInvalidArgument) {
+		log.Infof("The %s data is invalid (%s)", format, err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.(AppError).msg})
+		return
+	} else if isAppError(err, errConflict) {
+		log.Infof("The %s data can't be imported (%s)", format, err)
+		c.JSON(http.StatusConflict, gin.H{"message": err.(AppError).msg})
+		return
+	} else if err != nil {
+		log.Errorf("An error occurred during the %s import attempt (%s)", format, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Data imported", "report": report})
+}
+
+/* Run the export subcommand
+
+   Params:
+   * store - the store to be exported
+   * path - the output file path (the standard output is used if empty or "-")
+   * format - one of the formatXxx constants
+   * baseUrl - the server base URL (see exporter)
+
+   Return:
+   * error (if occurred and nil otherwise) */
+func runExportCommand(store Store, path string, format string, baseUrl string) error {
+	exp, found := exporters[format]
+	if !found {
+		return AppError{errInvalidArgument, fmt.Sprintf("Unknown export format (%s)", format)}
+	}
+
+	out := os.Stdout
+
+	if path != "" && path != "-" {
+		var err error
+
+		if out, err = os.Create(path); err != nil {
+			return err
+		}
+
+		defer out.Close()
+	}
+
+	return exp.save(store, out, baseUrl)
+}
+
+/* Run the import subcommand
+
+   The import report is written to the standard output.
+
+   Params:
+   * store - the store to import the data into
+   * gen - the generator of the ids of the new relations
+   * path - the input file path (the standard input is used if empty or "-")
+   * format - one of the formatXxx constants
+   * mode - one of the importXxx constants
+
+   Return:
+   * error (if occurred and nil otherwise) */
+func runImportCommand(store Store, gen relationIdGenerator, path string, format string, mode string) error {
+	load, found := importLoaders[format]
+	if !found {
+		return AppError{errInvalidArgument, fmt.Sprintf("Unknown import format (%s)", format)}
+	}
+
+	var in io.Reader = os.Stdin
+
+	if path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		in = file
+	}
+
+	report, err := load(store, gen, in, mode)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+}
@@ -0,0 +1,226 @@
+package main
+
+/* This file defines the request handlers exposing the trash and the periodic trash purge */
+
+import (
+	"fmt"
+	"github.com/gin-contrib/location"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+/* Trash item payload returned by the retrieveTrash handler */
+type trashPayload struct {
+	Id   int64     `json:"id"`
+	Time time.Time `json:"time"`
+	// The deleted person (null if only a relation was deleted)
+	Person    *fullPersonPayload `json:"person"`
+	Relations []relationPayload  `json:"relations"`
+}
+
+/* The structure used to extract trash item id from a URI */
+type specifyTrashUri struct {
+	Id int64 `uri:"id" binding:"required"`
+}
+
+/* Convert a trash item to payload data */
+func (r *trashRecord) toPayload() trashPayload {
+	payload := trashPayload{
+		Id:        r.Id,
+		Time:      r.Time,
+		Relations: relationList(r.Relations).toPayload(),
+	}
+
+	if r.Person != nil {
+		person := r.Person.toPayload()
+		payload.Person = &person
+	}
+
+	return payload
+}
+
+/* Convert a trash item list to payload data */
+func (list trashList) toPayload() []trashPayload {
+	payload := make([]trashPayload, 0, len(list))
+
+	for _, item := range list {
+		payload = append(payload, item.toPayload())
+	}
+
+	return payload
+}
+
+/* Put the records of a trash item back into the store and remove the item from the trash
+
+   The function must be called from the function passed to the store update method, so that no
+   record is restored if any of them can't be.
+
+   Return:
+   * error (AppError with the errConflict code if any record conflicts with the current data, other
+     error if occurred, and nil otherwise) */
+func untrash(tx Store, item trashRecord) error {
+	if item.Person != nil {
+		if err := tx.insertPerson(*item.Person); isAppError(err, errDuplicateFound) {
+			return AppError{
+				errConflict, fmt.Sprintf("Person (%s) already exists", item.Person.Id)}
+		} else if err != nil {
+			return err
+		}
+
+		if len(item.GedcomExtensions) > 0 {
+			if err := tx.setGedcomExtensions(item.Person.Id, item.GedcomExtensions); err != nil {
+				return err
+			}
+		}
+
+		// The handle might have been assigned to another person by an import in the meantime:
+		if item.GrampsHandle != "" {
+			err := tx.setGrampsHandle(item.Person.Id, item.GrampsHandle)
+
+			if isAppError(err, errDuplicateFound) {
+				return AppError{
+					errConflict,
+					fmt.Sprintf("Gramps handle (%s) is assigned to another person", item.GrampsHandle)}
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, relation := range item.Relations {
+		if _, found, err := queryRelationByData(
+			tx, relation.Pid1, relation.Type, relation.Pid2); found {
+			return AppError{
+				errConflict,
+				fmt.Sprintf("Relation (%s, %s, %s) already exists",
+					relation.Pid1, relation.Type, relation.Pid2)}
+		} else if err != nil {
+			return err
+		}
+
+		if valid, err := validateRelation(tx, relation); err != nil {
+			return err
+		} else if !valid {
+			return AppError{
+				errConflict,
+				fmt.Sprintf("Relation (%s, %s, %s) is invalid",
+					relation.Pid1, relation.Type, relation.Pid2)}
+		}
+
+		if err := tx.insertRelation(relation); isAppError(err, errDuplicateFound) {
+			return AppError{
+				errConflict, fmt.Sprintf("Relation id (%d) is already taken", relation.Id)}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return tx.removeTrash(item.Id)
+}
+
+/* Handle a retrieve trash request
+
+   The trash items are ordered by id (i.e. by the deletion order) */
+func retrieveTrash(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	var pagQuery paginationQuery
+
+	if err := c.ShouldBindQuery(&pagQuery); err != nil {
+		log.Infof("Query parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": queryErrorMsg})
+		return
+	}
+
+	items, pagData, err := getStore(c).queryTrash(pagQuery.toPaginationData())
+
+	if err != nil {
+		log.Errorf("An error occurred during trash retrieval attempt (%s)", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	}
+
+	reqUrl := location.Get(c)
+	reqUrl.Path = "/trash"
+
+	c.JSON(http.StatusOK, gin.H{
+		"pagination": pagData.getJson(*reqUrl),
+		"records":    items.toPayload(),
+	})
+
+	log.Infof("Found %d trash items", len(items))
+}
+
+/* Handle a restore trash item request
+
+   The function will extract the trash item id from the request URI (specifyTrashUri). All the
+   records of the item (the person and all the relations deleted together with them) are restored
+   or none of them is. */
+func restoreTrash(c *gin.Context) {
+	log.Trace("Entry checkpoint")
+
+	var params specifyTrashUri
+
+	if err := c.ShouldBindUri(&params); err != nil {
+		log.Infof("Uri parameters unmarshalling error: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": uriErrorMsg})
+		return
+	}
+
+	var item trashRecord
+	var found bool
+
+	err := getStore(c).update(func(tx Store) error {
+		var err error
+
+		if item, found, err = tx.getTrash(params.Id); !found || err != nil {
+			return err
+		}
+
+		return untrash(tx, item)
+	})
+
+	if !found {
+		log.Infof("The trash item with given id (%d) doesn't exist", params.Id)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown trash item id"})
+		return
+	} else if isAppError(err, errConflict) {
+		log.Infof("The trash item (%d) can't be restored (%s)", params.Id, err)
+		c.JSON(http.StatusConflict, gin.H{"message": err.(AppError).msg})
+		return
+	} else if err != nil {
+		log.Errorf("An error occurred during the trash item restoration attempt (%s)", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": internalErrorMsg})
+		return
+	}
+
+	response := gin.H{
+		"message":               "Trash item restored",
+		"restored_relation_cnt": len(item.Relations)}
+
+	if item.Person != nil {
+		response["location"] = makeRetrievePersonUrl(c, item.Person.Id)
+	}
+
+	c.JSON(http.StatusOK, response)
+
+	log.Infof("Restored the trash item (%d) with %d relation records", item.Id, len(item.Relations))
+}
+
+/* Purge the trash items older than the retention period in the given intervals
+
+   The function never returns, so it should be run as a goroutine for the whole server lifetime */
+func purgeTrashPeriodically(store Store, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if cnt, err := store.purgeTrash(time.Now().Add(-retention)); err != nil {
+			log.Errorf("An error occurred during the trash purge attempt (%s)", err)
+		} else if cnt > 0 {
+			log.Infof("Purged %d trash items", cnt)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+/* This file defines the trash data structures, the in-memory store functions maintaining the
+   trash, and the functions moving the records to the trash */
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"time"
+)
+
+/* Storage representation of a trash item
+
+   A trash item contains all the records deleted by a single deletion request (a person together
+   with their relations or a single relation). The items are restored as a whole. The JSON encoding
+   of the item is used by the journal files (see journal_store.go). */
+type trashRecord struct {
+	// Identifier assigned by the store (increasing)
+	Id int64 `json:"id"`
+	// Deletion time assigned by the store
+	Time time.Time `json:"time"`
+	// The deleted person (nil if only a relation was deleted)
+	Person *personRecord `json:"person,omitempty"`
+	// The deleted relations (ordered by id)
+	Relations []relationRecord `json:"relations"`
+	// The GEDCOM extension structures of the deleted person (see gedcom_extension_data.go)
+	GedcomExtensions []gedcomExtension `json:"gedcom_extensions,omitempty"`
+	// Gramps handle of the deleted person (see gramps.go; empty if none)
+	GrampsHandle string `json:"gramps_handle,omitempty"`
+}
+
+type trashList []trashRecord
+
+/* Delete a person together with all their relations and put the records into the trash
+
+   The function must be called from the function passed to the store update method, so that the
+   person relations can't be modified in between. The data removed by the store together with the
+   person (the GEDCOM extensions and the Gramps handle) are kept in the trash item as well.
+
+   Params:
+   * tx - the store (as passed to the function run by the store update method)
+   * person - the person record to be deleted
+
+   Return:
+   * the trash item (valid only if no error occurred)
+   * error (if occurred and nil otherwise) */
+func trashPerson(tx Store, person personRecord) (trashRecord, error) {
+	outgoing, err := tx.queryRelationsByData(person.Id, "", "")
+	if err != nil {
+		return trashRecord{}, err
+	}
+
+	incoming, err := tx.queryRelationsByData("", "", person.Id)
+	if err != nil {
+		return trashRecord{}, err
+	}
+
+	item := trashRecord{Person: &person, Relations: []relationRecord{}}
+
+	// The store removes the extensions together with the person:
+	if item.GedcomExtensions, err = tx.getGedcomExtensions(person.Id); err != nil {
+		return trashRecord{}, err
+	} else if len(item.GedcomExtensions) == 0 {
+		item.GedcomExtensions = nil
+	}
+
+	if item.GrampsHandle, err = tx.getGrampsHandle(person.Id); err != nil {
+		return trashRecord{}, err
+	}
+
+	for _, r := range append(outgoing, incoming...) {
+		// A relation of a person with themselves is both outgoing and incoming:
+		if !containsRelation(item.Relations, r.Id) {
+			item.Relations = append(item.Relations, r)
+		}
+	}
+
+	sort.Slice(item.Relations, func(i, j int) bool { return item.Relations[i].Id < item.Relations[j].Id })
+
+	if _, err := tx.deleteRelationsByPerson(person.Id); err != nil {
+		return trashRecord{}, err
+	}
+
+	if err := tx.removePerson(person.Id); err != nil {
+		return trashRecord{}, err
+	}
+
+	if item.Id, err = tx.insertTrash(item); err != nil {
+		return trashRecord{}, err
+	}
+
+	return item, nil
+}
+
+/* Delete a relation and put it into the trash (see trashPerson)
+
+   Return:
+   * the trash item (valid only if no error occurred)
+   * error (if occurred and nil otherwise) */
+func trashRelation(tx Store, relation relationRecord) (trashRecord, error) {
+	if err := tx.removeRelation(relation.Id); err != nil {
+		return trashRecord{}, err
+	}
+
+	item := trashRecord{Relations: []relationRecord{relation}}
+
+	var err error
+
+	if item.Id, err = tx.insertTrash(item); err != nil {
+		return trashRecord{}, err
+	}
+
+	return item, nil
+}
+
+/* Check if the relation slice contains a relation with the given id */
+func containsRelation(relations []relationRecord, id int64) bool {
+	for _, r := range relations {
+		if r.Id == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+/* Store a new trash item
+
+   The item identifier and time are assigned by the store (the corresponding fields of the
+   parameter are ignored)
+
+   Return:
+   * identifier of the new item
+   * error (if occurred and nil otherwise) */
+func (s *memoryStore) insertTrash(item trashRecord) (int64, error) {
+	lastId := s.lastTrashId
+
+	item.Id = lastId + 1
+	item.Time = s.modificationTime()
+
+	log.Debugf("Inserting trash item (%d)", item.Id)
+
+	s.trash[item.Id] = item
+	s.lastTrashId = item.Id
+	s.onUndo(func() {
+		delete(s.trash, item.Id)
+		s.lastTrashId = lastId
+	})
+
+	return item.Id, nil
+}
+
+/* Retrieve a trash item by id
+
+   Returns:
+   * trash item (uninitialized if not found)
+   * success flag (true if the item was found and false otherwise)
+   * error (if occurred and nil otherwise) */
+func (s *memoryStore) getTrash(id int64) (trashRecord, bool, error) {
+	log.Debugf("Retrieving trash item by id (%d)", id)
+
+	item, found := s.trash[id]
+
+	return item, found, nil
+}
+
+/* Query trash items ordered by id
+
+   Params:
+   * pag - pagination data specifying the range of items to be returned
+
+   Return:
+   * slice of trash items (empty if an error occurred)
+   * updated pagination data (empty if an error occurred; copy of the pag parameter with the total
+     item count field updated otherwise)
+   * error (if occurred and nil otherwise) */
+func (s *memoryStore) queryTrash(pag paginationData) (trashList, paginationData, error) {
+	log.Debugf("Retrieving the trash items")
+
+	if err := pag.validate(); err != nil {
+		return trashList{}, paginationData{}, err
+	}
+
+	sorted := make(trashList, 0, len(s.trash))
+
+	for _, item := range s.trash {
+		sorted = append(sorted, item)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Id < sorted[j].Id })
+
+	first := minInt(pag.PageIdx*pag.PageSize, len(sorted))
+	last := minInt((pag.PageIdx+1)*pag.PageSize, len(sorted))
+
+	pag.TotalCnt = len(sorted)
+
+	return sorted[first:last], pag, nil
+}
+
+/* Remove a trash item
+
+   Return:
+   * error (if the item doesn't exist and nil otherwise) */
+func (s *memoryStore) removeTrash(id int64) error {
+	log.Debugf("Removing trash item (%d)", id)
+
+	old, found := s.trash[id]
+
+	if !found {
+		return AppError{errRecordNotFound, fmt.Sprintf("Trash item (%d) not found", id)}
+	}
+
+	delete(s.trash, id)
+	s.onUndo(func() { s.trash[old.Id] = old })
+
+	return nil
+}
+
+/* Remove all the trash items deleted before the given time
+
+   Return:
+   * number of removed items
+   * error (if occurred and nil otherwise) */
+func (s *memoryStore) purgeTrash(before time.Time) (int64, error) {
+	log.Debugf("Purging the trash items deleted before %s", before)
+
+	var num int64 = 0
+
+	for id, item := range s.trash {
+		if item.Time.Before(before) {
+			delete(s.trash, id)
+			num++
+
+			old := item
+			s.onUndo(func() { s.trash[old.Id] = old })
+		}
+	}
+
+	return num, nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testTrashItemJson struct {
+	Id        int64                  `json:"id"`
+	Time      time.Time              `json:"time"`
+	Person    *testPersonJson        `json:"person"`
+	Relations []testFullRelationJson `json:"relations"`
+}
+
+type testTrashListJson struct {
+	Pagination testPaginationJson  `json:"pagination"`
+	Records    []testTrashItemJson `json:"records"`
+}
+
+func testTrashListRes(t *testing.T, res *httptest.ResponseRecorder) testTrashListJson {
+	payload := testTrashListJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+type testTrashIdJson struct {
+	Message string `json:"message"`
+	TrashId int64  `json:"trash_id"`
+}
+
+func testTrashIdRes(t *testing.T, res *httptest.ResponseRecorder) testTrashIdJson {
+	payload := testTrashIdJson{}
+	testJsonRes(t, res, &payload)
+	return payload
+}
+
+/* Test if every store variant keeps the trash and purges it
+
+   1. Move a person with their relations and a single relation to the trash
+   2. Check the trash items
+   3. Check if the journal store restores the trash both from the journal and from the snapshot
+   4. Purge the trash */
+func TestStoreTrash(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "gentree.journal")
+	journal := testOpenJournalStore(t, journalPath)
+
+	stores := map[string]Store{
+		"memory":  newMemoryStore(nil, nil),
+		"journal": journal,
+		"sqlite":  testOpenSqliteStore(t, filepath.Join(t.TempDir(), "gentree.db")),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			// Case 1: Deletion
+
+			require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+			require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+			require.Nil(t, store.insertPerson(personRecord{"P3", "Ewa", "Kowalska", gFemale, 0}))
+			require.Nil(t, store.insertRelation(relationRecord{7, "P1", "P2", relHusband, 0}))
+			require.Nil(t, store.insertRelation(relationRecord{3, "P1", "P3", relFather, 0}))
+			require.Nil(t, store.insertRelation(relationRecord{5, "P2", "P3", relMother, 0}))
+
+			var first, second trashRecord
+
+			require.Nil(t, store.update(func(tx Store) error {
+				person, _, err := tx.getPerson("P1")
+				if err != nil {
+					return err
+				}
+
+				first, err = trashPerson(tx, person)
+				return err
+			}))
+			require.Nil(t, store.update(func(tx Store) error {
+				relation, _, err := tx.queryRelationById(5)
+				if err != nil {
+					return err
+				}
+
+				second, err = trashRelation(tx, relation)
+				return err
+			}))
+
+			// Case 2: Trash
+
+			_, found, err := store.getPerson("P1")
+
+			assert.Nil(t, err)
+			assert.False(t, found)
+
+			relations, _, err := store.queryRelationsByPerson("", paginationData{0, 10, 0, 10, 10})
+
+			assert.Nil(t, err)
+			assert.Empty(t, relations)
+
+			item, found, err := store.getTrash(first.Id)
+
+			assert.Nil(t, err)
+			require.True(t, found)
+			assert.Equal(t, personRecord{"P1", "Jan", "Kowalski", gMale, 1}, *item.Person)
+			assert.Equal(t, []relationRecord{
+				{3, "P1", "P3", relFather, 1},
+				{7, "P1", "P2", relHusband, 1}}, item.Relations)
+			assert.WithinDuration(t, time.Now(), item.Time, time.Minute)
+
+			items, pag, err := store.queryTrash(paginationData{0, 10, 0, 10, 10})
+
+			assert.Nil(t, err)
+			assert.Equal(t, 2, pag.TotalCnt)
+			require.Len(t, items, 2)
+			assert.Equal(t, second.Id, items[1].Id)
+			assert.Nil(t, items[1].Person)
+			assert.Equal(t, []relationRecord{{5, "P2", "P3", relMother, 1}}, items[1].Relations)
+
+			// Case 3: Journal restart
+
+			if name == "journal" {
+				require.Nil(t, journal.close())
+				journal = testOpenJournalStore(t, journalPath)
+
+				restored, _, err := journal.queryTrash(paginationData{0, 10, 0, 10, 10})
+
+				assert.Nil(t, err)
+				assert.Equal(t, items, restored)
+
+				require.Nil(t, journal.compact())
+				require.Nil(t, journal.close())
+				journal = testOpenJournalStore(t, journalPath)
+
+				restored, _, err = journal.queryTrash(paginationData{0, 10, 0, 10, 10})
+
+				assert.Nil(t, err)
+				assert.Equal(t, items, restored)
+
+				store = journal
+			}
+
+			// Case 4: Purge
+
+			cnt, err := store.purgeTrash(time.Now().Add(-time.Hour))
+
+			assert.Nil(t, err)
+			assert.Equal(t, int64(0), cnt)
+
+			cnt, err = store.purgeTrash(time.Now().Add(time.Minute))
+
+			assert.Nil(t, err)
+			assert.Equal(t, int64(2), cnt)
+
+			_, found, err = store.getTrash(first.Id)
+
+			assert.Nil(t, err)
+			assert.False(t, found)
+		})
+	}
+}
+
+/* Test the trash endpoints
+
+   1. Delete a person with their relations and a single relation
+   2. Retrieve the trash
+   3. Restore the person together with their relations
+   4. Attempt to restore a missing item
+   5. Attempt to restore a person whose id was taken in the meantime */
+func TestTrashRequests(t *testing.T) {
+	store := newMemoryStore(nil, nil)
+	router := setupRouter(store)
+
+	require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P2", "Anna", "Nowak", gFemale, 0}))
+	require.Nil(t, store.insertPerson(personRecord{"P3", "Ewa", "Kowalska", gFemale, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{1, "P1", "P2", relHusband, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{2, "P1", "P3", relFather, 0}))
+	require.Nil(t, store.insertRelation(relationRecord{3, "P2", "P3", relMother, 0}))
+
+	// Case 1: Deletion
+
+	res := testMakeRequest(router, "DELETE", "/people/P1", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, int64(1), testTrashIdRes(t, res).TrashId)
+
+	res = testMakeRequest(router, "DELETE", "/relations/3", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, int64(2), testTrashIdRes(t, res).TrashId)
+	assert.Empty(t, store.relations)
+
+	// Case 2: Trash
+
+	res = testMakeRequest(router, "GET", "/trash", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	trash := testTrashListRes(t, res)
+
+	require.Len(t, trash.Records, 2)
+	assert.Equal(t, int64(1), trash.Records[0].Id)
+	assert.Equal(t, &testPersonJson{"P1", "Jan", "Kowalski", gMale}, trash.Records[0].Person)
+	assert.Equal(t, []testFullRelationJson{
+		{1, "P1", "P2", relHusband},
+		{2, "P1", "P3", relFather}}, trash.Records[0].Relations)
+	assert.Nil(t, trash.Records[1].Person)
+	assert.Equal(t, []testFullRelationJson{{3, "P2", "P3", relMother}}, trash.Records[1].Relations)
+
+	// Case 3: Restoration
+
+	res = testMakeRequest(router, "POST", "/trash/1/restore", nil)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "http://example.com/people/P1", testLocationRes(t, res).Location)
+	assert.Equal(t, personRecord{"P1", "Jan", "Kowalski", gMale, 3}, store.people["P1"])
+	assert.Len(t, store.relations, 2)
+	assert.Equal(t, int64(3), store.relations[2].Rev)
+	assert.Len(t, store.trash, 1)
+
+	// Case 4: Missing item
+
+	res = testMakeRequest(router, "POST", "/trash/1/restore", nil)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, "Unknown trash item id", testErrorRes(t, res).Message)
+
+	// Case 5: Conflict
+
+	res = testMakeRequest(router, "DELETE", "/people/P3", nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Nil(t, store.insertPerson(personRecord{"P3", "Ewa", "Nowak", gFemale, 0}))
+
+	assert.Equal(t, int64(3), testTrashIdRes(t, res).TrashId)
+
+	res = testMakeRequest(router, "POST", "/trash/3/restore", nil)
+
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.Equal(t, "Person (P3) already exists", testErrorRes(t, res).Message)
+	assert.Equal(t, "Nowak", store.people["P3"].Surname)
+	assert.Len(t, store.relations, 1)
+	assert.Len(t, store.trash, 2)
+}
+
+/* Test if every store variant keeps the import data of a deleted person in the trash
+
+   1. Delete a person with GEDCOM extensions and a Gramps handle
+   2. Check if the journal store keeps the data in the trash after a restart
+   3. Restore the person together with the data */
+func TestStoreTrashImportData(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "gentree.journal")
+	journal := testOpenJournalStore(t, journalPath)
+
+	stores := map[string]Store{
+		"memory":  newMemoryStore(nil, nil),
+		"journal": journal,
+		"sqlite":  testOpenSqliteStore(t, filepath.Join(t.TempDir(), "gentree.db")),
+	}
+
+	extensions := []gedcomExtension{
+		{"", gedcomLine{Level: 1, Tag: "_UID", Value: "ABC"}},
+		{"https://example.com/note", gedcomLine{Level: 1, Tag: "_NOTE", Value: "Note"}},
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			require.Nil(t, store.insertPerson(personRecord{"P1", "Jan", "Kowalski", gMale, 0}))
+			require.Nil(t, store.setGedcomExtensions("P1", extensions))
+			require.Nil(t, store.setGrampsHandle("P1", "_a1"))
+
+			// Case 1: Deletion
+
+			var item trashRecord
+
+			require.Nil(t, store.update(func(tx Store) error {
+				person, _, err := tx.getPerson("P1")
+				if err != nil {
+					return err
+				}
+
+				item, err = trashPerson(tx, person)
+				return err
+			}))
+
+			stored, err := store.getGedcomExtensions("P1")
+
+			assert.Nil(t, err)
+			assert.Empty(t, stored)
+
+			handle, err := store.getGrampsHandle("P1")
+
+			assert.Nil(t, err)
+			assert.Empty(t, handle)
+
+			item, found, err := store.getTrash(item.Id)
+
+			assert.Nil(t, err)
+			require.True(t, found)
+			assert.Equal(t, extensions, item.GedcomExtensions)
+			assert.Equal(t, "_a1", item.GrampsHandle)
+
+			// Case 2: Journal restart
+
+			if name == "journal" {
+				require.Nil(t, journal.close())
+				journal = testOpenJournalStore(t, journalPath)
+
+				item, _, err = journal.getTrash(item.Id)
+
+				assert.Nil(t, err)
+				assert.Equal(t, extensions, item.GedcomExtensions)
+				assert.Equal(t, "_a1", item.GrampsHandle)
+
+				store = journal
+			}
+
+			// Case 3: Restoration
+
+			require.Nil(t, store.update(func(tx Store) error { return untrash(tx, item) }))
+
+			stored, err = store.getGedcomExtensions("P1")
+
+			assert.Nil(t, err)
+			assert.Equal(t, extensions, stored)
+
+			handle, err = store.getGrampsHandle("P1")
+
+			assert.Nil(t, err)
+			assert.Equal(t, "_a1", handle)
+		})
+	}
+}
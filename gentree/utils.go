@@ -25,3 +25,14 @@ func containsStr(slice []string, str string) bool {
 
 	return false
 }
+
+/* Check if the string consists of the ASCII letters and digits only (the empty string included) */
+func isAlphanum(str string) bool {
+	for _, r := range str {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
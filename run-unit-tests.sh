@@ -1,4 +1,4 @@
 #!/usr/bin/env bash
 
-gotest . -v -cover -coverprofile /output/gentree_cover.out
+gotest . -v -race -cover -coverprofile /output/gentree_cover.out
 go tool cover -html=/output/gentree_cover.out -o /output/cover.html